@@ -10,14 +10,22 @@ type BidRequest struct {
 	App     *App     `json:"app,omitempty"`     // APP信息
 	Device  *Device  `json:"device,omitempty"`  // 设备信息
 	User    *User    `json:"user,omitempty"`    // 用户信息
+	Regs    *Regs    `json:"regs,omitempty"`    // 法规信息
 	Test    int      `json:"test,omitempty"`    // 测试标志 0=正式 1=测试
 	TMax    int      `json:"tmax,omitempty"`    // 超时时间(ms)
 	WSeat   []string `json:"wseat,omitempty"`   // 白名单席位
 	BSeat   []string `json:"bseat,omitempty"`   // 黑名单席位
 	AllImps int      `json:"allimps,omitempty"` // 0=部分 1=全部
 	Cur     []string `json:"cur,omitempty"`     // 货币类型
+	AT      int      `json:"at,omitempty"`      // 拍卖类型 1=第一价格 2=第二价格（默认）
 }
 
+// 拍卖类型
+const (
+	AuctionFirstPrice  = 1
+	AuctionSecondPrice = 2
+)
+
 // Imp 广告位
 type Imp struct {
 	ID          string   `json:"id"`                    // 广告位ID
@@ -88,6 +96,7 @@ type Site struct {
 	Cat    []string `json:"cat,omitempty"`  // IAB内容分类
 	Page   string `json:"page,omitempty"`   // 当前页面URL
 	Ref    string `json:"ref,omitempty"`    // 来源页面URL
+	Publisher *Publisher `json:"publisher,omitempty"` // 媒体信息
 }
 
 // App APP信息
@@ -98,6 +107,14 @@ type App struct {
 	Domain string   `json:"domain,omitempty"` // APP域名
 	Cat    []string `json:"cat,omitempty"`    // IAB内容分类
 	Ver    string   `json:"ver,omitempty"`    // APP版本
+	Publisher *Publisher `json:"publisher,omitempty"` // 媒体信息
+}
+
+// Publisher 媒体信息
+type Publisher struct {
+	ID     string `json:"id,omitempty"`     // 媒体ID
+	Name   string `json:"name,omitempty"`   // 媒体名称
+	Domain string `json:"domain,omitempty"` // 媒体域名
 }
 
 // Device 设备信息
@@ -127,6 +144,11 @@ type Device struct {
 	DIDMD5        string  `json:"didmd5,omitempty"`        // 设备ID MD5
 	DPIDSHA1      string  `json:"dpidsha1,omitempty"`      // 平台设备ID SHA1
 	DPIDMD5       string  `json:"dpidmd5,omitempty"`       // 平台设备ID MD5
+
+	// 以下字段由DSP根据UA解析补全，不属于OpenRTB协议
+	Browser        string `json:"-"`
+	BrowserVersion string `json:"-"`
+	Bot            bool   `json:"-"` // 爬虫或自动化工具
 }
 
 // Geo 地理位置信息
@@ -138,6 +160,8 @@ type Geo struct {
 	Region  string  `json:"region,omitempty"`  // 地区
 	City    string  `json:"city,omitempty"`    // 城市
 	ZIP     string  `json:"zip,omitempty"`     // 邮编
+	// UTCOffset 当地时间与UTC的偏移（分钟），0是有效值，没有时为nil
+	UTCOffset *int `json:"utcoffset,omitempty"`
 }
 
 // User 用户信息
@@ -150,6 +174,30 @@ type User struct {
 	CustomData string `json:"customdata,omitempty"` // 自定义数据
 	Geo        *Geo   `json:"geo,omitempty"`        // 地理位置
 	Data       []Data `json:"data,omitempty"`       // 第三方数据
+	Consent    string   `json:"consent,omitempty"` // TCF v2同意字符串（OpenRTB 2.6）
+	Ext        *UserExt `json:"ext,omitempty"`     // 扩展字段
+}
+
+// UserExt 用户扩展字段（OpenRTB 2.5 通过扩展传递同意字符串）
+type UserExt struct {
+	Consent string `json:"consent,omitempty"` // TCF v2同意字符串
+}
+
+// Regs 法规信息
+// OpenRTB 2.6 直接定义gdpr、us_privacy和gpp字段，2.5 通过ext传递，两种写法都支持
+type Regs struct {
+	COPPA     int      `json:"coppa,omitempty"`      // 1=受COPPA约束（面向儿童）
+	GDPR      *int     `json:"gdpr,omitempty"`       // 1=适用GDPR
+	USPrivacy string   `json:"us_privacy,omitempty"` // CCPA字符串，如"1YNN"
+	GPP       string   `json:"gpp,omitempty"`        // GPP字符串
+	GPPSID    []int    `json:"gpp_sid,omitempty"`    // 适用的GPP分区ID
+	Ext       *RegsExt `json:"ext,omitempty"`        // 扩展字段
+}
+
+// RegsExt 法规扩展字段（OpenRTB 2.5）
+type RegsExt struct {
+	GDPR      *int   `json:"gdpr,omitempty"`       // 1=适用GDPR
+	USPrivacy string `json:"us_privacy,omitempty"` // CCPA字符串
 }
 
 // Data 第三方数据
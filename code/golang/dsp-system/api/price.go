@@ -0,0 +1,21 @@
+package api
+
+import "dsp-system/money"
+
+// OpenRTB 协议中的价格是浮点 CPM，系统内部统一使用整数微单位（money.Micros），
+// 两者只在这里互相转换。
+
+// PriceMicros 获取出价（微单位）
+func (b *Bid) PriceMicros() money.Micros {
+	return money.FromFloat(b.Price)
+}
+
+// SetPriceMicros 以微单位设置出价
+func (b *Bid) SetPriceMicros(price money.Micros) {
+	b.Price = price.Float()
+}
+
+// BidFloorMicros 获取广告位底价（微单位）
+func (imp *Imp) BidFloorMicros() money.Micros {
+	return money.FromFloat(imp.BidFloor)
+}
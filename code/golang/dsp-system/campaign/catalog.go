@@ -0,0 +1,412 @@
+package campaign
+
+import (
+	"dsp-system/api"
+	"dsp-system/frequency"
+	"dsp-system/money"
+	"dsp-system/rotation"
+	"dsp-system/targeting"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Ad 可投放的广告：一个投放单元使用的一个创意
+type Ad struct {
+	ID       string // 投放单元ID:创意ID
+	Campaign *Campaign
+	LineItem *LineItem
+	Creative *Creative
+	BidType  string // cpm、cpc、cpa
+	BidPrice money.Micros
+	Rule     *targeting.Rule // 投放单元的定向规则，同一投放单元的广告共用；nil表示不限
+	// FrequencyCaps 创意、活动和广告主的频次上限
+	FrequencyCaps []frequency.Cap
+	// Schedule 投放单元的分时段投放计划，同一投放单元的广告共用；nil表示全天投放
+	Schedule *Schedule
+	// Rotation 投放单元的创意轮播方式，同一投放单元的广告共用
+	Rotation *rotation.Policy
+
+	start, end time.Time      // 活动和投放单元投放时间的交集
+	loc        *time.Location // 活动时区
+}
+
+// Live 判断广告在指定时间是否在投放期内（不考虑分时段投放）
+func (a *Ad) Live(now time.Time) bool {
+	if !a.start.IsZero() && now.Before(a.start) {
+		return false
+	}
+	return a.end.IsZero() || now.Before(a.end)
+}
+
+// Progress 广告在活动时区当天的投放进度（0到1），用于匀速投放：有分时段投放计划时按计划，否则按全天
+func (a *Ad) Progress(now time.Time) float64 {
+	if a.Schedule != nil {
+		return a.Schedule.Progress(now)
+	}
+	return dayProgress(now.In(a.loc))
+}
+
+// Location 活动时区，预算服务按这个时区的日期清零日消耗
+func (a *Ad) Location() *time.Location {
+	return a.loc
+}
+
+// size 创意尺寸
+type size struct {
+	w, h int
+}
+
+// Catalog 编译后的广告库快照，创建后只读，可以并发查询
+// 暂停的活动、投放单元和创意在编译时剔除，投放时间在查询时判断
+type Catalog struct {
+	Version  string
+	LoadedAt time.Time
+
+	campaigns int
+	lineItems int
+	creatives int
+
+	ads      []*Ad
+	byID     map[string]*Ad
+	bySize   map[size]bitset   // 按尺寸索引的Banner广告
+	byFormat map[string]bitset // 按创意形式索引的广告
+	index    *index            // 定向维度的倒排索引
+}
+
+// NewCatalog 校验数据并编译成快照，定向规则、频次上限、分时段投放和创意轮播在这里编译一次
+// ID重复、引用不存在的活动或创意、出价或出价方式、尺寸、定向规则、频次上限、时区、投放时段或轮播方式无效时返回错误
+func NewCatalog(data *Data) (*Catalog, error) {
+	c := &Catalog{LoadedAt: time.Now()}
+
+	advertiserCaps := make(map[string][]frequency.Cap, len(data.Advertisers))
+	for i, advertiser := range data.Advertisers {
+		if advertiser.ID == "" {
+			return nil, fmt.Errorf("第%d个广告主缺少ID", i+1)
+		}
+		if _, ok := advertiserCaps[advertiser.ID]; ok {
+			return nil, fmt.Errorf("广告主ID重复: %s", advertiser.ID)
+		}
+		caps, err := compileCaps(frequency.LevelAdvertiser, advertiser.ID, advertiser.FrequencyCaps)
+		if err != nil {
+			return nil, fmt.Errorf("广告主%s: %w", advertiser.ID, err)
+		}
+		advertiserCaps[advertiser.ID] = caps
+	}
+
+	campaignCaps := make(map[string][]frequency.Cap, len(data.Campaigns))
+	campaignLocs := make(map[string]*time.Location, len(data.Campaigns))
+	campaigns := make(map[string]*Campaign, len(data.Campaigns))
+	for i := range data.Campaigns {
+		campaign := &data.Campaigns[i]
+		if campaign.ID == "" {
+			return nil, fmt.Errorf("第%d个活动缺少ID", i+1)
+		}
+		if _, ok := campaigns[campaign.ID]; ok {
+			return nil, fmt.Errorf("活动ID重复: %s", campaign.ID)
+		}
+		if err := checkStatus(campaign.Status); err != nil {
+			return nil, fmt.Errorf("活动%s: %w", campaign.ID, err)
+		}
+		caps, err := compileCaps(frequency.LevelCampaign, campaign.ID, campaign.FrequencyCaps)
+		if err != nil {
+			return nil, fmt.Errorf("活动%s: %w", campaign.ID, err)
+		}
+		loc, err := time.LoadLocation(campaign.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("活动%s时区无效: %w", campaign.ID, err)
+		}
+		campaigns[campaign.ID] = campaign
+		campaignCaps[campaign.ID] = append(caps, advertiserCaps[campaign.Advertiser]...)
+		campaignLocs[campaign.ID] = loc
+	}
+
+	creativeCaps := make(map[string][]frequency.Cap, len(data.Creatives))
+	creatives := make(map[string]*Creative, len(data.Creatives))
+	for i := range data.Creatives {
+		creative := &data.Creatives[i]
+		if creative.ID == "" {
+			return nil, fmt.Errorf("第%d个创意缺少ID", i+1)
+		}
+		if _, ok := creatives[creative.ID]; ok {
+			return nil, fmt.Errorf("创意ID重复: %s", creative.ID)
+		}
+		if err := checkCreative(creative); err != nil {
+			return nil, fmt.Errorf("创意%s: %w", creative.ID, err)
+		}
+		caps, err := compileCaps(frequency.LevelCreative, creative.ID, creative.FrequencyCaps)
+		if err != nil {
+			return nil, fmt.Errorf("创意%s: %w", creative.ID, err)
+		}
+		creatives[creative.ID] = creative
+		creativeCaps[creative.ID] = caps
+	}
+
+	lineItems := make(map[string]bool, len(data.LineItems))
+	for i := range data.LineItems {
+		lineItem := &data.LineItems[i]
+		if lineItem.ID == "" {
+			return nil, fmt.Errorf("第%d个投放单元缺少ID", i+1)
+		}
+		if lineItems[lineItem.ID] {
+			return nil, fmt.Errorf("投放单元ID重复: %s", lineItem.ID)
+		}
+		lineItems[lineItem.ID] = true
+		if err := checkStatus(lineItem.Status); err != nil {
+			return nil, fmt.Errorf("投放单元%s: %w", lineItem.ID, err)
+		}
+		campaign, ok := campaigns[lineItem.CampaignID]
+		if !ok {
+			return nil, fmt.Errorf("投放单元%s引用了不存在的活动: %s", lineItem.ID, lineItem.CampaignID)
+		}
+		bidPrice, err := money.ParseDecimal(lineItem.BidPrice)
+		if err != nil || bidPrice <= 0 {
+			return nil, fmt.Errorf("投放单元%s出价无效: %q", lineItem.ID, lineItem.BidPrice)
+		}
+		bidType := lineItem.BidType
+		switch bidType {
+		case "":
+			bidType = BidTypeCPM
+		case BidTypeCPM, BidTypeCPC, BidTypeCPA:
+		default:
+			return nil, fmt.Errorf("投放单元%s出价方式无效: %s", lineItem.ID, lineItem.BidType)
+		}
+
+		rule, err := targeting.Compile(lineItem.Targeting.Rule)
+		if err != nil {
+			return nil, fmt.Errorf("投放单元%s定向规则无效: %w", lineItem.ID, err)
+		}
+		schedule, err := compileSchedule(lineItem.Dayparting, campaignLocs[campaign.ID])
+		if err != nil {
+			return nil, fmt.Errorf("投放单元%s分时段投放无效: %w", lineItem.ID, err)
+		}
+		policy, err := compileRotation(lineItem)
+		if err != nil {
+			return nil, fmt.Errorf("投放单元%s创意轮播无效: %w", lineItem.ID, err)
+		}
+
+		live := isActive(campaign.Status) && isActive(lineItem.Status)
+		for _, creativeID := range lineItem.CreativeIDs {
+			creative, ok := creatives[creativeID]
+			if !ok {
+				return nil, fmt.Errorf("投放单元%s引用了不存在的创意: %s", lineItem.ID, creativeID)
+			}
+			if !live || !isActive(creative.Status) {
+				continue
+			}
+			c.ads = append(c.ads, &Ad{
+				ID:       lineItem.ID + ":" + creative.ID,
+				Campaign: campaign,
+				LineItem: lineItem,
+				Creative: creative,
+				BidType:  bidType,
+				BidPrice: bidPrice,
+				Rule:     rule,
+				start:    later(campaign.Start, lineItem.Start),
+				end:      earlier(campaign.End, lineItem.End),
+				loc:      campaignLocs[campaign.ID],
+
+				FrequencyCaps: slices.Concat(creativeCaps[creative.ID], campaignCaps[campaign.ID]),
+				Schedule:      schedule,
+				Rotation:      policy,
+			})
+		}
+	}
+
+	c.campaigns, c.lineItems, c.creatives = len(campaigns), len(lineItems), len(creatives)
+	c.buildIndex()
+	return c, nil
+}
+
+// buildIndex 建立ID、尺寸、创意形式和定向维度的索引
+func (c *Catalog) buildIndex() {
+	c.byID = make(map[string]*Ad, len(c.ads))
+	c.bySize = make(map[size]bitset)
+	c.byFormat = make(map[string]bitset)
+	for i, ad := range c.ads {
+		c.byID[ad.ID] = ad
+		format := ad.Creative.Format
+		if c.byFormat[format] == nil {
+			c.byFormat[format] = newBitset(len(c.ads))
+		}
+		c.byFormat[format].set(i)
+		if format == FormatBanner {
+			key := size{ad.Creative.W, ad.Creative.H}
+			if c.bySize[key] == nil {
+				c.bySize[key] = newBitset(len(c.ads))
+			}
+			c.bySize[key].set(i)
+		}
+	}
+	c.index = newIndex(c.ads)
+}
+
+// Len 可投放的广告数量（不考虑投放时间）
+func (c *Catalog) Len() int {
+	if c == nil {
+		return 0
+	}
+	return len(c.ads)
+}
+
+// Ad 按ID查找广告，不存在（或已暂停）时返回nil
+func (c *Catalog) Ad(id string) *Ad {
+	if c == nil {
+		return nil
+	}
+	return c.byID[id]
+}
+
+// String 快照摘要，用于日志
+func (c *Catalog) String() string {
+	if c == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("Campaigns=%d, LineItems=%d, Creatives=%d, Ads=%d, Version=%s",
+		c.campaigns, c.lineItems, c.creatives, len(c.ads), c.Version)
+}
+
+// Ads 返回可以填充广告位且在投放期和投放时段内的广告
+// Banner按尺寸匹配：广告位指定了宽高时精确匹配，否则按最大最小宽高范围匹配；
+// 视频按时长范围匹配；原生广告不区分尺寸。广告位支持多种形式时返回各形式的并集。
+// env不为nil时先用倒排索引排除定向规则和定向人群一定不满足的广告，
+// 返回的广告仍需调用方求值规则；按用户当地时间的投放时段取env中的时区，env为nil时用活动时区
+func (c *Catalog) Ads(imp *api.Imp, env *targeting.Env, now time.Time) []*Ad {
+	return c.find(imp, env, true, now)
+}
+
+// ScanAds 与Ads相同但不使用倒排索引，返回全部尺寸和投放时间匹配的广告，
+// 用于测试请求逐个解释广告未命中定向规则的原因
+func (c *Catalog) ScanAds(imp *api.Imp, env *targeting.Env, now time.Time) []*Ad {
+	return c.find(imp, env, false, now)
+}
+
+// find 按广告位、投放时间和（useIndex时）定向索引查找广告
+func (c *Catalog) find(imp *api.Imp, env *targeting.Env, useIndex bool, now time.Time) []*Ad {
+	if c == nil || len(c.ads) == 0 {
+		return nil
+	}
+
+	candidates := newBitset(len(c.ads))
+	if banner := imp.Banner; banner != nil {
+		if banner.W > 0 && banner.H > 0 {
+			if b := c.bySize[size{banner.W, banner.H}]; b != nil {
+				candidates.or(b)
+			}
+		} else {
+			for key, b := range c.bySize {
+				if within(key.w, banner.WMin, banner.WMax) && within(key.h, banner.HMin, banner.HMax) {
+					candidates.or(b)
+				}
+			}
+		}
+	}
+	if imp.Video != nil {
+		if b := c.byFormat[FormatVideo]; b != nil {
+			candidates.or(b)
+		}
+	}
+	if imp.Native != nil {
+		if b := c.byFormat[FormatNative]; b != nil {
+			candidates.or(b)
+		}
+	}
+	if useIndex && env != nil && !c.index.filter(candidates, env) {
+		return nil
+	}
+
+	var utcOffset *int
+	if env != nil {
+		utcOffset = env.UTCOffset
+	}
+	var ads []*Ad
+	candidates.each(func(i int) {
+		ad := c.ads[i]
+		if !ad.Live(now) || !ad.Schedule.Active(now, utcOffset) {
+			return
+		}
+		if video := imp.Video; ad.Creative.Format == FormatVideo &&
+			!within(ad.Creative.Duration, video.MinDuration, video.MaxDuration) {
+			return
+		}
+		ads = append(ads, ad)
+	})
+	return ads
+}
+
+// within 判断取值是否在范围内，上下限为0表示不限
+func within(v, min, max int) bool {
+	return (min <= 0 || v >= min) && (max <= 0 || v <= max)
+}
+
+// checkStatus 校验投放状态
+func checkStatus(status string) error {
+	switch status {
+	case "", StatusActive, StatusPaused:
+		return nil
+	}
+	return fmt.Errorf("状态无效: %s", status)
+}
+
+// isActive 空状态视为投放中
+func isActive(status string) bool {
+	return status == "" || status == StatusActive
+}
+
+// checkCreative 校验创意形式和尺寸
+func checkCreative(creative *Creative) error {
+	if err := checkStatus(creative.Status); err != nil {
+		return err
+	}
+	switch creative.Format {
+	case FormatBanner:
+		if creative.W <= 0 || creative.H <= 0 {
+			return fmt.Errorf("Banner创意缺少尺寸")
+		}
+	case FormatVideo, FormatNative:
+	default:
+		return fmt.Errorf("创意形式无效: %s", creative.Format)
+	}
+	if creative.AdM == "" {
+		return fmt.Errorf("缺少素材标记")
+	}
+	return nil
+}
+
+// compileCaps 编译一个对象的频次上限
+func compileCaps(level, id string, specs []FrequencyCap) ([]frequency.Cap, error) {
+	caps := make([]frequency.Cap, 0, len(specs))
+	for i, spec := range specs {
+		c, err := frequency.NewCap(level, id, spec.Max, spec.Window)
+		if err != nil {
+			return nil, fmt.Errorf("第%d个频次上限无效: %w", i+1, err)
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// compileRotation 编译投放单元的创意轮播方式，没有设置时各创意等权随机
+func compileRotation(lineItem *LineItem) (*rotation.Policy, error) {
+	var spec Rotation
+	if lineItem.Rotation != nil {
+		spec = *lineItem.Rotation
+	}
+	return rotation.NewPolicy(lineItem.ID, spec.Mode, lineItem.CreativeIDs, spec.Weights, spec.Exploration)
+}
+
+// later 返回较晚的开始时间，零值表示不限
+func later(a, b time.Time) time.Time {
+	if a.IsZero() || b.After(a) {
+		return b
+	}
+	return a
+}
+
+// earlier 返回较早的结束时间，零值表示不限
+func earlier(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
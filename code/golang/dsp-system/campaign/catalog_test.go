@@ -0,0 +1,104 @@
+package campaign_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/campaign"
+)
+
+func testData() *campaign.Data {
+	return &campaign.Data{
+		Campaigns: []campaign.Campaign{
+			{ID: "c1", Domain: "a.com"},
+			{ID: "c2", Domain: "b.com", Status: campaign.StatusPaused},
+			{ID: "c3", Domain: "c.com", Start: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), End: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		LineItems: []campaign.LineItem{
+			{ID: "li1", CampaignID: "c1", BidPrice: "5.5", Targeting: campaign.Targeting{Rule: "geo.country == 'CHN'"}, CreativeIDs: []string{"banner728", "banner300", "video30"}},
+			{ID: "li2", CampaignID: "c2", BidPrice: "3", CreativeIDs: []string{"banner728"}},
+			{ID: "li3", CampaignID: "c3", BidPrice: "2.25", End: time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC), CreativeIDs: []string{"banner728", "native"}},
+			{ID: "li4", CampaignID: "c1", BidPrice: "1", Status: campaign.StatusPaused, CreativeIDs: []string{"banner728"}},
+		},
+		Creatives: []campaign.Creative{
+			{ID: "banner728", Format: campaign.FormatBanner, W: 728, H: 90, AdM: "<a/>"},
+			{ID: "banner300", Format: campaign.FormatBanner, W: 300, H: 250, AdM: "<a/>"},
+			{ID: "video30", Format: campaign.FormatVideo, Duration: 30, AdM: "<VAST/>"},
+			{ID: "native", Format: campaign.FormatNative, AdM: "{}"},
+		},
+	}
+}
+
+func adIDs(ads []*campaign.Ad) []string {
+	ids := make([]string, 0, len(ads))
+	for _, ad := range ads {
+		ids = append(ids, ad.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestCatalogAds(t *testing.T) {
+	catalog, err := campaign.NewCatalog(testData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Len() != 5 {
+		t.Errorf("暂停的活动和投放单元不应编入广告库，实际为%d个广告", catalog.Len())
+	}
+
+	june := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		imp  api.Imp
+		now  time.Time
+		want []string
+	}{
+		{"精确尺寸", api.Imp{Banner: &api.Banner{W: 728, H: 90}}, june, []string{"li1:banner728", "li3:banner728"}},
+		{"尺寸范围", api.Imp{Banner: &api.Banner{WMin: 200, WMax: 400}}, june, []string{"li1:banner300"}},
+		{"投放期外", api.Imp{Banner: &api.Banner{W: 728, H: 90}}, june.AddDate(0, 0, 10), []string{"li1:banner728"}},
+		{"视频时长", api.Imp{Video: &api.Video{MaxDuration: 15}}, june, []string{}},
+		{"多种形式", api.Imp{Video: &api.Video{MaxDuration: 30}, Native: &api.Native{}}, june, []string{"li1:video30", "li3:native"}},
+	}
+	for _, tt := range tests {
+		if got := adIDs(catalog.Ads(&tt.imp, nil, tt.now)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 期望%v，实际为%v", tt.name, tt.want, got)
+		}
+	}
+
+	ad := catalog.Ads(&api.Imp{Banner: &api.Banner{W: 300, H: 250}}, nil, june)[0]
+	if ad.BidPrice != 5_500_000 || ad.Campaign.Domain != "a.com" || ad.LineItem.ID != "li1" {
+		t.Errorf("广告字段不正确: %+v", ad)
+	}
+	if ad.Rule == nil || ad.Rule.String() != "geo.country == 'CHN'" {
+		t.Errorf("定向规则应在加载时编译: %v", ad.Rule)
+	}
+}
+
+func TestCatalogValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*campaign.Data)
+		want   string
+	}{
+		{"活动ID重复", func(d *campaign.Data) { d.Campaigns[1].ID = "c1" }, "活动ID重复"},
+		{"引用不存在的活动", func(d *campaign.Data) { d.LineItems[0].CampaignID = "c9" }, "不存在的活动"},
+		{"引用不存在的创意", func(d *campaign.Data) { d.LineItems[0].CreativeIDs = []string{"x"} }, "不存在的创意"},
+		{"出价无效", func(d *campaign.Data) { d.LineItems[0].BidPrice = "abc" }, "出价无效"},
+		{"出价为0", func(d *campaign.Data) { d.LineItems[0].BidPrice = "0" }, "出价无效"},
+		{"Banner缺少尺寸", func(d *campaign.Data) { d.Creatives[0].W = 0 }, "缺少尺寸"},
+		{"创意形式无效", func(d *campaign.Data) { d.Creatives[3].Format = "audio" }, "创意形式无效"},
+		{"状态无效", func(d *campaign.Data) { d.LineItems[0].Status = "deleted" }, "状态无效"},
+		{"定向规则无效", func(d *campaign.Data) { d.LineItems[0].Targeting.Rule = "geo.country = 'CHN'" }, "定向规则无效"},
+	}
+	for _, tt := range tests {
+		data := testData()
+		tt.modify(data)
+		if _, err := campaign.NewCatalog(data); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: 期望错误包含%q，实际为%v", tt.name, tt.want, err)
+		}
+	}
+}
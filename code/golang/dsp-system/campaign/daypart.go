@@ -0,0 +1,123 @@
+package campaign
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+// TimezoneUser 分时段投放按用户当地时间
+const TimezoneUser = "user"
+
+// weekdayNames 投放时段中星期的写法
+var weekdayNames = map[string][]time.Weekday{
+	"sun":      {time.Sunday},
+	"mon":      {time.Monday},
+	"tue":      {time.Tuesday},
+	"wed":      {time.Wednesday},
+	"thu":      {time.Thursday},
+	"fri":      {time.Friday},
+	"sat":      {time.Saturday},
+	"weekdays": {time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+	"weekends": {time.Saturday, time.Sunday},
+}
+
+// Schedule 编译后的分时段投放计划，nil表示全天投放
+type Schedule struct {
+	hours        [7]uint32      // 按星期（周日为0），第h位表示h点到h+1点投放
+	loc          *time.Location // 活动时区
+	userTimezone bool           // 请求带时区时按用户当地时间
+}
+
+// compileSchedule 编译投放计划，d为nil时返回nil
+func compileSchedule(d *Dayparting, loc *time.Location) (*Schedule, error) {
+	if d == nil {
+		return nil, nil
+	}
+	s := &Schedule{loc: loc}
+	switch d.Timezone {
+	case "":
+	case TimezoneUser:
+		s.userTimezone = true
+	default:
+		return nil, fmt.Errorf("时区只能为空或%s: %q", TimezoneUser, d.Timezone)
+	}
+
+	for i, w := range d.Hours {
+		if w.Start < 0 || w.Start > 23 || w.End < 1 || w.End > 24 || w.Start == w.End {
+			return nil, fmt.Errorf("第%d个时段的小时无效: %d-%d", i+1, w.Start, w.End)
+		}
+		days := []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}
+		if len(w.Days) > 0 {
+			days = days[:0]
+			for _, name := range w.Days {
+				weekdays, ok := weekdayNames[strings.ToLower(name)]
+				if !ok {
+					return nil, fmt.Errorf("第%d个时段的星期无效: %s", i+1, name)
+				}
+				days = append(days, weekdays...)
+			}
+		}
+		for _, day := range days {
+			if w.Start < w.End {
+				s.hours[day] |= hourMask(w.Start, w.End)
+			} else {
+				// 跨过午夜的部分计入次日
+				s.hours[day] |= hourMask(w.Start, 24)
+				s.hours[(day+1)%7] |= hourMask(0, w.End)
+			}
+		}
+	}
+	if s.hours == [7]uint32{} {
+		return nil, fmt.Errorf("投放时段为空")
+	}
+	return s, nil
+}
+
+// hourMask start到end（不含）点的位
+func hourMask(start, end int) uint32 {
+	return (1<<end - 1) &^ (1<<start - 1)
+}
+
+// Location 计划使用的时区：按用户当地时间且请求带时区时为用户时区，否则为活动时区
+// utcOffset为用户当地时间与UTC的偏移（分钟）
+func (s *Schedule) Location(utcOffset *int) *time.Location {
+	if s.userTimezone && utcOffset != nil {
+		return time.FixedZone("", *utcOffset*60)
+	}
+	return s.loc
+}
+
+// Active 判断now是否在投放时段内
+func (s *Schedule) Active(now time.Time, utcOffset *int) bool {
+	if s == nil {
+		return true
+	}
+	t := now.In(s.Location(utcOffset))
+	return s.hours[t.Weekday()]&(1<<t.Hour()) != 0
+}
+
+// Progress 活动时区的当天已经过去的投放时长占当天投放总时长的比例，在0到1之间
+// 匀速投放按计划分配日预算：到now为止的消耗目标为日预算乘以该比例，不投放的时段不分配预算；
+// 当天没有投放时段时返回1。日消耗按活动时区的日期清零，因此按用户当地时间投放的计划也按活动时区计算，
+// 同一活动在所有请求中的进度相同。s不能为nil，没有投放计划的广告用Ad.Progress按活动时区的全天计算
+func (s *Schedule) Progress(now time.Time) float64 {
+	t := now.In(s.loc)
+	today := s.hours[t.Weekday()]
+	total := bits.OnesCount32(today)
+	if total == 0 {
+		return 1
+	}
+
+	elapsed := float64(bits.OnesCount32(today & hourMask(0, t.Hour())))
+	if today&(1<<t.Hour()) != 0 {
+		elapsed += float64(t.Minute()*60+t.Second()) / 3600
+	}
+	return elapsed / float64(total)
+}
+
+// dayProgress 当天已经过去的时长占全天的比例
+func dayProgress(t time.Time) float64 {
+	return float64(t.Hour()*3600+t.Minute()*60+t.Second()) / (24 * 3600)
+}
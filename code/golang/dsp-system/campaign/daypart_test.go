@@ -0,0 +1,148 @@
+package campaign_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/targeting"
+)
+
+func daypartCatalog(t *testing.T, timezone string, dayparting *campaign.Dayparting) (*campaign.Catalog, error) {
+	t.Helper()
+	return campaign.NewCatalog(&campaign.Data{
+		Campaigns: []campaign.Campaign{{ID: "c1", Domain: "a.com", Timezone: timezone}},
+		LineItems: []campaign.LineItem{{ID: "li1", CampaignID: "c1", BidPrice: "1", CreativeIDs: []string{"cr1"}, Dayparting: dayparting}},
+		Creatives: []campaign.Creative{{ID: "cr1", Format: campaign.FormatBanner, W: 300, H: 250, AdM: "<a/>"}},
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	catalog, err := daypartCatalog(t, "Asia/Shanghai", &campaign.Dayparting{
+		Timezone: campaign.TimezoneUser,
+		Hours: []campaign.DaypartWindow{
+			{Days: []string{"weekdays"}, Start: 18, End: 23},
+			{Days: []string{"Sat"}, Start: 22, End: 2}, // 跨过午夜到周日2点
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := catalog.Ad("li1:cr1").Schedule
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 10, day, hour, minute, 0, 0, shanghai) // 10月19日为周一
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		active bool
+	}{
+		{"周一晚上", at(19, 19, 0), true},
+		{"周一下午", at(19, 17, 59), false},
+		{"周一23点结束", at(19, 23, 0), false},
+		{"周六深夜", at(24, 23, 30), true},
+		{"跨到周日凌晨", at(25, 1, 59), true},
+		{"周日凌晨结束", at(25, 2, 0), false},
+		{"周日晚上", at(25, 19, 0), false},
+	}
+	for _, tt := range tests {
+		if got := schedule.Active(tt.now, nil); got != tt.active {
+			t.Errorf("%s: 应为%v，实际为%v", tt.name, tt.active, got)
+		}
+	}
+
+	// 按用户当地时间：上海19点是纽约（UTC-4）7点
+	newYork := -240
+	if schedule.Active(at(19, 19, 0), &newYork) {
+		t.Error("应按用户当地时间判断")
+	}
+	if !schedule.Active(at(20, 7, 0), &newYork) {
+		t.Error("纽约周一19点应投放")
+	}
+
+	progress := []struct {
+		name string
+		now  time.Time
+		want float64
+	}{
+		{"开始前", at(19, 10, 0), 0},
+		{"投放中", at(19, 20, 30), 0.5},
+		{"结束后", at(19, 23, 30), 1},
+		{"周日只有2小时", at(25, 1, 30), 0.75},
+	}
+	for _, tt := range progress {
+		if got := schedule.Progress(tt.now); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: 进度应为%v，实际为%v", tt.name, tt.want, got)
+		}
+	}
+
+	var always *campaign.Schedule
+	if !always.Active(at(19, 3, 0), nil) {
+		t.Error("没有投放计划时应全天投放")
+	}
+	if got := catalog.Ad("li1:cr1").Progress(at(19, 20, 30)); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("有投放计划时广告进度应按计划: %v", got)
+	}
+
+	// 没有投放计划时按活动时区的全天计算：上海12点为一半
+	allDay, err := daypartCatalog(t, "Asia/Shanghai", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := allDay.Ad("li1:cr1").Progress(time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC)); math.Abs(got-0.5) > 1e-9 {
+		t.Errorf("没有投放计划时应按活动时区计算进度: %v", got)
+	}
+	if loc := allDay.Ad("li1:cr1").Location(); loc.String() != "Asia/Shanghai" {
+		t.Errorf("广告应带活动时区: %s", loc)
+	}
+}
+
+func TestScheduleAds(t *testing.T) {
+	catalog, err := daypartCatalog(t, "UTC", &campaign.Dayparting{
+		Timezone: campaign.TimezoneUser,
+		Hours:    []campaign.DaypartWindow{{Start: 9, End: 17}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := &api.Imp{Banner: &api.Banner{W: 300, H: 250}}
+	now := time.Date(2026, 10, 19, 7, 0, 0, 0, time.UTC)
+
+	if ads := catalog.Ads(imp, nil, now); len(ads) != 0 {
+		t.Error("活动时区7点不应投放")
+	}
+	offset := 480
+	env := targeting.NewEnv(&api.BidRequest{Device: &api.Device{Geo: &api.Geo{UTCOffset: &offset}}}, nil, nil, now)
+	if ads := catalog.Ads(imp, env, now); len(ads) != 1 {
+		t.Error("用户当地时间15点应投放")
+	}
+	if ads := catalog.ScanAds(imp, env, now); len(ads) != 1 {
+		t.Error("不使用索引时也应按用户当地时间判断")
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	tests := []struct {
+		timezone   string
+		dayparting campaign.Dayparting
+		err        string
+	}{
+		{"Mars/Base", campaign.Dayparting{Hours: []campaign.DaypartWindow{{Start: 0, End: 24}}}, "时区无效"},
+		{"", campaign.Dayparting{Timezone: "utc", Hours: []campaign.DaypartWindow{{Start: 0, End: 24}}}, "时区只能"},
+		{"", campaign.Dayparting{Hours: []campaign.DaypartWindow{{Start: 8, End: 8}}}, "小时无效"},
+		{"", campaign.Dayparting{Hours: []campaign.DaypartWindow{{Start: 8, End: 25}}}, "小时无效"},
+		{"", campaign.Dayparting{Hours: []campaign.DaypartWindow{{Days: []string{"holiday"}, Start: 8, End: 9}}}, "星期无效"},
+		{"", campaign.Dayparting{}, "投放时段为空"},
+	}
+	for _, tt := range tests {
+		_, err := daypartCatalog(t, tt.timezone, &tt.dayparting)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%+v: 错误应包含%q，实际为%v", tt.dayparting, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package campaign
+
+import (
+	"dsp-system/targeting"
+	"math/bits"
+	"strings"
+)
+
+// bitset 广告序号集合
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i int) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) or(other bitset) {
+	for i, w := range other {
+		b[i] |= w
+	}
+}
+
+// and 求交集，返回结果是否非空
+func (b bitset) and(other bitset) bool {
+	var nonZero uint64
+	for i := range b {
+		b[i] &= other[i]
+		nonZero |= b[i]
+	}
+	return nonZero != 0
+}
+
+// each 按序号遍历集合中的元素
+func (b bitset) each(fn func(i int)) {
+	for i, w := range b {
+		for w != 0 {
+			fn(i*64 + bits.TrailingZeros64(w))
+			w &= w - 1
+		}
+	}
+}
+
+// segmentField 投放单元的IncludeSegments与规则中的user.segment条件索引在同一维度
+const segmentField = "user.segment"
+
+// dimension 一个定向维度的倒排表
+type dimension struct {
+	postings map[string]bitset // 取值 -> 限定了该取值的广告
+	any      bitset            // 在该维度上不限的广告
+}
+
+// index 定向维度的倒排索引
+// 广告在某维度上有约束时记入对应取值的倒排表，否则记入any；查询时逐维度取
+// 请求取值的倒排表与any的并集，再求各维度的交集。结果是满足定向的广告的超集，
+// 仍需逐个求值规则，但只需求值少量候选
+type index struct {
+	size int
+	dims map[string]*dimension
+}
+
+// newIndex 按广告的定向规则和定向人群建立索引
+func newIndex(ads []*Ad) *index {
+	idx := &index{size: len(ads), dims: make(map[string]*dimension)}
+
+	constrained := make([]map[string][]string, len(ads))
+	for i, ad := range ads {
+		fields := make(map[string][]string)
+		for _, c := range ad.Rule.Constraints() {
+			fields[c.Field] = append(fields[c.Field], c.Values...)
+		}
+		for _, segment := range ad.LineItem.Targeting.IncludeSegments {
+			fields[segmentField] = append(fields[segmentField], strings.ToLower(segment))
+		}
+		for field := range fields {
+			if idx.dims[field] == nil {
+				idx.dims[field] = &dimension{postings: make(map[string]bitset), any: newBitset(len(ads))}
+			}
+		}
+		constrained[i] = fields
+	}
+
+	for i := range ads {
+		for field, dim := range idx.dims {
+			values, ok := constrained[i][field]
+			if !ok {
+				dim.any.set(i)
+				continue
+			}
+			for _, v := range values {
+				posting := dim.postings[v]
+				if posting == nil {
+					posting = newBitset(len(ads))
+					dim.postings[v] = posting
+				}
+				posting.set(i)
+			}
+		}
+	}
+	return idx
+}
+
+// filter 在候选集合上按请求的各维度取值求交集，结果写回candidates，返回是否非空
+func (idx *index) filter(candidates bitset, env *targeting.Env) bool {
+	scratch := newBitset(idx.size)
+	for field, dim := range idx.dims {
+		copy(scratch, dim.any)
+		for _, key := range env.Keys(field) {
+			if posting := dim.postings[key]; posting != nil {
+				scratch.or(posting)
+			}
+		}
+		if !candidates.and(scratch) {
+			return false
+		}
+	}
+	return true
+}
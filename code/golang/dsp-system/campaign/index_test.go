@@ -0,0 +1,281 @@
+package campaign
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/targeting"
+)
+
+var (
+	testCountries = []string{"CHN", "USA", "JPN", "HKG", "KOR", "SGP", "DEU", "FRA", "GBR", "AUS"}
+	testOS        = []string{"iOS", "Android", "Windows", "macOS"}
+	testCats      = []string{"IAB1", "IAB2", "IAB3", "IAB7", "IAB9", "IAB12", "IAB17", "IAB19"}
+)
+
+func pick(r *rand.Rand, values []string, n int) []string {
+	picked := make([]string, 0, n)
+	for _, i := range r.Perm(len(values))[:n] {
+		picked = append(picked, "'"+values[i]+"'")
+	}
+	return picked
+}
+
+// randomRule 随机组合可索引和不可索引的条件
+func randomRule(r *rand.Rand, domains, segments []string) string {
+	conditions := []func() string{
+		func() string {
+			return "geo.country in (" + strings.Join(pick(r, testCountries, 1+r.Intn(3)), ", ") + ")"
+		},
+		func() string { return "device.os == " + pick(r, testOS, 1)[0] },
+		func() string { lo := 1 + r.Intn(5); return fmt.Sprintf("device.type in (%d..%d)", lo, lo+r.Intn(3)) },
+		func() string { return "site.domain in (" + strings.Join(pick(r, domains, 1+r.Intn(5)), ", ") + ")" },
+		func() string { return "cat in (" + strings.Join(pick(r, testCats, 1+r.Intn(2)), ", ") + ")" },
+		func() string { return "user.segment == " + pick(r, segments, 1)[0] },
+		func() string {
+			c := pick(r, testCountries, 2)
+			return "(geo.country == " + c[0] + " or geo.country == " + c[1] + ")"
+		},
+		func() string { return "not device.bot" },
+		func() string { return fmt.Sprintf("device.osv >= %d", 8+r.Intn(8)) },
+		func() string { return "geo.country != " + pick(r, testCountries, 1)[0] },
+		func() string { return "(device.os == 'iOS' or cat in ('IAB1'))" },
+	}
+	if r.Intn(10) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := 1 + r.Intn(3); i > 0; i-- {
+		parts = append(parts, conditions[r.Intn(len(conditions))]())
+	}
+	return strings.Join(parts, " and ")
+}
+
+// randomCatalog 生成n个投放单元，大部分使用300x250的创意
+func randomCatalog(tb testing.TB, r *rand.Rand, n int) (*Catalog, []string, []string) {
+	domains := make([]string, 200)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("site%d.com", i)
+	}
+	segments := make([]string, 500)
+	for i := range segments {
+		segments[i] = fmt.Sprintf("seg_%d", i)
+	}
+
+	data := &Data{
+		Campaigns: []Campaign{{ID: "c1", Domain: "a.com"}, {ID: "c2", Domain: "b.com", End: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}},
+		Creatives: []Creative{
+			{ID: "cr300", Format: FormatBanner, W: 300, H: 250, AdM: "<a/>"},
+			{ID: "cr728", Format: FormatBanner, W: 728, H: 90, AdM: "<a/>"},
+			{ID: "video", Format: FormatVideo, Duration: 15, AdM: "<VAST/>"},
+		},
+	}
+	for i := 0; i < n; i++ {
+		li := LineItem{
+			ID:          fmt.Sprintf("li%d", i),
+			CampaignID:  "c1",
+			BidPrice:    "1",
+			Targeting:   Targeting{Rule: randomRule(r, domains, segments)},
+			CreativeIDs: []string{"cr300"},
+		}
+		if r.Intn(20) == 0 {
+			li.CampaignID = "c2" // 已结束
+		}
+		if r.Intn(5) == 0 {
+			li.CreativeIDs = []string{"cr728", "video"}
+		}
+		if r.Intn(4) == 0 {
+			li.Targeting.IncludeSegments = []string{segments[r.Intn(len(segments))], strings.ToUpper(segments[r.Intn(len(segments))])}
+		}
+		data.LineItems = append(data.LineItems, li)
+	}
+
+	catalog, err := NewCatalog(data)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return catalog, domains, segments
+}
+
+// randomRequest 随机请求，部分字段缺失
+func randomRequest(r *rand.Rand, domains, segments []string) (*api.Imp, *targeting.Env, []string) {
+	req := &api.BidRequest{Device: &api.Device{OS: testOS[r.Intn(len(testOS))], OSV: fmt.Sprint(8 + r.Intn(10)), DeviceType: r.Intn(8), Bot: r.Intn(10) == 0}}
+	if r.Intn(10) > 0 {
+		req.Device.Geo = &api.Geo{Country: testCountries[r.Intn(len(testCountries))]}
+	}
+	if r.Intn(10) > 0 {
+		req.Site = &api.Site{Domain: domains[r.Intn(len(domains))], Cat: []string{testCats[r.Intn(len(testCats))], testCats[r.Intn(len(testCats))]}}
+	}
+	var userSegments []string
+	for i := r.Intn(30); i > 0; i-- {
+		userSegments = append(userSegments, segments[r.Intn(len(segments))])
+	}
+
+	imp := &api.Imp{Banner: &api.Banner{W: 300, H: 250}}
+	switch r.Intn(4) {
+	case 0:
+		imp = &api.Imp{Banner: &api.Banner{W: 728, H: 90}, Video: &api.Video{MaxDuration: 30}}
+	case 1:
+		imp = &api.Imp{Banner: &api.Banner{WMax: 800, HMax: 100}}
+	}
+	return imp, targeting.NewEnv(req, userSegments, nil, time.Now()), userSegments
+}
+
+// linearAds 不使用任何索引，逐个检查广告的尺寸、形式和投放期
+func linearAds(c *Catalog, imp *api.Imp, now time.Time) []*Ad {
+	var ads []*Ad
+	for _, ad := range c.ads {
+		if !ad.Live(now) {
+			continue
+		}
+		creative := ad.Creative
+		switch creative.Format {
+		case FormatBanner:
+			banner := imp.Banner
+			if banner == nil {
+				continue
+			}
+			if banner.W > 0 && banner.H > 0 {
+				if creative.W != banner.W || creative.H != banner.H {
+					continue
+				}
+			} else if !within(creative.W, banner.WMin, banner.WMax) || !within(creative.H, banner.HMin, banner.HMax) {
+				continue
+			}
+		case FormatVideo:
+			if imp.Video == nil || !within(creative.Duration, imp.Video.MinDuration, imp.Video.MaxDuration) {
+				continue
+			}
+		case FormatNative:
+			if imp.Native == nil {
+				continue
+			}
+		}
+		ads = append(ads, ad)
+	}
+	return ads
+}
+
+// match 定向规则和定向人群的完整判断
+func match(ad *Ad, env *targeting.Env, segments []string) bool {
+	include := ad.LineItem.Targeting.IncludeSegments
+	if len(include) > 0 && !slices.ContainsFunc(include, func(s string) bool { return slices.Contains(segments, s) }) {
+		return false
+	}
+	return ad.Rule.Match(env)
+}
+
+// eligible 满足定向的广告ID，按ID排序
+func eligible(ads []*Ad, env *targeting.Env, segments []string) []string {
+	ids := []string{}
+	for _, ad := range ads {
+		if match(ad, env, segments) {
+			ids = append(ids, ad.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	catalog, domains, segments := randomCatalog(t, r, 3000)
+	now := time.Now()
+
+	total := 0
+	for i := 0; i < 500; i++ {
+		imp, env, userSegments := randomRequest(r, domains, segments)
+		want := eligible(linearAds(catalog, imp, now), env, userSegments)
+		indexed := catalog.Ads(imp, env, now)
+		if got := eligible(indexed, env, userSegments); !slices.Equal(got, want) {
+			t.Fatalf("第%d个请求: 索引结果与线性扫描不一致\n索引: %v\n扫描: %v", i, got, want)
+		}
+		if all := catalog.Ads(imp, nil, now); len(indexed) > len(all) {
+			t.Fatalf("索引不应增加候选: %d > %d", len(indexed), len(all))
+		}
+		total += len(want)
+	}
+	if total == 0 {
+		t.Fatal("测试数据应有命中的广告")
+	}
+}
+
+func TestIndexConstraints(t *testing.T) {
+	data := &Data{
+		Campaigns: []Campaign{{ID: "c1", Domain: "a.com"}},
+		Creatives: []Creative{{ID: "cr", Format: FormatBanner, W: 300, H: 250, AdM: "<a/>"}},
+		LineItems: []LineItem{
+			{ID: "cn", CampaignID: "c1", BidPrice: "1", CreativeIDs: []string{"cr"}, Targeting: Targeting{Rule: "geo.country == 'CHN' and device.osv >= 14"}},
+			{ID: "any", CampaignID: "c1", BidPrice: "1", CreativeIDs: []string{"cr"}, Targeting: Targeting{Rule: "not device.bot"}},
+			{ID: "seg", CampaignID: "c1", BidPrice: "1", CreativeIDs: []string{"cr"}, Targeting: Targeting{IncludeSegments: []string{"S1"}}},
+		},
+	}
+	catalog, err := NewCatalog(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imp := &api.Imp{Banner: &api.Banner{W: 300, H: 250}}
+	lineItems := func(env *targeting.Env) []string {
+		var ids []string
+		for _, ad := range catalog.Ads(imp, env, time.Now()) {
+			ids = append(ids, ad.LineItem.ID)
+		}
+		return ids
+	}
+
+	usa := targeting.NewEnv(&api.BidRequest{Device: &api.Device{Geo: &api.Geo{Country: "USA"}}}, nil, nil, time.Now())
+	if got := lineItems(usa); !slices.Equal(got, []string{"any"}) {
+		t.Errorf("国家不符和不在人群中的广告应被索引排除: %v", got)
+	}
+	// 索引只看可索引的条件，osv不满足的广告仍返回，由规则求值排除
+	cn := targeting.NewEnv(&api.BidRequest{Device: &api.Device{OSV: "13", Geo: &api.Geo{Country: "chn"}}}, []string{"s1"}, nil, time.Now())
+	if got := lineItems(cn); !slices.Equal(got, []string{"cn", "any", "seg"}) {
+		t.Errorf("索引结果不正确: %v", got)
+	}
+}
+
+// 两万个投放单元，每次请求取出候选并完整判断定向
+func benchmarkAds(b *testing.B, indexed bool) {
+	r := rand.New(rand.NewSource(2))
+	catalog, domains, segments := randomCatalog(b, r, 20000)
+	now := time.Now()
+
+	type request struct {
+		imp      *api.Imp
+		env      *targeting.Env
+		segments []string
+	}
+	requests := make([]request, 256)
+	for i := range requests {
+		imp, env, userSegments := randomRequest(r, domains, segments)
+		requests[i] = request{imp, env, userSegments}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req := requests[i%len(requests)]
+		var ads []*Ad
+		if indexed {
+			ads = catalog.Ads(req.imp, req.env, now)
+		} else {
+			ads = linearAds(catalog, req.imp, now)
+		}
+		for _, ad := range ads {
+			match(ad, req.env, req.segments)
+		}
+	}
+}
+
+func BenchmarkAdsLinearScan(b *testing.B) {
+	benchmarkAds(b, false)
+}
+
+func BenchmarkAdsIndexed(b *testing.B) {
+	benchmarkAds(b, true)
+}
@@ -0,0 +1,133 @@
+// Package campaign 广告活动、投放单元和创意库
+// 数据来自声明式文件或SQL数据库，编译成只读快照后原子替换，竞价读取时不加锁
+package campaign
+
+import "time"
+
+// 投放状态
+const (
+	StatusActive = "active"
+	StatusPaused = "paused"
+)
+
+// 创意形式
+const (
+	FormatBanner = "banner"
+	FormatVideo  = "video"
+	FormatNative = "native"
+)
+
+// 出价方式
+const (
+	BidTypeCPM = "cpm" // 按千次曝光出价
+	BidTypeCPC = "cpc" // 按点击出价，竞价时按预估点击率换算为eCPM
+	BidTypeCPA = "cpa" // 按转化出价，竞价时按预估点击率和转化率换算为eCPM
+)
+
+// Data 一个数据源中的全部广告主、活动、投放单元和创意
+type Data struct {
+	Advertisers []Advertiser `json:"advertisers,omitempty"`
+	Campaigns   []Campaign   `json:"campaigns"`
+	LineItems   []LineItem   `json:"line_items"`
+	Creatives   []Creative   `json:"creatives"`
+}
+
+// FrequencyCap 频次上限：同一用户在窗口内最多曝光Max次
+type FrequencyCap struct {
+	Max int `json:"max"`
+	// Window hour、day、week、month为自然窗口（服务器时区），30m、24h、7d等为滚动窗口
+	Window string `json:"window"`
+}
+
+// Advertiser 广告主，只在需要设置广告主级频次上限时声明
+type Advertiser struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name,omitempty"`
+	FrequencyCaps []FrequencyCap `json:"frequency_caps,omitempty"`
+}
+
+// Campaign 广告活动
+type Campaign struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name,omitempty"`
+	Advertiser string    `json:"advertiser,omitempty"` // 广告主ID，对应Advertisers时使用其频次上限
+	Domain     string    `json:"domain"`               // 广告主域名，竞价响应的adomain
+	Status     string    `json:"status,omitempty"`     // active, paused，为空时为active
+	Start      time.Time `json:"start,omitempty"`      // 开始时间，零值表示不限
+	End        time.Time `json:"end,omitempty"`        // 结束时间（不含），零值表示不限
+	Timezone   string    `json:"timezone,omitempty"`   // 分时段投放、匀速投放和日预算的时区（IANA名称），为空时为UTC
+	// DisableBidShading 不做出价折减，第一价格拍卖中也按出价上限出价
+	DisableBidShading bool `json:"disable_bid_shading,omitempty"`
+
+	FrequencyCaps []FrequencyCap `json:"frequency_caps,omitempty"`
+}
+
+// LineItem 投放单元：出价、定向和使用的创意
+type LineItem struct {
+	ID          string    `json:"id"`
+	CampaignID  string    `json:"campaign_id"`
+	Name        string    `json:"name,omitempty"`
+	Status      string    `json:"status,omitempty"`
+	BidType     string    `json:"bid_type,omitempty"` // cpm、cpc、cpa，为空时为cpm
+	BidPrice    string    `json:"bid_price"`          // 按BidType的出价，十进制字符串（元），避免浮点误差
+	Start       time.Time `json:"start,omitempty"`
+	End         time.Time `json:"end,omitempty"`
+	Targeting   Targeting `json:"targeting"`
+	CreativeIDs []string  `json:"creative_ids"`
+	// Dayparting 分时段投放计划，为空表示全天投放
+	Dayparting *Dayparting `json:"dayparting,omitempty"`
+	// Rotation 有多个创意时的轮播方式，为空时各创意等权随机
+	Rotation *Rotation `json:"rotation,omitempty"`
+}
+
+// Rotation 创意轮播：同一广告位上投放单元只出一个创意，按Mode选择
+type Rotation struct {
+	// Mode weighted按权重随机；sequential每人按CreativeIDs的顺序依次观看，看完从头开始；
+	// optimized按全局点击率选择，Exploration比例的流量随机探索。为空时为weighted
+	Mode string `json:"mode,omitempty"`
+	// Weights weighted时各创意的权重，未列出的创意为1
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// Exploration optimized时随机探索的流量比例（0-1），未设置时为0.1，设置为0时不探索
+	Exploration *float64 `json:"exploration,omitempty"`
+}
+
+// Dayparting 分时段投放：一周中哪些小时投放
+type Dayparting struct {
+	// Timezone 为user时按用户当地时间（请求的geo.utcoffset），请求没有时区时用活动时区；为空时用活动时区
+	Timezone string          `json:"timezone,omitempty"`
+	Hours    []DaypartWindow `json:"hours"`
+}
+
+// DaypartWindow 投放时段，Start大于End时跨过午夜，例如22到2点
+type DaypartWindow struct {
+	// Days mon、tue、wed、thu、fri、sat、sun，或weekdays、weekends；为空表示每天
+	Days  []string `json:"days,omitempty"`
+	Start int      `json:"start"` // 开始小时（0-23）
+	End   int      `json:"end"`   // 结束小时（不含，1-24）
+}
+
+// Targeting 投放单元的定向条件
+type Targeting struct {
+	// Tags 用户标签，命中任一即可，为空表示不限
+	Tags []string `json:"tags,omitempty"`
+	// IncludeSegments 定向人群，用户属于其中任一人群才投放；为空表示不限
+	IncludeSegments []string `json:"include_segments,omitempty"`
+	// ExcludeSegments 排除人群，用户属于其中任一人群则不投放
+	ExcludeSegments []string `json:"exclude_segments,omitempty"`
+	// Rule 定向规则表达式（地域、设备、媒体、时间等），语法见targeting.Rule；为空表示不限
+	Rule string `json:"rule,omitempty"`
+}
+
+// Creative 创意
+type Creative struct {
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Format   string `json:"format"` // banner, video, native
+	W        int    `json:"w,omitempty"`
+	H        int    `json:"h,omitempty"`
+	Duration int    `json:"duration,omitempty"` // 视频时长（秒）
+	AdM      string `json:"adm"`                // 广告素材标记
+
+	FrequencyCaps []FrequencyCap `json:"frequency_caps,omitempty"`
+}
@@ -0,0 +1,134 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadTimeout 单次加载的超时时间
+const loadTimeout = 30 * time.Second
+
+// Repository 广告库，合并所有数据源编译成快照，数据源变化后自动重新加载
+// 竞价通过Catalog取得当前快照，不加锁；重新加载时先完整编译新快照再原子替换
+type Repository struct {
+	sources []Source
+	current atomic.Pointer[Catalog]
+
+	mu       sync.Mutex // 串行化重新加载
+	versions []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewRepository 加载广告库，reloadInterval大于0时按该间隔检查数据源是否变化
+// 多个数据源的数据合并后编译，ID在数据源之间也不能重复；没有数据源时广告库为空
+func NewRepository(sources []Source, reloadInterval time.Duration) (*Repository, error) {
+	r := &Repository{
+		sources: sources,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	if _, err := r.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 && len(sources) > 0 {
+		go r.watch(reloadInterval)
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// Catalog 当前快照，同一次竞价应只取一次以保证看到一致的数据
+func (r *Repository) Catalog() *Catalog {
+	if r == nil {
+		return nil
+	}
+	return r.current.Load()
+}
+
+// Reload 数据源有变化时重新加载，返回是否替换了快照；加载或校验失败时继续使用旧快照
+func (r *Repository) Reload(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := make([]string, len(r.sources))
+	for i, source := range r.sources {
+		version, err := source.Version(ctx)
+		if err != nil {
+			return false, fmt.Errorf("检查数据源%s失败: %w", source.Name(), err)
+		}
+		versions[i] = version
+	}
+	if r.current.Load() != nil && slices.Equal(versions, r.versions) {
+		return false, nil
+	}
+
+	merged := &Data{}
+	for _, source := range r.sources {
+		data, err := source.Load(ctx)
+		if err != nil {
+			return false, fmt.Errorf("加载数据源%s失败: %w", source.Name(), err)
+		}
+		merged.Advertisers = append(merged.Advertisers, data.Advertisers...)
+		merged.Campaigns = append(merged.Campaigns, data.Campaigns...)
+		merged.LineItems = append(merged.LineItems, data.LineItems...)
+		merged.Creatives = append(merged.Creatives, data.Creatives...)
+	}
+	catalog, err := NewCatalog(merged)
+	if err != nil {
+		return false, fmt.Errorf("编译广告库失败: %w", err)
+	}
+	catalog.Version = strings.Join(versions, ",")
+
+	r.current.Store(catalog)
+	r.versions = versions
+
+	log.Printf("广告库已加载: %s", catalog)
+	return true, nil
+}
+
+// watch 定期检查数据源
+func (r *Repository) watch(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		if _, err := r.Reload(ctx); err != nil {
+			log.Printf("重新加载广告库失败（继续使用旧数据）: %v", err)
+		}
+		cancel()
+	}
+}
+
+// Close 停止检查数据源
+func (r *Repository) Close() {
+	if r == nil {
+		return
+	}
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+}
@@ -0,0 +1,158 @@
+package campaign_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/rotation"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func writeFile(t *testing.T, path, content string, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(path, mod, mod)
+}
+
+func TestRepositoryFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaigns.json")
+	writeFile(t, path, `{
+		"campaigns": [{"id": "c1", "domain": "a.com"}],
+		"line_items": [{"id": "li1", "campaign_id": "c1", "bid_price": "5.5", "targeting": {"tags": ["运动"]}, "creative_ids": ["cr1"]}],
+		"creatives": [{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"}]
+	}`, time.Now())
+
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	imp := &api.Imp{Banner: &api.Banner{W: 728, H: 90}}
+	old := repo.Catalog()
+	ads := old.Ads(imp, nil, time.Now())
+	if len(ads) != 1 || ads[0].LineItem.Targeting.Tags[0] != "运动" {
+		t.Fatalf("应从文件加载广告: %v", ads)
+	}
+
+	// 文件未变化时不重新加载
+	if reloaded, err := repo.Reload(context.Background()); err != nil || reloaded {
+		t.Errorf("文件未变化时不应重新加载: %v, %v", reloaded, err)
+	}
+
+	// 文件变化后替换快照，已取得的旧快照不受影响
+	writeFile(t, path, `{
+		"campaigns": [{"id": "c1", "domain": "a.com", "status": "paused"}],
+		"line_items": [{"id": "li1", "campaign_id": "c1", "bid_price": "5.5", "creative_ids": ["cr1"]}],
+		"creatives": [{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"}]
+	}`, time.Now().Add(time.Second))
+	if reloaded, err := repo.Reload(context.Background()); err != nil || !reloaded {
+		t.Fatalf("文件变化后应重新加载: %v, %v", reloaded, err)
+	}
+	if n := len(repo.Catalog().Ads(imp, nil, time.Now())); n != 0 {
+		t.Errorf("活动暂停后不应有广告，实际为%d", n)
+	}
+	if n := len(old.Ads(imp, nil, time.Now())); n != 1 {
+		t.Errorf("旧快照不应被修改，实际为%d", n)
+	}
+
+	// 新文件无效时继续使用旧快照
+	current := repo.Catalog()
+	writeFile(t, path, `{"line_items": [{"id": "li1", "campaign_id": "missing", "bid_price": "1"}]}`, time.Now().Add(2*time.Second))
+	if _, err := repo.Reload(context.Background()); err == nil {
+		t.Error("无效的数据应返回错误")
+	}
+	if repo.Catalog() != current {
+		t.Error("加载失败时应保留旧快照")
+	}
+}
+
+func TestRepositorySQLSource(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	versionQuery := regexp.QuoteMeta(campaign.DefaultVersionQuery)
+	version := func(v string) {
+		mock.ExpectQuery(versionQuery).WillReturnRows(
+			sqlmock.NewRows([]string{"c", "l", "cr", "lc", "n1", "n2", "n3", "n4"}).
+				AddRow(v, v, v, nil, 1, 2, 2, 2))
+	}
+	load := func(bidPrice string) {
+		mock.ExpectBegin()
+		mock.ExpectQuery("FROM advertisers").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "frequency_caps"}).
+				AddRow("adv1", "广告主", `[{"max": 10, "window": "week"}]`))
+		mock.ExpectQuery("FROM campaigns").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "advertiser", "domain", "status", "start_time", "end_time", "timezone", "disable_bid_shading", "frequency_caps"}).
+				AddRow("c1", "活动", "adv1", "a.com", "active", nil, time.Now().Add(time.Hour), "Asia/Shanghai", true, `[{"max": 3, "window": "day"}]`))
+		mock.ExpectQuery("FROM line_items").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "campaign_id", "name", "status", "bid_type", "bid_price", "start_time", "end_time", "targeting", "dayparting", "rotation"}).
+				AddRow("li1", "c1", "", "active", "cpm", bidPrice, nil, nil, `{"include_segments": ["s1"]}`, `{"hours": [{"start": 0, "end": 24}]}`, `{"mode": "optimized", "exploration": 0}`).
+				AddRow("li2", "c1", "", "paused", "cpc", "1", nil, nil, nil, nil, nil))
+		mock.ExpectQuery("FROM creatives").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "name", "status", "format", "w", "h", "duration", "adm", "frequency_caps"}).
+				AddRow("cr1", "", "active", "banner", 728, 90, 0, "<a/>", nil).
+				AddRow("cr2", "", "active", "native", 0, 0, 0, "{}", ""))
+		mock.ExpectQuery("FROM line_item_creatives").WillReturnRows(
+			sqlmock.NewRows([]string{"line_item_id", "creative_id"}).
+				AddRow("li1", "cr1").AddRow("li1", "cr2").AddRow("li2", "cr1"))
+		mock.ExpectRollback()
+	}
+
+	version("2024-06-01 00:00:00")
+	load("5.5")
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewSQLSource(db, "")}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ads := repo.Catalog().Ads(&api.Imp{Banner: &api.Banner{W: 728, H: 90}, Native: &api.Native{}}, nil, time.Now())
+	if len(ads) != 2 || ads[0].BidType != campaign.BidTypeCPM || ads[0].BidPrice != 5_500_000 || ads[0].LineItem.Targeting.IncludeSegments[0] != "s1" {
+		t.Errorf("应从数据库加载广告: %+v", ads)
+	}
+	if ads[0].Schedule == nil || ads[0].Schedule.Location(nil).String() != "Asia/Shanghai" {
+		t.Errorf("应加载投放时段和活动时区: %+v", ads[0].Schedule)
+	}
+	if !ads[0].Campaign.DisableBidShading {
+		t.Error("应加载活动的出价折减开关")
+	}
+	if caps := ads[0].FrequencyCaps; len(caps) != 2 || caps[0].String() != "campaign:c1 3/day" || caps[1].String() != "advertiser:adv1 10/week" {
+		t.Errorf("应加载活动和广告主的频次上限: %v", caps)
+	}
+	if policy := ads[0].Rotation; policy.Mode != rotation.ModeOptimized || policy.Exploration != 0 || !slices.Equal(policy.Creatives, []string{"cr1", "cr2"}) {
+		t.Errorf("应加载创意轮播方式和创意顺序: %+v", policy)
+	}
+
+	// 版本未变化时不查询数据
+	version("2024-06-01 00:00:00")
+	if reloaded, err := repo.Reload(context.Background()); err != nil || reloaded {
+		t.Errorf("版本未变化时不应重新加载: %v, %v", reloaded, err)
+	}
+
+	version("2024-06-02 00:00:00")
+	load("6")
+	if reloaded, err := repo.Reload(context.Background()); err != nil || !reloaded {
+		t.Fatalf("版本变化后应重新加载: %v, %v", reloaded, err)
+	}
+	if ads := repo.Catalog().Ads(&api.Imp{Native: &api.Native{}}, nil, time.Now()); len(ads) != 1 || ads[0].BidPrice != 6_000_000 {
+		t.Errorf("重新加载后应使用新数据: %+v", ads)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,56 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Source 广告库数据源
+type Source interface {
+	// Name 数据源名称，用于日志
+	Name() string
+	// Version 数据版本，与上次加载时相同则不重新加载
+	Version(ctx context.Context) (string, error)
+	// Load 加载全部数据
+	Load(ctx context.Context) (*Data, error)
+}
+
+// FileSource 声明式JSON文件数据源，以修改时间和大小作为版本
+type FileSource struct {
+	path string
+}
+
+// NewFileSource 创建文件数据源
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Name 数据源名称
+func (s *FileSource) Name() string {
+	return "file:" + s.path
+}
+
+// Version 文件的修改时间和大小
+func (s *FileSource) Version(ctx context.Context) (string, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// Load 读取并解析文件
+func (s *FileSource) Load(ctx context.Context) (*Data, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var data Data
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("解析广告库文件失败: %w", err)
+	}
+	return &data, nil
+}
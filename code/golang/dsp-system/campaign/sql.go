@@ -0,0 +1,245 @@
+package campaign
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultVersionQuery 默认的版本查询：各表最近的更新时间和行数，行数用于发现删除
+const DefaultVersionQuery = `SELECT
+	(SELECT MAX(updated_at) FROM advertisers),
+	(SELECT MAX(updated_at) FROM campaigns),
+	(SELECT MAX(updated_at) FROM line_items),
+	(SELECT MAX(updated_at) FROM creatives),
+	(SELECT MAX(updated_at) FROM line_item_creatives),
+	(SELECT COUNT(*) FROM advertisers),
+	(SELECT COUNT(*) FROM campaigns),
+	(SELECT COUNT(*) FROM line_items),
+	(SELECT COUNT(*) FROM creatives),
+	(SELECT COUNT(*) FROM line_item_creatives)`
+
+// SQLSource SQL数据库数据源，表结构见scripts/campaign_schema.sql
+// 时间列需要能扫描为time.Time（MySQL的DSN需带parseTime=true）
+type SQLSource struct {
+	db           *sql.DB
+	versionQuery string
+}
+
+// NewSQLSource 创建SQL数据源，versionQuery为空时使用DefaultVersionQuery
+func NewSQLSource(db *sql.DB, versionQuery string) *SQLSource {
+	if versionQuery == "" {
+		versionQuery = DefaultVersionQuery
+	}
+	return &SQLSource{db: db, versionQuery: versionQuery}
+}
+
+// Name 数据源名称
+func (s *SQLSource) Name() string {
+	return "sql"
+}
+
+// Version 执行版本查询，把第一行的所有列拼成版本号
+func (s *SQLSource) Version(ctx context.Context) (string, error) {
+	rows, err := s.db.QueryContext(ctx, s.versionQuery)
+	if err != nil {
+		return "", fmt.Errorf("查询广告库版本失败: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", nil
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return "", fmt.Errorf("读取广告库版本失败: %w", err)
+	}
+
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = v.String
+	}
+	return strings.Join(parts, "|"), nil
+}
+
+// Load 查询全部广告主、活动、投放单元、创意及其关联
+// 多条查询在同一个只读事务中执行，避免读到不一致的数据
+func (s *SQLSource) Load(ctx context.Context) (*Data, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	data := &Data{}
+	if data.Advertisers, err = loadAdvertisers(ctx, tx); err != nil {
+		return nil, fmt.Errorf("查询广告主失败: %w", err)
+	}
+	if data.Campaigns, err = loadCampaigns(ctx, tx); err != nil {
+		return nil, fmt.Errorf("查询活动失败: %w", err)
+	}
+	if data.LineItems, err = loadLineItems(ctx, tx); err != nil {
+		return nil, fmt.Errorf("查询投放单元失败: %w", err)
+	}
+	if data.Creatives, err = loadCreatives(ctx, tx); err != nil {
+		return nil, fmt.Errorf("查询创意失败: %w", err)
+	}
+	if err := loadLineItemCreatives(ctx, tx, data.LineItems); err != nil {
+		return nil, fmt.Errorf("查询投放单元创意失败: %w", err)
+	}
+	return data, nil
+}
+
+func loadAdvertisers(ctx context.Context, tx *sql.Tx) ([]Advertiser, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT id, name, frequency_caps FROM advertisers ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var advertisers []Advertiser
+	for rows.Next() {
+		var a Advertiser
+		var caps sql.NullString
+		if err := rows.Scan(&a.ID, &a.Name, &caps); err != nil {
+			return nil, err
+		}
+		if err := unmarshalCaps(caps, &a.FrequencyCaps); err != nil {
+			return nil, fmt.Errorf("广告主%s的频次上限无效: %w", a.ID, err)
+		}
+		advertisers = append(advertisers, a)
+	}
+	return advertisers, rows.Err()
+}
+
+func loadCampaigns(ctx context.Context, tx *sql.Tx) ([]Campaign, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, name, advertiser, domain, status, start_time, end_time, timezone, disable_bid_shading, frequency_caps FROM campaigns ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []Campaign
+	for rows.Next() {
+		var c Campaign
+		var start, end sql.NullTime
+		var caps sql.NullString
+		if err := rows.Scan(&c.ID, &c.Name, &c.Advertiser, &c.Domain, &c.Status, &start, &end, &c.Timezone, &c.DisableBidShading, &caps); err != nil {
+			return nil, err
+		}
+		c.Start, c.End = start.Time, end.Time
+		if err := unmarshalCaps(caps, &c.FrequencyCaps); err != nil {
+			return nil, fmt.Errorf("活动%s的频次上限无效: %w", c.ID, err)
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+func loadLineItems(ctx context.Context, tx *sql.Tx) ([]LineItem, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, campaign_id, name, status, bid_type, bid_price, start_time, end_time, targeting, dayparting, rotation FROM line_items ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lineItems []LineItem
+	for rows.Next() {
+		var li LineItem
+		var start, end sql.NullTime
+		var targeting, dayparting, rotation sql.NullString
+		if err := rows.Scan(&li.ID, &li.CampaignID, &li.Name, &li.Status, &li.BidType, &li.BidPrice, &start, &end, &targeting, &dayparting, &rotation); err != nil {
+			return nil, err
+		}
+		li.Start, li.End = start.Time, end.Time
+		if targeting.String != "" {
+			if err := json.Unmarshal([]byte(targeting.String), &li.Targeting); err != nil {
+				return nil, fmt.Errorf("投放单元%s的定向条件无效: %w", li.ID, err)
+			}
+		}
+		if dayparting.String != "" {
+			if err := json.Unmarshal([]byte(dayparting.String), &li.Dayparting); err != nil {
+				return nil, fmt.Errorf("投放单元%s的分时段投放无效: %w", li.ID, err)
+			}
+		}
+		if rotation.String != "" {
+			if err := json.Unmarshal([]byte(rotation.String), &li.Rotation); err != nil {
+				return nil, fmt.Errorf("投放单元%s的创意轮播无效: %w", li.ID, err)
+			}
+		}
+		lineItems = append(lineItems, li)
+	}
+	return lineItems, rows.Err()
+}
+
+func loadCreatives(ctx context.Context, tx *sql.Tx) ([]Creative, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, name, status, format, w, h, duration, adm, frequency_caps FROM creatives ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var creatives []Creative
+	for rows.Next() {
+		var c Creative
+		var caps sql.NullString
+		if err := rows.Scan(&c.ID, &c.Name, &c.Status, &c.Format, &c.W, &c.H, &c.Duration, &c.AdM, &caps); err != nil {
+			return nil, err
+		}
+		if err := unmarshalCaps(caps, &c.FrequencyCaps); err != nil {
+			return nil, fmt.Errorf("创意%s的频次上限无效: %w", c.ID, err)
+		}
+		creatives = append(creatives, c)
+	}
+	return creatives, rows.Err()
+}
+
+// loadLineItemCreatives 查询关联表，按position顺序填入投放单元的CreativeIDs（顺序播放的顺序）
+// 关联到不存在的投放单元时忽略（由外键或运营清理），关联到不存在的创意时由编译报错
+func loadLineItemCreatives(ctx context.Context, tx *sql.Tx, lineItems []LineItem) error {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT line_item_id, creative_id FROM line_item_creatives ORDER BY line_item_id, position, creative_id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[string]*LineItem, len(lineItems))
+	for i := range lineItems {
+		index[lineItems[i].ID] = &lineItems[i]
+	}
+	for rows.Next() {
+		var lineItemID, creativeID string
+		if err := rows.Scan(&lineItemID, &creativeID); err != nil {
+			return err
+		}
+		if li, ok := index[lineItemID]; ok {
+			li.CreativeIDs = append(li.CreativeIDs, creativeID)
+		}
+	}
+	return rows.Err()
+}
+
+// unmarshalCaps 解析JSON列中的频次上限，NULL或空字符串表示没有上限
+func unmarshalCaps(column sql.NullString, caps *[]FrequencyCap) error {
+	if column.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(column.String), caps)
+}
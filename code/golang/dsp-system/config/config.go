@@ -3,15 +3,25 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 // Config 全局配置
 type Config struct {
-	Server     ServerConfig
-	Redis      RedisConfig
-	ClickHouse ClickHouseConfig
-	RPC        RPCConfig
-	Log        LogConfig
+	Server       ServerConfig
+	Redis        RedisConfig
+	ClickHouse   ClickHouseConfig
+	RPC          RPCConfig
+	Log          LogConfig
+	Sync         SyncConfig
+	Privacy      PrivacyConfig
+	DataSegments DataSegmentsConfig
+	Geo          GeoConfig
+	UserAgent    UserAgentConfig
+	Campaigns    CampaignConfig
+	Model        ModelConfig
+	BidShading   BidShadingConfig
 }
 
 type ServerConfig struct {
@@ -36,6 +46,93 @@ type ClickHouseConfig struct {
 type RPCConfig struct {
 	UserServiceAddr   string
 	BudgetServiceAddr string
+	BudgetLease       BudgetLeaseConfig
+	BudgetPacing      BudgetPacingConfig
+	BehaviorSender    BehaviorSenderConfig
+}
+
+// BudgetLeaseConfig 预算租约配置（启用后竞价节点在本地消耗预先领取的预算）
+type BudgetLeaseConfig struct {
+	Enabled    bool
+	NodeID     string
+	SliceSize  string // 每次申请的额度（元，十进制字符串）
+	TTLSeconds int
+}
+
+// BudgetPacingConfig 匀速投放配置：活动当天的消耗按投放进度分配日预算
+type BudgetPacingConfig struct {
+	Enabled        bool
+	RefreshSeconds int // 活动预算信息的缓存时间
+}
+
+// BehaviorSenderConfig 赢标、曝光、点击行为异步上报到用户服务的配置
+type BehaviorSenderConfig struct {
+	BufferSize      int // 待发送队列长度，队列满时丢弃新事件
+	BatchSize       int
+	FlushIntervalMs int // 不足一批时最长等待
+}
+
+// SyncConfig Cookie同步配置
+type SyncConfig struct {
+	CookieName   string
+	CookieDomain string // 为空时使用请求的域名
+	CookieMaxAge time.Duration
+	CookieSecure bool          // 第三方Cookie需要SameSite=None且Secure，仅本地调试时关闭
+	MappingTTL   time.Duration // 交易平台用户ID映射的保留时间，每次同步后续期
+	// RedirectHosts 允许跳转的交易平台域名（逗号分隔，支持子域名），为空时只返回像素
+	RedirectHosts string
+}
+
+// PrivacyConfig 隐私合规配置
+type PrivacyConfig struct {
+	// TCFVendorID 本方在IAB全球供应商列表中的ID，为0时适用GDPR的请求一律不使用个人数据
+	TCFVendorID int
+}
+
+// DataSegmentsConfig 竞价请求中第三方数据段的映射配置
+type DataSegmentsConfig struct {
+	// MappingFile 数据提供商和段ID到本方标签的映射（JSON），为空时不使用第三方数据段
+	MappingFile string
+}
+
+// GeoConfig IP地理位置库配置
+type GeoConfig struct {
+	// DatabaseFile MaxMind格式（.mmdb）或CSV区间格式的地理位置库，为空时不根据IP补全地理位置
+	DatabaseFile          string
+	Languages             string // 城市名称的语言优先级（逗号分隔，仅MaxMind格式使用）
+	ReloadIntervalSeconds int    // 检查库文件是否变化的间隔，0表示不自动重新加载
+}
+
+// UserAgentConfig User-Agent解析配置
+type UserAgentConfig struct {
+	// RulesFile 解析规则（JSON），为空时使用内置规则
+	RulesFile             string
+	CacheSize             int // 解析结果LRU缓存的条数，0表示不缓存
+	ReloadIntervalSeconds int // 检查规则文件是否变化的间隔，0表示不自动重新加载
+}
+
+// CampaignConfig 广告库配置，文件和数据库可以同时配置，数据合并后使用
+type CampaignConfig struct {
+	File                  string // 声明式JSON文件，为空时不使用
+	DBDriver              string // database/sql驱动名
+	DBDSN                 string // 数据库连接串，为空时不使用；MySQL需带parseTime=true
+	VersionQuery          string // 判断数据是否变化的查询，为空时使用默认查询
+	ReloadIntervalSeconds int    // 检查数据源是否变化的间隔，0表示不自动重新加载
+}
+
+// ModelConfig 点击率和转化率预估模型配置
+type ModelConfig struct {
+	File                  string // 模型文件（JSON），为空时不预估，只有按CPM出价的广告参与竞价
+	ReloadIntervalSeconds int    // 检查模型文件是否变化的间隔，0表示不自动重新加载
+}
+
+// BidShadingConfig 第一价格拍卖的出价折减配置
+type BidShadingConfig struct {
+	Enabled                bool
+	MinFactor              float64 // 折减后的出价不低于出价上限的这个比例
+	MinSamples             int     // 赢标概率曲线至少需要的出价次数
+	WindowDays             int     // 学习最近多少天的出价和赢标记录
+	RefreshIntervalSeconds int     // 重新拟合曲线的间隔，0表示只在启动时拟合
 }
 
 type LogConfig struct {
@@ -69,6 +166,21 @@ func LoadConfig() *Config {
 		RPC: RPCConfig{
 			UserServiceAddr:   getEnv("USER_SERVICE_ADDR", "localhost:50051"),
 			BudgetServiceAddr: getEnv("BUDGET_SERVICE_ADDR", "localhost:50052"),
+			BudgetLease: BudgetLeaseConfig{
+				Enabled:    getEnv("BUDGET_LEASE_ENABLED", "false") == "true",
+				NodeID:     getEnv("BUDGET_LEASE_NODE_ID", hostname()),
+				SliceSize:  getEnv("BUDGET_LEASE_SLICE", "100"),
+				TTLSeconds: getEnvInt("BUDGET_LEASE_TTL_SECONDS", 60),
+			},
+			BudgetPacing: BudgetPacingConfig{
+				Enabled:        getEnv("BUDGET_PACING_ENABLED", "true") == "true",
+				RefreshSeconds: getEnvInt("BUDGET_PACING_REFRESH_SECONDS", 5),
+			},
+			BehaviorSender: BehaviorSenderConfig{
+				BufferSize:      getEnvInt("BEHAVIOR_BUFFER_SIZE", 10000),
+				BatchSize:       getEnvInt("BEHAVIOR_BATCH_SIZE", 200),
+				FlushIntervalMs: getEnvInt("BEHAVIOR_FLUSH_INTERVAL_MS", 500),
+			},
 		},
 		Log: LogConfig{
 			Level:      getEnv("LOG_LEVEL", "info"),
@@ -78,6 +190,133 @@ func LoadConfig() *Config {
 			MaxAge:     7,   // 保留7天
 			Compress:   true,
 		},
+		Sync: SyncConfig{
+			CookieName:    getEnv("SYNC_COOKIE_NAME", "dsp_uid"),
+			CookieDomain:  getEnv("SYNC_COOKIE_DOMAIN", ""),
+			CookieMaxAge:  time.Duration(getEnvInt("SYNC_COOKIE_TTL_DAYS", 365)) * 24 * time.Hour,
+			CookieSecure:  getEnv("SYNC_COOKIE_SECURE", "true") == "true",
+			MappingTTL:    time.Duration(getEnvInt("SYNC_MAPPING_TTL_DAYS", 30)) * 24 * time.Hour,
+			RedirectHosts: getEnv("SYNC_REDIRECT_HOSTS", ""),
+		},
+		Privacy: PrivacyConfig{
+			TCFVendorID: getEnvInt("PRIVACY_TCF_VENDOR_ID", 0),
+		},
+		DataSegments: DataSegmentsConfig{
+			MappingFile: getEnv("DATA_SEGMENT_MAPPING_FILE", ""),
+		},
+		Geo: GeoConfig{
+			DatabaseFile:          getEnv("GEO_DB_FILE", ""),
+			Languages:             getEnv("GEO_LANGUAGES", "zh-CN,en"),
+			ReloadIntervalSeconds: getEnvInt("GEO_RELOAD_INTERVAL_SECONDS", 60),
+		},
+		UserAgent: UserAgentConfig{
+			RulesFile:             getEnv("UA_RULES_FILE", ""),
+			CacheSize:             getEnvInt("UA_CACHE_SIZE", 10000),
+			ReloadIntervalSeconds: getEnvInt("UA_RELOAD_INTERVAL_SECONDS", 60),
+		},
+		Campaigns: CampaignConfig{
+			File:                  getEnv("CAMPAIGN_FILE", ""),
+			DBDriver:              getEnv("CAMPAIGN_DB_DRIVER", "mysql"),
+			DBDSN:                 getEnv("CAMPAIGN_DB_DSN", ""),
+			VersionQuery:          getEnv("CAMPAIGN_DB_VERSION_QUERY", ""),
+			ReloadIntervalSeconds: getEnvInt("CAMPAIGN_RELOAD_INTERVAL_SECONDS", 30),
+		},
+		Model: ModelConfig{
+			File:                  getEnv("MODEL_FILE", ""),
+			ReloadIntervalSeconds: getEnvInt("MODEL_RELOAD_INTERVAL_SECONDS", 60),
+		},
+		BidShading: BidShadingConfig{
+			Enabled:                getEnv("BID_SHADING_ENABLED", "true") == "true",
+			MinFactor:              getEnvFloat("BID_SHADING_MIN_FACTOR", 0.5),
+			MinSamples:             getEnvInt("BID_SHADING_MIN_SAMPLES", 1000),
+			WindowDays:             getEnvInt("BID_SHADING_WINDOW_DAYS", 7),
+			RefreshIntervalSeconds: getEnvInt("BID_SHADING_REFRESH_INTERVAL_SECONDS", 300),
+		},
+	}
+}
+
+// BudgetServiceConfig 预算服务配置
+type BudgetServiceConfig struct {
+	Port         string
+	Store        string // memory, redis
+	Redis        RedisConfig
+	SeedTestData bool // 启动时写入测试数据（memory存储总是写入）
+	Alerts       BudgetAlertConfig
+}
+
+// BudgetAlertConfig 预算告警配置
+type BudgetAlertConfig struct {
+	Enabled    bool
+	Thresholds string // 逗号分隔的百分比，如"50,90,100"
+	WebhookURL string // 为空时不发送Webhook
+	MaxRetries int
+}
+
+// LoadBudgetServiceConfig 加载预算服务配置
+func LoadBudgetServiceConfig() *BudgetServiceConfig {
+	return &BudgetServiceConfig{
+		Port:  getEnv("BUDGET_SERVICE_PORT", "50052"),
+		Store: getEnv("BUDGET_STORE", "memory"),
+		Redis: RedisConfig{
+			Host:     getEnv("REDIS_HOST", "localhost"),
+			Port:     getEnv("REDIS_PORT", "6379"),
+			Password: getEnv("REDIS_PASSWORD", ""),
+			DB:       0,
+		},
+		SeedTestData: getEnv("BUDGET_SEED_TEST_DATA", "false") == "true",
+		Alerts: BudgetAlertConfig{
+			Enabled:    getEnv("BUDGET_ALERT_ENABLED", "true") == "true",
+			Thresholds: getEnv("BUDGET_ALERT_THRESHOLDS", "50,90,100"),
+			WebhookURL: getEnv("BUDGET_ALERT_WEBHOOK_URL", ""),
+			MaxRetries: getEnvInt("BUDGET_ALERT_MAX_RETRIES", 3),
+		},
+	}
+}
+
+// UserServiceConfig 用户服务配置
+type UserServiceConfig struct {
+	Port         string
+	Store        string // bolt, memory
+	DataPath     string // bolt数据文件路径
+	ProfileTTL   time.Duration
+	SeedTestData bool // 存储为空时写入测试数据
+	// AdCategoriesFile 广告类目映射（JSON），为空时使用内置的示例映射
+	AdCategoriesFile string
+	// 跨设备身份图：共现多少次后关联，以及单个身份簇的标识上限
+	IdentityLinkThreshold  int
+	IdentityMaxClusterSize int
+	// 删除和导出用户数据时需要处理DSP侧的缓存和竞价日志
+	Redis      RedisConfig
+	ClickHouse ClickHouseConfig
+}
+
+// LoadUserServiceConfig 加载用户服务配置
+func LoadUserServiceConfig() *UserServiceConfig {
+	return &UserServiceConfig{
+		Port:         getEnv("USER_SERVICE_PORT", "50051"),
+		Store:        getEnv("USER_STORE", "bolt"),
+		DataPath:     getEnv("USER_PROFILE_DB", "data/user_profiles.db"),
+		ProfileTTL:   time.Duration(getEnvInt("USER_PROFILE_TTL_DAYS", 90)) * 24 * time.Hour,
+		SeedTestData: getEnv("USER_SEED_TEST_DATA", "true") == "true",
+
+		AdCategoriesFile: getEnv("USER_AD_CATEGORIES_FILE", ""),
+
+		IdentityLinkThreshold:  getEnvInt("USER_IDENTITY_LINK_THRESHOLD", 3),
+		IdentityMaxClusterSize: getEnvInt("USER_IDENTITY_MAX_CLUSTER", 32),
+
+		Redis: RedisConfig{
+			Host:     getEnv("REDIS_HOST", "localhost"),
+			Port:     getEnv("REDIS_PORT", "6379"),
+			Password: getEnv("REDIS_PASSWORD", ""),
+			DB:       0,
+		},
+		ClickHouse: ClickHouseConfig{
+			Host:     getEnv("CLICKHOUSE_HOST", "localhost"),
+			Port:     getEnv("CLICKHOUSE_PORT", "9000"),
+			Database: getEnv("CLICKHOUSE_DB", "dsp_logs"),
+			Username: getEnv("CLICKHOUSE_USER", "default"),
+			Password: getEnv("CLICKHOUSE_PASS", ""),
+		},
 	}
 }
 
@@ -89,3 +328,39 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Using default value for %s: %d", key, defaultValue)
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %s, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		log.Printf("Using default value for %s: %g", key, defaultValue)
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Invalid value for %s: %s, using default %g", key, value, defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "dsp-node"
+	}
+	return name
+}
@@ -0,0 +1,131 @@
+package frequency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 频次控制的级别
+const (
+	LevelCreative   = "creative"
+	LevelCampaign   = "campaign"
+	LevelAdvertiser = "advertiser"
+)
+
+// Scope 计数的对象
+type Scope struct {
+	Level string
+	ID    string
+}
+
+// String 级别:ID
+func (s Scope) String() string {
+	return s.Level + ":" + s.ID
+}
+
+// Cap 一个对象在一个窗口内的曝光上限
+type Cap struct {
+	Scope
+	Max    int
+	Window Window
+}
+
+// NewCap 创建频次上限，limit必须大于0
+func NewCap(level, id string, limit int, window string) (Cap, error) {
+	if limit <= 0 {
+		return Cap{}, fmt.Errorf("频次上限应大于0: %d", limit)
+	}
+	w, err := ParseWindow(window)
+	if err != nil {
+		return Cap{}, err
+	}
+	return Cap{Scope: Scope{Level: level, ID: id}, Max: limit, Window: w}, nil
+}
+
+// String 例如campaign:c1 3/day
+func (c Cap) String() string {
+	return fmt.Sprintf("%s %d/%s", c.Scope, c.Max, c.Window)
+}
+
+// Query 查询对象自Since以来的曝光次数
+type Query struct {
+	Scope Scope
+	Since time.Time
+}
+
+// Store 曝光计数的存储
+type Store interface {
+	// CountImpressions 查询用户在各对象上的曝光次数，结果与queries一一对应，应在一次往返中完成
+	CountImpressions(ctx context.Context, userID string, queries []Query) ([]int64, error)
+	// RecordImpression 在各对象上记录一次曝光，eventID相同的曝光只计一次；
+	// 记录至少保留retention中对应的时长
+	RecordImpression(ctx context.Context, userID, eventID string, at time.Time, retention map[Scope]time.Duration) error
+}
+
+// Limiter 频次控制
+type Limiter struct {
+	store Store
+}
+
+// NewLimiter 创建频次控制，store为nil时返回nil（不做频次控制）
+func NewLimiter(store Store) *Limiter {
+	if store == nil {
+		return nil
+	}
+	return &Limiter{store: store}
+}
+
+// Exceeded 返回caps中用户在now时已达到上限的部分
+// 相同对象和窗口的上限只查询一次，全部查询在一次存储往返中完成
+func (l *Limiter) Exceeded(ctx context.Context, userID string, caps []Cap, now time.Time) (map[Cap]bool, error) {
+	if l == nil || len(caps) == 0 {
+		return nil, nil
+	}
+
+	type key struct {
+		scope  Scope
+		window Window
+	}
+	positions := make(map[key]int)
+	var queries []Query
+	for _, c := range caps {
+		k := key{c.Scope, c.Window}
+		if _, ok := positions[k]; !ok {
+			positions[k] = len(queries)
+			queries = append(queries, Query{Scope: c.Scope, Since: c.Window.Start(now)})
+		}
+	}
+
+	counts, err := l.store.CountImpressions(ctx, userID, queries)
+	if err != nil {
+		return nil, fmt.Errorf("查询曝光次数失败: %w", err)
+	}
+	if len(counts) != len(queries) {
+		return nil, fmt.Errorf("曝光次数数量不符: %d != %d", len(counts), len(queries))
+	}
+
+	exceeded := make(map[Cap]bool)
+	for _, c := range caps {
+		if counts[positions[key{c.Scope, c.Window}]] >= int64(c.Max) {
+			exceeded[c] = true
+		}
+	}
+	return exceeded, nil
+}
+
+// Record 记录用户的一次曝光，计入caps涉及的全部对象
+// eventID用于去重，曝光监测重复触发时只计一次
+func (l *Limiter) Record(ctx context.Context, userID, eventID string, caps []Cap, at time.Time) error {
+	if l == nil || len(caps) == 0 {
+		return nil
+	}
+	retention := make(map[Scope]time.Duration)
+	for _, c := range caps {
+		retention[c.Scope] = max(retention[c.Scope], c.Window.Span())
+	}
+	if err := l.store.RecordImpression(ctx, userID, eventID, at, retention); err != nil {
+		return fmt.Errorf("记录曝光失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package frequency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseWindow(t *testing.T) {
+	valid := map[string]string{
+		"day":   "day",
+		" Week": "week",
+		"24h":   "1d",
+		"7d":    "7d",
+		"90m":   "1h30m0s",
+		"31d":   "31d",
+	}
+	for input, want := range valid {
+		w, err := ParseWindow(input)
+		if err != nil {
+			t.Errorf("%q应为有效窗口: %v", input, err)
+			continue
+		}
+		if w.String() != want {
+			t.Errorf("%q应为%s，实际为%s", input, want, w)
+		}
+	}
+
+	for _, input := range []string{"", "year", "0h", "-1h", "32d", "xd", "3"} {
+		if _, err := ParseWindow(input); err == nil {
+			t.Errorf("%q应为无效窗口", input)
+		}
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2026, 10, 18, 15, 42, 7, 0, loc) // 周日
+
+	tests := []struct {
+		window string
+		want   time.Time
+	}{
+		{"hour", time.Date(2026, 10, 18, 15, 0, 0, 0, loc)},
+		{"day", time.Date(2026, 10, 18, 0, 0, 0, 0, loc)},
+		{"week", time.Date(2026, 10, 12, 0, 0, 0, 0, loc)},
+		{"month", time.Date(2026, 10, 1, 0, 0, 0, 0, loc)},
+		{"24h", now.Add(-24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		w, _ := ParseWindow(tt.window)
+		if got := w.Start(now); !got.Equal(tt.want) {
+			t.Errorf("%s窗口起点应为%s，实际为%s", tt.window, tt.want, got)
+		}
+		if start := w.Start(now); now.Sub(start) > w.Span() {
+			t.Errorf("%s窗口的保留时间%s不足以覆盖起点%s", tt.window, w.Span(), start)
+		}
+	}
+
+	// 周一当天是一周的开始
+	monday := time.Date(2026, 10, 19, 8, 0, 0, 0, loc)
+	if w, _ := ParseWindow("week"); !w.Start(monday).Equal(time.Date(2026, 10, 19, 0, 0, 0, 0, loc)) {
+		t.Errorf("周一的周窗口起点不正确: %s", w.Start(monday))
+	}
+}
+
+// fakeStore 内存中的曝光记录，记录查询次数
+type fakeStore struct {
+	impressions map[Scope][]time.Time
+	retention   map[Scope]time.Duration
+	calls       int
+	err         error
+}
+
+func (s *fakeStore) CountImpressions(ctx context.Context, userID string, queries []Query) ([]int64, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	counts := make([]int64, len(queries))
+	for i, q := range queries {
+		for _, at := range s.impressions[q.Scope] {
+			if !at.Before(q.Since) {
+				counts[i]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (s *fakeStore) RecordImpression(ctx context.Context, userID, eventID string, at time.Time, retention map[Scope]time.Duration) error {
+	for scope := range retention {
+		s.impressions[scope] = append(s.impressions[scope], at)
+	}
+	s.retention = retention
+	return nil
+}
+
+func TestLimiter(t *testing.T) {
+	store := &fakeStore{impressions: make(map[Scope][]time.Time)}
+	limiter := NewLimiter(store)
+	ctx := context.Background()
+	now := time.Now()
+
+	campaignDay, _ := NewCap(LevelCampaign, "c1", 2, "24h")
+	campaignWeek, _ := NewCap(LevelCampaign, "c1", 3, "7d")
+	advertiser, _ := NewCap(LevelAdvertiser, "adv1", 5, "7d")
+	creative, _ := NewCap(LevelCreative, "cr1", 1, "1h")
+
+	// 两次曝光：两天前和刚才
+	limiter.Record(ctx, "u1", "bid_1", []Cap{campaignDay, campaignWeek, advertiser}, now.Add(-48*time.Hour))
+	limiter.Record(ctx, "u1", "bid_2", []Cap{campaignDay, campaignWeek, advertiser}, now)
+	if store.retention[campaignDay.Scope] != 7*24*time.Hour || store.retention[advertiser.Scope] != 7*24*time.Hour {
+		t.Errorf("保留时间应为对象最长的窗口: %v", store.retention)
+	}
+
+	// 多个广告共用的上限只查询一次
+	caps := []Cap{campaignDay, campaignWeek, advertiser, creative, campaignDay, advertiser}
+	exceeded, err := limiter.Exceeded(ctx, "u1", caps, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.calls != 1 {
+		t.Errorf("应只查询一次存储，实际为%d次", store.calls)
+	}
+	if exceeded[campaignDay] || exceeded[campaignWeek] || exceeded[advertiser] || exceeded[creative] {
+		t.Errorf("未达到上限: %v", exceeded)
+	}
+
+	limiter.Record(ctx, "u1", "bid_3", []Cap{campaignDay, campaignWeek, advertiser}, now)
+	exceeded, _ = limiter.Exceeded(ctx, "u1", caps, now)
+	if !exceeded[campaignDay] || !exceeded[campaignWeek] || exceeded[advertiser] {
+		t.Errorf("活动应达到日和周上限，广告主未达到: %v", exceeded)
+	}
+
+	store.err = errors.New("连接断开")
+	if _, err := limiter.Exceeded(ctx, "u1", caps, now); err == nil {
+		t.Error("存储失败时应返回错误")
+	}
+
+	var disabled *Limiter
+	if exceeded, err := disabled.Exceeded(ctx, "u1", caps, now); err != nil || len(exceeded) != 0 {
+		t.Error("未启用频次控制时不应有广告达到上限")
+	}
+	if _, err := NewCap(LevelCampaign, "c1", 0, "day"); err == nil {
+		t.Error("上限为0应返回错误")
+	}
+}
@@ -0,0 +1,107 @@
+// Package frequency 按用户曝光次数的频次控制
+// 上限可以设在创意、活动和广告主上，窗口为自然小时、天、周、月或滚动时长；
+// 曝光在曝光监测回调时计数，竞价时一次查询请求涉及的全部计数
+package frequency
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxWindow 滚动窗口的最大长度，也是曝光记录的最长保留时间
+const MaxWindow = 31 * 24 * time.Hour
+
+// 自然窗口
+const (
+	WindowHour  = "hour"
+	WindowDay   = "day"
+	WindowWeek  = "week" // 周一开始
+	WindowMonth = "month"
+)
+
+// Window 频次控制的时间窗口
+// 自然窗口按服务器时区对齐，例如day从当天0点开始；滚动窗口为当前时间之前的固定时长
+type Window struct {
+	calendar string        // 自然窗口，滚动窗口为空
+	duration time.Duration // 滚动窗口长度
+}
+
+// ParseWindow 解析窗口：hour、day、week、month为自然窗口，
+// 30m、24h、7d等时长为滚动窗口（d表示24小时），不超过MaxWindow
+func ParseWindow(s string) (Window, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case WindowHour, WindowDay, WindowWeek, WindowMonth:
+		return Window{calendar: s}, nil
+	case "":
+		return Window{}, fmt.Errorf("窗口不能为空")
+	}
+
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return Window{}, fmt.Errorf("无效的窗口: %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return Window{}, fmt.Errorf("无效的窗口: %q", s)
+		}
+	}
+	if d <= 0 || d > MaxWindow {
+		return Window{}, fmt.Errorf("滚动窗口应在0到%s之间: %q", MaxWindow, s)
+	}
+	return Window{duration: d}, nil
+}
+
+// Rolling 是否为滚动窗口
+func (w Window) Rolling() bool {
+	return w.calendar == ""
+}
+
+// Start 窗口在now时的起点，自然窗口按now的时区对齐
+func (w Window) Start(now time.Time) time.Time {
+	y, m, d := now.Date()
+	switch w.calendar {
+	case WindowHour:
+		return time.Date(y, m, d, now.Hour(), 0, 0, 0, now.Location())
+	case WindowDay:
+		return time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	case WindowWeek:
+		offset := (int(now.Weekday()) + 6) % 7 // 距周一的天数
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, now.Location())
+	case WindowMonth:
+		return time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	}
+	return now.Add(-w.duration)
+}
+
+// Span 窗口可能覆盖的最长时间，决定曝光记录需要保留多久
+func (w Window) Span() time.Duration {
+	switch w.calendar {
+	case WindowHour:
+		return time.Hour
+	case WindowDay:
+		return 25 * time.Hour // 夏令时切换日
+	case WindowWeek:
+		return 7*24*time.Hour + time.Hour
+	case WindowMonth:
+		return MaxWindow
+	}
+	return w.duration
+}
+
+// String 窗口的文本形式，与ParseWindow的输入一致
+func (w Window) String() string {
+	if !w.Rolling() {
+		return w.calendar
+	}
+	if w.duration%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", w.duration/(24*time.Hour))
+	}
+	return w.duration.String()
+}
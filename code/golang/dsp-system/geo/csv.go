@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// ipRange 一个地址区间（含两端）
+type ipRange struct {
+	start, end netip.Addr
+	loc        Location
+}
+
+// CSVDatabase CSV区间格式的地理位置库
+// 每行 start_ip,end_ip,country,region,city,zip；国家可以是二位或三位代码，
+// 可以有表头，#开头的行为注释。IPv4和IPv6区间可以写在同一个文件里，区间不能重叠
+type CSVDatabase struct {
+	ranges []ipRange // 按起始地址排序
+}
+
+// OpenCSV 加载CSV区间库
+func OpenCSV(path string) (*CSVDatabase, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCSV(f)
+}
+
+// ParseCSV 解析CSV区间库
+func ParseCSV(r io.Reader) (*CSVDatabase, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	db := &CSVDatabase{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("第%d行字段不足", line)
+		}
+
+		start, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			if line == 1 {
+				continue // 表头
+			}
+			return nil, fmt.Errorf("第%d行起始地址无效: %w", line, err)
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行结束地址无效: %w", line, err)
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("第%d行地址区间无效: %s - %s", line, start, end)
+		}
+
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		loc := Location{Country: countryCode(field(2)), Region: field(3), City: field(4), ZIP: field(5)}
+		if loc.Country == "" {
+			return nil, fmt.Errorf("第%d行国家代码无效: %s", line, field(2))
+		}
+		db.ranges = append(db.ranges, ipRange{start: start, end: end, loc: loc})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool { return db.ranges[i].start.Less(db.ranges[j].start) })
+	for i := 1; i < len(db.ranges); i++ {
+		if prev := db.ranges[i-1]; !prev.end.Less(db.ranges[i].start) {
+			return nil, fmt.Errorf("地址区间重叠: %s - %s 与 %s", prev.start, prev.end, db.ranges[i].start)
+		}
+	}
+	return db, nil
+}
+
+// Lookup 二分查找地址所在区间
+func (d *CSVDatabase) Lookup(addr netip.Addr) (Location, bool) {
+	i := sort.Search(len(d.ranges), func(i int) bool { return addr.Less(d.ranges[i].start) })
+	if i == 0 {
+		return Location{}, false
+	}
+	if r := d.ranges[i-1]; !r.end.Less(addr) {
+		return r.loc, true
+	}
+	return Location{}, false
+}
+
+// Close 无需释放资源
+func (d *CSVDatabase) Close() error {
+	return nil
+}
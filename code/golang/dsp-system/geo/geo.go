@@ -0,0 +1,215 @@
+// Package geo 根据IP地址查询地理位置，补全竞价请求中缺失的geo字段
+package geo
+
+import (
+	"dsp-system/api"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LocationTypeIP OpenRTB geo.type：根据IP地址推断的位置
+const LocationTypeIP = 2
+
+// Location IP对应的地理位置，字段取值与OpenRTB一致
+type Location struct {
+	Country string // ISO 3166-1 三位国家代码
+	Region  string // ISO 3166-2 地区代码（不含国家前缀）
+	City    string
+	ZIP     string
+}
+
+// Database IP地理位置库
+type Database interface {
+	Lookup(addr netip.Addr) (Location, bool)
+	Close() error
+}
+
+// Open 打开地理位置库，按扩展名选择格式：.mmdb为MaxMind格式，其他按CSV区间格式解析
+// languages为城市名称的语言优先级（仅MaxMind格式使用）
+func Open(path string, languages []string) (Database, error) {
+	if strings.EqualFold(filepath.Ext(path), ".mmdb") {
+		return OpenMMDB(path, languages)
+	}
+	return OpenCSV(path)
+}
+
+// Resolver 地理位置查询，数据库文件变化后自动重新加载
+// 查询不加锁：重新加载时先打开新库再原子替换，旧库在替换后关闭
+type Resolver struct {
+	path      string
+	languages []string
+	db        atomic.Pointer[dbHolder]
+
+	mu      sync.Mutex // 串行化重新加载
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// dbHolder 包装接口值以便原子替换
+type dbHolder struct {
+	db Database
+}
+
+// NewResolver 加载地理位置库，reloadInterval大于0时按该间隔检查文件是否变化
+func NewResolver(path string, languages []string, reloadInterval time.Duration) (*Resolver, error) {
+	r := &Resolver{
+		path:      path,
+		languages: languages,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if reloadInterval > 0 {
+		go r.watch(reloadInterval)
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// Reload 文件有变化时重新加载，返回是否加载了新库；加载失败时继续使用旧库
+func (r *Resolver) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return false, err
+	}
+	if r.db.Load() != nil && info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false, nil
+	}
+
+	db, err := Open(r.path, r.languages)
+	if err != nil {
+		return false, fmt.Errorf("加载地理位置库失败: %w", err)
+	}
+	if old := r.db.Swap(&dbHolder{db: db}); old != nil {
+		old.db.Close()
+	}
+	r.modTime = info.ModTime()
+	r.size = info.Size()
+
+	log.Printf("地理位置库已加载: %s", r.path)
+	return true, nil
+}
+
+// watch 定期检查数据库文件
+func (r *Resolver) watch(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		// 文件可能正在写入，失败后下次检查再试
+		if _, err := r.Reload(); err != nil {
+			log.Printf("重新加载地理位置库失败（继续使用旧库）: %v", err)
+		}
+	}
+}
+
+// Close 停止检查并关闭数据库
+func (r *Resolver) Close() error {
+	if r == nil {
+		return nil
+	}
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+
+	if holder := r.db.Swap(nil); holder != nil {
+		return holder.db.Close()
+	}
+	return nil
+}
+
+// Lookup 查询IP地址（IPv4或IPv6字符串）的地理位置
+func (r *Resolver) Lookup(ip string) (Location, bool) {
+	if r == nil {
+		return Location{}, false
+	}
+	holder := r.db.Load()
+	if holder == nil {
+		return Location{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	return holder.db.Lookup(addr.Unmap())
+}
+
+// Enrich 根据设备IP补全请求中缺失的地理位置字段
+// 请求已带国家且与IP查询结果不一致时不补全，避免拼出互相矛盾的位置；
+// coarse为true时（不允许使用个人数据）只补全国家和地区
+func (r *Resolver) Enrich(req *api.BidRequest, coarse bool) {
+	if r == nil || req.Device == nil {
+		return
+	}
+	device := req.Device
+	geo := device.Geo
+	if geo != nil && geo.Country != "" && geo.Region != "" && (coarse || geo.City != "" && geo.ZIP != "") {
+		return
+	}
+
+	ip := device.IP
+	if ip == "" {
+		ip = device.IPv6
+	}
+	loc, ok := r.Lookup(ip)
+	if !ok {
+		return
+	}
+
+	if geo == nil {
+		geo = &api.Geo{Type: LocationTypeIP}
+		device.Geo = geo
+	}
+	if geo.Country != "" && !strings.EqualFold(geo.Country, loc.Country) {
+		return
+	}
+	fill(&geo.Country, loc.Country)
+	fill(&geo.Region, loc.Region)
+	if !coarse {
+		fill(&geo.City, loc.City)
+		fill(&geo.ZIP, loc.ZIP)
+	}
+}
+
+// fill 字段为空时填入
+func fill(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// countryCode 统一为三位国家代码，无法识别的二位代码返回空
+func countryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) == 2 {
+		return alpha3[code]
+	}
+	return code
+}
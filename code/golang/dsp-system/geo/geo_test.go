@@ -0,0 +1,285 @@
+package geo_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/geo"
+)
+
+// mmdbWriter 构造只含少量网段的MaxMind格式库（IPv6树，24位记录）
+type mmdbWriter struct {
+	nodes [][2]int // 0为空，正数为子节点，负数为-(数据偏移+1)
+	data  bytes.Buffer
+}
+
+func (w *mmdbWriter) insert(prefix netip.Prefix, record map[string]any) {
+	offset := w.data.Len()
+	encodeMMDB(&w.data, record)
+
+	addr := prefix.Addr()
+	bits := prefix.Bits()
+	if addr.Is4() {
+		// IPv4网段位于IPv6树的::a.b.c.d/96+n
+		b := addr.As16()
+		b[10], b[11] = 0, 0
+		addr = netip.AddrFrom16(b)
+		bits += 96
+	}
+	ip := addr.As16()
+
+	if len(w.nodes) == 0 {
+		w.nodes = append(w.nodes, [2]int{})
+	}
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			w.nodes[node][bit] = -(offset + 1)
+			break
+		}
+		if w.nodes[node][bit] <= 0 {
+			w.nodes = append(w.nodes, [2]int{})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit]
+	}
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	var out bytes.Buffer
+	count := len(w.nodes)
+	for _, node := range w.nodes {
+		for _, r := range node {
+			v := count
+			if r > 0 {
+				v = r
+			} else if r < 0 {
+				v = count + 16 - r - 1
+			}
+			out.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(w.data.Bytes())
+	out.WriteString("\xab\xcd\xefMaxMind.com")
+	encodeMMDB(&out, map[string]any{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(6),
+		"database_type":               "Test-City",
+		"languages":                   []any{"en", "zh-CN"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"description":                 map[string]any{"en": "test"},
+	})
+	return out.Bytes()
+}
+
+// encodeMMDB 按MaxMind数据段格式编码（只支持测试用到的类型）
+func encodeMMDB(buf *bytes.Buffer, v any) {
+	control := func(typ, size int) {
+		if typ <= 7 {
+			buf.WriteByte(byte(typ<<5 | size))
+		} else {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(byte(typ - 7))
+		}
+	}
+	writeUint := func(typ int, n uint64) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		trimmed := bytes.TrimLeft(b[:], "\x00")
+		control(typ, len(trimmed))
+		buf.Write(trimmed)
+	}
+
+	switch v := v.(type) {
+	case string:
+		control(2, len(v))
+		buf.WriteString(v)
+	case uint16:
+		writeUint(5, uint64(v))
+	case uint32:
+		writeUint(6, uint64(v))
+	case uint64:
+		writeUint(9, v)
+	case []any:
+		control(11, len(v))
+		for _, item := range v {
+			encodeMMDB(buf, item)
+		}
+	case map[string]any:
+		control(7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDB(buf, k)
+			encodeMMDB(buf, v[k])
+		}
+	}
+}
+
+func cityRecord(country, region, en, zh, zip string) map[string]any {
+	return map[string]any{
+		"country":      map[string]any{"iso_code": country},
+		"subdivisions": []any{map[string]any{"iso_code": region}},
+		"city":         map[string]any{"names": map[string]any{"en": en, "zh-CN": zh}},
+		"postal":       map[string]any{"code": zip},
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMMDBLookup(t *testing.T) {
+	w := &mmdbWriter{}
+	w.insert(netip.MustParsePrefix("1.2.3.0/24"), cityRecord("CN", "BJ", "Beijing", "北京", "100000"))
+	w.insert(netip.MustParsePrefix("2001:db8::/32"), cityRecord("US", "CA", "San Jose", "", "95112"))
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeFile(t, path, w.bytes())
+
+	db, err := geo.Open(path, []string{"zh-CN"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tests := map[string]geo.Location{
+		"1.2.3.4":          {Country: "CHN", Region: "BJ", City: "北京", ZIP: "100000"},
+		"::ffff:1.2.3.200": {Country: "CHN", Region: "BJ", City: "北京", ZIP: "100000"},
+		"2001:db8:1::1":    {Country: "USA", Region: "CA", City: "San Jose", ZIP: "95112"},
+	}
+	for ip, want := range tests {
+		got, ok := db.Lookup(netip.MustParseAddr(ip).Unmap())
+		if !ok || got != want {
+			t.Errorf("%s: 期望%+v，实际为%+v(%v)", ip, want, got, ok)
+		}
+	}
+	for _, ip := range []string{"1.2.4.1", "2001:db9::1"} {
+		if _, ok := db.Lookup(netip.MustParseAddr(ip)); ok {
+			t.Errorf("%s不在库中", ip)
+		}
+	}
+}
+
+func TestCSVLookup(t *testing.T) {
+	db, err := geo.ParseCSV(strings.NewReader(`start_ip,end_ip,country,region,city,zip
+# 注释
+1.2.3.0,1.2.3.255,CN,BJ,北京,100000
+10.0.0.0,10.0.255.255,USA,CA,San Jose
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,DE,BE,Berlin,10115
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]geo.Location{
+		"1.2.3.0":       {Country: "CHN", Region: "BJ", City: "北京", ZIP: "100000"},
+		"1.2.3.255":     {Country: "CHN", Region: "BJ", City: "北京", ZIP: "100000"},
+		"10.0.8.8":      {Country: "USA", Region: "CA", City: "San Jose"},
+		"2001:db8:5::9": {Country: "DEU", Region: "BE", City: "Berlin", ZIP: "10115"},
+	}
+	for ip, want := range tests {
+		got, ok := db.Lookup(netip.MustParseAddr(ip))
+		if !ok || got != want {
+			t.Errorf("%s: 期望%+v，实际为%+v(%v)", ip, want, got, ok)
+		}
+	}
+	for _, ip := range []string{"1.2.4.0", "0.0.0.1", "9.255.255.255", "2001:db9::"} {
+		if _, ok := db.Lookup(netip.MustParseAddr(ip)); ok {
+			t.Errorf("%s不在库中", ip)
+		}
+	}
+
+	for _, bad := range []string{
+		"1.2.3.0,1.2.3.255,CN\n1.2.3.128,1.2.4.0,CN\n", // 重叠
+		"1.2.3.0,::1,CN\n",       // 地址族不一致
+		"1.2.3.9,1.2.3.0,CN\n",   // 结束小于起始
+		"1.2.3.0,1.2.3.255,ZZ\n", // 未知国家
+	} {
+		if _, err := geo.ParseCSV(strings.NewReader(bad)); err == nil {
+			t.Errorf("非法CSV应返回错误: %q", bad)
+		}
+	}
+}
+
+func TestResolverEnrichAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.csv")
+	writeFile(t, path, []byte("1.2.3.0,1.2.3.255,CN,BJ,北京,100000\n"))
+
+	r, err := geo.NewResolver(path, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// 没有geo时按IP补全并标记为IP推断
+	req := &api.BidRequest{Device: &api.Device{IP: "1.2.3.4"}}
+	r.Enrich(req, false)
+	if g := req.Device.Geo; g == nil || *g != (api.Geo{Type: geo.LocationTypeIP, Country: "CHN", Region: "BJ", City: "北京", ZIP: "100000"}) {
+		t.Errorf("应补全全部字段: %+v", g)
+	}
+
+	// 只补全缺失的字段，已有的值保留
+	req = &api.BidRequest{Device: &api.Device{IP: "1.2.3.4", Geo: &api.Geo{Country: "CHN", City: "朝阳", Lat: 39.9}}}
+	r.Enrich(req, false)
+	if g := req.Device.Geo; g.City != "朝阳" || g.Region != "BJ" || g.ZIP != "100000" || g.Lat != 39.9 {
+		t.Errorf("已有字段不应覆盖: %+v", g)
+	}
+
+	// 国家与IP查询结果不一致时不补全
+	req = &api.BidRequest{Device: &api.Device{IP: "1.2.3.4", Geo: &api.Geo{Country: "USA"}}}
+	r.Enrich(req, false)
+	if g := req.Device.Geo; g.City != "" || g.Region != "" {
+		t.Errorf("国家不一致时不应补全: %+v", g)
+	}
+
+	// 不允许使用个人数据时只补全国家和地区
+	req = &api.BidRequest{Device: &api.Device{IP: "1.2.3.4"}}
+	r.Enrich(req, true)
+	if g := req.Device.Geo; g.Country != "CHN" || g.Region != "BJ" || g.City != "" || g.ZIP != "" {
+		t.Errorf("粗粒度补全不正确: %+v", g)
+	}
+
+	// 库文件更新后重新加载
+	writeFile(t, path, []byte("1.2.3.0,1.2.3.255,CN,SH,上海,200000\n2001:db8::,2001:db8::ffff,JP,13,Tokyo\n"))
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if reloaded, err := r.Reload(); err != nil || !reloaded {
+		t.Fatalf("文件变化后应重新加载: %v, %v", reloaded, err)
+	}
+	if loc, _ := r.Lookup("1.2.3.4"); loc.City != "上海" {
+		t.Errorf("重新加载后应使用新库: %+v", loc)
+	}
+	req = &api.BidRequest{Device: &api.Device{IPv6: "2001:db8::1"}}
+	r.Enrich(req, false)
+	if g := req.Device.Geo; g == nil || g.Country != "JPN" {
+		t.Errorf("应使用IPv6地址补全: %+v", g)
+	}
+
+	// 新文件损坏时继续使用旧库
+	writeFile(t, path, []byte("garbage\nnot-an-ip,,\n"))
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+	if _, err := r.Reload(); err == nil {
+		t.Error("损坏的库文件应返回错误")
+	}
+	if loc, ok := r.Lookup("1.2.3.4"); !ok || loc.City != "上海" {
+		t.Errorf("加载失败时应保留旧库: %+v", loc)
+	}
+}
@@ -0,0 +1,81 @@
+package geo
+
+import (
+	"log"
+	"net/netip"
+	"os"
+	"slices"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdbRecord GeoIP2/GeoLite2 City库的记录中用到的字段
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+}
+
+// MMDB MaxMind格式的地理位置库
+// 整个文件读入内存而不是mmap：热加载替换后旧库由GC回收，正在进行的查询不会访问已解除映射的内存
+type MMDB struct {
+	reader    *maxminddb.Reader
+	languages []string
+}
+
+// OpenMMDB 打开MaxMind格式的库，languages为城市名称的语言优先级，都没有时取英文
+func OpenMMDB(path string, languages []string) (*MMDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("MaxMind地理位置库: Type=%s, IPVersion=%d, BuildEpoch=%d",
+		reader.Metadata.DatabaseType, reader.Metadata.IPVersion, reader.Metadata.BuildEpoch)
+
+	return &MMDB{
+		reader:    reader,
+		languages: append(slices.Clone(languages), "en"),
+	}, nil
+}
+
+// Lookup 查询地址
+func (m *MMDB) Lookup(addr netip.Addr) (Location, bool) {
+	var record mmdbRecord
+	_, ok, err := m.reader.LookupNetwork(addr.AsSlice(), &record)
+	if err != nil || !ok {
+		return Location{}, false
+	}
+
+	loc := Location{
+		Country: countryCode(record.Country.ISOCode),
+		ZIP:     record.Postal.Code,
+	}
+	if len(record.Subdivisions) > 0 {
+		loc.Region = record.Subdivisions[0].ISOCode
+	}
+	for _, lang := range m.languages {
+		if name := record.City.Names[lang]; name != "" {
+			loc.City = name
+			break
+		}
+	}
+	return loc, loc.Country != ""
+}
+
+// Close 库在内存中，由GC回收
+func (m *MMDB) Close() error {
+	return nil
+}
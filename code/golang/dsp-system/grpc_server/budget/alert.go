@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"dsp-system/money"
+)
+
+// 告警类型
+const (
+	AlertTypeThreshold = "threshold" // 消耗达到预算的某个百分比
+	AlertTypeOverspend = "overspend" // 消耗超过预算
+)
+
+// Alert 预算告警
+type Alert struct {
+	// ID 由层级、对象、阈值、周期和预算金额组成，同一告警重试投递时不变，接收方可据此去重
+	ID               string       `json:"id"`
+	Type             string       `json:"type"`
+	Level            string       `json:"level"`
+	CampaignID       string       `json:"campaign_id"`
+	AdvertiserID     string       `json:"advertiser_id"`
+	ThresholdPercent int          `json:"threshold_percent"`
+	Budget           money.Micros `json:"budget_micros"`
+	Spent            money.Micros `json:"spent_micros"`
+	Currency         string       `json:"currency"`
+	Day              string       `json:"day,omitempty"`
+	Timestamp        time.Time    `json:"timestamp"`
+	Message          string       `json:"message"`
+}
+
+// AlertConfig 告警配置
+type AlertConfig struct {
+	Thresholds   []int         // 阈值百分比
+	MaxRetries   int           // 投递失败后的最大重试次数
+	RetryBackoff time.Duration // 首次重试间隔，之后每次翻倍
+	QueueSize    int           // 每个通道的待投递队列长度，满了之后丢弃并记录日志
+	// DedupTTL 告警去重记录的保留时间；日预算告警的ID带日期，总预算告警的ID带预算金额，
+	// 调整预算后会重新告警
+	DedupTTL time.Duration
+}
+
+// DefaultAlertConfig 默认告警配置
+func DefaultAlertConfig() AlertConfig {
+	return AlertConfig{
+		Thresholds:   []int{50, 90, 100},
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+		QueueSize:    1024,
+		DedupTTL:     30 * 24 * time.Hour,
+	}
+}
+
+// AlertSink 告警投递通道
+type AlertSink interface {
+	Name() string
+	Send(ctx context.Context, alert Alert) error
+}
+
+// budgetUsage 某个预算层级的预算和消耗
+type budgetUsage struct {
+	level   string
+	subject string // 告警对象：广告主层级为广告主ID，其他为活动ID
+	budget  money.Micros
+	spent   money.Micros
+	day     string // 只有日预算有值
+}
+
+// usageOf 汇总活动相关的各层级消耗，预算为0的层级不参与告警
+func usageOf(budget *BudgetInfo, advertiser *AdvertiserBudget, day string) []budgetUsage {
+	var usages []budgetUsage
+	if advertiser != nil && advertiser.TotalBudget > 0 {
+		usages = append(usages, budgetUsage{
+			level:   LevelAdvertiserTotal,
+			subject: advertiser.AdvertiserID,
+			budget:  advertiser.TotalBudget,
+			spent:   advertiser.TotalBudget - advertiser.RemainingBudget,
+		})
+	}
+	if budget.TotalBudget > 0 {
+		usages = append(usages, budgetUsage{
+			level:   LevelCampaignTotal,
+			subject: budget.CampaignID,
+			budget:  budget.TotalBudget,
+			spent:   budget.TotalBudget - budget.RemainingBudget,
+		})
+	}
+	if budget.DailyBudget > 0 {
+		usages = append(usages, budgetUsage{
+			level:   LevelCampaignDaily,
+			subject: budget.CampaignID,
+			budget:  budget.DailyBudget,
+			spent:   budget.DailySpent,
+			day:     day,
+		})
+	}
+	return usages
+}
+
+// crossedThresholds 返回已达到的阈值（升序）
+func crossedThresholds(thresholds []int, u budgetUsage) []int {
+	var crossed []int
+	for _, t := range thresholds {
+		if int64(u.spent)*100 >= int64(u.budget)*int64(t) {
+			crossed = append(crossed, t)
+		}
+	}
+	sort.Ints(crossed)
+	return crossed
+}
+
+// alertID 生成告警ID（同时作为去重键）
+func alertID(u budgetUsage, kind string) string {
+	id := u.subject + ":" + u.level + ":" + kind + ":" + strconv.FormatInt(int64(u.budget), 10)
+	if u.day != "" {
+		id += ":" + u.day
+	}
+	return id
+}
+
+// AlertNotifier 预算告警
+// 余额变动后检查各层级的消耗比例，达到阈值或超支时生成告警，
+// 经存储去重（多个预算服务实例只会有一个发出）后投递到所有通道；
+// 所有通道都没有投递成功（队列已满或重试后仍失败）时撤销去重登记，下次检查重新发出
+type AlertNotifier struct {
+	store   BudgetStore
+	cfg     AlertConfig
+	workers []*sinkWorker
+	pending chan string // 待检查的活动ID
+	now     func() time.Time
+}
+
+// sinkWorker 单个通道的投递队列，慢通道不会拖累其他通道
+type sinkWorker struct {
+	sink  AlertSink
+	queue chan *alertDelivery
+}
+
+// alertDelivery 一条告警在各通道的投递结果
+type alertDelivery struct {
+	alert Alert
+
+	mu        sync.Mutex
+	pending   int  // 尚未结束投递的通道数
+	delivered bool // 至少一个通道投递成功
+}
+
+// NewAlertNotifier 创建告警
+func NewAlertNotifier(store BudgetStore, cfg AlertConfig, sinks ...AlertSink) *AlertNotifier {
+	n := &AlertNotifier{
+		store:   store,
+		cfg:     cfg,
+		pending: make(chan string, cfg.QueueSize),
+		now:     time.Now,
+	}
+	for _, sink := range sinks {
+		n.workers = append(n.workers, &sinkWorker{sink: sink, queue: make(chan *alertDelivery, cfg.QueueSize)})
+	}
+	return n
+}
+
+// Observe 登记一次余额变动，检查在后台进行，不阻塞调用方
+func (n *AlertNotifier) Observe(campaignID string) {
+	select {
+	case n.pending <- campaignID:
+	default:
+		log.Printf("告警检查队列已满，跳过: CampaignID=%s", campaignID)
+	}
+}
+
+// Run 处理待检查的活动并投递告警，直到ctx取消
+func (n *AlertNotifier) Run(ctx context.Context) {
+	for _, w := range n.workers {
+		go w.run(ctx, n.cfg, n.settle)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case campaignID := <-n.pending:
+			alerts, err := n.check(ctx, campaignID)
+			if err != nil {
+				log.Printf("告警检查失败: CampaignID=%s, err=%v", campaignID, err)
+				continue
+			}
+			for _, alert := range alerts {
+				n.dispatch(alert)
+			}
+		}
+	}
+}
+
+// check 检查活动相关的各层级，返回本实例需要发出的告警
+// 同一次变动跨过多个阈值时只发出最高的一个，较低的阈值同样标记为已发出
+func (n *AlertNotifier) check(ctx context.Context, campaignID string) ([]Alert, error) {
+	budget, err := n.store.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	var advertiser *AdvertiserBudget
+	if budget.AdvertiserID != "" {
+		if advertiser, err = n.store.GetAdvertiser(ctx, budget.AdvertiserID); err != nil && !errors.Is(err, ErrAdvertiserNotFound) {
+			return nil, err
+		}
+	}
+
+	now := n.now()
+	var alerts []Alert
+	for _, u := range usageOf(budget, advertiser, campaignDay(budget.Timezone, now)) {
+		newest := 0
+		for _, t := range crossedThresholds(n.cfg.Thresholds, u) {
+			claimed, err := n.store.ClaimAlert(ctx, alertID(u, strconv.Itoa(t)), n.cfg.DedupTTL)
+			if err != nil {
+				return nil, err
+			}
+			if claimed {
+				newest = t
+			}
+		}
+		if newest > 0 {
+			alerts = append(alerts, n.newAlert(u, budget, AlertTypeThreshold, newest, now))
+		}
+
+		if u.spent > u.budget {
+			claimed, err := n.store.ClaimAlert(ctx, alertID(u, AlertTypeOverspend), n.cfg.DedupTTL)
+			if err != nil {
+				return nil, err
+			}
+			if claimed {
+				alerts = append(alerts, n.newAlert(u, budget, AlertTypeOverspend, 0, now))
+			}
+		}
+	}
+
+	return alerts, nil
+}
+
+// newAlert 生成告警
+func (n *AlertNotifier) newAlert(u budgetUsage, budget *BudgetInfo, alertType string, threshold int, now time.Time) Alert {
+	kind := alertType
+	message := fmt.Sprintf("%s超支: 预算=%s, 已消耗=%s", levelName(u.level), u.budget, u.spent)
+	if alertType == AlertTypeThreshold {
+		kind = strconv.Itoa(threshold)
+		message = fmt.Sprintf("%s已消耗%d%%: 预算=%s, 已消耗=%s", levelName(u.level), threshold, u.budget, u.spent)
+	}
+
+	return Alert{
+		ID:               alertID(u, kind),
+		Type:             alertType,
+		Level:            u.level,
+		CampaignID:       budget.CampaignID,
+		AdvertiserID:     budget.AdvertiserID,
+		ThresholdPercent: threshold,
+		Budget:           u.budget,
+		Spent:            u.spent,
+		Currency:         budget.Currency,
+		Day:              u.day,
+		Timestamp:        now,
+		Message:          message,
+	}
+}
+
+// levelName 预算层级的中文名
+func levelName(level string) string {
+	switch level {
+	case LevelAdvertiserTotal:
+		return "广告主总预算"
+	case LevelCampaignDaily:
+		return "活动日预算"
+	default:
+		return "活动总预算"
+	}
+}
+
+// dispatch 把告警放入每个通道的队列
+func (n *AlertNotifier) dispatch(alert Alert) {
+	d := &alertDelivery{alert: alert, pending: len(n.workers)}
+	for _, w := range n.workers {
+		select {
+		case w.queue <- d:
+		default:
+			log.Printf("告警队列已满，丢弃: Sink=%s, AlertID=%s", w.sink.Name(), alert.ID)
+			n.settle(d, false)
+		}
+	}
+}
+
+// settle 登记一个通道的投递结果，所有通道都失败时撤销去重登记
+func (n *AlertNotifier) settle(d *alertDelivery, ok bool) {
+	d.mu.Lock()
+	d.pending--
+	d.delivered = d.delivered || ok
+	lost := d.pending == 0 && !d.delivered
+	d.mu.Unlock()
+	if !lost {
+		return
+	}
+
+	// 投递可能因服务关闭而失败，撤销登记不使用已取消的ctx
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := n.store.ReleaseAlert(ctx, d.alert.ID); err != nil {
+		log.Printf("撤销告警登记失败: AlertID=%s, err=%v", d.alert.ID, err)
+	}
+}
+
+// run 逐条投递告警，失败后按指数退避重试，投递结果交给settle
+func (w *sinkWorker) run(ctx context.Context, cfg AlertConfig, settle func(*alertDelivery, bool)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-w.queue:
+			err := deliver(ctx, w.sink, d.alert, cfg)
+			if err != nil {
+				log.Printf("告警投递失败: Sink=%s, AlertID=%s, err=%v", w.sink.Name(), d.alert.ID, err)
+			}
+			settle(d, err == nil)
+		}
+	}
+}
+
+// deliver 投递一条告警，最多重试cfg.MaxRetries次
+func deliver(ctx context.Context, sink AlertSink, alert Alert, cfg AlertConfig) error {
+	backoff := cfg.RetryBackoff
+	var err error
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if err = sink.Send(ctx, alert); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// LogSink 把告警写入服务日志
+type LogSink struct{}
+
+// Name 通道名称
+func (LogSink) Name() string { return "log" }
+
+// Send 记录告警
+func (LogSink) Send(ctx context.Context, alert Alert) error {
+	log.Printf("预算告警: ID=%s, CampaignID=%s, %s", alert.ID, alert.CampaignID, alert.Message)
+	return nil
+}
+
+// WebhookSink 以JSON POST告警到指定地址，非2xx响应视为失败
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink 创建Webhook通道
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name 通道名称
+func (w *WebhookSink) Name() string { return "webhook" }
+
+// Send 发送告警
+func (w *WebhookSink) Send(ctx context.Context, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// 重试时ID不变，接收方可用此头去重
+	req.Header.Set("Idempotency-Key", alert.ID)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回状态码%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// StreamSink 把告警广播给WatchAlerts的订阅者
+// 订阅者消费过慢时丢弃该订阅者的告警，不阻塞其他订阅者
+type StreamSink struct {
+	mu          sync.Mutex
+	nextID      int
+	subscribers map[int]*alertSubscriber
+}
+
+// alertSubscriber 一个告警订阅
+type alertSubscriber struct {
+	campaignID   string
+	advertiserID string
+	ch           chan Alert
+}
+
+// matches 告警是否符合订阅条件
+func (s *alertSubscriber) matches(alert Alert) bool {
+	if s.campaignID != "" && s.campaignID != alert.CampaignID {
+		return false
+	}
+	if s.advertiserID != "" && s.advertiserID != alert.AdvertiserID {
+		return false
+	}
+	return true
+}
+
+// NewStreamSink 创建流式通道
+func NewStreamSink() *StreamSink {
+	return &StreamSink{subscribers: make(map[int]*alertSubscriber)}
+}
+
+// Name 通道名称
+func (s *StreamSink) Name() string { return "stream" }
+
+// Send 广播告警
+func (s *StreamSink) Send(ctx context.Context, alert Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subscribers {
+		if !sub.matches(alert) {
+			continue
+		}
+		select {
+		case sub.ch <- alert:
+		default:
+			log.Printf("告警订阅者消费过慢，丢弃: AlertID=%s", alert.ID)
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅告警，筛选条件为空表示不限；返回的函数用于取消订阅
+func (s *StreamSink) Subscribe(campaignID, advertiserID string) (<-chan Alert, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	sub := &alertSubscriber{
+		campaignID:   campaignID,
+		advertiserID: advertiserID,
+		ch:           make(chan Alert, 64),
+	}
+	s.subscribers[id] = sub
+
+	return sub.ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
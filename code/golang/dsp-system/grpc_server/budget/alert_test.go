@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+)
+
+// flakySink 前几次发送失败的告警通道
+type flakySink struct {
+	failures int
+	sent     []Alert
+}
+
+func (f *flakySink) Name() string { return "flaky" }
+
+func (f *flakySink) Send(ctx context.Context, alert Alert) error {
+	if f.failures > 0 {
+		f.failures--
+		return errors.New("temporary failure")
+	}
+	f.sent = append(f.sent, alert)
+	return nil
+}
+
+func TestAlertThresholdsAndDedup(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *BudgetServer, store BudgetStore) {
+		ctx := context.Background()
+		n := NewAlertNotifier(store, DefaultAlertConfig())
+
+		// campaign_001 日预算1000，已消耗200
+		if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", AmountMicros: 300 * 1_000_000}); err != nil {
+			t.Fatal(err)
+		}
+		alerts, err := n.check(ctx, "campaign_001")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(alerts) != 1 || alerts[0].Level != LevelCampaignDaily || alerts[0].ThresholdPercent != 50 || alerts[0].Day == "" {
+			t.Fatalf("日消耗达到50%%时应告警: %+v", alerts)
+		}
+
+		if alerts, _ := n.check(ctx, "campaign_001"); len(alerts) != 0 {
+			t.Errorf("同一阈值不应重复告警: %+v", alerts)
+		}
+
+		// 一次跨过多个阈值只发出最高的
+		if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", AmountMicros: 500 * 1_000_000}); err != nil {
+			t.Fatal(err)
+		}
+		other := NewAlertNotifier(store, DefaultAlertConfig())
+		alerts, _ = other.check(ctx, "campaign_001")
+		if len(alerts) != 1 || alerts[0].ThresholdPercent != 100 {
+			t.Errorf("日预算用完时应只发出100%%告警: %+v", alerts)
+		}
+
+		// 共享存储的另一个实例不会再次发出
+		if alerts, _ := n.check(ctx, "campaign_001"); len(alerts) != 0 {
+			t.Errorf("其他实例已发出的告警不应重复: %+v", alerts)
+		}
+	})
+}
+
+func TestAlertReleasedWhenUndelivered(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *BudgetServer, store BudgetStore) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// campaign_001 日预算1000，已消耗200
+		if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", AmountMicros: 300 * 1_000_000}); err != nil {
+			t.Fatal(err)
+		}
+
+		// 队列已满被丢弃：撤销登记，下次检查重新发出
+		cfg := DefaultAlertConfig()
+		cfg.QueueSize = 0
+		n := NewAlertNotifier(store, cfg, &flakySink{})
+		alerts, err := n.check(ctx, "campaign_001")
+		if err != nil || len(alerts) != 1 {
+			t.Fatalf("日消耗达到50%%时应告警: %+v, %v", alerts, err)
+		}
+		n.dispatch(alerts[0])
+		if alerts, _ = n.check(ctx, "campaign_001"); len(alerts) != 1 || alerts[0].ThresholdPercent != 50 {
+			t.Fatalf("丢弃的告警应重新发出: %+v", alerts)
+		}
+
+		// 只要有一个通道投递成功就保留登记
+		d := &alertDelivery{alert: alerts[0], pending: 2}
+		n.settle(d, false)
+		n.settle(d, true)
+		if alerts, _ := n.check(ctx, "campaign_001"); len(alerts) != 0 {
+			t.Fatalf("已投递的告警不应重复: %+v", alerts)
+		}
+
+		// 重试后仍投递失败：撤销登记
+		cfg = DefaultAlertConfig()
+		cfg.MaxRetries, cfg.RetryBackoff = 1, time.Millisecond
+		sink := &flakySink{failures: 2}
+		n = NewAlertNotifier(store, cfg, sink)
+		go n.Run(ctx)
+		if err := store.ReleaseAlert(ctx, alerts[0].ID); err != nil {
+			t.Fatal(err)
+		}
+		alerts, _ = n.check(ctx, "campaign_001")
+		if len(alerts) != 1 {
+			t.Fatalf("撤销登记后应重新告警: %+v", alerts)
+		}
+		n.dispatch(alerts[0])
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if alerts, _ := n.check(ctx, "campaign_001"); len(alerts) == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("投递失败的告警应撤销登记")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func TestAlertOverspend(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+
+	// 日预算被下调到已消耗以下
+	if err := store.PutCampaign(ctx, BudgetInfo{
+		CampaignID:      "campaign_x",
+		Currency:        money.DefaultCurrency,
+		TotalBudget:     1000 * money.MicrosPerUnit,
+		RemainingBudget: 880 * money.MicrosPerUnit,
+		DailyBudget:     100 * money.MicrosPerUnit,
+		DailySpent:      120 * money.MicrosPerUnit,
+		Status:          "active",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := NewAlertNotifier(store, DefaultAlertConfig()).check(ctx, "campaign_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || alerts[0].ThresholdPercent != 100 || alerts[1].Type != AlertTypeOverspend || alerts[1].Spent != 120*money.MicrosPerUnit {
+		t.Errorf("超支时应同时发出100%%和超支告警: %+v", alerts)
+	}
+}
+
+func TestAlertDeliveryRetries(t *testing.T) {
+	cfg := DefaultAlertConfig()
+	cfg.RetryBackoff = time.Millisecond
+
+	sink := &flakySink{failures: 2}
+	if err := deliver(context.Background(), sink, Alert{ID: "a"}, cfg); err != nil || len(sink.sent) != 1 {
+		t.Errorf("重试后应投递成功: %v, %+v", err, sink.sent)
+	}
+
+	sink = &flakySink{failures: 10}
+	if err := deliver(context.Background(), sink, Alert{ID: "a"}, cfg); err == nil {
+		t.Error("超过重试次数后应返回错误")
+	}
+	if sink.failures != 10-(cfg.MaxRetries+1) {
+		t.Errorf("应尝试%d次，剩余失败次数为%d", cfg.MaxRetries+1, sink.failures)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received Alert
+	var key string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key = r.Header.Get("Idempotency-Key")
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewWebhookSink(server.URL, time.Second)
+	alert := Alert{ID: "campaign_001:campaign_daily:90", Type: AlertTypeThreshold, ThresholdPercent: 90, Spent: 900 * money.MicrosPerUnit}
+	if err := sink.Send(context.Background(), alert); err != nil {
+		t.Fatal(err)
+	}
+	if key != alert.ID || received.ID != alert.ID || received.Spent != alert.Spent {
+		t.Errorf("Webhook内容不正确: key=%s, body=%+v", key, received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Send(context.Background(), alert); err == nil {
+		t.Error("非2xx响应应视为失败")
+	}
+}
+
+func TestAlertStreamAfterDeduct(t *testing.T) {
+	s, store := newTestServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := NewStreamSink()
+	notifier := NewAlertNotifier(store, DefaultAlertConfig(), stream)
+	s.EnableAlerts(notifier, stream)
+	go notifier.Run(ctx)
+
+	alerts, unsubscribe := stream.Subscribe("campaign_002", "")
+	defer unsubscribe()
+	others, unsubscribeOthers := stream.Subscribe("campaign_001", "")
+	defer unsubscribeOthers()
+
+	// campaign_002 日预算500，已消耗150
+	if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_002", AmountMicros: 200 * 1_000_000}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case alert := <-alerts:
+		if alert.CampaignID != "campaign_002" || alert.ThresholdPercent != 50 {
+			t.Errorf("告警内容不正确: %+v", alert)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到告警")
+	}
+
+	select {
+	case alert := <-others:
+		t.Errorf("不应收到其他活动的告警: %+v", alert)
+	default:
+	}
+}
@@ -0,0 +1,774 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dsp-system/config"
+	"dsp-system/money"
+	pb "dsp-system/proto"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+)
+
+// BudgetServer 预算服务实现
+type BudgetServer struct {
+	pb.UnimplementedBudgetServiceServer
+
+	// 预算存储（内存或Redis），校验扣减的原子性由存储保证
+	store BudgetStore
+
+	leaseConfig LeaseConfig
+
+	// 预算告警（可选），余额扣减后登记检查
+	alerts      *AlertNotifier
+	alertStream *StreamSink
+}
+
+// BudgetInfo 预算信息
+type BudgetInfo struct {
+	CampaignID      string
+	AdvertiserID    string
+	Currency        string
+	TotalBudget     money.Micros
+	RemainingBudget money.Micros
+	DailyBudget     money.Micros
+	DailySpent      money.Micros
+	Status          string
+
+	// Timezone 活动时区（IANA名称），日消耗在该时区的午夜清零，为空时为UTC；与DSP广告库中活动的timezone一致
+	Timezone string
+	// DailyDay DailySpent所属的活动当地日期（YYYY-MM-DD）
+	DailyDay string
+
+	// 租约计数：未结算租约的发放额度之和，以及已结算租约上报的消耗之和
+	LeaseOutstanding money.Micros
+	LeaseSpent       money.Micros
+}
+
+// NewBudgetServer 创建预算服务
+func NewBudgetServer(store BudgetStore) *BudgetServer {
+	return &BudgetServer{
+		store:       store,
+		leaseConfig: DefaultLeaseConfig(),
+	}
+}
+
+// initTestData 初始化测试数据
+// 测试数据已写入过（使用Redis存储时服务重启）时跳过，不覆盖各层级已有的余额
+func initTestData(ctx context.Context, store BudgetStore) error {
+	if _, err := store.GetCampaign(ctx, "campaign_001"); err == nil {
+		log.Printf("测试预算已存在，跳过初始化")
+		return nil
+	} else if !errors.Is(err, ErrCampaignNotFound) {
+		return err
+	}
+
+	testAdvertisers := []AdvertiserBudget{
+		{AdvertiserID: "adv_001", TotalBudget: 30000 * money.MicrosPerUnit, RemainingBudget: 25000 * money.MicrosPerUnit, Status: "active"},
+		{AdvertiserID: "adv_002", TotalBudget: 5000 * money.MicrosPerUnit, RemainingBudget: 3200 * money.MicrosPerUnit, Status: "active"},
+	}
+	for _, advertiser := range testAdvertisers {
+		if err := store.PutAdvertiser(ctx, advertiser); err != nil {
+			return err
+		}
+	}
+
+	testLineItems := []LineItemBudget{
+		{LineItemID: "li_001_a", CampaignID: "campaign_001", TotalBudget: 6000 * money.MicrosPerUnit, RemainingBudget: 5000 * money.MicrosPerUnit, Status: "active"},
+		{LineItemID: "li_001_b", CampaignID: "campaign_001", TotalBudget: 4000 * money.MicrosPerUnit, RemainingBudget: 3500 * money.MicrosPerUnit, Status: "active"},
+		{LineItemID: "li_002_a", CampaignID: "campaign_002", TotalBudget: 5000 * money.MicrosPerUnit, RemainingBudget: 3200 * money.MicrosPerUnit, Status: "active"},
+		{LineItemID: "li_003_a", CampaignID: "campaign_003", TotalBudget: 20000 * money.MicrosPerUnit, RemainingBudget: 18500 * money.MicrosPerUnit, Status: "active"},
+	}
+	for _, lineItem := range testLineItems {
+		if err := store.PutLineItem(ctx, lineItem); err != nil {
+			return err
+		}
+	}
+
+	testCampaigns := []BudgetInfo{
+		{
+			CampaignID:      "campaign_001",
+			AdvertiserID:    "adv_001",
+			Currency:        money.DefaultCurrency,
+			TotalBudget:     10000 * money.MicrosPerUnit,
+			RemainingBudget: 8500 * money.MicrosPerUnit,
+			DailyBudget:     1000 * money.MicrosPerUnit,
+			DailySpent:      200 * money.MicrosPerUnit,
+			Status:          "active",
+		},
+		{
+			CampaignID:      "campaign_002",
+			AdvertiserID:    "adv_002",
+			Currency:        money.DefaultCurrency,
+			TotalBudget:     5000 * money.MicrosPerUnit,
+			RemainingBudget: 3200 * money.MicrosPerUnit,
+			DailyBudget:     500 * money.MicrosPerUnit,
+			DailySpent:      150 * money.MicrosPerUnit,
+			Status:          "active",
+			Timezone:        "Asia/Shanghai",
+		},
+		{
+			CampaignID:      "campaign_003",
+			AdvertiserID:    "adv_001",
+			Currency:        money.DefaultCurrency,
+			TotalBudget:     20000 * money.MicrosPerUnit,
+			RemainingBudget: 18500 * money.MicrosPerUnit,
+			DailyBudget:     2000 * money.MicrosPerUnit,
+			DailySpent:      500 * money.MicrosPerUnit,
+			Status:          "active",
+		},
+	}
+	for _, campaign := range testCampaigns {
+		if err := store.PutCampaign(ctx, campaign); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("初始化测试预算: 广告主=%d, 活动=%d, 投放单元=%d",
+		len(testAdvertisers), len(testCampaigns), len(testLineItems))
+	return nil
+}
+
+// CheckBudget 检查预算
+func (s *BudgetServer) CheckBudget(ctx context.Context, req *pb.CheckBudgetRequest) (*pb.CheckBudgetResponse, error) {
+	amount := money.Micros(req.AmountMicros)
+	log.Printf("检查预算: CampaignID=%s, LineItemID=%s, Amount=%s %s", req.CampaignId, req.LineItemId, amount, req.Currency)
+
+	budget, err := s.store.GetCampaign(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return &pb.CheckBudgetResponse{
+			HasBudget:    false,
+			Message:      blockMessage(LevelCampaignTotal, statusMissing),
+			BlockedLevel: LevelCampaignTotal,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message := validateAmount(budget, amount, req.Currency); message != "" {
+		return &pb.CheckBudgetResponse{
+			HasBudget:       false,
+			RemainingMicros: int64(budget.RemainingBudget),
+			Currency:        budget.Currency,
+			Message:         message,
+		}, nil
+	}
+
+	// 依次检查广告主总预算、活动总预算、活动日预算和投放单元预算
+	result, err := s.store.Check(ctx, Mutation{
+		CampaignID: req.CampaignId,
+		LineItemID: req.LineItemId,
+		Amount:     amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.CheckBudgetResponse{
+		HasBudget:       result.OK,
+		RemainingMicros: int64(result.Remaining),
+		Currency:        budget.Currency,
+		Message:         result.Message,
+		BlockedLevel:    result.BlockedLevel,
+	}, nil
+}
+
+// DeductBudget 扣减预算
+func (s *BudgetServer) DeductBudget(ctx context.Context, req *pb.DeductBudgetRequest) (*pb.DeductBudgetResponse, error) {
+	amount := money.Micros(req.AmountMicros)
+	log.Printf("扣减预算: CampaignID=%s, LineItemID=%s, Amount=%s %s, BidID=%s",
+		req.CampaignId, req.LineItemId, amount, req.Currency, req.BidId)
+
+	budget, err := s.store.GetCampaign(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return &pb.DeductBudgetResponse{
+			Success:      false,
+			Message:      blockMessage(LevelCampaignTotal, statusMissing),
+			BlockedLevel: LevelCampaignTotal,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message := validateAmount(budget, amount, req.Currency); message != "" {
+		return &pb.DeductBudgetResponse{
+			Success:         false,
+			RemainingMicros: int64(budget.RemainingBudget),
+			Currency:        budget.Currency,
+			Message:         message,
+		}, nil
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "deduct"
+	}
+	result, err := s.store.Deduct(ctx, Mutation{
+		CampaignID: req.CampaignId,
+		LineItemID: req.LineItemId,
+		Amount:     amount,
+		BidID:      req.BidId,
+		Reason:     reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.OK {
+		log.Printf("预算扣减成功: CampaignID=%s, Remaining=%s", req.CampaignId, result.Remaining)
+		s.observe(req.CampaignId)
+	}
+
+	return &pb.DeductBudgetResponse{
+		Success:         result.OK,
+		RemainingMicros: int64(result.Remaining),
+		Currency:        budget.Currency,
+		Message:         result.Message,
+		BlockedLevel:    result.BlockedLevel,
+	}, nil
+}
+
+// GetBudgetInfo 获取预算信息
+func (s *BudgetServer) GetBudgetInfo(ctx context.Context, req *pb.GetBudgetInfoRequest) (*pb.GetBudgetInfoResponse, error) {
+	log.Printf("获取预算信息: CampaignID=%s", req.CampaignId)
+
+	budget, err := s.store.GetCampaign(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return nil, fmt.Errorf("活动不存在: %s", req.CampaignId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.GetBudgetInfoResponse{
+		CampaignId:             budget.CampaignID,
+		TotalBudgetMicros:      int64(budget.TotalBudget),
+		RemainingBudgetMicros:  int64(budget.RemainingBudget),
+		DailyBudgetMicros:      int64(budget.DailyBudget),
+		DailySpentMicros:       int64(budget.DailySpent),
+		Status:                 budget.Status,
+		AdvertiserId:           budget.AdvertiserID,
+		Currency:               budget.Currency,
+		LeaseOutstandingMicros: int64(budget.LeaseOutstanding),
+	}
+	if budget.AdvertiserID != "" {
+		if advertiser, err := s.store.GetAdvertiser(ctx, budget.AdvertiserID); err == nil {
+			resp.AdvertiserRemainingMicros = int64(advertiser.RemainingBudget)
+		}
+	}
+
+	return resp, nil
+}
+
+// RefundBudget 退还预算
+func (s *BudgetServer) RefundBudget(ctx context.Context, req *pb.RefundBudgetRequest) (*pb.RefundBudgetResponse, error) {
+	amount := money.Micros(req.AmountMicros)
+	log.Printf("退还预算: CampaignID=%s, LineItemID=%s, Amount=%s %s, Reason=%s",
+		req.CampaignId, req.LineItemId, amount, req.Currency, req.Reason)
+
+	budget, err := s.store.GetCampaign(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return &pb.RefundBudgetResponse{
+			Success: false,
+			Message: blockMessage(LevelCampaignTotal, statusMissing),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message := validateAmount(budget, amount, req.Currency); message != "" {
+		return &pb.RefundBudgetResponse{
+			Success:         false,
+			RemainingMicros: int64(budget.RemainingBudget),
+			Currency:        budget.Currency,
+			Message:         message,
+		}, nil
+	}
+
+	// 在所有层级退还预算
+	result, err := s.store.Refund(ctx, Mutation{
+		CampaignID: req.CampaignId,
+		LineItemID: req.LineItemId,
+		Amount:     amount,
+		BidID:      req.BidId,
+		Reason:     req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.OK {
+		log.Printf("预算退还成功: CampaignID=%s, Remaining=%s", req.CampaignId, result.Remaining)
+	}
+
+	return &pb.RefundBudgetResponse{
+		Success:         result.OK,
+		RemainingMicros: int64(result.Remaining),
+		Currency:        budget.Currency,
+		Message:         result.Message,
+	}, nil
+}
+
+// validateAmount 校验金额和币种，返回错误消息（合法时为空）
+func validateAmount(budget *BudgetInfo, amount money.Micros, currency string) string {
+	if amount <= 0 {
+		return "金额必须为正数"
+	}
+	if currency != "" && currency != budget.Currency {
+		return fmt.Sprintf("币种不匹配: 请求=%s, 活动=%s", currency, budget.Currency)
+	}
+	return ""
+}
+
+// ListLedgerEntries 查询预算流水
+func (s *BudgetServer) ListLedgerEntries(ctx context.Context, req *pb.ListLedgerEntriesRequest) (*pb.ListLedgerEntriesResponse, error) {
+	log.Printf("查询预算流水: CampaignID=%s, Start=%d, End=%d", req.CampaignId, req.StartTime, req.EndTime)
+
+	var start, end time.Time
+	if req.StartTime > 0 {
+		start = time.UnixMilli(req.StartTime)
+	}
+	if req.EndTime > 0 {
+		end = time.UnixMilli(req.EndTime)
+	}
+
+	entries, err := s.store.ListLedger(ctx, req.CampaignId, start, end, int(req.Limit))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListLedgerEntriesResponse{
+		Entries: make([]*pb.LedgerEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, &pb.LedgerEntry{
+			Id:                 entry.ID,
+			CampaignId:         entry.CampaignID,
+			Type:               entry.Type,
+			AmountMicros:       int64(entry.Amount),
+			BidId:              entry.BidID,
+			Reason:             entry.Reason,
+			Timestamp:          entry.Timestamp.UnixMilli(),
+			BalanceAfterMicros: int64(entry.BalanceAfter),
+			AdvertiserId:       entry.AdvertiserID,
+			LineItemId:         entry.LineItemID,
+			Currency:           entry.Currency,
+			LeaseId:            entry.LeaseID,
+		})
+	}
+
+	return resp, nil
+}
+
+// ReconcileBudget 根据流水重算余额并与当前记录比对
+func (s *BudgetServer) ReconcileBudget(ctx context.Context, req *pb.ReconcileBudgetRequest) (*pb.ReconcileBudgetResponse, error) {
+	log.Printf("预算对账: CampaignID=%s", req.CampaignId)
+
+	// 存储保证活动记录和流水取自同一快照
+	budget, b, err := s.store.Reconcile(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return nil, fmt.Errorf("活动不存在: %s", req.CampaignId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 整数金额可以精确比较
+	consistent := b.Balance == budget.RemainingBudget
+	if !consistent {
+		log.Printf("对账不一致: CampaignID=%s, Ledger=%s, Recorded=%s",
+			req.CampaignId, b.Balance, budget.RemainingBudget)
+	}
+
+	// 流水中租出减归还的净额，应等于已结算租约的消耗加上未结算租约的额度
+	leasesConsistent := b.TotalLeased-b.TotalLeaseReturned == budget.LeaseSpent+budget.LeaseOutstanding
+	if !leasesConsistent {
+		log.Printf("租约对账不一致: CampaignID=%s, Leased=%s, Returned=%s, Spent=%s, Outstanding=%s",
+			req.CampaignId, b.TotalLeased, b.TotalLeaseReturned, budget.LeaseSpent, budget.LeaseOutstanding)
+	}
+
+	return &pb.ReconcileBudgetResponse{
+		CampaignId:               req.CampaignId,
+		LedgerBalanceMicros:      int64(b.Balance),
+		RecordedBalanceMicros:    int64(budget.RemainingBudget),
+		Consistent:               consistent && leasesConsistent,
+		EntryCount:               int64(b.EntryCount),
+		TotalDeductedMicros:      int64(b.TotalDeducted),
+		TotalRefundedMicros:      int64(b.TotalRefunded),
+		Currency:                 budget.Currency,
+		TotalLeasedMicros:        int64(b.TotalLeased),
+		TotalLeaseReturnedMicros: int64(b.TotalLeaseReturned),
+		LeaseOutstandingMicros:   int64(budget.LeaseOutstanding),
+		LeaseSpentMicros:         int64(budget.LeaseSpent),
+		LeasesConsistent:         leasesConsistent,
+	}, nil
+}
+
+// AcquireLease 申请预算租约
+func (s *BudgetServer) AcquireLease(ctx context.Context, req *pb.AcquireLeaseRequest) (*pb.AcquireLeaseResponse, error) {
+	amount := money.Micros(req.AmountMicros)
+	log.Printf("申请租约: CampaignID=%s, LineItemID=%s, NodeID=%s, Amount=%s %s",
+		req.CampaignId, req.LineItemId, req.NodeId, amount, req.Currency)
+
+	if req.NodeId == "" {
+		return &pb.AcquireLeaseResponse{Granted: false, Message: "节点ID不能为空"}, nil
+	}
+
+	budget, err := s.store.GetCampaign(ctx, req.CampaignId)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return &pb.AcquireLeaseResponse{
+			Granted:      false,
+			Message:      blockMessage(LevelCampaignTotal, statusMissing),
+			BlockedLevel: LevelCampaignTotal,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if message := validateAmount(budget, amount, req.Currency); message != "" {
+		return &pb.AcquireLeaseResponse{
+			Granted:         false,
+			Message:         message,
+			RemainingMicros: int64(budget.RemainingBudget),
+		}, nil
+	}
+
+	now := time.Now()
+	lease, result, err := s.store.AcquireLease(ctx, LeaseRequest{
+		LeaseID:    newLeaseID(),
+		CampaignID: req.CampaignId,
+		LineItemID: req.LineItemId,
+		NodeID:     req.NodeId,
+		Amount:     amount,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(s.leaseConfig.ttl(time.Duration(req.TtlMs) * time.Millisecond)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if lease == nil {
+		return &pb.AcquireLeaseResponse{
+			Granted:         false,
+			Message:         result.Message,
+			BlockedLevel:    result.BlockedLevel,
+			RemainingMicros: int64(result.Remaining),
+		}, nil
+	}
+
+	log.Printf("租约已发放: LeaseID=%s, Granted=%s, Remaining=%s", lease.ID, lease.Granted, result.Remaining)
+	s.observe(req.CampaignId)
+
+	return &pb.AcquireLeaseResponse{
+		Granted:         true,
+		Message:         result.Message,
+		Lease:           leaseToPB(lease),
+		RemainingMicros: int64(result.Remaining),
+	}, nil
+}
+
+// ReleaseLease 归还预算租约
+func (s *BudgetServer) ReleaseLease(ctx context.Context, req *pb.ReleaseLeaseRequest) (*pb.ReleaseLeaseResponse, error) {
+	spent := money.Micros(req.SpentMicros)
+	log.Printf("归还租约: LeaseID=%s, Spent=%s", req.LeaseId, spent)
+
+	lease, err := s.store.ReleaseLease(ctx, req.LeaseId, spent)
+	if errors.Is(err, ErrLeaseNotFound) || errors.Is(err, ErrLeaseSettled) {
+		return &pb.ReleaseLeaseResponse{Success: false, Message: err.Error()}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if lease.Spent != spent {
+		log.Printf("租约上报消耗超出范围已截断: LeaseID=%s, Reported=%s, Granted=%s", lease.ID, spent, lease.Granted)
+	}
+
+	return &pb.ReleaseLeaseResponse{
+		Success: true,
+		Message: "归还成功",
+		Lease:   leaseToPB(lease),
+	}, nil
+}
+
+// ListLeases 查询活动的预算租约
+func (s *BudgetServer) ListLeases(ctx context.Context, req *pb.ListLeasesRequest) (*pb.ListLeasesResponse, error) {
+	leases, err := s.store.ListLeases(ctx, req.CampaignId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListLeasesResponse{
+		Leases: make([]*pb.Lease, 0, len(leases)),
+	}
+	for i := range leases {
+		resp.Leases = append(resp.Leases, leaseToPB(&leases[i]))
+	}
+
+	return resp, nil
+}
+
+// leaseToPB 转换租约
+func leaseToPB(lease *Lease) *pb.Lease {
+	return &pb.Lease{
+		Id:             lease.ID,
+		CampaignId:     lease.CampaignID,
+		LineItemId:     lease.LineItemID,
+		NodeId:         lease.NodeID,
+		GrantedMicros:  int64(lease.Granted),
+		SpentMicros:    int64(lease.Spent),
+		ReturnedMicros: int64(lease.Returned),
+		Status:         lease.Status,
+		CreatedAt:      lease.CreatedAt.UnixMilli(),
+		ExpiresAt:      lease.ExpiresAt.UnixMilli(),
+		Currency:       lease.Currency,
+	}
+}
+
+// EnableAlerts 启用预算告警，stream非nil时WatchAlerts可订阅
+func (s *BudgetServer) EnableAlerts(notifier *AlertNotifier, stream *StreamSink) {
+	s.alerts = notifier
+	s.alertStream = stream
+}
+
+// observe 余额减少后登记告警检查
+func (s *BudgetServer) observe(campaignID string) {
+	if s.alerts != nil {
+		s.alerts.Observe(campaignID)
+	}
+}
+
+// WatchAlerts 订阅预算告警，直到客户端断开
+func (s *BudgetServer) WatchAlerts(req *pb.WatchAlertsRequest, stream pb.BudgetService_WatchAlertsServer) error {
+	if s.alertStream == nil {
+		return errors.New("预算告警未启用")
+	}
+
+	log.Printf("订阅预算告警: CampaignID=%s, AdvertiserID=%s", req.CampaignId, req.AdvertiserId)
+	alerts, cancel := s.alertStream.Subscribe(req.CampaignId, req.AdvertiserId)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case alert := <-alerts:
+			if err := stream.Send(alertToPB(alert)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// alertToPB 转换告警
+func alertToPB(alert Alert) *pb.BudgetAlert {
+	return &pb.BudgetAlert{
+		Id:               alert.ID,
+		Type:             alert.Type,
+		Level:            alert.Level,
+		CampaignId:       alert.CampaignID,
+		AdvertiserId:     alert.AdvertiserID,
+		ThresholdPercent: int32(alert.ThresholdPercent),
+		BudgetMicros:     int64(alert.Budget),
+		SpentMicros:      int64(alert.Spent),
+		Currency:         alert.Currency,
+		Day:              alert.Day,
+		Timestamp:        alert.Timestamp.UnixMilli(),
+		Message:          alert.Message,
+	}
+}
+
+// newAlertNotifier 根据配置创建告警，日志和订阅通道总是启用，配置了地址时启用Webhook
+func newAlertNotifier(store BudgetStore, cfg config.BudgetAlertConfig) (*AlertNotifier, *StreamSink, error) {
+	alertConfig := DefaultAlertConfig()
+	alertConfig.MaxRetries = cfg.MaxRetries
+
+	thresholds, err := parseThresholds(cfg.Thresholds)
+	if err != nil {
+		return nil, nil, err
+	}
+	alertConfig.Thresholds = thresholds
+
+	stream := NewStreamSink()
+	sinks := []AlertSink{LogSink{}, stream}
+	if cfg.WebhookURL != "" {
+		sinks = append(sinks, NewWebhookSink(cfg.WebhookURL, 5*time.Second))
+	}
+
+	return NewAlertNotifier(store, alertConfig, sinks...), stream, nil
+}
+
+// parseThresholds 解析逗号分隔的阈值百分比，如"50,90,100"
+func parseThresholds(value string) ([]int, error) {
+	var thresholds []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		t, err := strconv.Atoi(part)
+		if err != nil || t <= 0 {
+			return nil, fmt.Errorf("无效的告警阈值: %s", part)
+		}
+		thresholds = append(thresholds, t)
+	}
+	return thresholds, nil
+}
+
+// runLeaseExpiry 定期将超过宽限期仍未归还的租约标记为过期
+// 过期租约的额度保持扣除状态（视为已消耗），节点之后仍可归还以退回未用完的部分
+func runLeaseExpiry(ctx context.Context, store BudgetStore, cfg LeaseConfig) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired, err := store.ExpireLeases(ctx, time.Now().Add(-cfg.ExpiryGrace))
+		if err != nil {
+			log.Printf("租约过期处理失败: %v", err)
+			continue
+		}
+		for _, lease := range expired {
+			log.Printf("租约已过期未归还: LeaseID=%s, CampaignID=%s, NodeID=%s, Granted=%s",
+				lease.ID, lease.CampaignID, lease.NodeID, lease.Granted)
+		}
+	}
+}
+
+// runDailyReset 每分钟检查一次各活动的当地日期，跨天后清零日消耗
+// 多个实例同时运行时由存储保证每个活动同一天只重置一次
+func runDailyReset(ctx context.Context, store BudgetStore) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if reset, err := store.ResetDaily(ctx, time.Now()); err != nil {
+			log.Printf("日预算重置失败: %v", err)
+		} else if reset > 0 {
+			log.Printf("日预算已重置: Campaigns=%d", reset)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// locations 已加载的时区，重置日消耗时每分钟要计算所有活动的当地日期
+var locations sync.Map // 时区名称 -> *time.Location
+
+// loadLocation 加载时区，空字符串为UTC
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("活动时区无效: %q", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// campaignDay 活动在now时的当地日期（YYYY-MM-DD），时区无效时按UTC
+func campaignDay(timezone string, now time.Time) string {
+	loc, err := loadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return now.In(loc).Format("2006-01-02")
+}
+
+// newStore 根据配置创建预算存储
+func newStore(cfg *config.BudgetServiceConfig) (BudgetStore, error) {
+	switch cfg.Store {
+	case "memory":
+		return NewMemoryStore(), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%s", cfg.Redis.Host, cfg.Redis.Port),
+			Password: cfg.Redis.Password,
+			DB:       cfg.Redis.DB,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx).Err(); err != nil {
+			return nil, fmt.Errorf("Redis连接失败: %w", err)
+		}
+		log.Printf("Redis连接成功: %s:%s", cfg.Redis.Host, cfg.Redis.Port)
+
+		return NewRedisStore(client), nil
+	default:
+		return nil, fmt.Errorf("未知的预算存储类型: %s", cfg.Store)
+	}
+}
+
+func main() {
+	cfg := config.LoadBudgetServiceConfig()
+
+	store, err := newStore(cfg)
+	if err != nil {
+		log.Fatalf("创建预算存储失败: %v", err)
+	}
+
+	// 内存存储每次启动都是空的，总是写入测试数据；Redis存储只在显式要求时写入
+	if cfg.Store == "memory" || cfg.SeedTestData {
+		if err := initTestData(context.Background(), store); err != nil {
+			log.Fatalf("初始化测试数据失败: %v", err)
+		}
+	}
+
+	go runDailyReset(context.Background(), store)
+	go runLeaseExpiry(context.Background(), store, DefaultLeaseConfig())
+
+	// 创建 gRPC 服务器
+	lis, err := net.Listen("tcp", ":"+cfg.Port)
+	if err != nil {
+		log.Fatalf("监听失败: %v", err)
+	}
+
+	grpcServer := grpc.NewServer()
+	budgetServer := NewBudgetServer(store)
+
+	if cfg.Alerts.Enabled {
+		notifier, stream, err := newAlertNotifier(store, cfg.Alerts)
+		if err != nil {
+			log.Fatalf("创建预算告警失败: %v", err)
+		}
+		budgetServer.EnableAlerts(notifier, stream)
+		go notifier.Run(context.Background())
+	}
+
+	pb.RegisterBudgetServiceServer(grpcServer, budgetServer)
+
+	log.Println("======================================")
+	log.Println("Budget gRPC 服务启动成功")
+	log.Printf("监听地址: localhost:%s", cfg.Port)
+	log.Printf("预算存储: %s", cfg.Store)
+	log.Println("======================================")
+
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatalf("服务启动失败: %v", err)
+	}
+}
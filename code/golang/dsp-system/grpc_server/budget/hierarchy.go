@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+
+	"dsp-system/money"
+)
+
+// 预算层级（按校验顺序）
+const (
+	LevelAdvertiserTotal = "advertiser_total" // 广告主总预算
+	LevelCampaignTotal   = "campaign_total"   // 活动总预算
+	LevelCampaignDaily   = "campaign_daily"   // 活动日预算
+	LevelLineItem        = "line_item"        // 投放单元预算
+)
+
+// statusMissing 表示对应层级的预算不存在
+const statusMissing = "missing"
+
+// AdvertiserBudget 广告主账户预算（跨活动的总上限）
+type AdvertiserBudget struct {
+	AdvertiserID    string
+	TotalBudget     money.Micros
+	RemainingBudget money.Micros
+	Status          string
+}
+
+// LineItemBudget 投放单元预算
+type LineItemBudget struct {
+	LineItemID      string
+	CampaignID      string
+	TotalBudget     money.Micros
+	RemainingBudget money.Micros
+	Status          string
+}
+
+// blockMessage 根据拦截层级和状态生成提示信息
+// status为空表示余额不足，statusMissing表示不存在，其他值表示状态异常
+func blockMessage(level, status string) string {
+	name := map[string]string{
+		LevelAdvertiserTotal: "广告主",
+		LevelCampaignTotal:   "活动",
+		LevelCampaignDaily:   "活动",
+		LevelLineItem:        "投放单元",
+	}[level]
+
+	switch status {
+	case "":
+		switch level {
+		case LevelAdvertiserTotal:
+			return "广告主总预算不足"
+		case LevelCampaignTotal:
+			return "总预算不足"
+		case LevelCampaignDaily:
+			return "日预算不足"
+		default:
+			return "投放单元预算不足"
+		}
+	case statusMissing:
+		return name + "不存在"
+	default:
+		return fmt.Sprintf("%s状态异常: %s", name, status)
+	}
+}
+
+// budgetChain 一次校验/扣减涉及的各层级预算
+type budgetChain struct {
+	advertiser *AdvertiserBudget // 可能为nil（活动未挂广告主）
+	campaign   *BudgetInfo
+	lineItem   *LineItemBudget // 可能为nil（未指定投放单元）
+}
+
+// evaluate 依次校验各层级，返回拦截层级和状态（通过时层级为空）
+func (c *budgetChain) evaluate(amount money.Micros) (string, string) {
+	if a := c.advertiser; a != nil {
+		if a.Status != "active" {
+			return LevelAdvertiserTotal, a.Status
+		}
+		if a.RemainingBudget < amount {
+			return LevelAdvertiserTotal, ""
+		}
+	}
+
+	if c.campaign.Status != "active" {
+		return LevelCampaignTotal, c.campaign.Status
+	}
+	if c.campaign.RemainingBudget < amount {
+		return LevelCampaignTotal, ""
+	}
+	if c.campaign.DailyBudget-c.campaign.DailySpent < amount {
+		return LevelCampaignDaily, ""
+	}
+
+	if li := c.lineItem; li != nil {
+		if li.Status != "active" {
+			return LevelLineItem, li.Status
+		}
+		if li.RemainingBudget < amount {
+			return LevelLineItem, ""
+		}
+	}
+
+	return "", ""
+}
+
+// available 依次校验各层级状态并返回可用额度（各层级余额的最小值）及限制它的层级
+// 状态异常时返回0和对应层级、状态
+func (c *budgetChain) available() (money.Micros, string, string) {
+	var (
+		avail money.Micros
+		limit string
+	)
+	consider := func(level string, value money.Micros) {
+		if limit == "" || value < avail {
+			avail, limit = value, level
+		}
+	}
+
+	if a := c.advertiser; a != nil {
+		if a.Status != "active" {
+			return 0, LevelAdvertiserTotal, a.Status
+		}
+		consider(LevelAdvertiserTotal, a.RemainingBudget)
+	}
+
+	if c.campaign.Status != "active" {
+		return 0, LevelCampaignTotal, c.campaign.Status
+	}
+	consider(LevelCampaignTotal, c.campaign.RemainingBudget)
+	consider(LevelCampaignDaily, c.campaign.DailyBudget-c.campaign.DailySpent)
+
+	if li := c.lineItem; li != nil {
+		if li.Status != "active" {
+			return 0, LevelLineItem, li.Status
+		}
+		consider(LevelLineItem, li.RemainingBudget)
+	}
+
+	return avail, limit, ""
+}
+
+// deduct 在所有层级扣减，调用前需先通过evaluate
+func (c *budgetChain) deduct(amount money.Micros) {
+	if c.advertiser != nil {
+		c.advertiser.RemainingBudget -= amount
+	}
+	c.campaign.RemainingBudget -= amount
+	c.campaign.DailySpent += amount
+	if c.lineItem != nil {
+		c.lineItem.RemainingBudget -= amount
+	}
+}
+
+// refund 在所有层级退还
+func (c *budgetChain) refund(amount money.Micros) {
+	if c.advertiser != nil {
+		c.advertiser.RemainingBudget += amount
+	}
+	c.campaign.RemainingBudget += amount
+	c.campaign.DailySpent -= amount
+	if c.lineItem != nil {
+		c.lineItem.RemainingBudget += amount
+	}
+}
+
+// lineItemID 返回链上的投放单元ID
+func (c *budgetChain) lineItemID() string {
+	if c.lineItem == nil {
+		return ""
+	}
+	return c.lineItem.LineItemID
+}
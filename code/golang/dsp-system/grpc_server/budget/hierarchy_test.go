@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+)
+
+func TestCheckBudgetBlockedLevel(t *testing.T) {
+	s, store := newTestServer(t)
+	ctx := context.Background()
+
+	// 广告主账户余额低于活动余额，应由广告主层级拦截
+	store.advertisers["adv_001"].RemainingBudget = 50 * money.MicrosPerUnit
+
+	tests := []struct {
+		name       string
+		campaignID string
+		lineItemID string
+		amount     money.Micros
+		wantLevel  string
+	}{
+		{"预算充足", "campaign_002", "li_002_a", 10 * money.MicrosPerUnit, ""},
+		{"广告主总预算不足", "campaign_001", "", 100 * money.MicrosPerUnit, LevelAdvertiserTotal},
+		{"活动日预算不足", "campaign_002", "", 400 * money.MicrosPerUnit, LevelCampaignDaily},
+		{"投放单元不属于活动", "campaign_002", "li_001_a", 10 * money.MicrosPerUnit, LevelLineItem},
+		{"活动不存在", "campaign_404", "", 10 * money.MicrosPerUnit, LevelCampaignTotal},
+	}
+
+	for _, tt := range tests {
+		resp, err := s.CheckBudget(ctx, &pb.CheckBudgetRequest{
+			CampaignId:   tt.campaignID,
+			LineItemId:   tt.lineItemID,
+			AmountMicros: int64(tt.amount),
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if resp.BlockedLevel != tt.wantLevel || resp.HasBudget != (tt.wantLevel == "") {
+			t.Errorf("%s: BlockedLevel=%q HasBudget=%v, 期望拦截层级%q", tt.name, resp.BlockedLevel, resp.HasBudget, tt.wantLevel)
+		}
+	}
+}
+
+func TestDeductBudgetAllLevels(t *testing.T) {
+	s, store := newTestServer(t)
+	ctx := context.Background()
+
+	store.lineItems["li_001_b"].RemainingBudget = 5 * money.MicrosPerUnit
+
+	resp, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", LineItemId: "li_001_b", AmountMicros: 10_000_000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Success || resp.BlockedLevel != LevelLineItem {
+		t.Fatalf("投放单元预算不足时应拦截: %+v", resp)
+	}
+	if store.budgets["campaign_001"].RemainingBudget != 8500*money.MicrosPerUnit || store.advertisers["adv_001"].RemainingBudget != 25000*money.MicrosPerUnit {
+		t.Fatal("被拦截的扣减不应修改任何层级")
+	}
+
+	resp, err = s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", LineItemId: "li_001_a", AmountMicros: 10_000_000})
+	if err != nil || !resp.Success {
+		t.Fatalf("扣减应成功: %+v, %v", resp, err)
+	}
+	if store.advertisers["adv_001"].RemainingBudget != 24990*money.MicrosPerUnit ||
+		store.budgets["campaign_001"].RemainingBudget != 8490*money.MicrosPerUnit ||
+		store.budgets["campaign_001"].DailySpent != 210*money.MicrosPerUnit ||
+		store.lineItems["li_001_a"].RemainingBudget != 4990*money.MicrosPerUnit {
+		t.Error("扣减应作用于广告主、活动和投放单元各层级")
+	}
+}
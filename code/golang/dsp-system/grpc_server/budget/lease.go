@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"dsp-system/money"
+)
+
+// 租约状态
+const (
+	LeaseStatusActive   = "active"   // 有效
+	LeaseStatusExpired  = "expired"  // 已过期未归还，额度视为已消耗
+	LeaseStatusReleased = "released" // 已归还结算
+)
+
+// ErrLeaseNotFound 租约不存在
+var ErrLeaseNotFound = errors.New("租约不存在")
+
+// ErrLeaseSettled 租约已结算，不能重复归还
+var ErrLeaseSettled = errors.New("租约已归还")
+
+// Lease 预算租约
+// 额度在发放时即从各层级预算中扣除，节点只能在本地消耗已领取的额度，
+// 所以节点宕机没有归还时最多少花钱，不会超扣
+type Lease struct {
+	ID         string
+	CampaignID string
+	LineItemID string
+	NodeID     string
+	Currency   string
+	Granted    money.Micros
+	Spent      money.Micros // 归还时节点上报的消耗
+	Returned   money.Micros // 归还时退回的额度（Granted - Spent）
+	Status     string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// LeaseRequest 申请租约
+type LeaseRequest struct {
+	LeaseID    string
+	CampaignID string
+	LineItemID string
+	NodeID     string
+	Amount     money.Micros // 期望额度，可用额度不足时部分发放
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+}
+
+// LeaseConfig 租约参数
+type LeaseConfig struct {
+	DefaultTTL time.Duration // 节点未指定时的有效期
+	MaxTTL     time.Duration // 有效期上限
+	// ExpiryGrace 服务端在过期时间之后再等待多久才把租约标记为过期，
+	// 给节点留出归还的时间，也容忍节点与服务端之间的时钟偏差
+	ExpiryGrace time.Duration
+}
+
+// DefaultLeaseConfig 默认租约参数
+func DefaultLeaseConfig() LeaseConfig {
+	return LeaseConfig{
+		DefaultTTL:  time.Minute,
+		MaxTTL:      10 * time.Minute,
+		ExpiryGrace: 30 * time.Second,
+	}
+}
+
+// ttl 根据请求计算有效期
+func (c LeaseConfig) ttl(requested time.Duration) time.Duration {
+	if requested <= 0 {
+		return c.DefaultTTL
+	}
+	if requested > c.MaxTTL {
+		return c.MaxTTL
+	}
+	return requested
+}
+
+// newLeaseID 生成租约ID
+func newLeaseID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "lease_" + hex.EncodeToString(b)
+}
+
+// settleLease 计算归还时的实际消耗和退回额度，上报值超出[0, Granted]时截断
+func settleLease(granted, spent money.Micros) (money.Micros, money.Micros) {
+	if spent < 0 {
+		spent = 0
+	}
+	if spent > granted {
+		spent = granted
+	}
+	return spent, granted - spent
+}
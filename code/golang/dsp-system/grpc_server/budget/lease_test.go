@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+)
+
+// forEachStore 分别用内存存储和Redis存储运行同一组租约测试
+func forEachStore(t *testing.T, fn func(t *testing.T, s *BudgetServer, store BudgetStore)) {
+	t.Run("memory", func(t *testing.T) {
+		s, store := newTestServer(t)
+		fn(t, s, store)
+	})
+	t.Run("redis", func(t *testing.T) {
+		store := newTestRedisStore(t)
+		fn(t, NewBudgetServer(store), store)
+	})
+}
+
+func TestLeaseAcquireAndRelease(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *BudgetServer, store BudgetStore) {
+		ctx := context.Background()
+
+		resp, err := s.AcquireLease(ctx, &pb.AcquireLeaseRequest{CampaignId: "campaign_001", LineItemId: "li_001_a", NodeId: "node_1", AmountMicros: 100_000_000})
+		if err != nil || !resp.Granted {
+			t.Fatalf("租约应发放: %+v, %v", resp, err)
+		}
+		if resp.Lease.GrantedMicros != 100_000_000 || resp.RemainingMicros != 8400*1_000_000 {
+			t.Fatalf("发放额度或剩余预算不正确: %+v", resp)
+		}
+
+		// 租约额度立即从各层级预扣
+		info, _ := s.GetBudgetInfo(ctx, &pb.GetBudgetInfoRequest{CampaignId: "campaign_001"})
+		if info.AdvertiserRemainingMicros != 24900*1_000_000 || info.DailySpentMicros != 300*1_000_000 || info.LeaseOutstandingMicros != 100_000_000 {
+			t.Errorf("租约应预扣所有层级: %+v", info)
+		}
+
+		rel, err := s.ReleaseLease(ctx, &pb.ReleaseLeaseRequest{LeaseId: resp.Lease.Id, SpentMicros: 30_000_000})
+		if err != nil || !rel.Success {
+			t.Fatalf("归还应成功: %+v, %v", rel, err)
+		}
+		if rel.Lease.Status != LeaseStatusReleased || rel.Lease.SpentMicros != 30_000_000 || rel.Lease.ReturnedMicros != 70_000_000 {
+			t.Errorf("结算结果不正确: %+v", rel.Lease)
+		}
+
+		info, _ = s.GetBudgetInfo(ctx, &pb.GetBudgetInfoRequest{CampaignId: "campaign_001"})
+		if info.RemainingBudgetMicros != 8470*1_000_000 || info.AdvertiserRemainingMicros != 24970*1_000_000 || info.LeaseOutstandingMicros != 0 {
+			t.Errorf("归还后应退回未用完的额度: %+v", info)
+		}
+
+		again, err := s.ReleaseLease(ctx, &pb.ReleaseLeaseRequest{LeaseId: resp.Lease.Id, SpentMicros: 0})
+		if err != nil || again.Success {
+			t.Errorf("重复归还应失败: %+v, %v", again, err)
+		}
+
+		entries, _ := s.ListLedgerEntries(ctx, &pb.ListLedgerEntriesRequest{CampaignId: "campaign_001"})
+		if len(entries.Entries) != 3 || entries.Entries[1].Type != LedgerTypeLeaseGrant || entries.Entries[2].Type != LedgerTypeLeaseReturn ||
+			entries.Entries[2].LeaseId != resp.Lease.Id || entries.Entries[2].AmountMicros != 70_000_000 {
+			t.Errorf("租约流水不正确: %+v", entries.Entries)
+		}
+
+		rec, err := s.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: "campaign_001"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rec.Consistent || !rec.LeasesConsistent || rec.LeaseSpentMicros != 30_000_000 || rec.TotalLeasedMicros != 100_000_000 {
+			t.Errorf("对账结果不正确: %+v", rec)
+		}
+	})
+}
+
+func TestLeasePartialGrant(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *BudgetServer, store BudgetStore) {
+		ctx := context.Background()
+
+		// campaign_002 日预算只剩350
+		resp, err := s.AcquireLease(ctx, &pb.AcquireLeaseRequest{CampaignId: "campaign_002", NodeId: "node_1", AmountMicros: 1000 * 1_000_000})
+		if err != nil || !resp.Granted || resp.Lease.GrantedMicros != 350*1_000_000 {
+			t.Fatalf("应按日预算余额部分发放: %+v, %v", resp, err)
+		}
+
+		resp, err = s.AcquireLease(ctx, &pb.AcquireLeaseRequest{CampaignId: "campaign_002", NodeId: "node_2", AmountMicros: 1_000_000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Granted || resp.BlockedLevel != LevelCampaignDaily {
+			t.Errorf("日预算耗尽后应拦截: %+v", resp)
+		}
+	})
+}
+
+func TestLeaseExpiryKeepsBudgetReserved(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s *BudgetServer, store BudgetStore) {
+		ctx := context.Background()
+
+		resp, err := s.AcquireLease(ctx, &pb.AcquireLeaseRequest{CampaignId: "campaign_003", NodeId: "node_1", AmountMicros: 50_000_000, TtlMs: 1000})
+		if err != nil || !resp.Granted {
+			t.Fatalf("租约应发放: %+v, %v", resp, err)
+		}
+
+		expired, err := store.ExpireLeases(ctx, time.Now().Add(time.Hour))
+		if err != nil || len(expired) != 1 || expired[0].ID != resp.Lease.Id {
+			t.Fatalf("租约应过期: %+v, %v", expired, err)
+		}
+
+		// 节点未归还：额度保持扣除，不会被再次分配
+		info, _ := s.GetBudgetInfo(ctx, &pb.GetBudgetInfoRequest{CampaignId: "campaign_003"})
+		if info.RemainingBudgetMicros != 18450*1_000_000 || info.LeaseOutstandingMicros != 50_000_000 {
+			t.Errorf("过期租约的额度应保持扣除: %+v", info)
+		}
+		rec, _ := s.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: "campaign_003"})
+		if !rec.Consistent || !rec.LeasesConsistent {
+			t.Errorf("存在过期租约时对账应一致: %+v", rec)
+		}
+
+		// 节点恢复后仍可归还，超出发放额度的上报按发放额度截断
+		rel, err := s.ReleaseLease(ctx, &pb.ReleaseLeaseRequest{LeaseId: resp.Lease.Id, SpentMicros: 80_000_000})
+		if err != nil || !rel.Success || rel.Lease.SpentMicros != 50_000_000 || rel.Lease.ReturnedMicros != 0 {
+			t.Errorf("过期租约应可归还: %+v, %v", rel, err)
+		}
+
+		leases, err := s.ListLeases(ctx, &pb.ListLeasesRequest{CampaignId: "campaign_003"})
+		if err != nil || len(leases.Leases) != 1 || leases.Leases[0].Status != LeaseStatusReleased {
+			t.Errorf("租约列表不正确: %+v, %v", leases, err)
+		}
+	})
+}
+
+func TestLeaseTTLBounds(t *testing.T) {
+	cfg := LeaseConfig{DefaultTTL: time.Minute, MaxTTL: 10 * time.Minute}
+
+	if got := cfg.ttl(0); got != time.Minute {
+		t.Errorf("未指定时应使用默认有效期，实际为%v", got)
+	}
+	if got := cfg.ttl(time.Hour); got != 10*time.Minute {
+		t.Errorf("超过上限时应截断，实际为%v", got)
+	}
+	if spent, returned := settleLease(10*money.MicrosPerUnit, -1); spent != 0 || returned != 10*money.MicrosPerUnit {
+		t.Errorf("负的上报消耗应视为0: spent=%s returned=%s", spent, returned)
+	}
+}
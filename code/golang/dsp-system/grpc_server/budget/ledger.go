@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"dsp-system/money"
+)
+
+// 流水类型
+const (
+	LedgerTypeOpen   = "open"   // 开户（初始余额）
+	LedgerTypeDeduct = "deduct" // 扣减
+	LedgerTypeRefund = "refund" // 退还
+
+	LedgerTypeLeaseGrant  = "lease_grant"  // 租约发放（从余额中预扣）
+	LedgerTypeLeaseReturn = "lease_return" // 租约归还（退回未用完的额度）
+)
+
+// LedgerEntry 预算流水记录
+type LedgerEntry struct {
+	ID           int64
+	CampaignID   string
+	Type         string
+	Amount       money.Micros // 变动金额（正数，方向由Type决定）
+	BidID        string
+	Reason       string
+	Timestamp    time.Time
+	BalanceAfter money.Micros // 变动后剩余预算
+	AdvertiserID string
+	LineItemID   string
+	Currency     string
+	LeaseID      string
+}
+
+// LedgerBalance 根据流水重算的结果
+type LedgerBalance struct {
+	Balance       money.Micros
+	EntryCount    int
+	TotalDeducted money.Micros
+	TotalRefunded money.Micros
+
+	TotalLeased        money.Micros
+	TotalLeaseReturned money.Micros
+}
+
+// Ledger 只追加的预算流水账本
+type Ledger struct {
+	mu         sync.RWMutex
+	entries    []LedgerEntry
+	byCampaign map[string][]int // campaignID -> entries下标
+	nextID     int64
+}
+
+// NewLedger 创建流水账本
+func NewLedger() *Ledger {
+	return &Ledger{
+		byCampaign: make(map[string][]int),
+		nextID:     1,
+	}
+}
+
+// Append 追加一条流水，返回分配了序号的记录
+func (l *Ledger) Append(entry LedgerEntry) LedgerEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.ID = l.nextID
+	l.nextID++
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	l.entries = append(l.entries, entry)
+	l.byCampaign[entry.CampaignID] = append(l.byCampaign[entry.CampaignID], len(l.entries)-1)
+
+	return entry
+}
+
+// List 按活动和时间范围查询流水（[start, end)，零值表示不限），按时间升序返回
+func (l *Ledger) List(campaignID string, start, end time.Time, limit int) []LedgerEntry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var result []LedgerEntry
+	for _, idx := range l.byCampaign[campaignID] {
+		entry := l.entries[idx]
+		if !start.IsZero() && entry.Timestamp.Before(start) {
+			continue
+		}
+		if !end.IsZero() && !entry.Timestamp.Before(end) {
+			continue
+		}
+		result = append(result, entry)
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+	}
+
+	return result
+}
+
+// Balance 根据流水重算活动余额
+func (l *Ledger) Balance(campaignID string) LedgerBalance {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	entries := make([]LedgerEntry, 0, len(l.byCampaign[campaignID]))
+	for _, idx := range l.byCampaign[campaignID] {
+		entries = append(entries, l.entries[idx])
+	}
+
+	return computeBalance(entries)
+}
+
+// computeBalance 按时间顺序累加流水得到余额
+func computeBalance(entries []LedgerEntry) LedgerBalance {
+	var b LedgerBalance
+	for _, entry := range entries {
+		switch entry.Type {
+		case LedgerTypeOpen:
+			b.Balance += entry.Amount
+		case LedgerTypeDeduct:
+			b.Balance -= entry.Amount
+			b.TotalDeducted += entry.Amount
+		case LedgerTypeRefund:
+			b.Balance += entry.Amount
+			b.TotalRefunded += entry.Amount
+		case LedgerTypeLeaseGrant:
+			b.Balance -= entry.Amount
+			b.TotalLeased += entry.Amount
+		case LedgerTypeLeaseReturn:
+			b.Balance += entry.Amount
+			b.TotalLeaseReturned += entry.Amount
+		}
+		b.EntryCount++
+	}
+
+	return b
+}
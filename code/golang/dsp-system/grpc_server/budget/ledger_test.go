@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+)
+
+// newTestServer 创建写入了测试数据的内存预算服务
+func newTestServer(t *testing.T) (*BudgetServer, *MemoryStore) {
+	t.Helper()
+	store := NewMemoryStore()
+	if err := initTestData(context.Background(), store); err != nil {
+		t.Fatalf("初始化测试数据失败: %v", err)
+	}
+	return NewBudgetServer(store), store
+}
+
+func TestLedgerRecordsEveryMutation(t *testing.T) {
+	s, _ := newTestServer(t)
+	ctx := context.Background()
+
+	if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", AmountMicros: 12_500_000, BidId: "bid_1"}); err != nil {
+		t.Fatalf("扣减失败: %v", err)
+	}
+	if _, err := s.RefundBudget(ctx, &pb.RefundBudgetRequest{CampaignId: "campaign_001", AmountMicros: 2_500_000, BidId: "bid_1", Reason: "bid_failed"}); err != nil {
+		t.Fatalf("退还失败: %v", err)
+	}
+
+	resp, err := s.ListLedgerEntries(ctx, &pb.ListLedgerEntriesRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatalf("查询流水失败: %v", err)
+	}
+	if len(resp.Entries) != 3 {
+		t.Fatalf("流水条数应为3(open/deduct/refund)，实际为%d", len(resp.Entries))
+	}
+
+	deduct := resp.Entries[1]
+	if deduct.Type != LedgerTypeDeduct || deduct.BidId != "bid_1" || deduct.BalanceAfterMicros != 8_487_500_000 {
+		t.Errorf("扣减流水不正确: %+v", deduct)
+	}
+	refund := resp.Entries[2]
+	if refund.Type != LedgerTypeRefund || refund.Reason != "bid_failed" || refund.BalanceAfterMicros != 8_490_000_000 {
+		t.Errorf("退还流水不正确: %+v", refund)
+	}
+
+	rec, err := s.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatalf("对账失败: %v", err)
+	}
+	if !rec.Consistent || rec.LedgerBalanceMicros != 8_490_000_000 || rec.TotalDeductedMicros != 12_500_000 || rec.TotalRefundedMicros != 2_500_000 {
+		t.Errorf("对账结果不正确: %+v", rec)
+	}
+}
+
+func TestLedgerListTimeRange(t *testing.T) {
+	l := NewLedger()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		l.Append(LedgerEntry{
+			CampaignID: "c1",
+			Type:       LedgerTypeDeduct,
+			Amount:     money.MicrosPerUnit,
+			Timestamp:  base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+	l.Append(LedgerEntry{CampaignID: "c2", Type: LedgerTypeDeduct, Amount: money.MicrosPerUnit, Timestamp: base})
+
+	entries := l.List("c1", base.Add(time.Hour), base.Add(3*time.Hour), 0)
+	if len(entries) != 2 {
+		t.Fatalf("时间范围[1h,3h)应返回2条，实际为%d", len(entries))
+	}
+	if entries[0].ID >= entries[1].ID {
+		t.Errorf("流水应按序号升序返回: %d, %d", entries[0].ID, entries[1].ID)
+	}
+
+	if got := l.List("c1", time.Time{}, time.Time{}, 3); len(got) != 3 {
+		t.Errorf("limit=3应返回3条，实际为%d", len(got))
+	}
+}
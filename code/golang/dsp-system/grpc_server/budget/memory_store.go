@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"dsp-system/money"
+)
+
+// MemoryStore 进程内预算存储，只适用于单实例部署和测试
+type MemoryStore struct {
+	budgets     map[string]*BudgetInfo
+	advertisers map[string]*AdvertiserBudget
+	lineItems   map[string]*LineItemBudget
+	leases      map[string]*Lease
+	alerts      map[string]time.Time // 告警ID -> 去重记录过期时间
+	mu          sync.RWMutex
+
+	// 预算流水（每次余额变动都会追加一条）
+	ledger *Ledger
+}
+
+// NewMemoryStore 创建内存预算存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		budgets:     make(map[string]*BudgetInfo),
+		advertisers: make(map[string]*AdvertiserBudget),
+		lineItems:   make(map[string]*LineItemBudget),
+		leases:      make(map[string]*Lease),
+		alerts:      make(map[string]time.Time),
+		ledger:      NewLedger(),
+	}
+}
+
+// PutAdvertiser 写入广告主预算
+func (m *MemoryStore) PutAdvertiser(ctx context.Context, advertiser AdvertiserBudget) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.advertisers[advertiser.AdvertiserID] = &advertiser
+	return nil
+}
+
+// PutCampaign 为新活动开户，活动已存在时返回ErrCampaignExists
+func (m *MemoryStore) PutCampaign(ctx context.Context, campaign BudgetInfo) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.budgets[campaign.CampaignID]; exists {
+		return ErrCampaignExists
+	}
+	if _, err := loadLocation(campaign.Timezone); err != nil {
+		return err
+	}
+	if campaign.DailyDay == "" {
+		campaign.DailyDay = campaignDay(campaign.Timezone, time.Now())
+	}
+	m.budgets[campaign.CampaignID] = &campaign
+	m.ledger.Append(LedgerEntry{
+		CampaignID:   campaign.CampaignID,
+		Type:         LedgerTypeOpen,
+		Amount:       campaign.RemainingBudget,
+		Reason:       "initial_balance",
+		BalanceAfter: campaign.RemainingBudget,
+		AdvertiserID: campaign.AdvertiserID,
+		Currency:     campaign.Currency,
+	})
+	return nil
+}
+
+// PutLineItem 写入投放单元预算
+func (m *MemoryStore) PutLineItem(ctx context.Context, lineItem LineItemBudget) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lineItems[lineItem.LineItemID] = &lineItem
+	return nil
+}
+
+// GetCampaign 获取活动预算（副本）
+func (m *MemoryStore) GetCampaign(ctx context.Context, campaignID string) (*BudgetInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	budget, exists := m.budgets[campaignID]
+	if !exists {
+		return nil, ErrCampaignNotFound
+	}
+	copied := *budget
+	return &copied, nil
+}
+
+// GetAdvertiser 获取广告主预算（副本）
+func (m *MemoryStore) GetAdvertiser(ctx context.Context, advertiserID string) (*AdvertiserBudget, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	advertiser, exists := m.advertisers[advertiserID]
+	if !exists {
+		return nil, ErrAdvertiserNotFound
+	}
+	copied := *advertiser
+	return &copied, nil
+}
+
+// Check 逐级校验预算
+func (m *MemoryStore) Check(ctx context.Context, mu Mutation) (*BudgetResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	chain, result := m.resolveChain(mu.CampaignID, mu.LineItemID)
+	if chain == nil {
+		return result, nil
+	}
+
+	if level, status := chain.evaluate(mu.Amount); level != "" {
+		return blocked(level, status, chain.campaign.RemainingBudget), nil
+	}
+
+	return &BudgetResult{OK: true, Message: "预算充足", Remaining: chain.campaign.RemainingBudget}, nil
+}
+
+// Deduct 逐级校验并扣减
+func (m *MemoryStore) Deduct(ctx context.Context, mu Mutation) (*BudgetResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chain, result := m.resolveChain(mu.CampaignID, mu.LineItemID)
+	if chain == nil {
+		return result, nil
+	}
+
+	budget := chain.campaign
+	if level, status := chain.evaluate(mu.Amount); level != "" {
+		return blocked(level, status, budget.RemainingBudget), nil
+	}
+
+	// 在所有层级扣减预算
+	chain.deduct(mu.Amount)
+
+	m.ledger.Append(LedgerEntry{
+		CampaignID:   mu.CampaignID,
+		Type:         LedgerTypeDeduct,
+		Amount:       mu.Amount,
+		BidID:        mu.BidID,
+		Reason:       mu.Reason,
+		BalanceAfter: budget.RemainingBudget,
+		AdvertiserID: budget.AdvertiserID,
+		LineItemID:   chain.lineItemID(),
+		Currency:     budget.Currency,
+	})
+
+	return &BudgetResult{OK: true, Message: "扣减成功", Remaining: budget.RemainingBudget}, nil
+}
+
+// Refund 在所有层级退还
+func (m *MemoryStore) Refund(ctx context.Context, mu Mutation) (*BudgetResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chain, result := m.resolveChain(mu.CampaignID, mu.LineItemID)
+	if chain == nil {
+		return result, nil
+	}
+
+	budget := chain.campaign
+	chain.refund(mu.Amount)
+
+	m.ledger.Append(LedgerEntry{
+		CampaignID:   mu.CampaignID,
+		Type:         LedgerTypeRefund,
+		Amount:       mu.Amount,
+		BidID:        mu.BidID,
+		Reason:       mu.Reason,
+		BalanceAfter: budget.RemainingBudget,
+		AdvertiserID: budget.AdvertiserID,
+		LineItemID:   chain.lineItemID(),
+		Currency:     budget.Currency,
+	})
+
+	return &BudgetResult{OK: true, Message: "退还成功", Remaining: budget.RemainingBudget}, nil
+}
+
+// ResetDaily 按活动当地日期清零日消耗
+func (m *MemoryStore) ResetDaily(ctx context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset := 0
+	for _, budget := range m.budgets {
+		day := campaignDay(budget.Timezone, now)
+		if day <= budget.DailyDay {
+			continue
+		}
+		if budget.DailyDay != "" {
+			budget.DailySpent = 0
+			reset++
+		}
+		budget.DailyDay = day
+	}
+	return reset, nil
+}
+
+// ListLedger 查询活动流水
+func (m *MemoryStore) ListLedger(ctx context.Context, campaignID string, start, end time.Time, limit int) ([]LedgerEntry, error) {
+	return m.ledger.List(campaignID, start, end, limit), nil
+}
+
+// Reconcile 在读锁下比对余额和流水
+func (m *MemoryStore) Reconcile(ctx context.Context, campaignID string) (*BudgetInfo, LedgerBalance, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	budget, exists := m.budgets[campaignID]
+	if !exists {
+		return nil, LedgerBalance{}, ErrCampaignNotFound
+	}
+	copied := *budget
+	return &copied, m.ledger.Balance(campaignID), nil
+}
+
+// AcquireLease 发放租约
+func (m *MemoryStore) AcquireLease(ctx context.Context, req LeaseRequest) (*Lease, *BudgetResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chain, result := m.resolveChain(req.CampaignID, req.LineItemID)
+	if chain == nil {
+		return nil, result, nil
+	}
+
+	budget := chain.campaign
+	avail, level, status := chain.available()
+	granted := min(req.Amount, avail)
+	if granted <= 0 {
+		return nil, blocked(level, status, budget.RemainingBudget), nil
+	}
+
+	chain.deduct(granted)
+	budget.LeaseOutstanding += granted
+
+	lease := &Lease{
+		ID:         req.LeaseID,
+		CampaignID: req.CampaignID,
+		LineItemID: chain.lineItemID(),
+		NodeID:     req.NodeID,
+		Currency:   budget.Currency,
+		Granted:    granted,
+		Status:     LeaseStatusActive,
+		CreatedAt:  req.CreatedAt,
+		ExpiresAt:  req.ExpiresAt,
+	}
+	m.leases[lease.ID] = lease
+
+	m.ledger.Append(LedgerEntry{
+		CampaignID:   req.CampaignID,
+		Type:         LedgerTypeLeaseGrant,
+		Amount:       granted,
+		Reason:       "lease:" + req.NodeID,
+		BalanceAfter: budget.RemainingBudget,
+		AdvertiserID: budget.AdvertiserID,
+		LineItemID:   lease.LineItemID,
+		Currency:     budget.Currency,
+		LeaseID:      lease.ID,
+	})
+
+	copied := *lease
+	return &copied, &BudgetResult{OK: true, Message: "租约已发放", Remaining: budget.RemainingBudget}, nil
+}
+
+// ReleaseLease 归还租约
+func (m *MemoryStore) ReleaseLease(ctx context.Context, leaseID string, spent money.Micros) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lease, exists := m.leases[leaseID]
+	if !exists {
+		return nil, ErrLeaseNotFound
+	}
+	if lease.Status == LeaseStatusReleased {
+		return nil, ErrLeaseSettled
+	}
+
+	budget, exists := m.budgets[lease.CampaignID]
+	if !exists {
+		return nil, ErrCampaignNotFound
+	}
+
+	// 投放单元或广告主可能在租约期间被删除，只退还仍存在的层级
+	chain := &budgetChain{campaign: budget}
+	if advertiser, exists := m.advertisers[budget.AdvertiserID]; exists {
+		chain.advertiser = advertiser
+	}
+	if lineItem, exists := m.lineItems[lease.LineItemID]; exists && lease.LineItemID != "" {
+		chain.lineItem = lineItem
+	}
+
+	lease.Spent, lease.Returned = settleLease(lease.Granted, spent)
+	lease.Status = LeaseStatusReleased
+	if lease.Returned > 0 {
+		chain.refund(lease.Returned)
+	}
+	budget.LeaseOutstanding -= lease.Granted
+	budget.LeaseSpent += lease.Spent
+
+	m.ledger.Append(LedgerEntry{
+		CampaignID:   lease.CampaignID,
+		Type:         LedgerTypeLeaseReturn,
+		Amount:       lease.Returned,
+		Reason:       "lease:" + lease.NodeID,
+		BalanceAfter: budget.RemainingBudget,
+		AdvertiserID: budget.AdvertiserID,
+		LineItemID:   lease.LineItemID,
+		Currency:     budget.Currency,
+		LeaseID:      lease.ID,
+	})
+
+	copied := *lease
+	return &copied, nil
+}
+
+// ExpireLeases 标记过期租约
+func (m *MemoryStore) ExpireLeases(ctx context.Context, before time.Time) ([]Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var expired []Lease
+	for _, lease := range m.leases {
+		if lease.Status == LeaseStatusActive && lease.ExpiresAt.Before(before) {
+			lease.Status = LeaseStatusExpired
+			expired = append(expired, *lease)
+		}
+	}
+	return expired, nil
+}
+
+// ListLeases 查询活动租约
+func (m *MemoryStore) ListLeases(ctx context.Context, campaignID string) ([]Lease, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var leases []Lease
+	for _, lease := range m.leases {
+		if lease.CampaignID == campaignID {
+			leases = append(leases, *lease)
+		}
+	}
+	sortLeases(leases)
+	return leases, nil
+}
+
+// resolveChain 解析活动对应的预算链，调用方需持有锁；解析失败时返回拦截结果
+func (m *MemoryStore) resolveChain(campaignID, lineItemID string) (*budgetChain, *BudgetResult) {
+	campaign, exists := m.budgets[campaignID]
+	if !exists {
+		return nil, blocked(LevelCampaignTotal, statusMissing, 0)
+	}
+
+	chain := &budgetChain{campaign: campaign}
+
+	if campaign.AdvertiserID != "" {
+		advertiser, exists := m.advertisers[campaign.AdvertiserID]
+		if !exists {
+			return nil, blocked(LevelAdvertiserTotal, statusMissing, campaign.RemainingBudget)
+		}
+		chain.advertiser = advertiser
+	}
+
+	if lineItemID != "" {
+		lineItem, exists := m.lineItems[lineItemID]
+		if !exists || lineItem.CampaignID != campaignID {
+			return nil, blocked(LevelLineItem, statusMissing, campaign.RemainingBudget)
+		}
+		chain.lineItem = lineItem
+	}
+
+	return chain, nil
+}
+
+// blocked 构造被拦截的结果
+func blocked(level, status string, remaining money.Micros) *BudgetResult {
+	return &BudgetResult{
+		OK:           false,
+		BlockedLevel: level,
+		Message:      blockMessage(level, status),
+		Remaining:    remaining,
+	}
+}
+
+// sortLeases 按发放时间升序排列，时间相同时按ID排列
+func sortLeases(leases []Lease) {
+	sort.Slice(leases, func(i, j int) bool {
+		if !leases[i].CreatedAt.Equal(leases[j].CreatedAt) {
+			return leases[i].CreatedAt.Before(leases[j].CreatedAt)
+		}
+		return leases[i].ID < leases[j].ID
+	})
+}
+
+// ClaimAlert 登记告警ID
+func (m *MemoryStore) ClaimAlert(ctx context.Context, alertID string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if expiresAt, exists := m.alerts[alertID]; exists && now.Before(expiresAt) {
+		return false, nil
+	}
+	m.alerts[alertID] = now.Add(ttl)
+	return true, nil
+}
+
+// ReleaseAlert 撤销告警登记
+func (m *MemoryStore) ReleaseAlert(ctx context.Context, alertID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.alerts, alertID)
+	return nil
+}
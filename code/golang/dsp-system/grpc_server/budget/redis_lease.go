@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dsp-system/money"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireLeaseScript 按各层级最小余额发放租约，并在所有层级预扣、记流水
+// KEYS: 活动, 广告主, 投放单元, 流水, 流水序号, 租约, 有效租约, 活动租约集合
+// ARGV: 期望额度, 活动ID, 投放单元ID, 是否挂广告主, 租约ID, 节点ID, 发放时间(ms), 过期时间(ms)
+// 返回 {是否发放, 拦截层级, 状态, 活动剩余预算, 发放额度}
+var acquireLeaseScript = redis.NewScript(luaLedger + luaResolveChain + `
+local avail = nil
+local limit = ''
+local function consider(level, value)
+  if avail == nil or value < avail then
+    avail = value
+    limit = level
+  end
+end
+
+if has_adv then
+  local a = redis.call('HMGET', KEYS[2], 'remaining', 'status')
+  if a[2] ~= 'active' then
+    return {0, 'advertiser_total', a[2] or 'unknown', remaining, 0}
+  end
+  consider('advertiser_total', tonumber(a[1]))
+end
+
+if c[4] ~= 'active' then
+  return {0, 'campaign_total', c[4] or 'unknown', remaining, 0}
+end
+consider('campaign_total', remaining)
+consider('campaign_daily', tonumber(c[2]) - tonumber(c[3]))
+
+if line_item_id ~= '' then
+  local l = redis.call('HMGET', KEYS[3], 'remaining', 'status')
+  if l[2] ~= 'active' then
+    return {0, 'line_item', l[2] or 'unknown', remaining, 0}
+  end
+  consider('line_item', tonumber(l[1]))
+end
+
+local granted = math.min(amount, avail)
+if granted <= 0 then
+  return {0, limit, '', remaining, 0}
+end
+local g = string.format('%d', granted)
+
+if has_adv then
+  redis.call('HINCRBY', KEYS[2], 'remaining', '-' .. g)
+end
+remaining = redis.call('HINCRBY', KEYS[1], 'remaining', '-' .. g)
+redis.call('HINCRBY', KEYS[1], 'daily_spent', g)
+redis.call('HINCRBY', KEYS[1], 'lease_outstanding', g)
+if line_item_id ~= '' then
+  redis.call('HINCRBY', KEYS[3], 'remaining', '-' .. g)
+end
+
+redis.call('HSET', KEYS[6],
+  'campaign_id', campaign_id, 'line_item_id', line_item_id, 'node_id', ARGV[6],
+  'currency', c[6] or '', 'granted', g, 'spent', 0, 'returned', 0,
+  'status', 'active', 'created_at', ARGV[7], 'expires_at', ARGV[8])
+redis.call('ZADD', KEYS[7], ARGV[8], ARGV[5])
+redis.call('SADD', KEYS[8], ARGV[5])
+
+append_ledger(KEYS[4], KEYS[5], {
+  'type', 'lease_grant', 'amount', g, 'bid_id', '', 'reason', 'lease:' .. ARGV[6],
+  'balance_after', remaining, 'advertiser_id', c[5] or '', 'line_item_id', line_item_id,
+  'currency', c[6] or '', 'lease_id', ARGV[5]})
+
+return {1, '', '', remaining, granted}
+`)
+
+// releaseLeaseScript 结算租约，退回未用完的额度并记流水
+// KEYS: 租约, 活动, 广告主, 投放单元, 流水, 流水序号, 有效租约
+// ARGV: 上报消耗, 是否挂广告主, 租约ID
+// 返回 {结果码, 实际消耗, 退回额度}，结果码 1成功 -1租约不存在 -2已归还 -3活动不存在
+var releaseLeaseScript = redis.NewScript(luaLedger + `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return {-1, 0, 0}
+end
+local l = redis.call('HMGET', KEYS[1], 'status', 'granted', 'node_id', 'line_item_id', 'campaign_id')
+if l[1] == 'released' then
+  return {-2, 0, 0}
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+  return {-3, 0, 0}
+end
+
+local granted = tonumber(l[2])
+local spent = tonumber(ARGV[1])
+if spent < 0 then
+  spent = 0
+end
+if spent > granted then
+  spent = granted
+end
+local returned = granted - spent
+local r = string.format('%d', returned)
+
+-- 广告主或投放单元可能在租约期间被删除，只退还仍存在的层级
+if returned > 0 then
+  if ARGV[2] == '1' and redis.call('EXISTS', KEYS[3]) == 1 then
+    redis.call('HINCRBY', KEYS[3], 'remaining', r)
+  end
+  redis.call('HINCRBY', KEYS[2], 'remaining', r)
+  redis.call('HINCRBY', KEYS[2], 'daily_spent', '-' .. r)
+  if l[4] ~= '' and redis.call('EXISTS', KEYS[4]) == 1 then
+    redis.call('HINCRBY', KEYS[4], 'remaining', r)
+  end
+end
+redis.call('HINCRBY', KEYS[2], 'lease_outstanding', '-' .. l[2])
+redis.call('HINCRBY', KEYS[2], 'lease_spent', string.format('%d', spent))
+
+local c = redis.call('HMGET', KEYS[2], 'remaining', 'advertiser_id', 'currency')
+append_ledger(KEYS[5], KEYS[6], {
+  'type', 'lease_return', 'amount', r, 'bid_id', '', 'reason', 'lease:' .. (l[3] or ''),
+  'balance_after', c[1], 'advertiser_id', c[2] or '', 'line_item_id', l[4] or '',
+  'currency', c[3] or '', 'lease_id', ARGV[3]})
+
+redis.call('HSET', KEYS[1], 'status', 'released', 'spent', string.format('%d', spent), 'returned', r)
+redis.call('ZREM', KEYS[7], ARGV[3])
+
+return {1, spent, returned}
+`)
+
+// expireLeaseScript 将过期的有效租约标记为过期
+// KEYS: 租约, 有效租约
+// ARGV: 租约ID, 截止时间(ms)
+var expireLeaseScript = redis.NewScript(`
+local l = redis.call('HMGET', KEYS[1], 'status', 'expires_at')
+if l[1] ~= 'active' then
+  redis.call('ZREM', KEYS[2], ARGV[1])
+  return 0
+end
+if tonumber(l[2]) >= tonumber(ARGV[2]) then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'status', 'expired')
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// AcquireLease 原子地发放租约
+func (r *RedisStore) AcquireLease(ctx context.Context, req LeaseRequest) (*Lease, *BudgetResult, error) {
+	advertiserID, err := r.client.HGet(ctx, campaignKey(req.CampaignID), "advertiser_id").Result()
+	if err == redis.Nil {
+		return nil, blocked(LevelCampaignTotal, statusMissing, 0), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hasAdv := "0"
+	if advertiserID != "" {
+		hasAdv = "1"
+	}
+
+	keys := []string{
+		campaignKey(req.CampaignID),
+		advertiserKey(advertiserID),
+		lineItemKey(req.LineItemID),
+		ledgerKey(req.CampaignID),
+		ledgerSeqKey,
+		leaseKey(req.LeaseID),
+		activeLeasesKey,
+		campaignLeasesKey(req.CampaignID),
+	}
+	reply, err := acquireLeaseScript.Run(ctx, r.client, keys,
+		int64(req.Amount), req.CampaignID, req.LineItemID, hasAdv,
+		req.LeaseID, req.NodeID, req.CreatedAt.UnixMilli(), req.ExpiresAt.UnixMilli(),
+	).Slice()
+	if err != nil {
+		return nil, nil, fmt.Errorf("执行租约脚本失败: %w", err)
+	}
+	if len(reply) < 4 {
+		return nil, nil, fmt.Errorf("租约脚本返回格式错误: %v", reply)
+	}
+
+	ok, _ := reply[0].(int64)
+	level, _ := reply[1].(string)
+	status, _ := reply[2].(string)
+	remaining, _ := reply[3].(int64)
+	if ok != 1 {
+		return nil, blocked(level, status, money.Micros(remaining)), nil
+	}
+
+	lease, err := r.getLease(ctx, req.LeaseID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lease, &BudgetResult{OK: true, Message: "租约已发放", Remaining: money.Micros(remaining)}, nil
+}
+
+// ReleaseLease 原子地结算租约
+func (r *RedisStore) ReleaseLease(ctx context.Context, leaseID string, spent money.Micros) (*Lease, error) {
+	lease, err := r.getLease(ctx, leaseID)
+	if err != nil {
+		return nil, err
+	}
+	advertiserID, err := r.client.HGet(ctx, campaignKey(lease.CampaignID), "advertiser_id").Result()
+	if err == redis.Nil {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hasAdv := "0"
+	if advertiserID != "" {
+		hasAdv = "1"
+	}
+
+	keys := []string{
+		leaseKey(leaseID),
+		campaignKey(lease.CampaignID),
+		advertiserKey(advertiserID),
+		lineItemKey(lease.LineItemID),
+		ledgerKey(lease.CampaignID),
+		ledgerSeqKey,
+		activeLeasesKey,
+	}
+	code, err := releaseLeaseScript.Run(ctx, r.client, keys, int64(spent), hasAdv, leaseID).Int64Slice()
+	if err != nil {
+		return nil, fmt.Errorf("执行租约脚本失败: %w", err)
+	}
+
+	switch code[0] {
+	case -1:
+		return nil, ErrLeaseNotFound
+	case -2:
+		return nil, ErrLeaseSettled
+	case -3:
+		return nil, ErrCampaignNotFound
+	}
+
+	return r.getLease(ctx, leaseID)
+}
+
+// ExpireLeases 标记过期租约
+func (r *RedisStore) ExpireLeases(ctx context.Context, before time.Time) ([]Lease, error) {
+	beforeMs := before.UnixMilli()
+	ids, err := r.client.ZRangeByScore(ctx, activeLeasesKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(beforeMs, 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Lease
+	for _, id := range ids {
+		n, err := expireLeaseScript.Run(ctx, r.client, []string{leaseKey(id), activeLeasesKey}, id, beforeMs).Int()
+		if err != nil {
+			return expired, err
+		}
+		if n != 1 {
+			continue
+		}
+		lease, err := r.getLease(ctx, id)
+		if err != nil {
+			return expired, err
+		}
+		expired = append(expired, *lease)
+	}
+
+	return expired, nil
+}
+
+// ListLeases 查询活动租约
+func (r *RedisStore) ListLeases(ctx context.Context, campaignID string) ([]Lease, error) {
+	ids, err := r.client.SMembers(ctx, campaignLeasesKey(campaignID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, id := range ids {
+			cmds[i] = pipe.HGetAll(ctx, leaseKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]Lease, 0, len(ids))
+	for i, id := range ids {
+		if fields := cmds[i].Val(); len(fields) > 0 {
+			leases = append(leases, *parseLease(id, fields))
+		}
+	}
+	sortLeases(leases)
+	return leases, nil
+}
+
+// getLease 读取租约
+func (r *RedisStore) getLease(ctx context.Context, leaseID string) (*Lease, error) {
+	fields, err := r.client.HGetAll(ctx, leaseKey(leaseID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrLeaseNotFound
+	}
+	return parseLease(leaseID, fields), nil
+}
+
+// parseLease 将租约哈希转换为Lease
+func parseLease(leaseID string, fields map[string]string) *Lease {
+	createdAt, _ := strconv.ParseInt(fields["created_at"], 10, 64)
+	expiresAt, _ := strconv.ParseInt(fields["expires_at"], 10, 64)
+
+	return &Lease{
+		ID:         leaseID,
+		CampaignID: fields["campaign_id"],
+		LineItemID: fields["line_item_id"],
+		NodeID:     fields["node_id"],
+		Currency:   fields["currency"],
+		Granted:    parseMicros(fields["granted"]),
+		Spent:      parseMicros(fields["spent"]),
+		Returned:   parseMicros(fields["returned"]),
+		Status:     fields["status"],
+		CreatedAt:  time.UnixMilli(createdAt),
+		ExpiresAt:  time.UnixMilli(expiresAt),
+	}
+}
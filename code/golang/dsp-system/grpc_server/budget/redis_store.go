@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dsp-system/money"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis键前缀（不能使用"budget:"，该前缀属于DSP侧的预算缓存）
+const redisKeyPrefix = "budget_svc:"
+
+// luaLedger 追加流水的Lua函数，fields为除id外的字段名/值列表
+const luaLedger = `
+local function append_ledger(ledger_key, seq_key, fields)
+  local id = redis.call('INCR', seq_key)
+  redis.call('XADD', ledger_key, '*', 'id', id, unpack(fields))
+  return id
+end
+`
+
+// luaResolveChain 各脚本共用的预算链解析
+// KEYS: 活动, 广告主, 投放单元
+// ARGV: 金额, 活动ID, 投放单元ID, 是否挂广告主("1"/"0")
+const luaResolveChain = `
+local amount = tonumber(ARGV[1])
+local campaign_id = ARGV[2]
+local line_item_id = ARGV[3]
+local has_adv = ARGV[4] == '1'
+
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return {0, 'campaign_total', 'missing', 0}
+end
+local c = redis.call('HMGET', KEYS[1], 'remaining', 'daily_budget', 'daily_spent', 'status', 'advertiser_id', 'currency')
+local remaining = tonumber(c[1])
+
+if has_adv and redis.call('EXISTS', KEYS[2]) == 0 then
+  return {0, 'advertiser_total', 'missing', remaining}
+end
+if line_item_id ~= '' and redis.call('HGET', KEYS[3], 'campaign_id') ~= campaign_id then
+  return {0, 'line_item', 'missing', remaining}
+end
+`
+
+// luaMutationLedger 校验扣减和退还脚本共用的流水写入，调用前需设置ledger_type和remaining
+// KEYS[4]: 流水, KEYS[5]: 流水序号
+// ARGV[6]: 竞价ID, ARGV[7]: 原因
+const luaMutationLedger = `
+append_ledger(KEYS[4], KEYS[5], {
+  'type', ledger_type, 'amount', ARGV[1], 'bid_id', ARGV[6], 'reason', ARGV[7],
+  'balance_after', remaining, 'advertiser_id', c[5] or '', 'line_item_id', line_item_id,
+  'currency', c[6] or '', 'lease_id', ''})
+`
+
+// checkDeductScript 逐级校验，ARGV[5]为"deduct"时在所有层级扣减并记流水
+// 返回 {是否通过, 拦截层级, 状态, 活动剩余预算}
+var checkDeductScript = redis.NewScript(luaLedger + luaResolveChain + `
+if has_adv then
+  local a = redis.call('HMGET', KEYS[2], 'remaining', 'status')
+  if a[2] ~= 'active' then
+    return {0, 'advertiser_total', a[2] or 'unknown', remaining}
+  end
+  if tonumber(a[1]) < amount then
+    return {0, 'advertiser_total', '', remaining}
+  end
+end
+
+if c[4] ~= 'active' then
+  return {0, 'campaign_total', c[4] or 'unknown', remaining}
+end
+if remaining < amount then
+  return {0, 'campaign_total', '', remaining}
+end
+if tonumber(c[2]) - tonumber(c[3]) < amount then
+  return {0, 'campaign_daily', '', remaining}
+end
+
+if line_item_id ~= '' then
+  local l = redis.call('HMGET', KEYS[3], 'remaining', 'status')
+  if l[2] ~= 'active' then
+    return {0, 'line_item', l[2] or 'unknown', remaining}
+  end
+  if tonumber(l[1]) < amount then
+    return {0, 'line_item', '', remaining}
+  end
+end
+
+if ARGV[5] ~= 'deduct' then
+  return {1, '', '', remaining}
+end
+
+if has_adv then
+  redis.call('HINCRBY', KEYS[2], 'remaining', '-' .. ARGV[1])
+end
+remaining = redis.call('HINCRBY', KEYS[1], 'remaining', '-' .. ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'daily_spent', ARGV[1])
+if line_item_id ~= '' then
+  redis.call('HINCRBY', KEYS[3], 'remaining', '-' .. ARGV[1])
+end
+
+local ledger_type = 'deduct'
+` + luaMutationLedger + `
+return {1, '', '', remaining}
+`)
+
+// refundScript 在所有层级退还并记流水，返回格式同checkDeductScript
+var refundScript = redis.NewScript(luaLedger + luaResolveChain + `
+if has_adv then
+  redis.call('HINCRBY', KEYS[2], 'remaining', ARGV[1])
+end
+remaining = redis.call('HINCRBY', KEYS[1], 'remaining', ARGV[1])
+redis.call('HINCRBY', KEYS[1], 'daily_spent', '-' .. ARGV[1])
+if line_item_id ~= '' then
+  redis.call('HINCRBY', KEYS[3], 'remaining', ARGV[1])
+end
+
+local ledger_type = 'refund'
+` + luaMutationLedger + `
+return {1, '', '', remaining}
+`)
+
+// openCampaignScript 写入活动预算并记开户流水，活动已存在时返回0且不做修改
+// KEYS: 活动, 活动集合, 流水, 流水序号
+// ARGV: 活动ID, 广告主ID, 币种, 总预算, 剩余预算, 日预算, 日消耗, 状态, 时区, 日消耗日期
+var openCampaignScript = redis.NewScript(luaLedger + `
+if redis.call('EXISTS', KEYS[1]) == 1 then
+  return 0
+end
+redis.call('HSET', KEYS[1],
+  'advertiser_id', ARGV[2], 'currency', ARGV[3], 'total', ARGV[4], 'remaining', ARGV[5],
+  'daily_budget', ARGV[6], 'daily_spent', ARGV[7], 'status', ARGV[8],
+  'timezone', ARGV[9], 'daily_day', ARGV[10])
+redis.call('SADD', KEYS[2], ARGV[1])
+return append_ledger(KEYS[3], KEYS[4], {
+  'type', 'open', 'amount', ARGV[5], 'bid_id', '', 'reason', 'initial_balance',
+  'balance_after', ARGV[5], 'advertiser_id', ARGV[2], 'line_item_id', '',
+  'currency', ARGV[3], 'lease_id', ''})
+`)
+
+// resetDailyScript 活动当地日期晚于记录的日期时清零日消耗，返回是否清零
+// 日期只向后推进，时钟稍慢的实例不会把日期改回前一天；没有记录日期时只记录日期
+// KEYS: 活动
+// ARGV: 活动当地日期
+var resetDailyScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+  return 0
+end
+local last = redis.call('HGET', KEYS[1], 'daily_day')
+if last and ARGV[1] <= last then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'daily_day', ARGV[1])
+if not last then
+  return 0
+end
+redis.call('HSET', KEYS[1], 'daily_spent', 0)
+return 1
+`)
+
+// RedisStore 基于Redis的预算存储
+// 校验扣减、退还和日重置都在Lua脚本内原子完成，多个预算服务实例可以共享同一个Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore 创建Redis预算存储
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func advertiserKey(id string) string { return redisKeyPrefix + "adv:" + id }
+func campaignKey(id string) string   { return redisKeyPrefix + "campaign:" + id }
+func lineItemKey(id string) string   { return redisKeyPrefix + "lineitem:" + id }
+func ledgerKey(id string) string     { return redisKeyPrefix + "ledger:" + id }
+
+func leaseKey(id string) string          { return redisKeyPrefix + "lease:" + id }
+func campaignLeasesKey(id string) string { return redisKeyPrefix + "campaign_leases:" + id }
+func alertKey(id string) string          { return redisKeyPrefix + "alert:" + id }
+
+const (
+	campaignSetKey  = redisKeyPrefix + "campaigns"
+	ledgerSeqKey    = redisKeyPrefix + "ledger_seq"
+	activeLeasesKey = redisKeyPrefix + "active_leases" // 有效租约，按过期时间排序
+)
+
+// PutAdvertiser 写入广告主预算
+func (r *RedisStore) PutAdvertiser(ctx context.Context, advertiser AdvertiserBudget) error {
+	return r.client.HSet(ctx, advertiserKey(advertiser.AdvertiserID),
+		"total", int64(advertiser.TotalBudget),
+		"remaining", int64(advertiser.RemainingBudget),
+		"status", advertiser.Status,
+	).Err()
+}
+
+// PutCampaign 为新活动开户，活动已存在时返回ErrCampaignExists
+func (r *RedisStore) PutCampaign(ctx context.Context, campaign BudgetInfo) error {
+	if _, err := loadLocation(campaign.Timezone); err != nil {
+		return err
+	}
+	if campaign.DailyDay == "" {
+		campaign.DailyDay = campaignDay(campaign.Timezone, time.Now())
+	}
+	keys := []string{campaignKey(campaign.CampaignID), campaignSetKey, ledgerKey(campaign.CampaignID), ledgerSeqKey}
+	ledgerID, err := openCampaignScript.Run(ctx, r.client, keys,
+		campaign.CampaignID, campaign.AdvertiserID, campaign.Currency,
+		int64(campaign.TotalBudget), int64(campaign.RemainingBudget),
+		int64(campaign.DailyBudget), int64(campaign.DailySpent), campaign.Status,
+		campaign.Timezone, campaign.DailyDay,
+	).Int64()
+	if err != nil {
+		return err
+	}
+	if ledgerID == 0 {
+		return ErrCampaignExists
+	}
+	return nil
+}
+
+// PutLineItem 写入投放单元预算
+func (r *RedisStore) PutLineItem(ctx context.Context, lineItem LineItemBudget) error {
+	return r.client.HSet(ctx, lineItemKey(lineItem.LineItemID),
+		"campaign_id", lineItem.CampaignID,
+		"total", int64(lineItem.TotalBudget),
+		"remaining", int64(lineItem.RemainingBudget),
+		"status", lineItem.Status,
+	).Err()
+}
+
+// GetCampaign 获取活动预算
+func (r *RedisStore) GetCampaign(ctx context.Context, campaignID string) (*BudgetInfo, error) {
+	fields, err := r.client.HGetAll(ctx, campaignKey(campaignID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrCampaignNotFound
+	}
+
+	return parseCampaign(campaignID, fields), nil
+}
+
+// GetAdvertiser 获取广告主预算
+func (r *RedisStore) GetAdvertiser(ctx context.Context, advertiserID string) (*AdvertiserBudget, error) {
+	fields, err := r.client.HGetAll(ctx, advertiserKey(advertiserID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrAdvertiserNotFound
+	}
+
+	return &AdvertiserBudget{
+		AdvertiserID:    advertiserID,
+		TotalBudget:     parseMicros(fields["total"]),
+		RemainingBudget: parseMicros(fields["remaining"]),
+		Status:          fields["status"],
+	}, nil
+}
+
+// Check 逐级校验预算
+func (r *RedisStore) Check(ctx context.Context, m Mutation) (*BudgetResult, error) {
+	return r.runMutation(ctx, checkDeductScript, m, "check")
+}
+
+// Deduct 原子地逐级校验并扣减
+func (r *RedisStore) Deduct(ctx context.Context, m Mutation) (*BudgetResult, error) {
+	return r.runMutation(ctx, checkDeductScript, m, "deduct")
+}
+
+// Refund 原子地在所有层级退还
+func (r *RedisStore) Refund(ctx context.Context, m Mutation) (*BudgetResult, error) {
+	return r.runMutation(ctx, refundScript, m, "refund")
+}
+
+// runMutation 执行预算脚本并解析结果
+func (r *RedisStore) runMutation(ctx context.Context, script *redis.Script, m Mutation, mode string) (*BudgetResult, error) {
+	// 活动所属广告主不会变化，先查出来以便把广告主键显式传给脚本
+	advertiserID, err := r.client.HGet(ctx, campaignKey(m.CampaignID), "advertiser_id").Result()
+	if err == redis.Nil {
+		return blocked(LevelCampaignTotal, statusMissing, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hasAdv := "0"
+	if advertiserID != "" {
+		hasAdv = "1"
+	}
+
+	keys := []string{
+		campaignKey(m.CampaignID),
+		advertiserKey(advertiserID),
+		lineItemKey(m.LineItemID),
+		ledgerKey(m.CampaignID),
+		ledgerSeqKey,
+	}
+	reply, err := script.Run(ctx, r.client, keys,
+		int64(m.Amount), m.CampaignID, m.LineItemID, hasAdv, mode, m.BidID, m.Reason,
+	).Slice()
+	if err != nil {
+		return nil, fmt.Errorf("执行预算脚本失败: %w", err)
+	}
+	if len(reply) != 4 {
+		return nil, fmt.Errorf("预算脚本返回格式错误: %v", reply)
+	}
+
+	ok, _ := reply[0].(int64)
+	level, _ := reply[1].(string)
+	status, _ := reply[2].(string)
+	remaining, _ := reply[3].(int64)
+
+	if ok != 1 {
+		return blocked(level, status, money.Micros(remaining)), nil
+	}
+
+	message := map[string]string{
+		"check":  "预算充足",
+		"deduct": "扣减成功",
+		"refund": "退还成功",
+	}[mode]
+	return &BudgetResult{OK: true, Message: message, Remaining: money.Micros(remaining)}, nil
+}
+
+// ResetDaily 按活动当地日期清零日消耗，每个活动在脚本内原子判断和清零
+func (r *RedisStore) ResetDaily(ctx context.Context, now time.Time) (int, error) {
+	ids, err := r.client.SMembers(ctx, campaignSetKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	pipe := r.client.Pipeline()
+	timezones := make([]*redis.StringCmd, len(ids))
+	for i, id := range ids {
+		timezones[i] = pipe.HGet(ctx, campaignKey(id), "timezone")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	reset := 0
+	for i, id := range ids {
+		n, err := resetDailyScript.Run(ctx, r.client, []string{campaignKey(id)}, campaignDay(timezones[i].Val(), now)).Int()
+		if err != nil {
+			return reset, err
+		}
+		reset += n
+	}
+	return reset, nil
+}
+
+// ListLedger 查询活动流水，流水ID的毫秒部分即记录时间
+func (r *RedisStore) ListLedger(ctx context.Context, campaignID string, start, end time.Time, limit int) ([]LedgerEntry, error) {
+	from, to := "-", "+"
+	if !start.IsZero() {
+		from = strconv.FormatInt(start.UnixMilli(), 10)
+	}
+	if !end.IsZero() {
+		// 区间右开
+		to = strconv.FormatInt(end.UnixMilli()-1, 10)
+	}
+
+	var (
+		messages []redis.XMessage
+		err      error
+	)
+	if limit > 0 {
+		messages, err = r.client.XRangeN(ctx, ledgerKey(campaignID), from, to, int64(limit)).Result()
+	} else {
+		messages, err = r.client.XRange(ctx, ledgerKey(campaignID), from, to).Result()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLedger(campaignID, messages), nil
+}
+
+// Reconcile 在同一个事务内读取活动记录和全部流水
+func (r *RedisStore) Reconcile(ctx context.Context, campaignID string) (*BudgetInfo, LedgerBalance, error) {
+	var (
+		fields   *redis.MapStringStringCmd
+		messages *redis.XMessageSliceCmd
+	)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = pipe.HGetAll(ctx, campaignKey(campaignID))
+		messages = pipe.XRange(ctx, ledgerKey(campaignID), "-", "+")
+		return nil
+	})
+	if err != nil {
+		return nil, LedgerBalance{}, err
+	}
+	if len(fields.Val()) == 0 {
+		return nil, LedgerBalance{}, ErrCampaignNotFound
+	}
+
+	return parseCampaign(campaignID, fields.Val()), computeBalance(parseLedger(campaignID, messages.Val())), nil
+}
+
+// parseCampaign 将活动哈希转换为BudgetInfo
+func parseCampaign(campaignID string, fields map[string]string) *BudgetInfo {
+	return &BudgetInfo{
+		CampaignID:       campaignID,
+		AdvertiserID:     fields["advertiser_id"],
+		Currency:         fields["currency"],
+		TotalBudget:      parseMicros(fields["total"]),
+		RemainingBudget:  parseMicros(fields["remaining"]),
+		DailyBudget:      parseMicros(fields["daily_budget"]),
+		DailySpent:       parseMicros(fields["daily_spent"]),
+		Status:           fields["status"],
+		Timezone:         fields["timezone"],
+		DailyDay:         fields["daily_day"],
+		LeaseOutstanding: parseMicros(fields["lease_outstanding"]),
+		LeaseSpent:       parseMicros(fields["lease_spent"]),
+	}
+}
+
+// parseLedger 将流水消息转换为LedgerEntry
+func parseLedger(campaignID string, messages []redis.XMessage) []LedgerEntry {
+	entries := make([]LedgerEntry, 0, len(messages))
+	for _, msg := range messages {
+		field := func(name string) string {
+			s, _ := msg.Values[name].(string)
+			return s
+		}
+
+		ms, _ := strconv.ParseInt(strings.SplitN(msg.ID, "-", 2)[0], 10, 64)
+		id, _ := strconv.ParseInt(field("id"), 10, 64)
+
+		entries = append(entries, LedgerEntry{
+			ID:           id,
+			CampaignID:   campaignID,
+			Type:         field("type"),
+			Amount:       parseMicros(field("amount")),
+			BidID:        field("bid_id"),
+			Reason:       field("reason"),
+			Timestamp:    time.UnixMilli(ms),
+			BalanceAfter: parseMicros(field("balance_after")),
+			AdvertiserID: field("advertiser_id"),
+			LineItemID:   field("line_item_id"),
+			Currency:     field("currency"),
+			LeaseID:      field("lease_id"),
+		})
+	}
+
+	return entries
+}
+
+// parseMicros 解析Redis中以整数字符串保存的金额
+func parseMicros(s string) money.Micros {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return money.Micros(n)
+}
+
+// ClaimAlert 登记告警ID，SETNX保证多个实例中只有一个登记成功
+func (r *RedisStore) ClaimAlert(ctx context.Context, alertID string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, alertKey(alertID), time.Now().UnixMilli(), ttl).Result()
+}
+
+// ReleaseAlert 撤销告警登记
+func (r *RedisStore) ReleaseAlert(ctx context.Context, alertID string) error {
+	return r.client.Del(ctx, alertKey(alertID)).Err()
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisStore 创建基于miniredis并写入了测试数据的Redis预算存储
+func newTestRedisStore(t *testing.T) *RedisStore {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	store := NewRedisStore(client)
+	if err := initTestData(context.Background(), store); err != nil {
+		t.Fatalf("初始化测试数据失败: %v", err)
+	}
+	return store
+}
+
+func TestRedisStoreBlockedLevel(t *testing.T) {
+	store := newTestRedisStore(t)
+	ctx := context.Background()
+
+	if err := store.PutAdvertiser(ctx, AdvertiserBudget{AdvertiserID: "adv_001", TotalBudget: 30000 * money.MicrosPerUnit, RemainingBudget: 50 * money.MicrosPerUnit, Status: "active"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PutLineItem(ctx, LineItemBudget{LineItemID: "li_paused", CampaignID: "campaign_002", TotalBudget: money.MicrosPerUnit, RemainingBudget: money.MicrosPerUnit, Status: "paused"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		campaignID string
+		lineItemID string
+		amount     money.Micros
+		wantLevel  string
+		wantMsg    string
+	}{
+		{"预算充足", "campaign_002", "li_002_a", 10 * money.MicrosPerUnit, "", "预算充足"},
+		{"广告主总预算不足", "campaign_001", "", 100 * money.MicrosPerUnit, LevelAdvertiserTotal, "广告主总预算不足"},
+		{"活动日预算不足", "campaign_002", "", 400 * money.MicrosPerUnit, LevelCampaignDaily, "日预算不足"},
+		{"投放单元不属于活动", "campaign_002", "li_001_a", 10 * money.MicrosPerUnit, LevelLineItem, "投放单元不存在"},
+		{"投放单元暂停", "campaign_002", "li_paused", 100_000, LevelLineItem, "投放单元状态异常: paused"},
+		{"活动不存在", "campaign_404", "", 10 * money.MicrosPerUnit, LevelCampaignTotal, "活动不存在"},
+	}
+
+	for _, tt := range tests {
+		result, err := store.Check(ctx, Mutation{CampaignID: tt.campaignID, LineItemID: tt.lineItemID, Amount: tt.amount})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if result.BlockedLevel != tt.wantLevel || result.OK != (tt.wantLevel == "") || result.Message != tt.wantMsg {
+			t.Errorf("%s: 结果=%+v, 期望拦截层级%q, 消息%q", tt.name, result, tt.wantLevel, tt.wantMsg)
+		}
+	}
+}
+
+func TestRedisStoreDeductRefundAndReconcile(t *testing.T) {
+	store := newTestRedisStore(t)
+	s := NewBudgetServer(store)
+	ctx := context.Background()
+
+	resp, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", LineItemId: "li_001_a", AmountMicros: 12_500_000, BidId: "bid_1"})
+	if err != nil || !resp.Success || resp.RemainingMicros != 8_487_500_000 {
+		t.Fatalf("扣减应成功: %+v, %v", resp, err)
+	}
+	if _, err := s.RefundBudget(ctx, &pb.RefundBudgetRequest{CampaignId: "campaign_001", LineItemId: "li_001_a", AmountMicros: 2_500_000, BidId: "bid_1", Reason: "bid_failed"}); err != nil {
+		t.Fatalf("退还失败: %v", err)
+	}
+
+	info, err := s.GetBudgetInfo(ctx, &pb.GetBudgetInfoRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.RemainingBudgetMicros != 8_490_000_000 || info.DailySpentMicros != 210_000_000 || info.AdvertiserRemainingMicros != 24_990_000_000 {
+		t.Errorf("扣减和退还应作用于各层级: %+v", info)
+	}
+
+	entries, err := s.ListLedgerEntries(ctx, &pb.ListLedgerEntriesRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries.Entries) != 3 {
+		t.Fatalf("流水条数应为3(open/deduct/refund)，实际为%d", len(entries.Entries))
+	}
+	deduct := entries.Entries[1]
+	if deduct.Type != LedgerTypeDeduct || deduct.BidId != "bid_1" || deduct.LineItemId != "li_001_a" ||
+		deduct.BalanceAfterMicros != 8_487_500_000 || deduct.Currency != money.DefaultCurrency || deduct.Timestamp == 0 {
+		t.Errorf("扣减流水不正确: %+v", deduct)
+	}
+
+	rec, err := s.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Consistent || rec.LedgerBalanceMicros != 8_490_000_000 || rec.TotalDeductedMicros != 12_500_000 || rec.TotalRefundedMicros != 2_500_000 {
+		t.Errorf("对账结果不正确: %+v", rec)
+	}
+}
+
+func TestRedisStoreReopenKeepsLedgerConsistent(t *testing.T) {
+	store := newTestRedisStore(t)
+	s := NewBudgetServer(store)
+	ctx := context.Background()
+
+	if _, err := s.DeductBudget(ctx, &pb.DeductBudgetRequest{CampaignId: "campaign_001", AmountMicros: 12_500_000, BidId: "bid_1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务重启时再次写入测试数据：不覆盖余额，也不重复记开户流水
+	if err := initTestData(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	err := store.PutCampaign(ctx, BudgetInfo{CampaignID: "campaign_001", RemainingBudget: 8500 * money.MicrosPerUnit, Status: "active"})
+	if err != ErrCampaignExists {
+		t.Errorf("活动已存在时应返回ErrCampaignExists，实际为%v", err)
+	}
+
+	budget, err := store.GetCampaign(ctx, "campaign_001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.RemainingBudget != 8_487_500_000 {
+		t.Errorf("重新写入不应覆盖余额，实际为%s", budget.RemainingBudget)
+	}
+	rec, err := s.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: "campaign_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Consistent {
+		t.Errorf("重新写入后流水应与余额一致: %+v", rec)
+	}
+}
+
+func TestRedisStoreConcurrentDeductNoOverspend(t *testing.T) {
+	store := newTestRedisStore(t)
+	ctx := context.Background()
+
+	// 两个"实例"共享同一个Redis，余额只够扣减10次
+	if err := store.PutCampaign(ctx, BudgetInfo{
+		CampaignID:      "campaign_race",
+		Currency:        money.DefaultCurrency,
+		TotalBudget:     10 * money.MicrosPerUnit,
+		RemainingBudget: 10 * money.MicrosPerUnit,
+		DailyBudget:     100 * money.MicrosPerUnit,
+		Status:          "active",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	other := NewRedisStore(store.client)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target := store
+			if i%2 == 1 {
+				target = other
+			}
+			result, err := target.Deduct(ctx, Mutation{CampaignID: "campaign_race", Amount: money.MicrosPerUnit})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if result.OK {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if succeeded != 10 {
+		t.Errorf("应恰好成功扣减10次，实际为%d", succeeded)
+	}
+	budget, err := store.GetCampaign(ctx, "campaign_race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if budget.RemainingBudget != 0 {
+		t.Errorf("剩余预算应为0，实际为%s", budget.RemainingBudget)
+	}
+}
+
+func TestRedisStoreResetDaily(t *testing.T) {
+	store := newTestRedisStore(t)
+	ctx := context.Background()
+
+	for _, c := range []BudgetInfo{
+		{CampaignID: "campaign_sh", Timezone: "Asia/Shanghai", DailyDay: "2025-01-01"},
+		{CampaignID: "campaign_utc", DailyDay: "2025-01-01"},
+	} {
+		c.Currency, c.Status = money.DefaultCurrency, "active"
+		c.TotalBudget, c.RemainingBudget, c.DailyBudget = 1000*money.MicrosPerUnit, 1000*money.MicrosPerUnit, 100*money.MicrosPerUnit
+		c.DailySpent = 50 * money.MicrosPerUnit
+		if err := store.PutCampaign(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dailySpent := func(id string) money.Micros {
+		budget, err := store.GetCampaign(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return budget.DailySpent
+	}
+
+	// UTC 16:30是上海的次日0:30：只清零上海时区的活动
+	shMidnight := time.Date(2025, 1, 1, 16, 30, 0, 0, time.UTC)
+	if reset, err := store.ResetDaily(ctx, shMidnight); err != nil || reset != 1 {
+		t.Fatalf("应只清零上海时区的活动: reset=%d, err=%v", reset, err)
+	}
+	if dailySpent("campaign_sh") != 0 || dailySpent("campaign_utc") != 50*money.MicrosPerUnit {
+		t.Errorf("日消耗应按活动时区清零: sh=%s, utc=%s", dailySpent("campaign_sh"), dailySpent("campaign_utc"))
+	}
+	if budget, _ := store.GetCampaign(ctx, "campaign_sh"); budget.DailyDay != "2025-01-02" {
+		t.Errorf("日消耗日期应为上海的当天: %s", budget.DailyDay)
+	}
+
+	if _, err := store.Deduct(ctx, Mutation{CampaignID: "campaign_sh", Amount: money.MicrosPerUnit}); err != nil {
+		t.Fatal(err)
+	}
+	// 同一天的其他实例再次调用、时钟稍慢的实例调用都不应生效
+	for _, now := range []time.Time{shMidnight, shMidnight.Add(-time.Hour)} {
+		if reset, err := store.ResetDaily(ctx, now); err != nil || reset != 0 {
+			t.Fatalf("%s不应重复重置: reset=%d, err=%v", now, reset, err)
+		}
+	}
+	if dailySpent("campaign_sh") != money.MicrosPerUnit {
+		t.Errorf("重复重置不应清掉当天消耗: %s", dailySpent("campaign_sh"))
+	}
+
+	// 没有记录日期的旧数据首次只记录日期，不清掉当天已有的消耗
+	store.client.HDel(ctx, campaignKey("campaign_utc"), "daily_day")
+	utcMidnight := time.Date(2025, 1, 2, 0, 30, 0, 0, time.UTC)
+	if reset, err := store.ResetDaily(ctx, utcMidnight); err != nil || reset != 0 {
+		t.Fatalf("首次运行不应重置: reset=%d, err=%v", reset, err)
+	}
+	if reset, err := store.ResetDaily(ctx, utcMidnight.AddDate(0, 0, 1)); err != nil || reset != 2 {
+		t.Fatalf("跨天应重置两个活动: reset=%d, err=%v", reset, err)
+	}
+	if dailySpent("campaign_utc") != 0 {
+		t.Errorf("跨天后日消耗应清零: %s", dailySpent("campaign_utc"))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dsp-system/money"
+)
+
+// ErrCampaignNotFound 活动不存在
+var ErrCampaignNotFound = errors.New("活动不存在")
+
+// ErrCampaignExists 活动已开户，余额只能通过流水变动，不能重新写入
+var ErrCampaignExists = errors.New("活动已存在")
+
+// ErrAdvertiserNotFound 广告主不存在
+var ErrAdvertiserNotFound = errors.New("广告主不存在")
+
+// Mutation 一次预算校验或变动
+type Mutation struct {
+	CampaignID string
+	LineItemID string
+	Amount     money.Micros
+	BidID      string
+	Reason     string
+}
+
+// BudgetResult 预算校验或变动的结果
+type BudgetResult struct {
+	OK           bool
+	BlockedLevel string // 拦截的预算层级（通过时为空）
+	Message      string
+	Remaining    money.Micros // 活动剩余预算
+}
+
+// BudgetStore 预算存储
+// 校验与扣减、余额变动与流水写入都必须在实现内部原子完成，
+// 这样多个预算服务实例共享同一份存储时也不会超扣。
+type BudgetStore interface {
+	PutAdvertiser(ctx context.Context, advertiser AdvertiserBudget) error
+	// PutCampaign 为新活动开户：写入活动预算，并以剩余预算作为期初余额记一条开户流水
+	// DailyDay为空时取活动当地的今天；时区无效时返回错误
+	// 活动已存在时返回ErrCampaignExists，不覆盖余额、日消耗和租约计数，也不重复记开户流水
+	PutCampaign(ctx context.Context, campaign BudgetInfo) error
+	PutLineItem(ctx context.Context, lineItem LineItemBudget) error
+
+	GetCampaign(ctx context.Context, campaignID string) (*BudgetInfo, error)
+	GetAdvertiser(ctx context.Context, advertiserID string) (*AdvertiserBudget, error)
+
+	// Check 逐级校验预算，不修改余额
+	Check(ctx context.Context, m Mutation) (*BudgetResult, error)
+	// Deduct 逐级校验并在所有层级扣减，同时追加扣减流水
+	Deduct(ctx context.Context, m Mutation) (*BudgetResult, error)
+	// Refund 在所有层级退还，同时追加退还流水
+	Refund(ctx context.Context, m Mutation) (*BudgetResult, error)
+	// ResetDaily 将当地日期（按活动时区）已晚于DailyDay的活动的日消耗清零，返回清零的活动数
+	// 日期只向后推进；没有记录日期的活动（旧数据）只记录日期，避免清掉当天已有的消耗
+	ResetDaily(ctx context.Context, now time.Time) (int, error)
+
+	// ListLedger 按时间范围[start, end)查询活动流水，零值表示不限
+	ListLedger(ctx context.Context, campaignID string, start, end time.Time, limit int) ([]LedgerEntry, error)
+	// Reconcile 在同一快照下返回活动当前记录（含租约计数）和根据流水重算的结果
+	Reconcile(ctx context.Context, campaignID string) (*BudgetInfo, LedgerBalance, error)
+
+	// AcquireLease 按可用额度发放租约，并在所有层级预扣、追加发放流水
+	// 没有可用额度时返回的租约为nil，拦截信息在BudgetResult中
+	AcquireLease(ctx context.Context, req LeaseRequest) (*Lease, *BudgetResult, error)
+	// ReleaseLease 结算租约：按上报消耗退回未用完的额度并追加归还流水
+	// 已过期的租约也可以归还；已归还的返回ErrLeaseSettled
+	ReleaseLease(ctx context.Context, leaseID string, spent money.Micros) (*Lease, error)
+	// ExpireLeases 将过期时间早于before的有效租约标记为过期，返回本次标记的租约
+	ExpireLeases(ctx context.Context, before time.Time) ([]Lease, error)
+	// ListLeases 查询活动的全部租约，按发放时间升序
+	ListLeases(ctx context.Context, campaignID string) ([]Lease, error)
+
+	// ClaimAlert 登记告警ID，ttl内首次登记返回true，用于多实例间的告警去重
+	ClaimAlert(ctx context.Context, alertID string, ttl time.Duration) (bool, error)
+	// ReleaseAlert 撤销告警登记，告警没有投递到任何通道时调用，之后的检查会重新发出
+	ReleaseAlert(ctx context.Context, alertID string) error
+}
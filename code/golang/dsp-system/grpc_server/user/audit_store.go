@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// DataSubjectStep 删除或导出请求在一个数据源上的执行结果
+type DataSubjectStep struct {
+	Target string `json:"target"`
+	Status string `json:"status"` // done, failed, skipped
+	Count  int    `json:"count"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AuditRecord 数据主体请求（删除、导出）的审计记录
+// 持久化时标识只保存哈希，删除完成后不再保留原始ID，仍可按ID的哈希核查
+type AuditRecord struct {
+	RequestID   string            `json:"request_id"`
+	Action      string            `json:"action"` // delete, export
+	UserID      string            `json:"user_id"`
+	PersonID    string            `json:"person_id"`
+	Identifiers []string          `json:"identifiers"`
+	RequestedBy string            `json:"requested_by"`
+	Reason      string            `json:"reason,omitempty"`
+	Steps       []DataSubjectStep `json:"steps"`
+	Completed   bool              `json:"completed"` // 所有数据源都执行成功
+	StartedAt   time.Time         `json:"started_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// AuditStore 审计记录存储，只追加不修改
+type AuditStore interface {
+	AppendAudit(ctx context.Context, record *AuditRecord) error
+	// ListAudit 按完成时间顺序返回全部审计记录
+	ListAudit(ctx context.Context) ([]*AuditRecord, error)
+}
+
+// cloneAudit 复制审计记录，存储内外不共享切片
+func cloneAudit(record *AuditRecord) *AuditRecord {
+	c := *record
+	c.Identifiers = slices.Clone(record.Identifiers)
+	c.Steps = slices.Clone(record.Steps)
+	return &c
+}
+
+// AppendAudit 追加审计记录
+func (m *MemoryProfileStore) AppendAudit(ctx context.Context, record *AuditRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = append(m.audit, cloneAudit(record))
+	return nil
+}
+
+// ListAudit 全部审计记录
+func (m *MemoryProfileStore) ListAudit(ctx context.Context) ([]*AuditRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	records := make([]*AuditRecord, 0, len(m.audit))
+	for _, record := range m.audit {
+		records = append(records, cloneAudit(record))
+	}
+	return records, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	pb "dsp-system/proto"
+)
+
+// maxBehaviorBatch 单批行为事件上限，超过时拒绝整个流，避免一批占用过多内存和存储事务
+const maxBehaviorBatch = 1000
+
+// behaviorEvent 一次用户行为
+type behaviorEvent struct {
+	seq      uint64
+	behavior string
+	adID     string
+	at       time.Time // 零值表示当前时间
+}
+
+// behaviorTime 转换行为时间戳（秒），未填写时返回零值
+func behaviorTime(timestamp int64) time.Time {
+	if timestamp > 0 {
+		return time.Unix(timestamp, 0)
+	}
+	return time.Time{}
+}
+
+// recordBehaviors 在一次读改写中把同一用户的一组行为按顺序记入画像
+func (s *UserServer) recordBehaviors(ctx context.Context, userID string, events []behaviorEvent) error {
+	_, err := s.store.Update(ctx, userID, func(profile *UserProfile, exists bool) error {
+		if !exists {
+			// 创建新用户画像
+			profile.Tags = []string{"新用户"}
+			profile.Interests = []string{}
+			profile.DeviceType = "unknown"
+			log.Printf("创建新用户画像: UserID=%s", userID)
+		}
+
+		// 按行为类型加权累加到广告所属类目的兴趣得分（浏览 < 点击 < 转化）
+		now := time.Now()
+		changed := false
+		for _, event := range events {
+			if s.interests.Apply(profile, event.behavior, event.adID, event.at, now) {
+				changed = true
+			}
+		}
+		if changed {
+			log.Printf("行为兴趣已更新: UserID=%s, Interests=%v", userID, profile.DerivedInterests)
+		}
+		// 有行为即视为活跃，推迟过期
+		profile.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// IngestBehaviors 流式接收用户行为
+// 每批写完再接收下一批，写入慢时由gRPC流控让客户端的发送阻塞；
+// 单个事件失败不中断流，结束时逐个返回失败的事件序号
+func (s *UserServer) IngestBehaviors(stream pb.UserService_IngestBehaviorsServer) error {
+	ctx := stream.Context()
+	resp := &pb.IngestBehaviorsResponse{}
+	batches := 0
+
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if len(batch.Events) > maxBehaviorBatch {
+			return fmt.Errorf("单批行为事件超过上限: %d > %d", len(batch.Events), maxBehaviorBatch)
+		}
+
+		accepted, failures := s.ingestBatch(ctx, batch.Events)
+		resp.Accepted += int64(accepted)
+		resp.Failures = append(resp.Failures, failures...)
+		batches++
+	}
+
+	log.Printf("接收用户行为完成: Batches=%d, Accepted=%d, Failed=%d", batches, resp.Accepted, len(resp.Failures))
+	return stream.SendAndClose(resp)
+}
+
+// ingestBatch 写入一批行为，同一用户的事件合并为一次读改写
+func (s *UserServer) ingestBatch(ctx context.Context, events []*pb.BehaviorEvent) (int, []*pb.BehaviorFailure) {
+	var failures []*pb.BehaviorFailure
+	var users []string
+	byUser := make(map[string][]behaviorEvent)
+
+	for _, e := range events {
+		if e.UserId == "" || e.Behavior == "" {
+			failures = append(failures, &pb.BehaviorFailure{Seq: e.Seq, Error: "用户ID和行为类型不能为空"})
+			continue
+		}
+		if _, exists := byUser[e.UserId]; !exists {
+			users = append(users, e.UserId)
+		}
+		byUser[e.UserId] = append(byUser[e.UserId], behaviorEvent{
+			seq:      e.Seq,
+			behavior: e.Behavior,
+			adID:     e.AdId,
+			at:       behaviorTime(e.Timestamp),
+		})
+	}
+
+	accepted := 0
+	for _, userID := range users {
+		userEvents := byUser[userID]
+		if err := s.recordBehaviors(ctx, userID, userEvents); err != nil {
+			log.Printf("写入用户行为失败: UserID=%s, Events=%d, err=%v", userID, len(userEvents), err)
+			for _, event := range userEvents {
+				failures = append(failures, &pb.BehaviorFailure{Seq: event.seq, Error: err.Error(), Retryable: true})
+			}
+			continue
+		}
+		accepted += len(userEvents)
+	}
+	return accepted, failures
+}
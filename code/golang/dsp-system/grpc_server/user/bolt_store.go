@@ -0,0 +1,599 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	profilesBucket = []byte("profiles") // 用户ID -> 画像JSON
+	// 活跃时间索引：8字节大端纳秒时间戳 + 用户ID -> 空值，按时间顺序扫描即可找到过期画像
+	activityBucket = []byte("activity")
+	segmentsBucket = []byte("segments") // 人群ID -> 人群元数据JSON
+	// 名单成员：每个成员集合一个子bucket，成员键 -> 空值
+	segmentMembersBucket = []byte("segment_members")
+
+	identityClustersBucket = []byte("identity_clusters") // 身份簇ID -> 身份簇JSON
+	identityLinksBucket    = []byte("identity_links")    // 标识 -> 身份簇ID
+	identityPairsBucket    = []byte("identity_pairs")    // 标识对 -> 共现计数JSON
+
+	// 数据主体请求审计：8字节大端纳秒时间戳 + 请求ID -> 审计记录JSON
+	auditBucket = []byte("audit")
+)
+
+// expireBatchSize 每个写事务最多删除的过期画像数，避免长时间占用写锁
+const expireBatchSize = 1000
+
+// BoltProfileStore 基于bbolt的本地持久化画像存储
+// bbolt对数据文件加独占锁，同一文件只能被一个进程打开
+type BoltProfileStore struct {
+	db *bolt.DB
+}
+
+// NewBoltProfileStore 打开（不存在时创建）画像数据文件
+func NewBoltProfileStore(path string) (*BoltProfileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开画像数据文件失败: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			profilesBucket, activityBucket,
+			segmentsBucket, segmentMembersBucket,
+			identityClustersBucket, identityLinksBucket, identityPairsBucket,
+			auditBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &BoltProfileStore{db: db}, nil
+}
+
+// activityKey 活跃时间索引键，零值时间排在最前
+func activityKey(t time.Time, userID string) []byte {
+	var ns int64
+	if !t.IsZero() {
+		ns = t.UnixNano()
+	}
+	key := make([]byte, 8, 8+len(userID))
+	binary.BigEndian.PutUint64(key, uint64(ns))
+	return append(key, userID...)
+}
+
+// getProfile 在事务内读取画像
+func getProfile(tx *bolt.Tx, userID string) (*UserProfile, error) {
+	data := tx.Bucket(profilesBucket).Get([]byte(userID))
+	if data == nil {
+		return nil, ErrProfileNotFound
+	}
+
+	var profile UserProfile
+	if err := json.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("解析画像失败: UserID=%s, err=%w", userID, err)
+	}
+	return &profile, nil
+}
+
+// putProfile 在事务内写入画像并维护活跃时间索引
+func putProfile(tx *bolt.Tx, profile *UserProfile) error {
+	if old, err := getProfile(tx, profile.UserID); err == nil {
+		if err := tx.Bucket(activityBucket).Delete(activityKey(old.UpdatedAt, old.UserID)); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(profilesBucket).Put([]byte(profile.UserID), data); err != nil {
+		return err
+	}
+	return tx.Bucket(activityBucket).Put(activityKey(profile.UpdatedAt, profile.UserID), nil)
+}
+
+// deleteProfile 在事务内删除画像和索引
+func deleteProfile(tx *bolt.Tx, profile *UserProfile) error {
+	if err := tx.Bucket(activityBucket).Delete(activityKey(profile.UpdatedAt, profile.UserID)); err != nil {
+		return err
+	}
+	return tx.Bucket(profilesBucket).Delete([]byte(profile.UserID))
+}
+
+// Get 读取画像
+func (b *BoltProfileStore) Get(ctx context.Context, userID string) (*UserProfile, error) {
+	var profile *UserProfile
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		profile, err = getProfile(tx, userID)
+		return err
+	})
+	return profile, err
+}
+
+// BatchGet 在同一个读事务中批量读取画像
+func (b *BoltProfileStore) BatchGet(ctx context.Context, userIDs []string) (map[string]*UserProfile, error) {
+	result := make(map[string]*UserProfile, len(userIDs))
+	err := b.db.View(func(tx *bolt.Tx) error {
+		for _, userID := range userIDs {
+			profile, err := getProfile(tx, userID)
+			if errors.Is(err, ErrProfileNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			result[userID] = profile
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Put 写入画像
+func (b *BoltProfileStore) Put(ctx context.Context, profile *UserProfile) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return putProfile(tx, profile)
+	})
+}
+
+// Update 在一个写事务中读改写画像
+func (b *BoltProfileStore) Update(ctx context.Context, userID string, fn func(profile *UserProfile, exists bool) error) (*UserProfile, error) {
+	var profile *UserProfile
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		current, err := getProfile(tx, userID)
+		exists := err == nil
+		if errors.Is(err, ErrProfileNotFound) {
+			current = &UserProfile{UserID: userID}
+		} else if err != nil {
+			return err
+		}
+
+		if err := fn(current, exists); err != nil {
+			return err
+		}
+		profile = current
+		return putProfile(tx, current)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// Delete 删除画像
+func (b *BoltProfileStore) Delete(ctx context.Context, userID string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		profile, err := getProfile(tx, userID)
+		if err != nil {
+			return err
+		}
+		return deleteProfile(tx, profile)
+	})
+}
+
+// ExpireInactive 沿活跃时间索引删除过期画像，分批提交
+func (b *BoltProfileStore) ExpireInactive(ctx context.Context, before time.Time) (int, error) {
+	limit := activityKey(before, "")
+	total := 0
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		n := 0
+		err := b.db.Update(func(tx *bolt.Tx) error {
+			profiles := tx.Bucket(profilesBucket)
+			activity := tx.Bucket(activityBucket)
+
+			var keys [][]byte
+			c := activity.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0 && len(keys) < expireBatchSize; k, _ = c.Next() {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+
+			for _, k := range keys {
+				if err := activity.Delete(k); err != nil {
+					return err
+				}
+				if err := profiles.Delete(k[8:]); err != nil {
+					return err
+				}
+			}
+			n = len(keys)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+		if n < expireBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// ForEach 在一个读事务中按用户ID顺序遍历画像
+// 遍历期间写入不受阻塞，但长时间的读事务会推迟旧页面的回收
+func (b *BoltProfileStore) ForEach(ctx context.Context, fn func(profile *UserProfile) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(profilesBucket).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			var profile UserProfile
+			if err := json.Unmarshal(v, &profile); err != nil {
+				return fmt.Errorf("解析画像失败: UserID=%s, err=%w", k, err)
+			}
+			return fn(&profile)
+		})
+	})
+}
+
+// Count 画像数量
+func (b *BoltProfileStore) Count(ctx context.Context) (int, error) {
+	count := 0
+	err := b.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(profilesBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// hasKey 键是否存在；成员的值为空，不能用Get的返回值判断
+func hasKey(bucket *bolt.Bucket, key []byte) bool {
+	k, _ := bucket.Cursor().Seek(key)
+	return bytes.Equal(k, key)
+}
+
+// PutSegment 写入人群元数据
+func (b *BoltProfileStore) PutSegment(ctx context.Context, segment *Segment) error {
+	data, err := json.Marshal(segment)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(segmentsBucket).Put([]byte(segment.ID), data)
+	})
+}
+
+// ListSegments 全部人群，按ID排序
+func (b *BoltProfileStore) ListSegments(ctx context.Context) ([]*Segment, error) {
+	var segments []*Segment
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(segmentsBucket).ForEach(func(k, v []byte) error {
+			var segment Segment
+			if err := json.Unmarshal(v, &segment); err != nil {
+				return fmt.Errorf("解析人群失败: SegmentID=%s, err=%w", k, err)
+			}
+			segments = append(segments, &segment)
+			return nil
+		})
+	})
+	return segments, err
+}
+
+// DeleteSegment 删除人群元数据
+func (b *BoltProfileStore) DeleteSegment(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(segmentsBucket)
+		if bucket.Get([]byte(id)) == nil {
+			return ErrSegmentNotFound
+		}
+		return bucket.Delete([]byte(id))
+	})
+}
+
+// AddMembers 在一个写事务中添加一批成员
+func (b *BoltProfileStore) AddMembers(ctx context.Context, set string, keys []string) (int, error) {
+	added := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		added = 0
+		members, err := tx.Bucket(segmentMembersBucket).CreateBucketIfNotExists([]byte(set))
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if hasKey(members, []byte(key)) {
+				continue
+			}
+			if err := members.Put([]byte(key), nil); err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	return added, err
+}
+
+// IsMember 成员判断
+func (b *BoltProfileStore) IsMember(ctx context.Context, set, key string) (bool, error) {
+	member := false
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if members := tx.Bucket(segmentMembersBucket).Bucket([]byte(set)); members != nil {
+			member = hasKey(members, []byte(key))
+		}
+		return nil
+	})
+	return member, err
+}
+
+// RemoveMembers 在一个写事务中删除一批成员
+func (b *BoltProfileStore) RemoveMembers(ctx context.Context, set string, keys []string) (int, error) {
+	removed := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		removed = 0
+		members := tx.Bucket(segmentMembersBucket).Bucket([]byte(set))
+		if members == nil {
+			return nil
+		}
+		for _, key := range keys {
+			if !hasKey(members, []byte(key)) {
+				continue
+			}
+			if err := members.Delete([]byte(key)); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// DropMembers 删除集合
+func (b *BoltProfileStore) DropMembers(ctx context.Context, set string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket(segmentMembersBucket).DeleteBucket([]byte(set))
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	})
+}
+
+// getCluster 在事务内读取身份簇
+func getCluster(tx *bolt.Tx, id []byte) (*IdentityCluster, error) {
+	data := tx.Bucket(identityClustersBucket).Get(id)
+	if data == nil {
+		return nil, ErrIdentityNotFound
+	}
+
+	var cluster IdentityCluster
+	if err := json.Unmarshal(data, &cluster); err != nil {
+		return nil, fmt.Errorf("解析身份簇失败: ID=%s, err=%w", id, err)
+	}
+	return &cluster, nil
+}
+
+// GetIdentityCluster 查询身份簇
+func (b *BoltProfileStore) GetIdentityCluster(ctx context.Context, identifier string) (*IdentityCluster, error) {
+	var cluster *IdentityCluster
+	err := b.db.View(func(tx *bolt.Tx) error {
+		id := tx.Bucket(identityLinksBucket).Get([]byte(identifier))
+		if id == nil {
+			return ErrIdentityNotFound
+		}
+		var err error
+		cluster, err = getCluster(tx, id)
+		return err
+	})
+	return cluster, err
+}
+
+// PutIdentityCluster 在一个写事务中写入身份簇和成员关联
+func (b *BoltProfileStore) PutIdentityCluster(ctx context.Context, cluster *IdentityCluster, replaced string) error {
+	data, err := json.Marshal(cluster)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		clusters := tx.Bucket(identityClustersBucket)
+		if replaced != "" && replaced != cluster.ID {
+			if err := clusters.Delete([]byte(replaced)); err != nil {
+				return err
+			}
+		}
+		if err := clusters.Put([]byte(cluster.ID), data); err != nil {
+			return err
+		}
+
+		links := tx.Bucket(identityLinksBucket)
+		for _, member := range cluster.Members {
+			if err := links.Put([]byte(member), []byte(cluster.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteIdentityCluster 删除身份簇及成员关联
+func (b *BoltProfileStore) DeleteIdentityCluster(ctx context.Context, id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		cluster, err := getCluster(tx, []byte(id))
+		if err != nil {
+			return err
+		}
+		links := tx.Bucket(identityLinksBucket)
+		for _, member := range cluster.Members {
+			if err := links.Delete([]byte(member)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(identityClustersBucket).Delete([]byte(id))
+	})
+}
+
+// getPair 在事务内读取共现计数
+func getPair(tx *bolt.Tx, key []byte) (identityPair, error) {
+	var pair identityPair
+	if data := tx.Bucket(identityPairsBucket).Get(key); data != nil {
+		if err := json.Unmarshal(data, &pair); err != nil {
+			return pair, fmt.Errorf("解析共现计数失败: %w", err)
+		}
+	}
+	return pair, nil
+}
+
+// IncrIdentityPair 共现计数加一
+// 先在读事务中检查时间窗口，窗口内的重复观测不产生写事务
+func (b *BoltProfileStore) IncrIdentityPair(ctx context.Context, a, c string, now time.Time, window time.Duration) (int, error) {
+	key := []byte(pairKey(a, c))
+	inWindow := func(pair identityPair) bool {
+		return pair.Count > 0 && now.Sub(pair.LastSeen) < window
+	}
+
+	var pair identityPair
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		pair, err = getPair(tx, key)
+		return err
+	})
+	if err != nil || inWindow(pair) {
+		return pair.Count, err
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if pair, err = getPair(tx, key); err != nil || inWindow(pair) {
+			return err
+		}
+		pair.Count++
+		pair.LastSeen = now
+
+		data, err := json.Marshal(pair)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(identityPairsBucket).Put(key, data)
+	})
+	return pair.Count, err
+}
+
+// DeleteIdentityPair 删除共现计数
+func (b *BoltProfileStore) DeleteIdentityPair(ctx context.Context, a, c string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(identityPairsBucket).Delete([]byte(pairKey(a, c)))
+	})
+}
+
+// ExpireIdentityPairs 扫描并删除过期的共现计数
+// 共现计数只在标识尚未关联时存在，数量远小于画像，全量扫描即可
+func (b *BoltProfileStore) ExpireIdentityPairs(ctx context.Context, before time.Time) (int, error) {
+	expired := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		pairs := tx.Bucket(identityPairsBucket)
+
+		var keys [][]byte
+		err := pairs.ForEach(func(k, v []byte) error {
+			var pair identityPair
+			if err := json.Unmarshal(v, &pair); err != nil || pair.LastSeen.Before(before) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := pairs.Delete(k); err != nil {
+				return err
+			}
+		}
+		expired = len(keys)
+		return nil
+	})
+	return expired, err
+}
+
+// DeleteIdentityPairsOf 扫描并删除涉及指定标识的共现计数
+func (b *BoltProfileStore) DeleteIdentityPairsOf(ctx context.Context, identifiers []string) (int, error) {
+	deleted := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		pairs := tx.Bucket(identityPairsBucket)
+
+		var keys [][]byte
+		err := pairs.ForEach(func(k, v []byte) error {
+			if pairHasAny(string(k), identifiers) {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := pairs.Delete(k); err != nil {
+				return err
+			}
+		}
+		deleted = len(keys)
+		return nil
+	})
+	return deleted, err
+}
+
+// AppendAudit 追加审计记录，按完成时间排序
+func (b *BoltProfileStore) AppendAudit(ctx context.Context, record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8, 8+len(record.RequestID))
+	binary.BigEndian.PutUint64(key, uint64(record.CompletedAt.UnixNano()))
+	key = append(key, record.RequestID...)
+
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).Put(key, data)
+	})
+}
+
+// ListAudit 全部审计记录
+func (b *BoltProfileStore) ListAudit(ctx context.Context) ([]*AuditRecord, error) {
+	var records []*AuditRecord
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(k, v []byte) error {
+			var record AuditRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("解析审计记录失败: %w", err)
+			}
+			records = append(records, &record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// Close 关闭数据文件
+func (b *BoltProfileStore) Close() error {
+	return b.db.Close()
+}
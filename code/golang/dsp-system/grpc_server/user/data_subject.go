@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"dsp-system/privacy"
+	pb "dsp-system/proto"
+	"dsp-system/repository"
+)
+
+// 数据主体请求涉及的数据源
+const (
+	targetProfileStore  = "profile_store"
+	targetSegments      = "segments"
+	targetProfileCache  = "profile_cache"
+	targetFrequencyCaps = "frequency_caps"
+	targetSyncMappings  = "sync_mappings"
+	targetBidLogs       = "bid_logs"
+	targetIdentityGraph = "identity_graph"
+)
+
+// ExternalUserData DSP侧以用户ID为键保存的数据，删除和导出请求需要一并处理；字段为nil时跳过
+type ExternalUserData struct {
+	Cache *repository.RedisCache     // 画像缓存、频次控制、Cookie同步映射
+	Logs  *repository.ClickHouseRepo // 竞价日志
+}
+
+// newAuditRecord 创建审计记录
+func newAuditRecord(action, userID, requestedBy, reason string) *AuditRecord {
+	now := time.Now()
+	return &AuditRecord{
+		RequestID:   fmt.Sprintf("%s_%d", action, now.UnixNano()),
+		Action:      action,
+		UserID:      userID,
+		RequestedBy: requestedBy,
+		Reason:      reason,
+		StartedAt:   now,
+	}
+}
+
+// step 记录一个数据源的执行结果
+func (r *AuditRecord) step(target string, count int, err error) {
+	step := DataSubjectStep{Target: target, Status: "done", Count: count}
+	if err != nil {
+		step.Status = "failed"
+		step.Error = err.Error()
+		log.Printf("数据主体请求执行失败: RequestID=%s, Target=%s, err=%v", r.RequestID, target, err)
+	}
+	r.Steps = append(r.Steps, step)
+}
+
+// skip 记录未配置或不适用的数据源
+func (r *AuditRecord) skip(target string) {
+	r.Steps = append(r.Steps, DataSubjectStep{Target: target, Status: "skipped"})
+}
+
+// failed 是否有数据源执行失败
+func (r *AuditRecord) failed() bool {
+	for _, step := range r.Steps {
+		if step.Status == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// finish 结束请求并写入审计，持久化的记录中标识替换为哈希
+func (s *UserServer) finish(ctx context.Context, record *AuditRecord) (*pb.DataSubjectReport, error) {
+	record.Completed = !record.failed()
+	record.CompletedAt = time.Now()
+
+	stored := cloneAudit(record)
+	stored.UserID = privacy.HashID(record.UserID)
+	stored.PersonID = privacy.HashID(record.PersonID)
+	for i, identifier := range stored.Identifiers {
+		stored.Identifiers[i] = privacy.HashID(identifier)
+	}
+	if err := s.store.AppendAudit(ctx, stored); err != nil {
+		return nil, fmt.Errorf("写入审计记录失败: RequestID=%s, err=%w", record.RequestID, err)
+	}
+
+	log.Printf("数据主体请求完成: RequestID=%s, Action=%s, Identifiers=%d, Completed=%v",
+		record.RequestID, record.Action, len(record.Identifiers), record.Completed)
+	return auditToPB(record), nil
+}
+
+// DeleteUser 删除用户数据
+// 按身份簇处理同一个人的全部标识；身份图最后删除，有数据源失败时保留身份图，重试仍能找到全部标识
+func (s *UserServer) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DataSubjectReport, error) {
+	if req.UserId == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	log.Printf("删除用户数据: RequestedBy=%s, Reason=%s", req.RequestedBy, req.Reason)
+
+	cluster, err := s.identity.Resolve(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	record := newAuditRecord("delete", req.UserId, req.RequestedBy, req.Reason)
+	record.PersonID = cluster.ID
+	record.Identifiers = cluster.Members
+	ids := cluster.Members
+
+	deleted := 0
+	found, err := s.store.BatchGet(ctx, ids)
+	if err == nil {
+		for userID := range found {
+			if err = s.store.Delete(ctx, userID); errors.Is(err, ErrProfileNotFound) {
+				err = nil // 并发过期清理
+			} else if err != nil {
+				break
+			}
+			deleted++
+		}
+	}
+	record.step(targetProfileStore, deleted, err)
+
+	removed, err := s.segments.RemoveUser(ctx, ids)
+	record.step(targetSegments, removed, err)
+
+	if cache := s.external.Cache; cache != nil {
+		n, err := cache.DeleteUserProfiles(ctx, ids)
+		record.step(targetProfileCache, n, err)
+
+		n, err = forEachID(ids, func(id string) (int, error) { return cache.DeleteFrequencyCaps(ctx, id) })
+		record.step(targetFrequencyCaps, n, err)
+
+		n, err = forEachID(ids, func(id string) (int, error) { return cache.DeleteUserSyncs(ctx, id) })
+		record.step(targetSyncMappings, n, err)
+	} else {
+		record.skip(targetProfileCache)
+		record.skip(targetFrequencyCaps)
+		record.skip(targetSyncMappings)
+	}
+
+	if logs := s.external.Logs; logs != nil {
+		record.step(targetBidLogs, len(ids), logs.DeleteUserLogs(ctx, ids))
+	} else {
+		record.skip(targetBidLogs)
+	}
+
+	if record.failed() {
+		record.skip(targetIdentityGraph)
+	} else {
+		forgotten, err := s.identity.Forget(ctx, ids)
+		record.step(targetIdentityGraph, forgotten, err)
+	}
+
+	return s.finish(ctx, record)
+}
+
+// ExportUser 导出用户数据
+func (s *UserServer) ExportUser(ctx context.Context, req *pb.ExportUserRequest) (*pb.ExportUserResponse, error) {
+	if req.UserId == "" {
+		return nil, fmt.Errorf("用户ID不能为空")
+	}
+	log.Printf("导出用户数据: RequestedBy=%s", req.RequestedBy)
+
+	cluster, err := s.identity.Resolve(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	record := newAuditRecord("export", req.UserId, req.RequestedBy, "")
+	record.PersonID = cluster.ID
+	record.Identifiers = cluster.Members
+	ids := cluster.Members
+	resp := &pb.ExportUserResponse{}
+
+	found, err := s.store.BatchGet(ctx, ids)
+	for _, userID := range ids {
+		if profile, exists := found[userID]; exists {
+			resp.Profiles = append(resp.Profiles, profileToRecord(profile))
+		}
+	}
+	record.step(targetProfileStore, len(resp.Profiles), err)
+
+	// 人群与DSP竞价时看到的一致：规则按合并画像判断，名单按簇内任一标识判断
+	profile, err := s.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: req.UserId})
+	if err == nil {
+		resp.SegmentIds = profile.SegmentIds
+	}
+	record.step(targetSegments, len(resp.SegmentIds), err)
+
+	// 画像缓存是画像的副本，不单独导出
+	if cache := s.external.Cache; cache != nil {
+		n, err := forEachID(ids, func(id string) (int, error) {
+			scopes, err := cache.ListFrequencyCaps(ctx, id)
+			resp.FrequencyCaps = append(resp.FrequencyCaps, scopes...)
+			return len(scopes), err
+		})
+		record.step(targetFrequencyCaps, n, err)
+
+		n, err = forEachID(ids, func(id string) (int, error) {
+			mappings, err := cache.ListUserSyncs(ctx, id)
+			resp.SyncMappings = append(resp.SyncMappings, mappings...)
+			return len(mappings), err
+		})
+		record.step(targetSyncMappings, n, err)
+	} else {
+		record.skip(targetFrequencyCaps)
+		record.skip(targetSyncMappings)
+	}
+
+	// 竞价日志只用于统计分析，不提供在线导出
+	record.skip(targetBidLogs)
+	record.step(targetIdentityGraph, len(ids), nil)
+
+	report, err := s.finish(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+	resp.Report = report
+	return resp, nil
+}
+
+// forEachID 对每个标识执行fn并累加条数，遇到错误时停止
+func forEachID(ids []string, fn func(id string) (int, error)) (int, error) {
+	total := 0
+	for _, id := range ids {
+		n, err := fn(id)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// auditToPB 转换执行报告
+func auditToPB(record *AuditRecord) *pb.DataSubjectReport {
+	report := &pb.DataSubjectReport{
+		RequestId:   record.RequestID,
+		Action:      record.Action,
+		UserId:      record.UserID,
+		PersonId:    record.PersonID,
+		Identifiers: record.Identifiers,
+		Completed:   record.Completed,
+		StartedAt:   unixMilli(record.StartedAt),
+		CompletedAt: unixMilli(record.CompletedAt),
+	}
+	for _, step := range record.Steps {
+		report.Steps = append(report.Steps, &pb.DataSubjectStep{
+			Target: step.Target,
+			Status: step.Status,
+			Count:  int64(step.Count),
+			Error:  step.Error,
+		})
+	}
+	return report
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/config"
+	"dsp-system/frequency"
+	"dsp-system/privacy"
+	pb "dsp-system/proto"
+	"dsp-system/repository"
+	"dsp-system/rpc"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var testScope = frequency.Scope{Level: frequency.LevelCampaign, ID: "c1"}
+
+// impressions 用户在testScope上的曝光次数
+func impressions(cache *repository.RedisCache, userID string) int64 {
+	counts, _ := cache.CountImpressions(context.Background(), userID, []frequency.Query{{Scope: testScope}})
+	if len(counts) == 0 {
+		return -1
+	}
+	return counts[0]
+}
+
+func TestDeleteAndExportUser(t *testing.T) {
+	forEachProfileStore(t, func(t *testing.T, store UserStore) {
+		ctx := context.Background()
+		mr := miniredis.RunT(t)
+		cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+		t.Cleanup(func() { cache.Close() })
+
+		s := newTestServer(t, store)
+		s.external = ExternalUserData{Cache: cache}
+
+		// 同一个人的两个标识，另有一个无关用户
+		now := time.Now()
+		for _, userID := range []string{"user_a", "ifa-a", "user_b"} {
+			store.Put(ctx, &UserProfile{UserID: userID, City: "北京", UpdatedAt: now})
+		}
+		if _, err := s.identity.Observe(ctx, []string{"user_a", "ifa-a"}, true); err != nil {
+			t.Fatal(err)
+		}
+		s.identity.Observe(ctx, []string{"user_b", "ifa-a"}, false)
+		if _, _, err := s.segments.ImportList(ctx, "seg_list", "名单", HashNone, strings.NewReader("user_a\nuser_b\n"), ListFormat{}, false); err != nil {
+			t.Fatal(err)
+		}
+		for _, userID := range []string{"user_a", "user_b"} {
+			cache.SetUserProfile(ctx, "user_profile:"+userID, &rpc.UserProfile{UserID: userID}, time.Hour)
+			cache.RecordImpression(ctx, userID, "bid_1", now, map[frequency.Scope]time.Duration{testScope: time.Hour})
+		}
+		cache.SetUserSync(ctx, "adx", "adx-a", "user_a", time.Hour)
+		cache.SetUserSync(ctx, "adx", "adx-b", "user_b", time.Hour)
+
+		export, err := s.ExportUser(ctx, &pb.ExportUserRequest{UserId: "ifa-a", RequestedBy: "dpo"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !export.Report.Completed || export.Report.PersonId != "user_a" || len(export.Profiles) != 2 {
+			t.Fatalf("导出应包含同一个人的两个画像: %+v", export)
+		}
+		if !slices.Equal(export.SegmentIds, []string{"seg_list"}) ||
+			!slices.Equal(export.FrequencyCaps, []string{"campaign:c1"}) ||
+			!slices.Equal(export.SyncMappings, []string{"adx:adx-a"}) {
+			t.Errorf("导出的人群、频次或同步映射不正确: %v %v %v", export.SegmentIds, export.FrequencyCaps, export.SyncMappings)
+		}
+
+		report, err := s.DeleteUser(ctx, &pb.DeleteUserRequest{UserId: "ifa-a", RequestedBy: "dpo", Reason: "ticket-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.Completed || !slices.Equal(report.Identifiers, []string{"ifa-a", "user_a"}) {
+			t.Fatalf("删除报告不正确: %+v", report)
+		}
+		counts := make(map[string]int64)
+		for _, step := range report.Steps {
+			counts[step.Target] = step.Count
+		}
+		want := map[string]int64{targetProfileStore: 2, targetSegments: 1, targetProfileCache: 1, targetFrequencyCaps: 1, targetSyncMappings: 1}
+		for target, count := range want {
+			if counts[target] != count {
+				t.Errorf("%s删除条数应为%d，实际为%d", target, count, counts[target])
+			}
+		}
+
+		// 同一个人的数据全部删除，无关用户不受影响
+		for _, userID := range []string{"user_a", "ifa-a"} {
+			if _, err := store.Get(ctx, userID); err != ErrProfileNotFound {
+				t.Errorf("画像应已删除: %s", userID)
+			}
+		}
+		if cluster, _ := s.identity.Resolve(ctx, "ifa-a"); len(cluster.Members) != 1 {
+			t.Errorf("身份簇应已删除: %+v", cluster)
+		}
+		if segments, _ := s.segments.UserSegments(ctx, []string{"user_a"}, nil); len(segments) != 0 {
+			t.Errorf("名单成员应已删除: %v", segments)
+		}
+		if segment, _ := s.segments.get("seg_list"); segment.Size != 1 {
+			t.Errorf("名单人数应减少: %d", segment.Size)
+		}
+		if cache.GetUserProfile(ctx, "user_profile:user_a") != nil || impressions(cache, "user_a") != 0 {
+			t.Error("画像缓存和频次控制应已删除")
+		}
+		if uid, _ := cache.GetUserSync(ctx, "adx", "adx-a"); uid != "" {
+			t.Errorf("同步映射应已删除: %s", uid)
+		}
+
+		if _, err := store.Get(ctx, "user_b"); err != nil {
+			t.Errorf("无关用户的画像不应删除: %v", err)
+		}
+		if impressions(cache, "user_b") != 1 {
+			t.Error("无关用户的频次控制不应删除")
+		}
+		if uid, _ := cache.GetUserSync(ctx, "adx", "adx-b"); uid != "user_b" {
+			t.Error("无关用户的同步映射不应删除")
+		}
+
+		// 审计记录保留请求信息，标识只保存哈希
+		records, err := store.ListAudit(ctx)
+		if err != nil || len(records) != 2 {
+			t.Fatalf("应记录两条审计: %d, %v", len(records), err)
+		}
+		deleted := records[1]
+		if deleted.Action != "delete" || deleted.Reason != "ticket-1" || deleted.UserID != privacy.HashID("ifa-a") || !deleted.Completed {
+			t.Errorf("删除审计记录不正确: %+v", deleted)
+		}
+		for _, identifier := range deleted.Identifiers {
+			if identifier == "user_a" || identifier == "ifa-a" {
+				t.Errorf("审计记录不应保存原始标识: %v", deleted.Identifiers)
+			}
+		}
+	})
+}
+
+func TestDeleteUserReportsFailures(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProfileStore()
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+
+	s := newTestServer(t, store)
+	s.external = ExternalUserData{Cache: cache}
+
+	// 同一个人的三个标识，各有画像、画像缓存、频次记录和同步映射
+	now := time.Now()
+	members := []string{"ifa-a", "user_a", "web-a"}
+	if _, err := s.identity.Observe(ctx, members, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, userID := range members {
+		store.Put(ctx, &UserProfile{UserID: userID, UpdatedAt: now})
+		cache.SetUserProfile(ctx, "user_profile:"+userID, &rpc.UserProfile{UserID: userID}, time.Hour)
+		cache.RecordImpression(ctx, userID, "bid_1", now, map[frequency.Scope]time.Duration{testScope: time.Hour})
+		cache.SetUserSync(ctx, "adx", "adx-"+userID, userID, time.Hour)
+	}
+	mr.Close()
+
+	// Redis不可用时其他数据源照常删除，保留身份图，报告标记未完成以便重试
+	reqCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	report, err := s.DeleteUser(reqCtx, &pb.DeleteUserRequest{UserId: "user_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Completed {
+		t.Error("有数据源失败时报告不应标记完成")
+	}
+	for _, step := range report.Steps {
+		failed := step.Target == targetProfileCache || step.Target == targetFrequencyCaps || step.Target == targetSyncMappings
+		if failed != (step.Status == "failed") {
+			t.Errorf("%s状态不正确: %s %s", step.Target, step.Status, step.Error)
+		}
+		if step.Target == targetIdentityGraph && step.Status != "skipped" {
+			t.Errorf("有数据源失败时不应删除身份图: %s", step.Status)
+		}
+	}
+	for _, userID := range members {
+		if _, err := store.Get(ctx, userID); err != ErrProfileNotFound {
+			t.Errorf("画像应已删除: %s", userID)
+		}
+	}
+
+	// Redis恢复后重试，仍按身份簇删除全部标识的数据
+	if err := mr.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	report, err = s.DeleteUser(ctx, &pb.DeleteUserRequest{UserId: "user_a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Completed || !slices.Equal(report.Identifiers, members) {
+		t.Fatalf("重试应覆盖身份簇的全部标识: %+v", report)
+	}
+	for _, userID := range members {
+		if cache.GetUserProfile(ctx, "user_profile:"+userID) != nil || impressions(cache, userID) != 0 {
+			t.Errorf("画像缓存和频次控制应已删除: %s", userID)
+		}
+		if uid, _ := cache.GetUserSync(ctx, "adx", "adx-"+userID); uid != "" {
+			t.Errorf("同步映射应已删除: %s", uid)
+		}
+	}
+	if cluster, _ := s.identity.Resolve(ctx, "ifa-a"); len(cluster.Members) != 1 {
+		t.Errorf("重试成功后身份簇应已删除: %+v", cluster)
+	}
+}
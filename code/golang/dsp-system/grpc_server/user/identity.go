@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IdentityConfig 身份图参数
+type IdentityConfig struct {
+	// LinkThreshold 两个标识共现达到该次数后关联；确定性匹配直接关联
+	LinkThreshold int
+	// PairWindow 同一对标识在该时间内重复出现只计一次，避免一次会话内的连续请求直接达到阈值
+	PairWindow time.Duration
+	// MaxClusterSize 单个身份簇的标识上限，超过时拒绝合并，避免共享设备或脏数据把大量用户连成一个人
+	MaxClusterSize int
+	// PairTTL 共现计数的保留时间，期间未再共现的计数被清理
+	PairTTL time.Duration
+}
+
+// DefaultIdentityConfig 默认身份图参数
+func DefaultIdentityConfig() IdentityConfig {
+	return IdentityConfig{
+		LinkThreshold:  3,
+		PairWindow:     time.Hour,
+		MaxClusterSize: 32,
+		PairTTL:        30 * 24 * time.Hour,
+	}
+}
+
+// maxObservedIdentifiers 一次观测最多处理的标识数
+const maxObservedIdentifiers = 16
+
+// IdentityGraph 跨设备身份图
+// 把同一个人的用户ID、IFA、设备ID哈希等标识关联到一个身份簇，读取画像时按簇合并
+type IdentityGraph struct {
+	store IdentityStore
+	cfg   IdentityConfig
+
+	// mu 串行化关联操作，保证合并身份簇时读到的是最新状态
+	mu sync.Mutex
+}
+
+// NewIdentityGraph 创建身份图
+func NewIdentityGraph(store IdentityStore, cfg IdentityConfig) *IdentityGraph {
+	return &IdentityGraph{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// validIdentifier 过滤空值和全零的设备ID（限制广告追踪的设备会上报全零IFA）
+func validIdentifier(identifier string) bool {
+	if identifier == "" || len(identifier) > 256 {
+		return false
+	}
+	return strings.Trim(identifier, "0-") != ""
+}
+
+// Resolve 返回标识所属的身份簇，未关联过的标识返回只包含自身的簇
+func (g *IdentityGraph) Resolve(ctx context.Context, identifier string) (*IdentityCluster, error) {
+	cluster, err := g.store.GetIdentityCluster(ctx, identifier)
+	if errors.Is(err, ErrIdentityNotFound) {
+		return &IdentityCluster{ID: identifier, Members: []string{identifier}}, nil
+	}
+	return cluster, err
+}
+
+// Observe 记录同时出现的一组标识，返回新关联的标识对数量
+// deterministic为true表示调用方已确认属于同一个人（如登录），直接关联；
+// 否则累加两两共现次数（每个时间窗口最多一次），达到阈值后关联。
+// 合并的两个簇一样大时沿用先列出的标识所在簇的ID，调用方应把主标识（如登录ID）放在最前
+func (g *IdentityGraph) Observe(ctx context.Context, identifiers []string, deterministic bool) (int, error) {
+	return g.observe(ctx, identifiers, deterministic, time.Now())
+}
+
+// observe 按指定时间记录标识
+func (g *IdentityGraph) observe(ctx context.Context, identifiers []string, deterministic bool, now time.Time) (int, error) {
+	var ids []string
+	for _, identifier := range identifiers {
+		if validIdentifier(identifier) && !slices.Contains(ids, identifier) {
+			ids = append(ids, identifier)
+		}
+	}
+	if len(ids) > maxObservedIdentifiers {
+		ids = ids[:maxObservedIdentifiers]
+	}
+	if len(ids) < 2 {
+		return 0, nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	linked := 0
+	for i := 0; i < len(ids); i++ {
+		for j := i + 1; j < len(ids); j++ {
+			if !deterministic {
+				same, err := g.sameCluster(ctx, ids[i], ids[j])
+				if err != nil {
+					return linked, err
+				}
+				if same {
+					continue
+				}
+				count, err := g.store.IncrIdentityPair(ctx, ids[i], ids[j], now, g.cfg.PairWindow)
+				if err != nil {
+					return linked, err
+				}
+				if count < g.cfg.LinkThreshold {
+					continue
+				}
+			}
+
+			ok, err := g.link(ctx, ids[i], ids[j], now)
+			if err != nil {
+				return linked, err
+			}
+			if ok {
+				linked++
+			}
+		}
+	}
+	return linked, nil
+}
+
+// ExpirePairs 清理超过保留期未再共现的计数
+func (g *IdentityGraph) ExpirePairs(ctx context.Context, now time.Time) (int, error) {
+	if g.cfg.PairTTL <= 0 {
+		return 0, nil
+	}
+	return g.store.ExpireIdentityPairs(ctx, now.Add(-g.cfg.PairTTL))
+}
+
+// Forget 删除标识所在的身份簇和涉及这些标识的共现计数，返回删除的关联和计数数量
+func (g *IdentityGraph) Forget(ctx context.Context, identifiers []string) (int, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	removed := 0
+	for _, identifier := range identifiers {
+		cluster, err := g.store.GetIdentityCluster(ctx, identifier)
+		if errors.Is(err, ErrIdentityNotFound) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if err := g.store.DeleteIdentityCluster(ctx, cluster.ID); err != nil && !errors.Is(err, ErrIdentityNotFound) {
+			return removed, err
+		}
+		removed += len(cluster.Members)
+	}
+
+	pairs, err := g.store.DeleteIdentityPairsOf(ctx, identifiers)
+	return removed + pairs, err
+}
+
+// sameCluster 两个标识是否已在同一个身份簇
+func (g *IdentityGraph) sameCluster(ctx context.Context, a, b string) (bool, error) {
+	ca, err := g.Resolve(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(ca.Members, b), nil
+}
+
+// link 合并两个标识所在的身份簇，保留较大簇的ID
+func (g *IdentityGraph) link(ctx context.Context, a, b string, now time.Time) (bool, error) {
+	ca, err := g.Resolve(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := g.Resolve(ctx, b)
+	if err != nil {
+		return false, err
+	}
+	if ca.ID == cb.ID {
+		return false, nil
+	}
+	if len(ca.Members)+len(cb.Members) > g.cfg.MaxClusterSize {
+		log.Printf("身份簇超过上限，拒绝关联: %s(%d) + %s(%d)", ca.ID, len(ca.Members), cb.ID, len(cb.Members))
+		return false, nil
+	}
+
+	keep, drop := ca, cb
+	if len(cb.Members) > len(ca.Members) {
+		keep, drop = cb, ca
+	}
+	merged := &IdentityCluster{
+		ID:        keep.ID,
+		Members:   append(slices.Clone(keep.Members), drop.Members...),
+		UpdatedAt: now,
+	}
+	sort.Strings(merged.Members)
+
+	if err := g.store.PutIdentityCluster(ctx, merged, drop.ID); err != nil {
+		return false, err
+	}
+	if err := g.store.DeleteIdentityPair(ctx, a, b); err != nil {
+		log.Printf("删除共现计数失败: %v", err)
+	}
+
+	log.Printf("关联身份: PersonID=%s, Members=%d, Linked=%s+%s", merged.ID, len(merged.Members), a, b)
+	return true, nil
+}
+
+// mergeProfiles 合并同一个人在不同标识下的画像
+// 人口属性优先取请求的标识自身的画像，其次取最近活跃的画像；设备类型只属于单个设备，不从其他画像补全；
+// 标签和兴趣取并集；
+// 兴趣得分按各自的计分时间衰减到now后相加，再重新生成行为兴趣
+func mergeProfiles(userID string, profiles []*UserProfile, interests *InterestModel, now time.Time) *UserProfile {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		if (profiles[i].UserID == userID) != (profiles[j].UserID == userID) {
+			return profiles[i].UserID == userID
+		}
+		return profiles[i].UpdatedAt.After(profiles[j].UpdatedAt)
+	})
+
+	merged := &UserProfile{UserID: userID, DeviceType: profiles[0].DeviceType}
+	scores := make(map[string]float64)
+	for _, p := range profiles {
+		if merged.Age <= 0 {
+			merged.Age = p.Age
+		}
+		if merged.Gender == "" || merged.Gender == "unknown" {
+			merged.Gender = p.Gender
+		}
+		if merged.City == "" {
+			merged.City = p.City
+		}
+		merged.Tags = mergeUnique(merged.Tags, p.Tags)
+		merged.Interests = mergeUnique(merged.Interests, p.Interests)
+		if p.UpdatedAt.After(merged.UpdatedAt) {
+			merged.UpdatedAt = p.UpdatedAt
+		}
+
+		for category, score := range interests.decayed(p, now) {
+			scores[category] = math.Min(scores[category]+score, interests.cfg.MaxScore)
+		}
+	}
+
+	interests.store(merged, scores, now)
+	return merged
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrIdentityNotFound 标识未关联到任何身份簇
+var ErrIdentityNotFound = errors.New("标识未关联")
+
+// IdentityCluster 身份簇：判定属于同一个人的一组标识（用户ID、IFA、设备ID哈希等）
+type IdentityCluster struct {
+	ID        string    `json:"id"`      // 人的ID，沿用簇内某个标识
+	Members   []string  `json:"members"` // 按字典序排列
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// identityPair 两个标识的共现计数
+type identityPair struct {
+	Count    int       `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// pairKey 共现计数的键，与两个标识的顺序无关
+func pairKey(a, b string) string {
+	if a > b {
+		a, b = b, a
+	}
+	return a + "\x00" + b
+}
+
+// IdentityStore 身份图存储
+// 写操作由IdentityGraph串行化，存储只需保证单个操作的原子性
+type IdentityStore interface {
+	// GetIdentityCluster 查询标识所属的身份簇
+	GetIdentityCluster(ctx context.Context, identifier string) (*IdentityCluster, error)
+	// PutIdentityCluster 写入身份簇并把全部成员指向它，replaced为被合并掉的旧簇ID（可为空）
+	PutIdentityCluster(ctx context.Context, cluster *IdentityCluster, replaced string) error
+	// DeleteIdentityCluster 删除身份簇及其成员的关联
+	DeleteIdentityCluster(ctx context.Context, id string) error
+
+	// IncrIdentityPair 两个标识的共现次数加一并返回累计次数；距上次计数不足window时不重复计数
+	IncrIdentityPair(ctx context.Context, a, b string, now time.Time, window time.Duration) (int, error)
+	DeleteIdentityPair(ctx context.Context, a, b string) error
+	// ExpireIdentityPairs 删除最后共现时间早于before的计数，返回删除数量
+	ExpireIdentityPairs(ctx context.Context, before time.Time) (int, error)
+	// DeleteIdentityPairsOf 删除涉及任一标识的共现计数，返回删除数量
+	DeleteIdentityPairsOf(ctx context.Context, identifiers []string) (int, error)
+}
+
+// pairHasAny 共现计数的键是否涉及任一标识
+func pairHasAny(key string, identifiers []string) bool {
+	a, b, _ := strings.Cut(key, "\x00")
+	return slices.Contains(identifiers, a) || slices.Contains(identifiers, b)
+}
+
+// cloneCluster 复制身份簇，存储内外不共享切片
+func cloneCluster(cluster *IdentityCluster) *IdentityCluster {
+	c := *cluster
+	c.Members = slices.Clone(cluster.Members)
+	return &c
+}
+
+// GetIdentityCluster 查询身份簇
+func (m *MemoryProfileStore) GetIdentityCluster(ctx context.Context, identifier string) (*IdentityCluster, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cluster, exists := m.clusters[m.identityLinks[identifier]]
+	if !exists {
+		return nil, ErrIdentityNotFound
+	}
+	return cloneCluster(cluster), nil
+}
+
+// PutIdentityCluster 写入身份簇
+func (m *MemoryProfileStore) PutIdentityCluster(ctx context.Context, cluster *IdentityCluster, replaced string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if replaced != "" && replaced != cluster.ID {
+		delete(m.clusters, replaced)
+	}
+	m.clusters[cluster.ID] = cloneCluster(cluster)
+	for _, member := range cluster.Members {
+		m.identityLinks[member] = cluster.ID
+	}
+	return nil
+}
+
+// DeleteIdentityCluster 删除身份簇
+func (m *MemoryProfileStore) DeleteIdentityCluster(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cluster, exists := m.clusters[id]
+	if !exists {
+		return ErrIdentityNotFound
+	}
+	for _, member := range cluster.Members {
+		delete(m.identityLinks, member)
+	}
+	delete(m.clusters, id)
+	return nil
+}
+
+// IncrIdentityPair 共现计数加一
+func (m *MemoryProfileStore) IncrIdentityPair(ctx context.Context, a, b string, now time.Time, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := pairKey(a, b)
+	pair := m.identityPairs[key]
+	if pair.Count > 0 && now.Sub(pair.LastSeen) < window {
+		return pair.Count, nil
+	}
+	pair.Count++
+	pair.LastSeen = now
+	m.identityPairs[key] = pair
+	return pair.Count, nil
+}
+
+// DeleteIdentityPair 删除共现计数
+func (m *MemoryProfileStore) DeleteIdentityPair(ctx context.Context, a, b string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.identityPairs, pairKey(a, b))
+	return nil
+}
+
+// ExpireIdentityPairs 删除过期的共现计数
+func (m *MemoryProfileStore) ExpireIdentityPairs(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for key, pair := range m.identityPairs {
+		if pair.LastSeen.Before(before) {
+			delete(m.identityPairs, key)
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// DeleteIdentityPairsOf 删除涉及指定标识的共现计数
+func (m *MemoryProfileStore) DeleteIdentityPairsOf(ctx context.Context, identifiers []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for key := range m.identityPairs {
+		if pairHasAny(key, identifiers) {
+			delete(m.identityPairs, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
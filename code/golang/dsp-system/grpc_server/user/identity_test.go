@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	pb "dsp-system/proto"
+)
+
+func TestIdentityGraphLinking(t *testing.T) {
+	forEachProfileStore(t, func(t *testing.T, store UserStore) {
+		ctx := context.Background()
+		g := NewIdentityGraph(store, DefaultIdentityConfig())
+		now := time.Now()
+
+		// 同一时间窗口内的重复共现只计一次
+		for i := 0; i < 5; i++ {
+			g.observe(ctx, []string{"user_001", "ifa-1"}, false, now)
+		}
+		if cluster, _ := g.Resolve(ctx, "ifa-1"); cluster.ID != "ifa-1" || len(cluster.Members) != 1 {
+			t.Fatalf("窗口内的重复共现不应关联: %+v", cluster)
+		}
+
+		// 不同时间窗口共现达到阈值后关联
+		g.observe(ctx, []string{"user_001", "ifa-1"}, false, now.Add(2*time.Hour))
+		linked, err := g.observe(ctx, []string{"user_001", "ifa-1"}, false, now.Add(4*time.Hour))
+		if err != nil || linked != 1 {
+			t.Fatalf("第三次共现应关联: %d, %v", linked, err)
+		}
+		cluster, _ := g.Resolve(ctx, "ifa-1")
+		if cluster.ID != "user_001" || !slices.Equal(cluster.Members, []string{"ifa-1", "user_001"}) {
+			t.Errorf("关联后的身份簇不正确: %+v", cluster)
+		}
+
+		// 确定性匹配直接关联，合并时保留较大簇的ID（两簇一样大时沿用先列出的标识）；全零IFA被忽略
+		linked, _ = g.Observe(ctx, []string{"did-sha1", "user_001", "00000000-0000-0000-0000-000000000000"}, true)
+		cluster, _ = g.Resolve(ctx, "did-sha1")
+		if linked != 1 || cluster.ID != "user_001" || len(cluster.Members) != 3 {
+			t.Errorf("确定性匹配应直接关联: %d, %+v", linked, cluster)
+		}
+		if zero, _ := g.Resolve(ctx, "00000000-0000-0000-0000-000000000000"); len(zero.Members) != 1 {
+			t.Errorf("全零IFA不应关联: %+v", zero)
+		}
+
+		// 超过身份簇上限时拒绝合并
+		small := NewIdentityGraph(store, IdentityConfig{LinkThreshold: 1, MaxClusterSize: 3})
+		if linked, _ := small.Observe(ctx, []string{"user_001", "ifa-2"}, true); linked != 0 {
+			t.Error("超过身份簇上限时不应关联")
+		}
+
+		// 未关联的共现计数过期后被清理
+		g.observe(ctx, []string{"x", "y"}, false, now)
+		if expired, err := g.ExpirePairs(ctx, now.Add(31*24*time.Hour)); err != nil || expired != 1 {
+			t.Errorf("应清理1个过期的共现计数: %d, %v", expired, err)
+		}
+	})
+}
+
+func TestMergedProfileAcrossDevices(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProfileStore()
+	if err := initTestData(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, store)
+
+	// 另一台设备上的转化行为
+	if _, err := client.UpdateUserBehavior(ctx, &pb.UpdateUserBehaviorRequest{UserId: "ifa-phone", Behavior: "conversion", AdId: "ad_002"}); err != nil {
+		t.Fatal(err)
+	}
+	upload, _ := client.UploadSegment(ctx)
+	upload.Send(&pb.UploadSegmentRequest{Payload: &pb.UploadSegmentRequest_Meta{Meta: &pb.UploadSegmentMeta{Id: "seg_crm"}}})
+	upload.Send(&pb.UploadSegmentRequest{Payload: &pb.UploadSegmentRequest_Chunk{Chunk: []byte("user_001\n")}})
+	if _, err := upload.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+
+	observed, err := client.ObserveIdentifiers(ctx, &pb.ObserveIdentifiersRequest{Identifiers: []string{"user_001", "ifa-phone"}, Deterministic: true})
+	if err != nil || observed.Linked != 1 {
+		t.Fatalf("关联标识失败: %+v, %v", observed, err)
+	}
+
+	resp, err := client.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: "ifa-phone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.UserId != "ifa-phone" || resp.PersonId != "user_001" {
+		t.Errorf("应返回请求的标识和合并后的人ID: %s, %s", resp.UserId, resp.PersonId)
+	}
+	if resp.Age != 28 || resp.City != "北京" || resp.DeviceType != "unknown" {
+		t.Errorf("人口属性应从关联的画像补全，设备类型保留请求设备的值: %+v", resp)
+	}
+	if !slices.Contains(resp.Tags, "运动爱好者") || !slices.Contains(resp.Tags, "购物达人") || !slices.Contains(resp.Interests, "beauty") {
+		t.Errorf("标签和兴趣应合并: %v, %v", resp.Tags, resp.Interests)
+	}
+	if !slices.Equal(resp.SegmentIds, []string{"seg_crm"}) {
+		t.Errorf("关联标识的名单人群应生效: %v", resp.SegmentIds)
+	}
+
+	batch, err := client.BatchGetUserProfiles(ctx, &pb.BatchGetUserProfilesRequest{UserIds: []string{"user_001", "user_002"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Profiles[0].PersonId != "user_001" || !slices.Contains(batch.Profiles[0].Interests, "shopping") {
+		t.Errorf("批量读取也应合并关联的画像: %+v", batch.Profiles[0])
+	}
+	if batch.Profiles[1].PersonId != "user_002" || strings.Contains(strings.Join(batch.Profiles[1].Tags, ","), "运动") {
+		t.Errorf("未关联的用户不受影响: %+v", batch.Profiles[1])
+	}
+
+	identity, err := client.ResolveIdentity(ctx, &pb.ResolveIdentityRequest{Identifier: "user_001"})
+	if err != nil || !slices.Equal(identity.Identifiers, []string{"ifa-phone", "user_001"}) {
+		t.Errorf("身份簇不正确: %+v, %v", identity, err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// AdCategoryResolver 查询广告所属的兴趣类目
+type AdCategoryResolver interface {
+	Categories(adID string) []string
+}
+
+// StaticAdCategories 固定的广告到类目映射
+type StaticAdCategories map[string][]string
+
+// Categories 查询广告类目
+func (s StaticAdCategories) Categories(adID string) []string {
+	return s[adID]
+}
+
+// DefaultAdCategories 示例广告的类目，与DSP模拟广告库一致
+func DefaultAdCategories() StaticAdCategories {
+	return StaticAdCategories{
+		"ad_001": {"sports"},
+		"ad_002": {"shopping", "beauty"},
+		"ad_003": {"technology"},
+	}
+}
+
+// LoadAdCategories 从JSON文件加载广告类目，格式为 {"ad_001": ["sports"], ...}
+func LoadAdCategories(path string) (StaticAdCategories, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var categories StaticAdCategories
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return nil, fmt.Errorf("解析广告类目文件失败: %w", err)
+	}
+	return categories, nil
+}
+
+// InterestConfig 兴趣模型参数
+type InterestConfig struct {
+	Weights   map[string]float64 // 行为类型 -> 每次行为的得分
+	HalfLife  time.Duration      // 得分半衰期
+	Threshold float64            // 得分达到该值的类目成为兴趣，并生成对应标签
+	MaxScore  float64            // 单个类目的得分上限，避免长期高频用户无法衰减
+	MinScore  float64            // 衰减到该值以下的类目从画像中移除
+	// CategoryTags 类目对应的画像标签，未配置的类目直接用类目名作标签
+	CategoryTags map[string]string
+}
+
+// DefaultInterestConfig 默认兴趣模型参数
+func DefaultInterestConfig() InterestConfig {
+	return InterestConfig{
+		Weights: map[string]float64{
+			"view":       1,
+			"click":      5,
+			"conversion": 20,
+		},
+		HalfLife:  7 * 24 * time.Hour,
+		Threshold: 10,
+		MaxScore:  100,
+		MinScore:  0.1,
+		CategoryTags: map[string]string{
+			"sports":     "运动爱好者",
+			"technology": "科技爱好者",
+			"shopping":   "购物达人",
+			"beauty":     "美妆爱好者",
+			"fashion":    "时尚达人",
+			"cars":       "汽车爱好者",
+			"finance":    "理财人群",
+			"gaming":     "游戏玩家",
+			"travel":     "旅游爱好者",
+		},
+	}
+}
+
+// BehaviorTag 行为推导出的标签及其得分
+type BehaviorTag struct {
+	Tag      string
+	Category string
+	Score    float64
+}
+
+// InterestModel 基于行为的兴趣模型
+// 每次行为按类型加权累加到广告所属类目的得分上，得分随时间指数衰减；
+// 得分越过阈值（上升或衰减后回落）时重新生成画像的行为兴趣和标签
+type InterestModel struct {
+	cfg        InterestConfig
+	categories AdCategoryResolver
+}
+
+// NewInterestModel 创建兴趣模型
+func NewInterestModel(cfg InterestConfig, categories AdCategoryResolver) *InterestModel {
+	return &InterestModel{
+		cfg:        cfg,
+		categories: categories,
+	}
+}
+
+// decayFactor 经过elapsed后得分保留的比例
+func (m *InterestModel) decayFactor(elapsed time.Duration) float64 {
+	if elapsed <= 0 || m.cfg.HalfLife <= 0 {
+		return 1
+	}
+	return math.Pow(0.5, float64(elapsed)/float64(m.cfg.HalfLife))
+}
+
+// decayed 返回衰减到now时的得分（不修改画像）
+func (m *InterestModel) decayed(profile *UserProfile, now time.Time) map[string]float64 {
+	factor := m.decayFactor(now.Sub(profile.ScoredAt))
+	scores := make(map[string]float64, len(profile.InterestScores))
+	for category, score := range profile.InterestScores {
+		if score *= factor; score >= m.cfg.MinScore {
+			scores[category] = score
+		}
+	}
+	return scores
+}
+
+// derive 得分达到阈值的类目，按类目名排序
+func (m *InterestModel) derive(scores map[string]float64) []string {
+	var derived []string
+	for category, score := range scores {
+		if score >= m.cfg.Threshold {
+			derived = append(derived, category)
+		}
+	}
+	sort.Strings(derived)
+	return derived
+}
+
+// Apply 记录一次行为，返回行为兴趣是否因此发生变化
+// 早于上次计分时间的行为（乱序到达）按其发生时间折算后计入
+func (m *InterestModel) Apply(profile *UserProfile, behavior, adID string, at, now time.Time) bool {
+	weight := m.cfg.Weights[behavior]
+	categories := m.categories.Categories(adID)
+
+	scores := m.decayed(profile, now)
+	if weight > 0 && len(categories) > 0 {
+		if at.IsZero() || at.After(now) {
+			at = now
+		}
+		weight *= m.decayFactor(now.Sub(at))
+		for _, category := range categories {
+			scores[category] = math.Min(scores[category]+weight, m.cfg.MaxScore)
+		}
+	}
+
+	return m.store(profile, scores, now)
+}
+
+// Refresh 把得分衰减到now，返回行为兴趣是否因衰减而变化
+func (m *InterestModel) Refresh(profile *UserProfile, now time.Time) bool {
+	return m.store(profile, m.decayed(profile, now), now)
+}
+
+// store 写回得分，行为兴趣变化时重新生成
+func (m *InterestModel) store(profile *UserProfile, scores map[string]float64, now time.Time) bool {
+	profile.InterestScores = scores
+	profile.ScoredAt = now
+
+	derived := m.derive(scores)
+	if slices.Equal(derived, profile.DerivedInterests) {
+		return false
+	}
+	profile.DerivedInterests = derived
+	return true
+}
+
+// Tag 类目对应的标签
+func (m *InterestModel) Tag(category string) string {
+	if tag, ok := m.cfg.CategoryTags[category]; ok {
+		return tag
+	}
+	return category
+}
+
+// BehaviorTags 返回画像的行为标签及now时的得分，按得分降序
+func (m *InterestModel) BehaviorTags(profile *UserProfile, now time.Time) []BehaviorTag {
+	scores := m.decayed(profile, now)
+	tags := make([]BehaviorTag, 0, len(profile.DerivedInterests))
+	for _, category := range profile.DerivedInterests {
+		tags = append(tags, BehaviorTag{
+			Tag:      m.Tag(category),
+			Category: category,
+			Score:    scores[category],
+		})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Score != tags[j].Score {
+			return tags[i].Score > tags[j].Score
+		}
+		return tags[i].Category < tags[j].Category
+	})
+	return tags
+}
+
+// MergedTags 画像标签加上行为标签（去重，保持顺序）
+func (m *InterestModel) MergedTags(profile *UserProfile) []string {
+	tags := make([]string, 0, len(profile.DerivedInterests))
+	for _, category := range profile.DerivedInterests {
+		tags = append(tags, m.Tag(category))
+	}
+	return mergeUnique(profile.Tags, tags)
+}
+
+// MergedInterests 画像兴趣加上行为兴趣（去重，保持顺序）
+func (m *InterestModel) MergedInterests(profile *UserProfile) []string {
+	return mergeUnique(profile.Interests, profile.DerivedInterests)
+}
+
+// mergeUnique 合并两个列表并去重
+func mergeUnique(base, extra []string) []string {
+	seen := make(map[string]bool, len(base)+len(extra))
+	merged := make([]string, 0, len(base)+len(extra))
+	for _, list := range [][]string{base, extra} {
+		for _, item := range list {
+			if !seen[item] {
+				seen[item] = true
+				merged = append(merged, item)
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	pb "dsp-system/proto"
+)
+
+func TestInterestThresholdAndDecay(t *testing.T) {
+	m := NewInterestModel(DefaultInterestConfig(), DefaultAdCategories())
+	now := time.Now()
+	profile := &UserProfile{UserID: "u"}
+
+	// 浏览不足以形成兴趣
+	if m.Apply(profile, "view", "ad_003", now, now) {
+		t.Error("一次浏览不应越过阈值")
+	}
+	if m.Apply(profile, "click", "ad_003", now, now) || !m.Apply(profile, "click", "ad_003", now, now) {
+		t.Error("第二次点击后应越过阈值")
+	}
+	if !slices.Equal(profile.DerivedInterests, []string{"technology"}) || profile.InterestScores["technology"] != 11 {
+		t.Fatalf("行为兴趣不正确: %+v", profile)
+	}
+
+	// 未知行为和未知广告不计分
+	m.Apply(profile, "share", "ad_003", now, now)
+	m.Apply(profile, "click", "ad_unknown", now, now)
+	if len(profile.InterestScores) != 1 || profile.InterestScores["technology"] != 11 {
+		t.Errorf("未知行为或广告不应计分: %+v", profile.InterestScores)
+	}
+
+	// 两个半衰期后得分降到阈值以下
+	later := now.Add(14 * 24 * time.Hour)
+	if !m.Refresh(profile, later) || len(profile.DerivedInterests) != 0 {
+		t.Errorf("衰减到阈值以下后应移除行为兴趣: %+v", profile)
+	}
+	if score := profile.InterestScores["technology"]; math.Abs(score-2.75) > 1e-9 {
+		t.Errorf("衰减后的得分应为2.75，实际为%v", score)
+	}
+}
+
+func TestInterestLateEvent(t *testing.T) {
+	m := NewInterestModel(DefaultInterestConfig(), DefaultAdCategories())
+	now := time.Now()
+	profile := &UserProfile{UserID: "u"}
+
+	// 一个半衰期前的转化按一半计入
+	m.Apply(profile, "conversion", "ad_001", now.Add(-7*24*time.Hour), now)
+	if score := profile.InterestScores["sports"]; math.Abs(score-10) > 1e-9 {
+		t.Errorf("迟到的行为应按发生时间衰减，实际得分%v", score)
+	}
+}
+
+func TestBehaviorTagsInProfile(t *testing.T) {
+	store := NewMemoryProfileStore()
+	ctx := context.Background()
+	if err := initTestData(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, store)
+
+	if _, err := s.UpdateUserBehavior(ctx, &pb.UpdateUserBehaviorRequest{UserId: "user_001", Behavior: "conversion", AdId: "ad_002"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: "user_001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(resp.Tags, "运动爱好者") || !slices.Contains(resp.Tags, "购物达人") || !slices.Contains(resp.Tags, "美妆爱好者") {
+		t.Errorf("应保留原有标签并加入行为标签: %v", resp.Tags)
+	}
+	if !slices.Contains(resp.Interests, "sports") || !slices.Contains(resp.Interests, "shopping") {
+		t.Errorf("应保留原有兴趣并加入行为兴趣: %v", resp.Interests)
+	}
+	if len(resp.BehaviorTags) != 2 || resp.BehaviorTags[0].Category != "beauty" || resp.BehaviorTags[0].Score < 19.99 {
+		t.Errorf("行为标签及得分不正确: %+v", resp.BehaviorTags)
+	}
+
+	// 新用户的行为同样生效
+	for i := 0; i < 3; i++ {
+		s.UpdateUserBehavior(ctx, &pb.UpdateUserBehaviorRequest{UserId: "user_new", Behavior: "click", AdId: "ad_003"})
+	}
+	resp, _ = s.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: "user_new"})
+	if !slices.Equal(resp.Tags, []string{"新用户", "科技爱好者"}) {
+		t.Errorf("新用户的行为标签不正确: %v", resp.Tags)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrProfileNotFound 用户画像不存在
+var ErrProfileNotFound = errors.New("用户画像不存在")
+
+// ProfileStore 用户画像存储
+type ProfileStore interface {
+	Get(ctx context.Context, userID string) (*UserProfile, error)
+	// BatchGet 批量读取，不存在的用户不出现在结果中
+	BatchGet(ctx context.Context, userIDs []string) (map[string]*UserProfile, error)
+	Put(ctx context.Context, profile *UserProfile) error
+	// Update 原子地读改写一个画像，用户不存在时fn收到只有UserID的画像且exists为false
+	Update(ctx context.Context, userID string, fn func(profile *UserProfile, exists bool) error) (*UserProfile, error)
+	Delete(ctx context.Context, userID string) error
+
+	// ExpireInactive 删除最后活跃时间早于before的画像，返回删除数量
+	ExpireInactive(ctx context.Context, before time.Time) (int, error)
+	// ForEach 按用户ID顺序遍历全部画像，fn返回错误时停止
+	ForEach(ctx context.Context, fn func(profile *UserProfile) error) error
+	Count(ctx context.Context) (int, error)
+
+	Close() error
+}
+
+// clone 深拷贝画像，存储内外不共享切片
+func (p *UserProfile) clone() *UserProfile {
+	c := *p
+	c.Tags = append([]string(nil), p.Tags...)
+	c.Interests = append([]string(nil), p.Interests...)
+	c.DerivedInterests = append([]string(nil), p.DerivedInterests...)
+	if p.InterestScores != nil {
+		c.InterestScores = make(map[string]float64, len(p.InterestScores))
+		for category, score := range p.InterestScores {
+			c.InterestScores[category] = score
+		}
+	}
+	return &c
+}
+
+// MemoryProfileStore 进程内画像存储，重启后数据丢失，用于测试
+type MemoryProfileStore struct {
+	profiles map[string]*UserProfile
+	segments map[string]*Segment
+	members  map[string]map[string]struct{} // 成员集合名 -> 成员键
+
+	clusters      map[string]*IdentityCluster
+	identityLinks map[string]string // 标识 -> 身份簇ID
+	identityPairs map[string]identityPair
+
+	audit []*AuditRecord
+	mu    sync.RWMutex
+}
+
+// NewMemoryProfileStore 创建内存画像存储
+func NewMemoryProfileStore() *MemoryProfileStore {
+	return &MemoryProfileStore{
+		profiles: make(map[string]*UserProfile),
+		segments: make(map[string]*Segment),
+		members:  make(map[string]map[string]struct{}),
+
+		clusters:      make(map[string]*IdentityCluster),
+		identityLinks: make(map[string]string),
+		identityPairs: make(map[string]identityPair),
+	}
+}
+
+// Get 读取画像
+func (m *MemoryProfileStore) Get(ctx context.Context, userID string) (*UserProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	profile, exists := m.profiles[userID]
+	if !exists {
+		return nil, ErrProfileNotFound
+	}
+	return profile.clone(), nil
+}
+
+// BatchGet 批量读取画像
+func (m *MemoryProfileStore) BatchGet(ctx context.Context, userIDs []string) (map[string]*UserProfile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make(map[string]*UserProfile, len(userIDs))
+	for _, userID := range userIDs {
+		if profile, exists := m.profiles[userID]; exists {
+			result[userID] = profile.clone()
+		}
+	}
+	return result, nil
+}
+
+// Put 写入画像
+func (m *MemoryProfileStore) Put(ctx context.Context, profile *UserProfile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.profiles[profile.UserID] = profile.clone()
+	return nil
+}
+
+// Update 读改写画像
+func (m *MemoryProfileStore) Update(ctx context.Context, userID string, fn func(profile *UserProfile, exists bool) error) (*UserProfile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	profile, exists := m.profiles[userID]
+	if exists {
+		profile = profile.clone()
+	} else {
+		profile = &UserProfile{UserID: userID}
+	}
+	if err := fn(profile, exists); err != nil {
+		return nil, err
+	}
+
+	m.profiles[userID] = profile.clone()
+	return profile, nil
+}
+
+// Delete 删除画像
+func (m *MemoryProfileStore) Delete(ctx context.Context, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.profiles[userID]; !exists {
+		return ErrProfileNotFound
+	}
+	delete(m.profiles, userID)
+	return nil
+}
+
+// ExpireInactive 删除不活跃的画像
+func (m *MemoryProfileStore) ExpireInactive(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := 0
+	for userID, profile := range m.profiles {
+		if profile.UpdatedAt.Before(before) {
+			delete(m.profiles, userID)
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// ForEach 遍历画像
+func (m *MemoryProfileStore) ForEach(ctx context.Context, fn func(profile *UserProfile) error) error {
+	m.mu.RLock()
+	profiles := make([]*UserProfile, 0, len(m.profiles))
+	for _, profile := range m.profiles {
+		profiles = append(profiles, profile.clone())
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].UserID < profiles[j].UserID })
+	for _, profile := range profiles {
+		if err := fn(profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Count 画像数量
+func (m *MemoryProfileStore) Count(ctx context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.profiles), nil
+}
+
+// Close 内存存储无需关闭
+func (m *MemoryProfileStore) Close() error {
+	return nil
+}
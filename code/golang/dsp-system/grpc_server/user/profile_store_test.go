@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// forEachProfileStore 分别用内存存储和bbolt存储运行同一组测试
+func forEachProfileStore(t *testing.T, fn func(t *testing.T, store UserStore)) {
+	t.Run("memory", func(t *testing.T) {
+		fn(t, NewMemoryProfileStore())
+	})
+	t.Run("bolt", func(t *testing.T) {
+		store, err := NewBoltProfileStore(filepath.Join(t.TempDir(), "profiles.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		fn(t, store)
+	})
+}
+
+func TestProfileStoreReadWrite(t *testing.T) {
+	forEachProfileStore(t, func(t *testing.T, store UserStore) {
+		ctx := context.Background()
+		if err := initTestData(ctx, store); err != nil {
+			t.Fatal(err)
+		}
+
+		profile, err := store.Get(ctx, "user_002")
+		if err != nil || profile.City != "上海" || len(profile.Interests) != 3 {
+			t.Fatalf("读取画像不正确: %+v, %v", profile, err)
+		}
+
+		// 修改读出的画像不应影响存储
+		profile.Tags[0] = "changed"
+		if again, _ := store.Get(ctx, "user_002"); again.Tags[0] != "女性" {
+			t.Errorf("存储内的画像被外部修改: %+v", again)
+		}
+
+		if _, err := store.Get(ctx, "user_missing"); !errors.Is(err, ErrProfileNotFound) {
+			t.Errorf("不存在的用户应返回ErrProfileNotFound: %v", err)
+		}
+
+		found, err := store.BatchGet(ctx, []string{"user_001", "user_missing", "user_003"})
+		if err != nil || len(found) != 2 || found["user_003"].Age != 38 {
+			t.Errorf("批量读取不正确: %+v, %v", found, err)
+		}
+
+		updated, err := store.Update(ctx, "user_new", func(p *UserProfile, exists bool) error {
+			if exists {
+				t.Error("新用户不应存在")
+			}
+			p.Tags = []string{"新用户"}
+			p.UpdatedAt = time.Now()
+			return nil
+		})
+		if err != nil || updated.UserID != "user_new" {
+			t.Fatalf("创建画像失败: %+v, %v", updated, err)
+		}
+		if count, _ := store.Count(ctx); count != 5 {
+			t.Errorf("画像数量应为5，实际为%d", count)
+		}
+
+		if err := store.Delete(ctx, "user_new"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Delete(ctx, "user_new"); !errors.Is(err, ErrProfileNotFound) {
+			t.Errorf("重复删除应返回ErrProfileNotFound: %v", err)
+		}
+
+		var ids []string
+		store.ForEach(ctx, func(p *UserProfile) error {
+			ids = append(ids, p.UserID)
+			return nil
+		})
+		if len(ids) != 4 || ids[0] != "user_001" || ids[3] != "user_12345" {
+			t.Errorf("遍历顺序不正确: %v", ids)
+		}
+	})
+}
+
+func TestProfileStoreExpireInactive(t *testing.T) {
+	forEachProfileStore(t, func(t *testing.T, store UserStore) {
+		ctx := context.Background()
+		now := time.Now()
+
+		store.Put(ctx, &UserProfile{UserID: "old", UpdatedAt: now.Add(-100 * 24 * time.Hour)})
+		store.Put(ctx, &UserProfile{UserID: "recent", UpdatedAt: now.Add(-time.Hour)})
+		store.Put(ctx, &UserProfile{UserID: "revived", UpdatedAt: now.Add(-200 * 24 * time.Hour)})
+
+		// 重新活跃的用户不应被清理
+		store.Update(ctx, "revived", func(p *UserProfile, exists bool) error {
+			p.UpdatedAt = now
+			return nil
+		})
+
+		expired, err := store.ExpireInactive(ctx, now.Add(-90*24*time.Hour))
+		if err != nil || expired != 1 {
+			t.Fatalf("应清理1个过期画像，实际为%d: %v", expired, err)
+		}
+		if _, err := store.Get(ctx, "old"); !errors.Is(err, ErrProfileNotFound) {
+			t.Error("过期画像应被删除")
+		}
+		if _, err := store.Get(ctx, "revived"); err != nil {
+			t.Errorf("重新活跃的画像不应被删除: %v", err)
+		}
+	})
+}
+
+func TestBoltProfileStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.db")
+	ctx := context.Background()
+
+	store, err := NewBoltProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := initTestData(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewBoltProfileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	profile, err := store.Get(ctx, "user_12345")
+	if err != nil || profile.City != "杭州" || profile.UpdatedAt.IsZero() {
+		t.Errorf("重新打开后画像应保留: %+v, %v", profile, err)
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 人群类型
+const (
+	SegmentTypeList = "list" // 上传的用户ID名单
+	SegmentTypeRule = "rule" // 按画像属性规则圈定
+)
+
+// 名单的哈希方式（上传的是用户ID的十六进制小写摘要）
+const (
+	HashNone   = ""
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+var (
+	// ErrSegmentNotFound 人群不存在
+	ErrSegmentNotFound = errors.New("人群不存在")
+	// ErrSegmentExists 人群已存在
+	ErrSegmentExists = errors.New("人群已存在")
+)
+
+// Segment 人群
+type Segment struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Type     string       `json:"type"`
+	HashType string       `json:"hash_type,omitempty"` // 名单人群的哈希方式
+	Rule     *SegmentRule `json:"rule,omitempty"`      // 规则人群的规则
+	Size     int          `json:"size"`                // 名单人群的成员数
+	// MemberSet 名单成员在存储中的集合名；替换名单时写入新集合后再切换，查询不会看到半成品
+	MemberSet string    `json:"member_set,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SegmentRule 画像属性规则
+type SegmentRule struct {
+	MatchAll   bool               `json:"match_all"` // true要求全部条件满足，false满足任一即可
+	Conditions []SegmentCondition `json:"conditions"`
+}
+
+// SegmentCondition 单个属性条件
+// 字段：age、gender、city、device_type、tags、interests
+// 操作：eq、ne、in、not_in（单值字段）；gte、lte（age）；contains、not_contains（tags、interests，匹配任一值）
+type SegmentCondition struct {
+	Field  string   `json:"field"`
+	Op     string   `json:"op"`
+	Values []string `json:"values"`
+}
+
+// validate 检查规则是否合法
+func (r *SegmentRule) validate() error {
+	if r == nil || len(r.Conditions) == 0 {
+		return errors.New("规则至少需要一个条件")
+	}
+	for _, c := range r.Conditions {
+		if len(c.Values) == 0 {
+			return fmt.Errorf("条件缺少取值: %s %s", c.Field, c.Op)
+		}
+		switch c.Field {
+		case "age":
+			if !slices.Contains([]string{"eq", "ne", "gte", "lte"}, c.Op) {
+				return fmt.Errorf("age不支持操作: %s", c.Op)
+			}
+			if _, err := strconv.Atoi(c.Values[0]); err != nil {
+				return fmt.Errorf("age取值必须为整数: %s", c.Values[0])
+			}
+		case "gender", "city", "device_type":
+			if !slices.Contains([]string{"eq", "ne", "in", "not_in"}, c.Op) {
+				return fmt.Errorf("%s不支持操作: %s", c.Field, c.Op)
+			}
+		case "tags", "interests":
+			if !slices.Contains([]string{"contains", "not_contains"}, c.Op) {
+				return fmt.Errorf("%s不支持操作: %s", c.Field, c.Op)
+			}
+		default:
+			return fmt.Errorf("不支持的字段: %s", c.Field)
+		}
+	}
+	return nil
+}
+
+// Match 画像是否满足规则
+func (r *SegmentRule) Match(profile *UserProfile) bool {
+	for _, c := range r.Conditions {
+		matched := c.match(profile)
+		if r.MatchAll && !matched {
+			return false
+		}
+		if !r.MatchAll && matched {
+			return true
+		}
+	}
+	return r.MatchAll
+}
+
+// match 画像是否满足条件
+func (c SegmentCondition) match(profile *UserProfile) bool {
+	switch c.Field {
+	case "age":
+		// 年龄未知的用户不满足任何年龄条件
+		if profile.Age <= 0 {
+			return false
+		}
+		v, _ := strconv.Atoi(c.Values[0])
+		age := int(profile.Age)
+		switch c.Op {
+		case "eq":
+			return age == v
+		case "ne":
+			return age != v
+		case "gte":
+			return age >= v
+		case "lte":
+			return age <= v
+		}
+	case "gender", "city", "device_type":
+		value := map[string]string{
+			"gender":      profile.Gender,
+			"city":        profile.City,
+			"device_type": profile.DeviceType,
+		}[c.Field]
+		switch c.Op {
+		case "eq":
+			return value == c.Values[0]
+		case "ne":
+			return value != c.Values[0]
+		case "in":
+			return slices.Contains(c.Values, value)
+		case "not_in":
+			return !slices.Contains(c.Values, value)
+		}
+	case "tags", "interests":
+		list := profile.Tags
+		if c.Field == "interests" {
+			list = profile.Interests
+		}
+		found := slices.ContainsFunc(c.Values, func(v string) bool { return slices.Contains(list, v) })
+		if c.Op == "contains" {
+			return found
+		}
+		return !found
+	}
+	return false
+}
+
+// hashUserID 按名单的哈希方式计算用户ID的成员键
+func hashUserID(hashType, userID string) string {
+	switch hashType {
+	case HashMD5:
+		sum := md5.Sum([]byte(userID))
+		return hex.EncodeToString(sum[:])
+	case HashSHA1:
+		sum := sha1.Sum([]byte(userID))
+		return hex.EncodeToString(sum[:])
+	case HashSHA256:
+		sum := sha256.Sum256([]byte(userID))
+		return hex.EncodeToString(sum[:])
+	default:
+		return userID
+	}
+}
+
+// normalizeMember 规范化上传的成员，不合法时返回false
+func normalizeMember(hashType, value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false
+	}
+
+	length := map[string]int{HashMD5: 32, HashSHA1: 40, HashSHA256: 64}[hashType]
+	if length == 0 {
+		return value, true
+	}
+
+	value = strings.ToLower(value)
+	if len(value) != length {
+		return "", false
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// ListFormat 上传名单的文件格式
+type ListFormat struct {
+	CSV       bool // false表示每行一个ID
+	Column    int  // CSV中ID所在列（从0开始）
+	HasHeader bool // 首行是表头
+}
+
+// ImportResult 名单导入结果
+type ImportResult struct {
+	Added   int // 新增成员
+	Invalid int // 不合法（空值、哈希格式错误）的行
+	Total   int // 导入后的成员总数
+}
+
+// importBatchSize 每批写入存储的成员数
+const importBatchSize = 10000
+
+// readMembers 逐行读取名单，按批回调
+func readMembers(r io.Reader, format ListFormat, hashType string, batch func(keys []string) error) (invalid int, err error) {
+	var keys []string
+	add := func(value string) error {
+		key, ok := normalizeMember(hashType, value)
+		if !ok {
+			invalid++
+			return nil
+		}
+		keys = append(keys, key)
+		if len(keys) >= importBatchSize {
+			err := batch(keys)
+			keys = nil
+			return err
+		}
+		return nil
+	}
+
+	first := true
+	if format.CSV {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return invalid, fmt.Errorf("解析CSV失败: %w", err)
+			}
+			if first && format.HasHeader {
+				first = false
+				continue
+			}
+			first = false
+			if format.Column >= len(record) {
+				invalid++
+				continue
+			}
+			if err := add(record[format.Column]); err != nil {
+				return invalid, err
+			}
+		}
+	} else {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if first && format.HasHeader {
+				first = false
+				continue
+			}
+			first = false
+			// 空行和注释行直接跳过，不计为不合法
+			if trimmed := strings.TrimSpace(line); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				continue
+			}
+			if err := add(line); err != nil {
+				return invalid, err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return invalid, err
+		}
+	}
+
+	if len(keys) > 0 {
+		return invalid, batch(keys)
+	}
+	return invalid, nil
+}
+
+// SegmentManager 人群管理
+// 人群元数据常驻内存；名单成员保存在存储中，成员判断是一次按键查找
+type SegmentManager struct {
+	store SegmentStore
+
+	// writeMu 串行化人群的创建、导入和删除；导入期间成员判断不受影响
+	writeMu sync.Mutex
+
+	mu       sync.RWMutex
+	segments map[string]*Segment
+}
+
+// get 读取人群元数据
+func (m *SegmentManager) get(id string) (*Segment, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	segment, exists := m.segments[id]
+	return segment, exists
+}
+
+// set 更新人群元数据，segment为nil表示删除
+func (m *SegmentManager) set(id string, segment *Segment) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if segment == nil {
+		delete(m.segments, id)
+	} else {
+		m.segments[id] = segment
+	}
+}
+
+// NewSegmentManager 创建人群管理并加载已有人群
+func NewSegmentManager(ctx context.Context, store SegmentStore) (*SegmentManager, error) {
+	segments, err := store.ListSegments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &SegmentManager{
+		store:    store,
+		segments: make(map[string]*Segment, len(segments)),
+	}
+	for _, segment := range segments {
+		m.segments[segment.ID] = segment
+	}
+	return m, nil
+}
+
+// CreateRuleSegment 创建规则人群
+func (m *SegmentManager) CreateRuleSegment(ctx context.Context, id, name string, rule *SegmentRule) (*Segment, error) {
+	if id == "" {
+		return nil, errors.New("人群ID不能为空")
+	}
+	if err := rule.validate(); err != nil {
+		return nil, err
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	if _, exists := m.get(id); exists {
+		return nil, ErrSegmentExists
+	}
+
+	now := time.Now()
+	segment := &Segment{
+		ID:        id,
+		Name:      name,
+		Type:      SegmentTypeRule,
+		Rule:      rule,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := m.store.PutSegment(ctx, segment); err != nil {
+		return nil, err
+	}
+	m.set(id, segment)
+	return segment, nil
+}
+
+// ImportList 从上传的文件导入名单人群
+// 人群不存在时创建；已存在时appendMembers为true则追加，否则替换全部成员
+func (m *SegmentManager) ImportList(ctx context.Context, id, name, hashType string, r io.Reader, format ListFormat, appendMembers bool) (*Segment, ImportResult, error) {
+	var result ImportResult
+	if id == "" {
+		return nil, result, errors.New("人群ID不能为空")
+	}
+	if !slices.Contains([]string{HashNone, HashMD5, HashSHA1, HashSHA256}, hashType) {
+		return nil, result, fmt.Errorf("不支持的哈希方式: %s", hashType)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	now := time.Now()
+	segment := &Segment{
+		ID:        id,
+		Name:      name,
+		Type:      SegmentTypeList,
+		HashType:  hashType,
+		MemberSet: id + "@" + strconv.FormatInt(now.UnixNano(), 10),
+		CreatedAt: now,
+	}
+	existing, exists := m.get(id)
+	if exists {
+		if existing.Type != SegmentTypeList {
+			return nil, result, fmt.Errorf("人群%s不是名单人群", id)
+		}
+		if existing.HashType != hashType {
+			return nil, result, fmt.Errorf("哈希方式与已有人群不一致: %s", existing.HashType)
+		}
+		segment.CreatedAt = existing.CreatedAt
+		if name == "" {
+			segment.Name = existing.Name
+		}
+		if appendMembers {
+			segment.MemberSet = existing.MemberSet
+			segment.Size = existing.Size
+		}
+	}
+
+	invalid, err := readMembers(r, format, hashType, func(keys []string) error {
+		added, err := m.store.AddMembers(ctx, segment.MemberSet, keys)
+		segment.Size += added
+		result.Added += added
+		return err
+	})
+	result.Invalid = invalid
+	if err != nil {
+		// 替换失败时丢弃写了一半的新集合，原名单保持不变
+		if !exists || segment.MemberSet != existing.MemberSet {
+			m.store.DropMembers(ctx, segment.MemberSet)
+		}
+		return nil, result, err
+	}
+
+	segment.UpdatedAt = time.Now()
+	if err := m.store.PutSegment(ctx, segment); err != nil {
+		return nil, result, err
+	}
+	m.set(id, segment)
+
+	if exists && existing.MemberSet != segment.MemberSet {
+		if err := m.store.DropMembers(ctx, existing.MemberSet); err != nil {
+			log.Printf("清理旧名单失败: SegmentID=%s, err=%v", id, err)
+		}
+	}
+
+	result.Total = segment.Size
+	return segment, result, nil
+}
+
+// Delete 删除人群及其成员
+func (m *SegmentManager) Delete(ctx context.Context, id string) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	segment, exists := m.get(id)
+	if !exists {
+		return ErrSegmentNotFound
+	}
+	if err := m.store.DeleteSegment(ctx, id); err != nil {
+		return err
+	}
+	m.set(id, nil)
+
+	if segment.MemberSet != "" {
+		if err := m.store.DropMembers(ctx, segment.MemberSet); err != nil {
+			log.Printf("清理名单成员失败: SegmentID=%s, err=%v", id, err)
+		}
+	}
+	return nil
+}
+
+// RemoveUser 从全部名单人群中删除用户的各个标识，返回删除的成员数
+func (m *SegmentManager) RemoveUser(ctx context.Context, userIDs []string) (int, error) {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	removed := 0
+	for _, segment := range m.List() {
+		if segment.Type != SegmentTypeList || segment.MemberSet == "" {
+			continue
+		}
+		keys := make([]string, 0, len(userIDs))
+		for _, userID := range userIDs {
+			keys = append(keys, hashUserID(segment.HashType, userID))
+		}
+
+		n, err := m.store.RemoveMembers(ctx, segment.MemberSet, keys)
+		if err != nil {
+			return removed, err
+		}
+		if n == 0 {
+			continue
+		}
+		removed += n
+
+		updated := *segment
+		updated.Size = max(updated.Size-n, 0)
+		updated.UpdatedAt = time.Now()
+		if err := m.store.PutSegment(ctx, &updated); err != nil {
+			return removed, err
+		}
+		m.set(segment.ID, &updated)
+	}
+	return removed, nil
+}
+
+// List 全部人群，按ID排序
+func (m *SegmentManager) List() []*Segment {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	segments := make([]*Segment, 0, len(m.segments))
+	for _, segment := range m.segments {
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments
+}
+
+// UserSegments 返回用户所属的人群ID（按ID排序）
+// userIDs为同一个人的全部标识，任一标识在名单中即属于该名单人群；
+// profile为nil表示用户没有画像，此时只判断名单人群；规则应使用合并了行为标签的画像
+func (m *SegmentManager) UserSegments(ctx context.Context, userIDs []string, profile *UserProfile) ([]string, error) {
+	segments := m.List()
+
+	keys := make(map[string][]string) // 哈希方式 -> 各标识的成员键，每种方式只计算一次
+	var ids []string
+	for _, segment := range segments {
+		switch segment.Type {
+		case SegmentTypeRule:
+			if profile != nil && segment.Rule.Match(profile) {
+				ids = append(ids, segment.ID)
+			}
+		case SegmentTypeList:
+			hashed, ok := keys[segment.HashType]
+			if !ok {
+				for _, userID := range userIDs {
+					hashed = append(hashed, hashUserID(segment.HashType, userID))
+				}
+				keys[segment.HashType] = hashed
+			}
+			for _, key := range hashed {
+				member, err := m.store.IsMember(ctx, segment.MemberSet, key)
+				if err != nil {
+					return nil, err
+				}
+				if member {
+					ids = append(ids, segment.ID)
+					break
+				}
+			}
+		}
+	}
+	return ids, nil
+}
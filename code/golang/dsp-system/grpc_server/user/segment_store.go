@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"sort"
+)
+
+// SegmentStore 人群存储
+// 名单成员按集合保存，集合名由SegmentManager分配（见Segment.MemberSet）
+type SegmentStore interface {
+	PutSegment(ctx context.Context, segment *Segment) error
+	ListSegments(ctx context.Context) ([]*Segment, error)
+	// DeleteSegment 只删除人群元数据，成员集合由调用方单独清理
+	DeleteSegment(ctx context.Context, id string) error
+
+	// AddMembers 向集合添加成员，返回新增（之前不存在）的数量
+	AddMembers(ctx context.Context, set string, keys []string) (int, error)
+	IsMember(ctx context.Context, set, key string) (bool, error)
+	// RemoveMembers 从集合删除成员，返回实际删除的数量
+	RemoveMembers(ctx context.Context, set string, keys []string) (int, error)
+	// DropMembers 删除整个集合
+	DropMembers(ctx context.Context, set string) error
+}
+
+// UserStore 用户服务的全部持久化数据
+type UserStore interface {
+	ProfileStore
+	SegmentStore
+	IdentityStore
+	AuditStore
+}
+
+// PutSegment 写入人群元数据
+func (m *MemoryProfileStore) PutSegment(ctx context.Context, segment *Segment) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := *segment
+	m.segments[segment.ID] = &c
+	return nil
+}
+
+// ListSegments 全部人群，按ID排序
+func (m *MemoryProfileStore) ListSegments(ctx context.Context) ([]*Segment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	segments := make([]*Segment, 0, len(m.segments))
+	for _, segment := range m.segments {
+		c := *segment
+		segments = append(segments, &c)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].ID < segments[j].ID })
+	return segments, nil
+}
+
+// DeleteSegment 删除人群元数据
+func (m *MemoryProfileStore) DeleteSegment(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.segments[id]; !exists {
+		return ErrSegmentNotFound
+	}
+	delete(m.segments, id)
+	return nil
+}
+
+// AddMembers 添加成员
+func (m *MemoryProfileStore) AddMembers(ctx context.Context, set string, keys []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members, exists := m.members[set]
+	if !exists {
+		members = make(map[string]struct{}, len(keys))
+		m.members[set] = members
+	}
+
+	added := 0
+	for _, key := range keys {
+		if _, exists := members[key]; !exists {
+			members[key] = struct{}{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+// IsMember 成员判断
+func (m *MemoryProfileStore) IsMember(ctx context.Context, set, key string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, exists := m.members[set][key]
+	return exists, nil
+}
+
+// RemoveMembers 删除成员
+func (m *MemoryProfileStore) RemoveMembers(ctx context.Context, set string, keys []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := m.members[set]
+	removed := 0
+	for _, key := range keys {
+		if _, exists := members[key]; exists {
+			delete(members, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// DropMembers 删除集合
+func (m *MemoryProfileStore) DropMembers(ctx context.Context, set string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.members, set)
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	pb "dsp-system/proto"
+)
+
+// newTestSegments 创建使用指定存储的人群管理
+func newTestSegments(t *testing.T, store SegmentStore) *SegmentManager {
+	t.Helper()
+
+	segments, err := NewSegmentManager(context.Background(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
+
+func TestSegmentRuleMatch(t *testing.T) {
+	profile := &UserProfile{Age: 28, Gender: "male", City: "北京", Tags: []string{"运动爱好者"}, Interests: []string{"sports"}}
+
+	cases := []struct {
+		rule SegmentRule
+		want bool
+	}{
+		{SegmentRule{MatchAll: true, Conditions: []SegmentCondition{{"age", "gte", []string{"25"}}, {"age", "lte", []string{"34"}}}}, true},
+		{SegmentRule{MatchAll: true, Conditions: []SegmentCondition{{"gender", "eq", []string{"male"}}, {"city", "in", []string{"上海", "深圳"}}}}, false},
+		{SegmentRule{Conditions: []SegmentCondition{{"gender", "eq", []string{"female"}}, {"city", "in", []string{"北京"}}}}, true},
+		{SegmentRule{Conditions: []SegmentCondition{{"tags", "contains", []string{"科技爱好者", "运动爱好者"}}}}, true},
+		{SegmentRule{Conditions: []SegmentCondition{{"interests", "not_contains", []string{"sports"}}}}, false},
+	}
+	for i, c := range cases {
+		if err := c.rule.validate(); err != nil {
+			t.Fatalf("规则%d应合法: %v", i, err)
+		}
+		if got := c.rule.Match(profile); got != c.want {
+			t.Errorf("规则%d匹配结果应为%v", i, c.want)
+		}
+	}
+
+	// 年龄未知的用户不满足年龄条件
+	unknown := SegmentRule{Conditions: []SegmentCondition{{"age", "lte", []string{"30"}}}}
+	if unknown.Match(&UserProfile{}) {
+		t.Error("年龄未知的用户不应满足年龄条件")
+	}
+
+	invalid := []SegmentRule{
+		{},
+		{Conditions: []SegmentCondition{{"age", "contains", []string{"1"}}}},
+		{Conditions: []SegmentCondition{{"income", "eq", []string{"1"}}}},
+		{Conditions: []SegmentCondition{{"city", "eq", nil}}},
+	}
+	for i, rule := range invalid {
+		if rule.validate() == nil {
+			t.Errorf("规则%d应不合法", i)
+		}
+	}
+}
+
+func TestSegmentImportList(t *testing.T) {
+	forEachProfileStore(t, func(t *testing.T, store UserStore) {
+		ctx := context.Background()
+		segments := newTestSegments(t, store)
+
+		// 明文名单，跳过空行和注释行
+		_, result, err := segments.ImportList(ctx, "seg_plain", "明文名单", HashNone,
+			strings.NewReader("user_001\n\n# 注释\nuser_002\nuser_001\n"), ListFormat{}, false)
+		if err != nil || result.Added != 2 || result.Invalid != 0 || result.Total != 2 {
+			t.Fatalf("导入明文名单结果不正确: %+v, %v", result, err)
+		}
+
+		// MD5名单，CSV第二列，大写摘要规范化为小写，格式错误的行计为不合法
+		sum := md5.Sum([]byte("user_003"))
+		csv := "email,device_md5\na@example.com," + strings.ToUpper(hex.EncodeToString(sum[:])) + "\nb@example.com,not-a-hash\nc@example.com\n"
+		_, result, err = segments.ImportList(ctx, "seg_md5", "", HashMD5,
+			strings.NewReader(csv), ListFormat{CSV: true, Column: 1, HasHeader: true}, false)
+		if err != nil || result.Added != 1 || result.Invalid != 2 {
+			t.Fatalf("导入MD5名单结果不正确: %+v, %v", result, err)
+		}
+
+		for userID, want := range map[string][]string{
+			"user_001": {"seg_plain"},
+			"user_003": {"seg_md5"},
+			"user_999": nil,
+		} {
+			got, err := segments.UserSegments(ctx, []string{userID}, nil)
+			if err != nil || !slices.Equal(got, want) {
+				t.Errorf("%s所属人群应为%v，实际为%v, %v", userID, want, got, err)
+			}
+		}
+
+		// 追加保留原有成员，替换则只保留新成员
+		if _, result, _ = segments.ImportList(ctx, "seg_plain", "", HashNone, strings.NewReader("user_003\n"), ListFormat{}, true); result.Total != 3 {
+			t.Errorf("追加后成员数应为3: %+v", result)
+		}
+		segment, result, err := segments.ImportList(ctx, "seg_plain", "", HashNone, strings.NewReader("user_004\n"), ListFormat{}, false)
+		if err != nil || result.Total != 1 || segment.Name != "明文名单" {
+			t.Fatalf("替换名单结果不正确: %+v, %+v, %v", segment, result, err)
+		}
+		if got, _ := segments.UserSegments(ctx, []string{"user_001"}, nil); len(got) != 0 {
+			t.Errorf("替换后原成员不应再属于人群: %v", got)
+		}
+		if got, _ := segments.UserSegments(ctx, []string{"user_004"}, nil); !slices.Equal(got, []string{"seg_plain"}) {
+			t.Errorf("替换后新成员应属于人群: %v", got)
+		}
+
+		if _, _, err := segments.ImportList(ctx, "seg_plain", "", HashSHA256, strings.NewReader(""), ListFormat{}, true); err == nil {
+			t.Error("哈希方式与已有人群不一致时应报错")
+		}
+
+		if err := segments.Delete(ctx, "seg_plain"); err != nil {
+			t.Fatal(err)
+		}
+		if member, _ := store.IsMember(ctx, segment.MemberSet, "user_004"); member {
+			t.Error("删除人群后应清理成员")
+		}
+
+		// 重新加载后人群和成员仍然可用
+		reloaded := newTestSegments(t, store)
+		if got, _ := reloaded.UserSegments(ctx, []string{"user_003"}, nil); !slices.Equal(got, []string{"seg_md5"}) {
+			t.Errorf("重新加载后人群不正确: %v", got)
+		}
+	})
+}
+
+func TestSegmentsInProfile(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProfileStore()
+	if err := initTestData(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	client := newTestClient(t, store)
+
+	_, err := client.CreateSegment(ctx, &pb.CreateSegmentRequest{
+		Id:   "seg_young_female",
+		Name: "年轻女性",
+		Rule: &pb.SegmentRule{MatchAll: true, Conditions: []*pb.SegmentCondition{
+			{Field: "gender", Op: "eq", Values: []string{"female"}},
+			{Field: "age", Op: "lte", Values: []string{"24"}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateSegment(ctx, &pb.CreateSegmentRequest{Id: "seg_young_female", Rule: &pb.SegmentRule{}}); err == nil {
+		t.Error("重复创建人群应报错")
+	}
+
+	// 分片上传名单，分片边界可以落在行中间
+	upload, err := client.UploadSegment(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload.Send(&pb.UploadSegmentRequest{Payload: &pb.UploadSegmentRequest_Meta{Meta: &pb.UploadSegmentMeta{Id: "seg_retarget", Name: "再营销"}}})
+	for _, chunk := range []string{"user_0", "02\nuser_", "new\n"} {
+		if err := upload.Send(&pb.UploadSegmentRequest{Payload: &pb.UploadSegmentRequest_Chunk{Chunk: []byte(chunk)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	uploaded, err := upload.CloseAndRecv()
+	if err != nil || uploaded.Added != 2 || uploaded.Segment.Size != 2 {
+		t.Fatalf("上传名单结果不正确: %+v, %v", uploaded, err)
+	}
+
+	profile, err := client.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: "user_002"})
+	if err != nil || !slices.Equal(profile.SegmentIds, []string{"seg_retarget", "seg_young_female"}) {
+		t.Errorf("画像中的人群不正确: %+v, %v", profile.GetSegmentIds(), err)
+	}
+
+	// 没有画像的用户仍可命中名单人群
+	batch, err := client.BatchGetUserProfiles(ctx, &pb.BatchGetUserProfilesRequest{UserIds: []string{"user_001", "user_new"}})
+	if err != nil || len(batch.Profiles[0].SegmentIds) != 0 || !slices.Equal(batch.Profiles[1].SegmentIds, []string{"seg_retarget"}) {
+		t.Errorf("批量画像中的人群不正确: %+v, %v", batch, err)
+	}
+
+	list, err := client.ListSegments(ctx, &pb.ListSegmentsRequest{})
+	if err != nil || len(list.Segments) != 2 || list.Segments[1].Rule == nil {
+		t.Errorf("人群列表不正确: %+v, %v", list, err)
+	}
+
+	if _, err := client.DeleteSegment(ctx, &pb.DeleteSegmentRequest{Id: "seg_retarget"}); err != nil {
+		t.Fatal(err)
+	}
+	segments, err := client.GetUserSegments(ctx, &pb.GetUserSegmentsRequest{UserId: "user_new"})
+	if err != nil || len(segments.SegmentIds) != 0 {
+		t.Errorf("删除人群后不应再命中: %+v, %v", segments, err)
+	}
+
+	// 首条消息不是元数据时拒绝上传
+	upload, _ = client.UploadSegment(ctx)
+	upload.Send(&pb.UploadSegmentRequest{Payload: &pb.UploadSegmentRequest_Chunk{Chunk: []byte("user_001\n")}})
+	if _, err := upload.CloseAndRecv(); err == nil || err == io.EOF {
+		t.Error("缺少元数据的上传应报错")
+	}
+}
+
+func TestSegmentReplaceKeepsOldMembersOnError(t *testing.T) {
+	store, err := NewBoltProfileStore(filepath.Join(t.TempDir(), "profiles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	ctx := context.Background()
+	segments := newTestSegments(t, store)
+
+	if _, _, err := segments.ImportList(ctx, "seg", "", HashNone, strings.NewReader("user_001\n"), ListFormat{}, false); err != nil {
+		t.Fatal(err)
+	}
+	// CSV解析失败时替换中止，原名单保持不变
+	if _, _, err := segments.ImportList(ctx, "seg", "", HashNone, strings.NewReader("user_002\n\"broken"), ListFormat{CSV: true}, false); err == nil {
+		t.Fatal("CSV格式错误时应报错")
+	}
+	if got, _ := segments.UserSegments(ctx, []string{"user_001"}, nil); !slices.Equal(got, []string{"seg"}) {
+		t.Errorf("替换失败后原成员应保留: %v", got)
+	}
+	if got, _ := segments.UserSegments(ctx, []string{"user_002"}, nil); len(got) != 0 {
+		t.Errorf("替换失败后不应出现新成员: %v", got)
+	}
+}
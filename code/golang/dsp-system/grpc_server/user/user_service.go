@@ -0,0 +1,682 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dsp-system/config"
+	pb "dsp-system/proto"
+	"dsp-system/repository"
+
+	"google.golang.org/grpc"
+)
+
+// UserServer 用户服务实现
+type UserServer struct {
+	pb.UnimplementedUserServiceServer
+
+	// 画像存储（本地持久化或内存），同时保存人群、身份图和审计记录
+	store UserStore
+
+	// 行为兴趣模型
+	interests *InterestModel
+
+	// 人群管理
+	segments *SegmentManager
+
+	// 跨设备身份图
+	identity *IdentityGraph
+
+	// DSP侧的用户数据，用于删除和导出请求
+	external ExternalUserData
+}
+
+// UserProfile 用户画像
+type UserProfile struct {
+	UserID     string    `json:"user_id"`
+	Tags       []string  `json:"tags"`
+	Age        int32     `json:"age"`
+	Gender     string    `json:"gender"`
+	Interests  []string  `json:"interests"`
+	City       string    `json:"city"`
+	DeviceType string    `json:"device_type"`
+	UpdatedAt  time.Time `json:"updated_at"` // 最后活跃时间，超过保留期的画像会被清理
+
+	// 行为兴趣：各类目在ScoredAt时的得分，以及得分达到阈值的类目
+	InterestScores   map[string]float64 `json:"interest_scores,omitempty"`
+	ScoredAt         time.Time          `json:"scored_at"`
+	DerivedInterests []string           `json:"derived_interests,omitempty"`
+}
+
+// NewUserServer 创建用户服务
+func NewUserServer(store UserStore, interests *InterestModel, segments *SegmentManager, identity *IdentityGraph, external ExternalUserData) *UserServer {
+	return &UserServer{
+		store:     store,
+		interests: interests,
+		segments:  segments,
+		identity:  identity,
+		external:  external,
+	}
+}
+
+// initTestData 初始化测试数据
+func initTestData(ctx context.Context, store ProfileStore) error {
+	testProfiles := []UserProfile{
+		{
+			UserID:     "user_001",
+			Tags:       []string{"男性", "25-34岁", "运动爱好者", "科技爱好者"},
+			Age:        28,
+			Gender:     "male",
+			Interests:  []string{"sports", "technology", "gaming"},
+			City:       "北京",
+			DeviceType: "ios",
+		},
+		{
+			UserID:     "user_002",
+			Tags:       []string{"女性", "18-24岁", "购物达人", "美妆爱好者"},
+			Age:        22,
+			Gender:     "female",
+			Interests:  []string{"shopping", "beauty", "fashion"},
+			City:       "上海",
+			DeviceType: "android",
+		},
+		{
+			UserID:     "user_003",
+			Tags:       []string{"男性", "35-44岁", "商务人士", "汽车爱好者"},
+			Age:        38,
+			Gender:     "male",
+			Interests:  []string{"business", "cars", "finance"},
+			City:       "深圳",
+			DeviceType: "ios",
+		},
+		{
+			UserID:     "user_12345",
+			Tags:       []string{"科技爱好者", "程序员", "男性"},
+			Age:        30,
+			Gender:     "male",
+			Interests:  []string{"technology", "programming", "reading"},
+			City:       "杭州",
+			DeviceType: "android",
+		},
+	}
+
+	now := time.Now()
+	for _, profile := range testProfiles {
+		profile.UpdatedAt = now
+		if err := store.Put(ctx, &profile); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("初始化 %d 个测试用户画像", len(testProfiles))
+	return nil
+}
+
+// GetUserProfile 获取用户画像
+func (s *UserServer) GetUserProfile(ctx context.Context, req *pb.GetUserProfileRequest) (*pb.GetUserProfileResponse, error) {
+	log.Printf("获取用户画像: UserID=%s", req.UserId)
+
+	cluster, err := s.identity.Resolve(ctx, req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	var profile *UserProfile
+	if len(cluster.Members) == 1 {
+		profile, err = s.store.Get(ctx, req.UserId)
+		if err == nil {
+			profile, err = s.refreshInterests(ctx, profile)
+		}
+	} else {
+		profile, err = s.mergedProfile(ctx, req.UserId, cluster)
+	}
+	if errors.Is(err, ErrProfileNotFound) {
+		// 返回默认画像
+		log.Printf("用户不存在，返回默认画像: UserID=%s", req.UserId)
+		return s.withSegments(ctx, defaultProfile(req.UserId), nil, cluster)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.withSegments(ctx, s.profileToPB(profile), profile, cluster)
+}
+
+// mergedProfile 读取身份簇内全部标识的画像并合并，都不存在时返回ErrProfileNotFound
+// 合并结果只用于返回，各标识的画像仍独立存储和更新
+func (s *UserServer) mergedProfile(ctx context.Context, userID string, cluster *IdentityCluster) (*UserProfile, error) {
+	found, err := s.store.BatchGet(ctx, cluster.Members)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := make([]*UserProfile, 0, len(found))
+	for _, member := range cluster.Members {
+		if profile, exists := found[member]; exists {
+			profiles = append(profiles, profile)
+		}
+	}
+	if len(profiles) == 0 {
+		return nil, ErrProfileNotFound
+	}
+	return mergeProfiles(userID, profiles, s.interests, time.Now()), nil
+}
+
+// withSegments 填充人ID和用户所属人群，profile为nil表示用户没有画像
+// 规则按合并了行为标签和兴趣的画像判断，与返回给DSP的画像一致；名单按簇内任一标识判断
+func (s *UserServer) withSegments(ctx context.Context, resp *pb.GetUserProfileResponse, profile *UserProfile, cluster *IdentityCluster) (*pb.GetUserProfileResponse, error) {
+	if profile != nil {
+		profile = profile.clone()
+		profile.Tags = resp.Tags
+		profile.Interests = resp.Interests
+	}
+
+	ids, err := s.segments.UserSegments(ctx, cluster.Members, profile)
+	if err != nil {
+		return nil, err
+	}
+	resp.SegmentIds = ids
+	resp.PersonId = cluster.ID
+	return resp, nil
+}
+
+// refreshInterests 衰减导致行为兴趣变化时重新生成并写回
+// 大多数读取不会越过阈值，只在变化时产生一次写入
+func (s *UserServer) refreshInterests(ctx context.Context, profile *UserProfile) (*UserProfile, error) {
+	if !s.interests.Refresh(profile.clone(), time.Now()) {
+		return profile, nil
+	}
+
+	updated, err := s.store.Update(ctx, profile.UserID, func(p *UserProfile, exists bool) error {
+		if !exists {
+			return ErrProfileNotFound
+		}
+		if s.interests.Refresh(p, time.Now()) {
+			log.Printf("行为兴趣已衰减更新: UserID=%s, Interests=%v", p.UserID, p.DerivedInterests)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrProfileNotFound) {
+		// 读取后被删除或过期清理
+		return profile, nil
+	}
+	return updated, err
+}
+
+// UpdateUserBehavior 更新用户行为
+func (s *UserServer) UpdateUserBehavior(ctx context.Context, req *pb.UpdateUserBehaviorRequest) (*pb.UpdateUserBehaviorResponse, error) {
+	log.Printf("更新用户行为: UserID=%s, Behavior=%s, AdID=%s", req.UserId, req.Behavior, req.AdId)
+
+	err := s.recordBehaviors(ctx, req.UserId, []behaviorEvent{{
+		behavior: req.Behavior,
+		adID:     req.AdId,
+		at:       behaviorTime(req.Timestamp),
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.UpdateUserBehaviorResponse{
+		Success: true,
+		Message: "行为记录成功",
+	}, nil
+}
+
+// BatchGetUserProfiles 批量获取用户画像
+func (s *UserServer) BatchGetUserProfiles(ctx context.Context, req *pb.BatchGetUserProfilesRequest) (*pb.BatchGetUserProfilesResponse, error) {
+	log.Printf("批量获取用户画像: Count=%d", len(req.UserIds))
+
+	// 先解析身份簇，再一次读取全部成员的画像
+	clusters := make(map[string]*IdentityCluster, len(req.UserIds))
+	var members []string
+	for _, userID := range req.UserIds {
+		cluster, err := s.identity.Resolve(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		clusters[userID] = cluster
+		members = append(members, cluster.Members...)
+	}
+
+	found, err := s.store.BatchGet(ctx, members)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []*pb.GetUserProfileResponse
+	now := time.Now()
+
+	for _, userID := range req.UserIds {
+		cluster := clusters[userID]
+		var clusterProfiles []*UserProfile
+		for _, member := range cluster.Members {
+			if profile, exists := found[member]; exists {
+				clusterProfiles = append(clusterProfiles, profile)
+			}
+		}
+
+		resp := defaultProfile(userID)
+		var profile *UserProfile
+		switch {
+		case len(cluster.Members) == 1 && len(clusterProfiles) == 1:
+			profile = clusterProfiles[0]
+		case len(clusterProfiles) > 0:
+			profile = mergeProfiles(userID, clusterProfiles, s.interests, now)
+		}
+		if profile != nil {
+			resp = s.profileToPB(profile)
+		}
+
+		resp, err = s.withSegments(ctx, resp, profile, cluster)
+		if err != nil {
+			return nil, err
+		}
+		profiles = append(profiles, resp)
+	}
+
+	return &pb.BatchGetUserProfilesResponse{
+		Profiles: profiles,
+	}, nil
+}
+
+// ExportProfiles 导出全部用户画像
+func (s *UserServer) ExportProfiles(req *pb.ExportProfilesRequest, stream pb.UserService_ExportProfilesServer) error {
+	log.Printf("导出用户画像")
+
+	count := 0
+	err := s.store.ForEach(stream.Context(), func(profile *UserProfile) error {
+		count++
+		return stream.Send(profileToRecord(profile))
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("导出用户画像完成: Count=%d", count)
+	return nil
+}
+
+// ImportProfiles 批量导入用户画像，已存在的用户会被覆盖
+func (s *UserServer) ImportProfiles(stream pb.UserService_ImportProfilesServer) error {
+	log.Printf("导入用户画像")
+
+	var imported, skipped int64
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if record.UserId == "" {
+			skipped++
+			continue
+		}
+		if err := s.store.Put(stream.Context(), recordToProfile(record)); err != nil {
+			return fmt.Errorf("导入用户画像失败: UserID=%s, err=%w", record.UserId, err)
+		}
+		imported++
+	}
+
+	log.Printf("导入用户画像完成: Imported=%d, Skipped=%d", imported, skipped)
+	return stream.SendAndClose(&pb.ImportProfilesResponse{
+		Imported: imported,
+		Skipped:  skipped,
+	})
+}
+
+// CreateSegment 创建规则人群
+func (s *UserServer) CreateSegment(ctx context.Context, req *pb.CreateSegmentRequest) (*pb.SegmentInfo, error) {
+	log.Printf("创建规则人群: SegmentID=%s", req.Id)
+
+	segment, err := s.segments.CreateRuleSegment(ctx, req.Id, req.Name, ruleFromPB(req.Rule))
+	if err != nil {
+		return nil, fmt.Errorf("创建人群失败: SegmentID=%s, err=%w", req.Id, err)
+	}
+	return segmentToPB(segment), nil
+}
+
+// UploadSegment 上传名单人群
+// 文件内容边接收边解析，不在内存中缓存整个文件
+func (s *UserServer) UploadSegment(stream pb.UserService_UploadSegmentServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	meta := first.GetMeta()
+	if meta == nil {
+		return errors.New("首条消息必须是名单元数据")
+	}
+	log.Printf("上传名单人群: SegmentID=%s, HashType=%s, Append=%v", meta.Id, meta.HashType, meta.Append)
+
+	r, w := io.Pipe()
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				w.Close()
+				return
+			}
+			if err != nil {
+				w.CloseWithError(err)
+				return
+			}
+			if _, err := w.Write(req.GetChunk()); err != nil {
+				// 导入已失败，读端已关闭
+				return
+			}
+		}
+	}()
+
+	format := ListFormat{CSV: meta.Csv, Column: int(meta.Column), HasHeader: meta.HasHeader}
+	segment, result, err := s.segments.ImportList(stream.Context(), meta.Id, meta.Name, meta.HashType, r, format, meta.Append)
+	r.CloseWithError(err)
+	if err != nil {
+		return fmt.Errorf("导入名单失败: SegmentID=%s, err=%w", meta.Id, err)
+	}
+
+	log.Printf("上传名单人群完成: SegmentID=%s, Added=%d, Invalid=%d, Total=%d", meta.Id, result.Added, result.Invalid, result.Total)
+	return stream.SendAndClose(&pb.UploadSegmentResponse{
+		Segment: segmentToPB(segment),
+		Added:   int64(result.Added),
+		Invalid: int64(result.Invalid),
+	})
+}
+
+// ListSegments 列出全部人群
+func (s *UserServer) ListSegments(ctx context.Context, req *pb.ListSegmentsRequest) (*pb.ListSegmentsResponse, error) {
+	resp := &pb.ListSegmentsResponse{}
+	for _, segment := range s.segments.List() {
+		resp.Segments = append(resp.Segments, segmentToPB(segment))
+	}
+	return resp, nil
+}
+
+// DeleteSegment 删除人群
+func (s *UserServer) DeleteSegment(ctx context.Context, req *pb.DeleteSegmentRequest) (*pb.DeleteSegmentResponse, error) {
+	log.Printf("删除人群: SegmentID=%s", req.Id)
+
+	if err := s.segments.Delete(ctx, req.Id); err != nil {
+		return nil, fmt.Errorf("删除人群失败: SegmentID=%s, err=%w", req.Id, err)
+	}
+	return &pb.DeleteSegmentResponse{}, nil
+}
+
+// GetUserSegments 查询用户所属人群
+func (s *UserServer) GetUserSegments(ctx context.Context, req *pb.GetUserSegmentsRequest) (*pb.GetUserSegmentsResponse, error) {
+	resp, err := s.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: req.UserId})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.GetUserSegmentsResponse{SegmentIds: resp.SegmentIds}, nil
+}
+
+// ObserveIdentifiers 记录同时出现的一组用户标识
+func (s *UserServer) ObserveIdentifiers(ctx context.Context, req *pb.ObserveIdentifiersRequest) (*pb.ObserveIdentifiersResponse, error) {
+	linked, err := s.identity.Observe(ctx, req.Identifiers, req.Deterministic)
+	if err != nil {
+		return nil, fmt.Errorf("记录用户标识失败: %w", err)
+	}
+	return &pb.ObserveIdentifiersResponse{Linked: int64(linked)}, nil
+}
+
+// ResolveIdentity 查询标识所属的身份簇
+func (s *UserServer) ResolveIdentity(ctx context.Context, req *pb.ResolveIdentityRequest) (*pb.ResolveIdentityResponse, error) {
+	cluster, err := s.identity.Resolve(ctx, req.Identifier)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.ResolveIdentityResponse{
+		PersonId:    cluster.ID,
+		Identifiers: cluster.Members,
+	}, nil
+}
+
+// ruleFromPB 转换人群规则
+func ruleFromPB(rule *pb.SegmentRule) *SegmentRule {
+	if rule == nil {
+		return nil
+	}
+	r := &SegmentRule{MatchAll: rule.MatchAll}
+	for _, c := range rule.Conditions {
+		r.Conditions = append(r.Conditions, SegmentCondition{Field: c.Field, Op: c.Op, Values: c.Values})
+	}
+	return r
+}
+
+// segmentToPB 转换人群信息
+func segmentToPB(segment *Segment) *pb.SegmentInfo {
+	info := &pb.SegmentInfo{
+		Id:        segment.ID,
+		Name:      segment.Name,
+		Type:      segment.Type,
+		HashType:  segment.HashType,
+		Size:      int64(segment.Size),
+		CreatedAt: unixMilli(segment.CreatedAt),
+		UpdatedAt: unixMilli(segment.UpdatedAt),
+	}
+	if segment.Rule != nil {
+		info.Rule = &pb.SegmentRule{MatchAll: segment.Rule.MatchAll}
+		for _, c := range segment.Rule.Conditions {
+			info.Rule.Conditions = append(info.Rule.Conditions, &pb.SegmentCondition{Field: c.Field, Op: c.Op, Values: c.Values})
+		}
+	}
+	return info
+}
+
+// defaultProfile 用户不存在时返回的默认画像
+func defaultProfile(userID string) *pb.GetUserProfileResponse {
+	return &pb.GetUserProfileResponse{
+		UserId:     userID,
+		Tags:       []string{"新用户"},
+		Age:        0,
+		Gender:     "unknown",
+		Interests:  []string{},
+		City:       "未知",
+		DeviceType: "unknown",
+	}
+}
+
+// profileToPB 转换用户画像，标签和兴趣合并了行为推导的部分
+func (s *UserServer) profileToPB(profile *UserProfile) *pb.GetUserProfileResponse {
+	resp := &pb.GetUserProfileResponse{
+		UserId:     profile.UserID,
+		Tags:       s.interests.MergedTags(profile),
+		Age:        profile.Age,
+		Gender:     profile.Gender,
+		Interests:  s.interests.MergedInterests(profile),
+		City:       profile.City,
+		DeviceType: profile.DeviceType,
+	}
+	for _, tag := range s.interests.BehaviorTags(profile, time.Now()) {
+		resp.BehaviorTags = append(resp.BehaviorTags, &pb.BehaviorTag{
+			Tag:      tag.Tag,
+			Category: tag.Category,
+			Score:    tag.Score,
+		})
+	}
+	return resp
+}
+
+// profileToRecord 转换为导出记录
+func profileToRecord(profile *UserProfile) *pb.UserProfileRecord {
+	return &pb.UserProfileRecord{
+		UserId:           profile.UserID,
+		Tags:             profile.Tags,
+		Age:              profile.Age,
+		Gender:           profile.Gender,
+		Interests:        profile.Interests,
+		City:             profile.City,
+		DeviceType:       profile.DeviceType,
+		UpdatedAt:        profile.UpdatedAt.UnixMilli(),
+		InterestScores:   profile.InterestScores,
+		ScoredAt:         unixMilli(profile.ScoredAt),
+		DerivedInterests: profile.DerivedInterests,
+	}
+}
+
+// unixMilli 转换为毫秒，零值时间为0
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// recordToProfile 转换导入记录，未带活跃时间的按当前时间处理
+func recordToProfile(record *pb.UserProfileRecord) *UserProfile {
+	updatedAt := time.Now()
+	if record.UpdatedAt > 0 {
+		updatedAt = time.UnixMilli(record.UpdatedAt)
+	}
+	var scoredAt time.Time
+	if record.ScoredAt > 0 {
+		scoredAt = time.UnixMilli(record.ScoredAt)
+	}
+
+	return &UserProfile{
+		UserID:     record.UserId,
+		Tags:       record.Tags,
+		Age:        record.Age,
+		Gender:     record.Gender,
+		Interests:  record.Interests,
+		City:       record.City,
+		DeviceType: record.DeviceType,
+		UpdatedAt:  updatedAt,
+
+		InterestScores:   record.InterestScores,
+		ScoredAt:         scoredAt,
+		DerivedInterests: record.DerivedInterests,
+	}
+}
+
+// runProfileExpiry 定期清理超过保留期未活跃的画像和长期未再共现的身份计数
+func runProfileExpiry(ctx context.Context, store ProfileStore, ttl time.Duration, identity *IdentityGraph) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if ttl > 0 {
+			expired, err := store.ExpireInactive(ctx, time.Now().Add(-ttl))
+			if err != nil {
+				log.Printf("清理过期画像失败: %v", err)
+			} else if expired > 0 {
+				log.Printf("已清理过期画像: Count=%d", expired)
+			}
+		}
+
+		if expired, err := identity.ExpirePairs(ctx, time.Now()); err != nil {
+			log.Printf("清理身份共现计数失败: %v", err)
+		} else if expired > 0 {
+			log.Printf("已清理身份共现计数: Count=%d", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// newProfileStore 根据配置创建画像存储，人群数据保存在同一存储中
+func newProfileStore(cfg *config.UserServiceConfig) (UserStore, error) {
+	switch cfg.Store {
+	case "memory":
+		return NewMemoryProfileStore(), nil
+	case "bolt":
+		return NewBoltProfileStore(cfg.DataPath)
+	default:
+		return nil, fmt.Errorf("未知的画像存储类型: %s", cfg.Store)
+	}
+}
+
+func main() {
+	cfg := config.LoadUserServiceConfig()
+
+	store, err := newProfileStore(cfg)
+	if err != nil {
+		log.Fatalf("创建画像存储失败: %v", err)
+	}
+	defer store.Close()
+
+	// 只在存储为空时写入测试数据，避免覆盖已持久化的画像
+	if count, err := store.Count(context.Background()); err != nil {
+		log.Fatalf("读取画像存储失败: %v", err)
+	} else if count == 0 && cfg.SeedTestData {
+		if err := initTestData(context.Background(), store); err != nil {
+			log.Fatalf("初始化测试数据失败: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	identity := NewIdentityGraph(store, IdentityConfig{
+		LinkThreshold:  cfg.IdentityLinkThreshold,
+		PairWindow:     DefaultIdentityConfig().PairWindow,
+		MaxClusterSize: cfg.IdentityMaxClusterSize,
+		PairTTL:        DefaultIdentityConfig().PairTTL,
+	})
+	go runProfileExpiry(ctx, store, cfg.ProfileTTL, identity)
+
+	// 创建 gRPC 服务器
+	lis, err := net.Listen("tcp", ":"+cfg.Port)
+	if err != nil {
+		log.Fatalf("监听失败: %v", err)
+	}
+
+	categories := DefaultAdCategories()
+	if cfg.AdCategoriesFile != "" {
+		if categories, err = LoadAdCategories(cfg.AdCategoriesFile); err != nil {
+			log.Fatalf("加载广告类目失败: %v", err)
+		}
+	}
+
+	segments, err := NewSegmentManager(context.Background(), store)
+	if err != nil {
+		log.Fatalf("加载人群失败: %v", err)
+	}
+
+	// 删除和导出请求需要同时处理DSP侧的Redis缓存和竞价日志
+	redisCache := repository.NewRedisCache(&cfg.Redis)
+	defer redisCache.Close()
+	clickhouseRepo := repository.NewClickHouseRepo(&cfg.ClickHouse)
+	defer clickhouseRepo.Close()
+
+	grpcServer := grpc.NewServer()
+	userServer := NewUserServer(store, NewInterestModel(DefaultInterestConfig(), categories), segments, identity,
+		ExternalUserData{Cache: redisCache, Logs: clickhouseRepo})
+
+	pb.RegisterUserServiceServer(grpcServer, userServer)
+
+	// 收到退出信号后停止接收请求，随后关闭存储
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		<-quit
+		log.Println("正在关闭 User gRPC 服务...")
+		grpcServer.GracefulStop()
+	}()
+
+	log.Println("======================================")
+	log.Println("User gRPC 服务启动成功")
+	log.Printf("监听地址: localhost:%s", cfg.Port)
+	log.Printf("画像存储: %s", cfg.Store)
+	log.Printf("人群数量: %d", len(segments.List()))
+	log.Println("======================================")
+	log.Printf("当前时间: %s", time.Now().Format("2006-01-02 15:04:05"))
+
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatalf("服务启动失败: %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	pb "dsp-system/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestServer 创建使用指定存储和默认参数的用户服务
+func newTestServer(t *testing.T, store UserStore) *UserServer {
+	t.Helper()
+
+	return NewUserServer(
+		store,
+		NewInterestModel(DefaultInterestConfig(), DefaultAdCategories()),
+		newTestSegments(t, store),
+		NewIdentityGraph(store, DefaultIdentityConfig()),
+		ExternalUserData{},
+	)
+}
+
+// newTestClient 启动使用指定存储的用户服务并返回客户端
+func newTestClient(t *testing.T, store UserStore) pb.UserServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterUserServiceServer(server, newTestServer(t, store))
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewUserServiceClient(conn)
+}
+
+func TestExportImportProfiles(t *testing.T) {
+	ctx := context.Background()
+
+	source := NewMemoryProfileStore()
+	if err := initTestData(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+	from := newTestClient(t, source)
+
+	exported, err := from.ExportProfiles(ctx, &pb.ExportProfilesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*pb.UserProfileRecord
+	for {
+		record, err := exported.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 || records[0].UpdatedAt == 0 {
+		t.Fatalf("应导出4个带活跃时间的画像: %+v", records)
+	}
+
+	target := NewMemoryProfileStore()
+	to := newTestClient(t, target)
+
+	imports, err := to.ImportProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range append(records, &pb.UserProfileRecord{}) {
+		if err := imports.Send(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := imports.CloseAndRecv()
+	if err != nil || resp.Imported != 4 || resp.Skipped != 1 {
+		t.Fatalf("导入结果不正确: %+v, %v", resp, err)
+	}
+
+	original, _ := source.Get(ctx, "user_003")
+	imported, err := target.Get(ctx, "user_003")
+	if err != nil || imported.City != original.City || imported.UpdatedAt.UnixMilli() != original.UpdatedAt.UnixMilli() {
+		t.Errorf("导入的画像与原画像不一致: %+v, %+v", imported, original)
+	}
+
+	got, err := to.GetUserProfile(ctx, &pb.GetUserProfileRequest{UserId: "user_002"})
+	if err != nil || got.Gender != "female" {
+		t.Errorf("导入后应可查询: %+v, %v", got, err)
+	}
+}
+
+func TestIngestBehaviors(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryProfileStore()
+	client := newTestClient(t, store)
+
+	stream, err := client.IngestBehaviors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同一用户的事件跨批次累加，参数错误的事件单独确认失败
+	batches := []*pb.BehaviorBatch{
+		{Events: []*pb.BehaviorEvent{
+			{Seq: 0, UserId: "user_new", Behavior: "click", AdId: "ad_001"},
+			{Seq: 1, UserId: "", Behavior: "click", AdId: "ad_001"},
+			{Seq: 2, UserId: "user_new", Behavior: "click", AdId: "ad_001"},
+		}},
+		{Events: []*pb.BehaviorEvent{
+			{Seq: 3, UserId: "user_new", Behavior: "view", AdId: "ad_001"},
+		}},
+	}
+	for _, batch := range batches {
+		if err := stream.Send(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Accepted != 3 || len(resp.Failures) != 1 || resp.Failures[0].Seq != 1 || resp.Failures[0].Retryable {
+		t.Fatalf("上报结果不正确: %+v", resp)
+	}
+
+	profile, err := store.Get(ctx, "user_new")
+	if err != nil || profile.InterestScores["sports"] < 10 || len(profile.DerivedInterests) != 1 {
+		t.Errorf("行为应写入兴趣得分: %+v, %v", profile, err)
+	}
+
+	// 超过单批上限时拒绝整个流
+	stream, err = client.IngestBehaviors(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oversized := &pb.BehaviorBatch{}
+	for i := 0; i <= maxBehaviorBatch; i++ {
+		oversized.Events = append(oversized.Events, &pb.BehaviorEvent{Seq: uint64(i), UserId: "user_new", Behavior: "view"})
+	}
+	if err := stream.Send(oversized); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); err == nil {
+		t.Error("超过单批上限应返回错误")
+	}
+}
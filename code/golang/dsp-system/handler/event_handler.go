@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"context"
+	"dsp-system/campaign"
+	"dsp-system/frequency"
+	"dsp-system/money"
+	"dsp-system/rotation"
+	"dsp-system/rpc"
+	"dsp-system/shading"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EventHandler 赢标、曝光、点击回调处理器
+// 回调中的用户行为放入异步队列上报给用户服务，不在请求路径上调用RPC；
+// 赢标按成交价扣减预算，曝光同时计入广告的频次控制，曝光和点击更新创意轮播的状态，第一价格拍卖的赢标用于学习出价折减
+type EventHandler struct {
+	behaviors *rpc.BehaviorSender
+	campaigns *campaign.Repository
+	frequency *frequency.Limiter
+	rotation  *rotation.Rotator
+	shader    *shading.Shader
+	budget    *rpc.BudgetClient
+	wins      WinStore
+}
+
+// WinStore 赢标通知的去重记录，多个实例共享，由repository.RedisCache实现
+type WinStore interface {
+	// ClaimWin 登记竞价ID，ttl内首次登记返回true
+	ClaimWin(ctx context.Context, bidID string, ttl time.Duration) (bool, error)
+	// ReleaseWin 删除竞价ID的登记，扣减失败时调用，ADX重发的通知可以再次扣减
+	ReleaseWin(ctx context.Context, bidID string) error
+}
+
+// WinRetention 赢标去重记录的保留时间，覆盖ADX重发赢标通知的时间范围
+const WinRetention = 7 * 24 * time.Hour
+
+// NewEventHandler 创建回调处理器，limiter为nil时不记录曝光频次，rotator为nil时不更新创意轮播状态，
+// shader为nil时不记录赢标，budget为nil时赢标不扣减预算，wins为nil时赢标扣减不去重
+func NewEventHandler(behaviors *rpc.BehaviorSender, campaigns *campaign.Repository, limiter *frequency.Limiter, rotator *rotation.Rotator, shader *shading.Shader, budget *rpc.BudgetClient, wins WinStore) *EventHandler {
+	return &EventHandler{
+		behaviors: behaviors,
+		campaigns: campaigns,
+		frequency: limiter,
+		rotation:  rotator,
+		shader:    shader,
+		budget:    budget,
+		wins:      wins,
+	}
+}
+
+// HandleWin 处理赢标通知
+// GET /win?bidid=<竞价ID>&adid=<广告ID>&uid=<用户ID>&bp=<出价微单位>&sk=<折减维度>&price=${AUCTION_PRICE}
+// sk只在第一价格拍卖的出价中出现
+func (h *EventHandler) HandleWin(c *gin.Context) {
+	log.Printf("赢标通知: BidID=%s, AdID=%s, Price=%s", c.Query("bidid"), c.Query("adid"), c.Query("price"))
+	h.record(c, rpc.BehaviorWin)
+	h.deductBudget(c)
+	h.recordShadingWin(c)
+
+	// 实际项目中还应该:
+	// 1. 记录赢标日志到ClickHouse
+	// 2. 更新统计数据
+
+	c.String(http.StatusOK, "OK")
+}
+
+// HandleImpression 处理曝光监测，返回1x1像素
+// GET /imp?bidid=<竞价ID>&adid=<广告ID>&uid=<用户ID>&pid=<人ID>
+func (h *EventHandler) HandleImpression(c *gin.Context) {
+	h.record(c, rpc.BehaviorImpression)
+	if ad := h.campaigns.Catalog().Ad(c.Query("adid")); ad != nil {
+		h.recordFrequency(c, ad)
+		if err := h.rotation.RecordImpression(c.Request.Context(), personID(c), ad.Rotation, ad.Creative.ID); err != nil {
+			log.Printf("记录创意轮播曝光失败: AdID=%s, %v", ad.ID, err)
+		}
+	}
+	h.writePixel(c)
+}
+
+// HandleClick 处理点击监测，返回1x1像素
+// GET /click?bidid=<竞价ID>&adid=<广告ID>&uid=<用户ID>
+func (h *EventHandler) HandleClick(c *gin.Context) {
+	log.Printf("点击: BidID=%s, AdID=%s", c.Query("bidid"), c.Query("adid"))
+	h.record(c, rpc.BehaviorClick)
+	if ad := h.campaigns.Catalog().Ad(c.Query("adid")); ad != nil {
+		if err := h.rotation.RecordClick(c.Request.Context(), ad.Rotation, ad.Creative.ID); err != nil {
+			log.Printf("记录创意轮播点击失败: AdID=%s, %v", ad.ID, err)
+		}
+	}
+	h.writePixel(c)
+}
+
+// record 记录回调对应的用户行为；竞价时不允许使用个人数据的请求不带uid，不记录
+func (h *EventHandler) record(c *gin.Context, behavior string) {
+	userID := c.Query("uid")
+	if userID == "" || h.behaviors == nil {
+		return
+	}
+	// 队列已满时丢弃，丢弃数量见上报器的计数，关闭时输出
+	h.behaviors.Record(userID, behavior, c.Query("adid"))
+}
+
+// recordFrequency 把曝光计入广告的频次上限，按人计数
+// 同一竞价ID的重复曝光只计一次；广告已不在广告库中时无法确定上限，由调用方跳过
+func (h *EventHandler) recordFrequency(c *gin.Context, ad *campaign.Ad) {
+	userID := personID(c)
+	if h.frequency == nil || userID == "" || len(ad.FrequencyCaps) == 0 {
+		return
+	}
+	if err := h.frequency.Record(c.Request.Context(), userID, c.Query("bidid"), ad.FrequencyCaps, time.Now()); err != nil {
+		log.Printf("记录曝光频次失败: AdID=%s, %v", ad.ID, err)
+	}
+}
+
+// deductBudget 按成交价扣减广告所属活动和投放单元的预算，启用租约时从本地租约扣减
+// ${AUCTION_PRICE}为千次展示价格（元），一次赢标花费其千分之一；成交价高于提交的出价时按出价扣减。
+// 同一竞价ID只扣减一次，去重记录读写失败时仍然扣减，宁可多扣也不漏记花费
+func (h *EventHandler) deductBudget(c *gin.Context) {
+	if h.budget == nil {
+		return
+	}
+	ctx := c.Request.Context()
+	bidID := c.Query("bidid")
+	ad := h.campaigns.Catalog().Ad(c.Query("adid"))
+	if ad == nil || bidID == "" {
+		log.Printf("赢标通知没有对应的广告，不扣减预算: BidID=%s, AdID=%s", bidID, c.Query("adid"))
+		return
+	}
+	price, err := money.ParseDecimal(c.Query("price"))
+	bid, bidErr := strconv.ParseInt(c.Query("bp"), 10, 64)
+	if err != nil || price < 0 || bidErr != nil || bid <= 0 {
+		log.Printf("赢标通知的成交价或出价无效: BidID=%s, Price=%s, Bid=%s", bidID, c.Query("price"), c.Query("bp"))
+		return
+	}
+	if price > money.Micros(bid) {
+		log.Printf("成交价高于出价，按出价扣减: BidID=%s, Price=%s, Bid=%s", bidID, price, money.Micros(bid))
+		price = money.Micros(bid)
+	}
+
+	claimed := false
+	if h.wins != nil {
+		ok, err := h.wins.ClaimWin(ctx, bidID, WinRetention)
+		if err != nil {
+			log.Printf("赢标去重失败，仍扣减预算: BidID=%s, %v", bidID, err)
+		} else if !ok {
+			log.Printf("忽略重复的赢标通知: BidID=%s", bidID)
+			return
+		}
+		claimed = ok
+	}
+
+	if err := h.budget.DeductLineItemBudget(ctx, ad.Campaign.ID, ad.LineItem.ID, bidID, price/1000); err != nil {
+		log.Printf("赢标扣减预算失败: BidID=%s, CampaignID=%s, %v", bidID, ad.Campaign.ID, err)
+		if claimed {
+			if err := h.wins.ReleaseWin(ctx, bidID); err != nil {
+				log.Printf("删除赢标去重记录失败: BidID=%s, %v", bidID, err)
+			}
+		}
+	}
+}
+
+// recordShadingWin 把第一价格拍卖的赢标计入出价折减的赢标概率，按竞价时提交的出价分桶
+func (h *EventHandler) recordShadingWin(c *gin.Context) {
+	if h.shader == nil || c.Query("sk") == "" {
+		return
+	}
+	key, err := shading.ParseKey(c.Query("sk"))
+	bid, bidErr := strconv.ParseInt(c.Query("bp"), 10, 64)
+	if err != nil || bidErr != nil {
+		log.Printf("赢标通知的出价折减参数无效: sk=%s, bp=%s", c.Query("sk"), c.Query("bp"))
+		return
+	}
+	recorded, err := h.shader.RecordWin(c.Request.Context(), key, c.Query("bidid"), money.Micros(bid), time.Now())
+	if err != nil {
+		log.Printf("记录赢标失败: Key=%s, %v", key, err)
+		return
+	}
+	if !recorded {
+		log.Printf("忽略重复或没有对应出价的赢标: BidID=%s, Key=%s, Bid=%s", c.Query("bidid"), key, money.Micros(bid))
+	}
+}
+
+// personID 频次控制和创意顺序播放使用的人ID，没有时为用户ID
+func personID(c *gin.Context) string {
+	if pid := c.Query("pid"); pid != "" {
+		return pid
+	}
+	return c.Query("uid")
+}
+
+// writePixel 返回不可缓存的1x1像素
+func (h *EventHandler) writePixel(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
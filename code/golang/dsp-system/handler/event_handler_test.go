@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"context"
+	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/config"
+	"dsp-system/frequency"
+	"dsp-system/money"
+	"dsp-system/privacy"
+	pb "dsp-system/proto"
+	"dsp-system/repository"
+	"dsp-system/rpc"
+	"dsp-system/service"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+)
+
+// fakeLeaseServer 只实现租约接口的预算服务，中心扣减未实现，回退到中心扣减时会失败
+type fakeLeaseServer struct {
+	pb.UnimplementedBudgetServiceServer
+
+	mu       sync.Mutex
+	releases map[string]money.Micros // leaseID -> 上报消耗
+}
+
+func (f *fakeLeaseServer) AcquireLease(ctx context.Context, req *pb.AcquireLeaseRequest) (*pb.AcquireLeaseResponse, error) {
+	return &pb.AcquireLeaseResponse{
+		Granted: true,
+		Lease: &pb.Lease{
+			Id:            "lease_1",
+			CampaignId:    req.CampaignId,
+			GrantedMicros: req.AmountMicros,
+			ExpiresAt:     time.Now().Add(time.Duration(req.TtlMs) * time.Millisecond).UnixMilli(),
+		},
+	}, nil
+}
+
+func (f *fakeLeaseServer) ReleaseLease(ctx context.Context, req *pb.ReleaseLeaseRequest) (*pb.ReleaseLeaseResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releases[req.LeaseId] = money.Micros(req.SpentMicros)
+	return &pb.ReleaseLeaseResponse{Success: true, Lease: &pb.Lease{Id: req.LeaseId, SpentMicros: req.SpentMicros}}, nil
+}
+
+func TestWinDeductsLeaseBudget(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeLeaseServer{releases: make(map[string]money.Micros)}
+	server := grpc.NewServer()
+	pb.RegisterBudgetServiceServer(server, fake)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	client := rpc.NewBudgetClient(lis.Addr().String())
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	leases := client.EnableLeases(rpc.DefaultLeaseConfig("node_test"))
+	ctx := context.Background()
+
+	// 竞价时领取租约
+	before, err := client.CheckBudgetDetail(ctx, "c1", "li1", 5*money.MicrosPerUnit)
+	if err != nil || !before.HasBudget {
+		t.Fatalf("应领取租约: %+v, %v", before, err)
+	}
+
+	campaigns := testCampaigns(t, `{
+		"campaigns": [{"id": "c1", "domain": "a.com"}],
+		"line_items": [{"id": "li1", "campaign_id": "c1", "bid_price": "5", "creative_ids": ["cr1"]}],
+		"creatives": [{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"}]
+	}`)
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/win", NewEventHandler(nil, campaigns, nil, nil, nil, client, cache).HandleWin)
+	win := func(query string) {
+		t.Helper()
+		if w := serve(router, "/win?"+query, ""); w.Code != http.StatusOK {
+			t.Fatalf("赢标通知应返回200: %d", w.Code)
+		}
+	}
+	remaining := func() money.Micros {
+		t.Helper()
+		detail, err := client.CheckBudgetDetail(ctx, "c1", "li1", 5*money.MicrosPerUnit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return detail.Remaining
+	}
+
+	// 千次展示价格5元，一次赢标花费0.005元，从本地租约扣减；重发的通知不再扣减
+	win("bidid=b1&adid=li1:cr1&bp=5000000&price=5.00")
+	win("bidid=b1&adid=li1:cr1&bp=5000000&price=5.00")
+	if want := before.Remaining - 5_000; remaining() != want {
+		t.Errorf("赢标后租约剩余应为%s，实际为%s", want, remaining())
+	}
+
+	// 成交价高于出价时按出价扣减；不在广告库中的广告和没有出价的通知不扣减
+	win("bidid=b2&adid=li1:cr1&bp=4000000&price=50")
+	win("bidid=b3&adid=li9:cr1&bp=5000000&price=5.00")
+	win("bidid=b4&adid=li1:cr1&price=5.00")
+	if want := before.Remaining - 9_000; remaining() != want {
+		t.Errorf("成交价应不超过出价，实际租约剩余为%s", remaining())
+	}
+
+	leases.Close(ctx)
+	if spent := fake.releases["lease_1"]; spent != 9_000 {
+		t.Errorf("归还租约时应上报赢标花费0.009，实际为%s", spent)
+	}
+}
+
+// testCampaigns 从JSON创建广告库
+func testCampaigns(t *testing.T, data string) *campaign.Repository {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "campaigns.json")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	campaigns, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(campaigns.Close)
+	return campaigns
+}
+
+func TestImpressionTrackerCapsNextBid(t *testing.T) {
+	campaigns := testCampaigns(t, `{
+		"campaigns": [{"id": "c1", "domain": "a.com", "frequency_caps": [{"max": 1, "window": "day"}]}],
+		"line_items": [{"id": "li1", "campaign_id": "c1", "bid_price": "5", "creative_ids": ["cr1"]}],
+		"creatives": [{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a href='http://a.com' onclick=\"new Image().src='${DSP_CLICK_URL}'\">ad</a>"}]
+	}`)
+
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	ctx := context.Background()
+	cache.SetUserProfile(ctx, "user_profile:u1", &rpc.UserProfile{UserID: "u1", Tags: []string{}}, time.Hour)
+
+	limiter := frequency.NewLimiter(cache)
+	bidService := service.NewBidService(
+		service.NewAdSelector(campaigns, limiter, nil, nil),
+		rpc.NewUserClient(""),
+		rpc.NewBudgetClient(""),
+		cache,
+		repository.NewClickHouseRepo(&config.ClickHouseConfig{}),
+		nil,
+		privacy.NewPolicy(testVendorID),
+		nil, nil, nil, nil, nil,
+	)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	events := NewEventHandler(nil, campaigns, limiter, nil, nil, nil, nil)
+	router.GET("/imp", events.HandleImpression)
+
+	req := &api.BidRequest{
+		ID:   "req1",
+		Imp:  []api.Imp{{ID: "imp1", Banner: &api.Banner{W: 728, H: 90}}},
+		User: &api.User{ID: "u1"},
+	}
+	resp, err := bidService.ProcessBid(ctx, "", req)
+	if err != nil || resp == nil {
+		t.Fatalf("第一次竞价应出价: %v", err)
+	}
+	adm := resp.SeatBid[0].Bid[0].AdM
+
+	// 点击宏替换为点击回调，banner末尾追加曝光像素
+	if !regexp.MustCompile(`src='http://dsp\.example\.com/click\?[^']*bidid=`).MatchString(adm) {
+		t.Errorf("点击宏应替换为点击回调地址: %s", adm)
+	}
+	match := regexp.MustCompile(`<img src="([^"]+)"`).FindStringSubmatch(adm)
+	if match == nil {
+		t.Fatalf("创意中应有曝光像素: %s", adm)
+	}
+	impURL, err := url.Parse(html.UnescapeString(match[1]))
+	if err != nil || impURL.Path != "/imp" || impURL.Query().Get("uid") != "u1" {
+		t.Fatalf("曝光回调地址无效: %s", match[1])
+	}
+	if w := serve(router, impURL.RequestURI(), ""); w.Code != http.StatusOK {
+		t.Fatalf("曝光回调应返回200: %d", w.Code)
+	}
+
+	// 活动每天1次，曝光后不再出价
+	req.ID = "req2"
+	if resp, err := bidService.ProcessBid(ctx, "", req); err != nil || resp != nil {
+		t.Errorf("曝光达到频次上限后不应出价: %+v, %v", resp, err)
+	}
+}
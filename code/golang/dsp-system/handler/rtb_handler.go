@@ -24,7 +24,7 @@ func NewRTBHandler(bidService *service.BidService) *RTBHandler {
 }
 
 // HandleBidRequest 处理竞价请求
-// POST /bid
+// POST /bid 或 POST /bid/:exchange（交易平台标识用于解析Cookie同步的BuyerUID）
 func (h *RTBHandler) HandleBidRequest(c *gin.Context) {
 	startTime := time.Now()
 	
@@ -40,13 +40,13 @@ func (h *RTBHandler) HandleBidRequest(c *gin.Context) {
 
 	// 2. 快速校验
 	if bidRequest.ID == "" || len(bidRequest.Imp) == 0 {
-		log.Printf("竞价请求参数不完整: %+v", bidRequest)
+		log.Printf("竞价请求参数不完整: ID=%s, Imps=%d", bidRequest.ID, len(bidRequest.Imp))
 		h.sendNoBid(c, bidRequest.ID, 2) // NBR=2: 技术错误
 		return
 	}
 
 	// 3. 调用竞价服务
-	bidResponse, err := h.bidService.ProcessBid(c.Request.Context(), &bidRequest)
+	bidResponse, err := h.bidService.ProcessBid(c.Request.Context(), c.Param("exchange"), &bidRequest)
 	if err != nil {
 		log.Printf("竞价处理失败: %v", err)
 		h.sendNoBid(c, bidRequest.ID, 3) // NBR=3: 无效请求
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"dsp-system/config"
+	"dsp-system/privacy"
+	"dsp-system/service"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uidMacro 跳转地址中替换为本方用户ID的宏
+const uidMacro = "${DSP_UID}"
+
+// transparentGIF 1x1透明GIF
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// SyncHandler Cookie同步处理器
+type SyncHandler struct {
+	userSync      *service.UserSyncService
+	cfg           *config.SyncConfig
+	policy        *privacy.Policy
+	redirectHosts []string
+}
+
+// NewSyncHandler 创建Cookie同步处理器
+func NewSyncHandler(userSync *service.UserSyncService, cfg *config.SyncConfig, policy *privacy.Policy) *SyncHandler {
+	var hosts []string
+	for _, host := range strings.Split(cfg.RedirectHosts, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return &SyncHandler{
+		userSync:      userSync,
+		cfg:           cfg,
+		policy:        policy,
+		redirectHosts: hosts,
+	}
+}
+
+// HandleSync 同步并跳转
+// GET /sync?exchange=adx&uid=<交易平台用户ID>&redirect=<交易平台同步地址>
+// 跳转地址中的${DSP_UID}替换为本方用户ID，供交易平台保存后作为BuyerUID传回；
+// 未带redirect时返回像素。未获得同意时不下发Cookie，${DSP_UID}替换为空
+func (h *SyncHandler) HandleSync(c *gin.Context) {
+	redirect := c.Query("redirect")
+	var target *url.URL
+	if redirect != "" {
+		var ok bool
+		if target, ok = h.allowedRedirect(redirect); !ok {
+			log.Printf("用户同步跳转地址不允许: Exchange=%s, Redirect=%s", c.Query("exchange"), redirect)
+			c.String(http.StatusBadRequest, "redirect not allowed")
+			return
+		}
+	}
+
+	dspUID, ok := h.sync(c)
+	if !ok {
+		return
+	}
+
+	if target == nil {
+		h.writePixel(c)
+		return
+	}
+
+	location := strings.ReplaceAll(target.String(), url.QueryEscape(uidMacro), url.QueryEscape(dspUID))
+	location = strings.ReplaceAll(location, uidMacro, url.QueryEscape(dspUID))
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, location)
+}
+
+// HandlePixel 同步并返回像素
+// GET /sync/pixel?exchange=adx&uid=<交易平台用户ID>
+func (h *SyncHandler) HandlePixel(c *gin.Context) {
+	if _, ok := h.sync(c); !ok {
+		return
+	}
+	h.writePixel(c)
+}
+
+// sync 读取或生成本方Cookie并保存映射，失败时已写入响应；未获得同意时返回空ID
+func (h *SyncHandler) sync(c *gin.Context) (string, bool) {
+	exchange := c.Query("exchange")
+	if !service.ValidExchange(exchange) {
+		c.String(http.StatusBadRequest, "invalid exchange")
+		return "", false
+	}
+
+	if d := h.policy.EvaluateSignals(syncSignals(c)); !d.AllowPersonalData {
+		log.Printf("用户同步未获得同意，不下发Cookie: Exchange=%s, Reason=%s", exchange, d.Reason)
+		return "", true
+	}
+
+	dspUID, err := c.Cookie(h.cfg.CookieName)
+	if err != nil || !service.ValidDSPUID(dspUID) {
+		dspUID = service.NewDSPUID()
+	}
+	// 每次同步都续期Cookie
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(h.cfg.CookieName, dspUID, int(h.cfg.CookieMaxAge.Seconds()), "/", h.cfg.CookieDomain, h.cfg.CookieSecure, true)
+
+	if err := h.userSync.Sync(c.Request.Context(), exchange, c.Query("uid"), dspUID); err != nil {
+		// 映射保存失败不影响Cookie下发，下次同步会重试
+		log.Printf("用户同步失败: %v", err)
+	}
+	return dspUID, true
+}
+
+// syncSignals 读取同步地址中的同意参数（与交易平台的同步宏一致）：
+// gdpr、gdpr_consent、us_privacy、gpp、gpp_sid（逗号分隔）
+func syncSignals(c *gin.Context) privacy.Signals {
+	s := privacy.Signals{
+		TCFConsent: c.Query("gdpr_consent"),
+		USPrivacy:  c.Query("us_privacy"),
+		GPP:        c.Query("gpp"),
+	}
+	if gdpr, err := strconv.Atoi(c.Query("gdpr")); err == nil {
+		s.GDPR = &gdpr
+	}
+	for _, sid := range strings.Split(c.Query("gpp_sid"), ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(sid)); err == nil {
+			s.GPPSID = append(s.GPPSID, id)
+		}
+	}
+	return s
+}
+
+// allowedRedirect 只允许跳转到配置的交易平台域名（含子域名），避免被用作开放跳转
+func (h *SyncHandler) allowedRedirect(raw string) (*url.URL, bool) {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return nil, false
+	}
+
+	host := strings.ToLower(target.Hostname())
+	for _, allowed := range h.redirectHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// writePixel 返回不可缓存的1x1像素
+func (h *SyncHandler) writePixel(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
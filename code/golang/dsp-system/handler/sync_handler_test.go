@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"dsp-system/config"
+	"dsp-system/privacy"
+	"dsp-system/repository"
+	"dsp-system/service"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+)
+
+// testVendorID 测试用的本方TCF供应商ID
+const testVendorID = 42
+
+// newTestSyncRouter 创建使用miniredis的同步路由
+func newTestSyncRouter(t *testing.T) (*gin.Engine, *repository.RedisCache) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	t.Cleanup(func() { cache.Close() })
+
+	cfg := &config.SyncConfig{
+		CookieName:    "dsp_uid",
+		CookieMaxAge:  24 * time.Hour,
+		CookieSecure:  true,
+		MappingTTL:    time.Hour,
+		RedirectHosts: "sync.adx.com, openx.net",
+	}
+	h := NewSyncHandler(service.NewUserSyncService(cache, cfg.MappingTTL), cfg, privacy.NewPolicy(testVendorID))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/sync", h.HandleSync)
+	router.GET("/sync/pixel", h.HandlePixel)
+	return router, cache
+}
+
+// serve 发起请求，cookie非空时带上本方Cookie
+func serve(router *gin.Engine, target, cookie string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if cookie != "" {
+		req.AddCookie(&http.Cookie{Name: "dsp_uid", Value: cookie})
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSyncPixelStoresMapping(t *testing.T) {
+	router, cache := newTestSyncRouter(t)
+	ctx := context.Background()
+
+	w := serve(router, "/sync/pixel?exchange=adx&uid=adx-user-1", "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("应返回像素: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !service.ValidDSPUID(cookies[0].Value) || cookies[0].SameSite != http.SameSiteNoneMode || !cookies[0].Secure {
+		t.Fatalf("应下发SameSite=None且Secure的用户Cookie: %+v", cookies)
+	}
+	dspUID := cookies[0].Value
+
+	if got, _ := cache.GetUserSync(ctx, "adx", "adx-user-1"); got != dspUID {
+		t.Errorf("应保存交易平台用户ID映射，实际为%q", got)
+	}
+
+	// 已有Cookie时沿用，不合法的Cookie被替换
+	w = serve(router, "/sync/pixel?exchange=openx&uid=ox-9", dspUID)
+	if got := w.Result().Cookies()[0].Value; got != dspUID {
+		t.Errorf("应沿用已有Cookie: %s", got)
+	}
+	w = serve(router, "/sync/pixel?exchange=openx&uid=ox-9", "forged")
+	if got := w.Result().Cookies()[0].Value; got == "forged" || !service.ValidDSPUID(got) {
+		t.Errorf("不合法的Cookie应被替换: %s", got)
+	}
+
+	if w := serve(router, "/sync/pixel?exchange=ADX%3A1", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("无效的交易平台标识应返回400，实际为%d", w.Code)
+	}
+}
+
+func TestSyncRedirect(t *testing.T) {
+	router, cache := newTestSyncRouter(t)
+	ctx := context.Background()
+
+	redirect := url.QueryEscape("https://sync.adx.com/setuid?bidder=dsp&buyeruid=${DSP_UID}")
+	w := serve(router, "/sync?exchange=adx&redirect="+redirect, "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("应跳转到交易平台，实际为%d", w.Code)
+	}
+	dspUID := w.Result().Cookies()[0].Value
+	if location := w.Header().Get("Location"); location != "https://sync.adx.com/setuid?bidder=dsp&buyeruid="+dspUID {
+		t.Errorf("跳转地址应替换为本方用户ID: %s", location)
+	}
+	// 交易平台保存本方ID后原样作为BuyerUID传回，同样可以解析
+	if got, _ := cache.GetUserSync(ctx, "adx", dspUID); got != dspUID {
+		t.Errorf("应记录本方用户ID自身的映射，实际为%q", got)
+	}
+
+	for _, target := range []string{
+		"https://evil.com/?u=${DSP_UID}",
+		"https://sync.adx.com.evil.com/",
+		"javascript:alert(1)",
+	} {
+		w := serve(router, "/sync?exchange=adx&redirect="+url.QueryEscape(target), "")
+		if w.Code != http.StatusBadRequest || strings.Contains(w.Header().Get("Location"), "evil") {
+			t.Errorf("不允许的跳转地址应返回400: %s -> %d", target, w.Code)
+		}
+	}
+
+	// 子域名允许跳转
+	if w := serve(router, "/sync?exchange=openx&redirect="+url.QueryEscape("https://us.openx.net/s?u=${DSP_UID}"), ""); w.Code != http.StatusFound {
+		t.Errorf("子域名应允许跳转，实际为%d", w.Code)
+	}
+}
+
+func TestSyncWithoutConsent(t *testing.T) {
+	router, cache := newTestSyncRouter(t)
+	ctx := context.Background()
+
+	redirect := url.QueryEscape("https://sync.adx.com/setuid?buyeruid=${DSP_UID}")
+	w := serve(router, "/sync?exchange=adx&uid=adx-user-1&gdpr=1&gdpr_consent=&redirect="+redirect, "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("未获得同意时仍应跳转，实际为%d", w.Code)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("未获得同意时不应下发Cookie: %+v", cookies)
+	}
+	if location := w.Header().Get("Location"); location != "https://sync.adx.com/setuid?buyeruid=" {
+		t.Errorf("未获得同意时用户ID宏应替换为空: %s", location)
+	}
+	if got, _ := cache.GetUserSync(ctx, "adx", "adx-user-1"); got != "" {
+		t.Errorf("未获得同意时不应保存映射，实际为%q", got)
+	}
+
+	if w := serve(router, "/sync/pixel?exchange=adx&uid=adx-user-2&us_privacy=1YYN", ""); len(w.Result().Cookies()) != 0 {
+		t.Error("CCPA拒绝出售时不应下发Cookie")
+	}
+}
@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"dsp-system/campaign"
 	"dsp-system/config"
+	"dsp-system/frequency"
+	"dsp-system/geo"
 	"dsp-system/handler"
 	"dsp-system/logger"
+	"dsp-system/money"
+	"dsp-system/predict"
+	"dsp-system/privacy"
 	"dsp-system/repository"
+	"dsp-system/rotation"
 	"dsp-system/rpc"
 	"dsp-system/service"
+	"dsp-system/shading"
+	"dsp-system/useragent"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	_ "github.com/go-sql-driver/mysql"
 )
 
 func main() {
@@ -31,6 +43,13 @@ func main() {
 	redisCache := repository.NewRedisCache(&cfg.Redis)
 	defer redisCache.Close()
 
+	// 将旧的浮点格式预算缓存迁移为微单位，失败时不影响启动（读取时仍会按键迁移）
+	migrateCtx, cancelMigrate := context.WithTimeout(context.Background(), 30*time.Second)
+	if _, err := redisCache.MigrateLegacyBudgets(migrateCtx); err != nil {
+		logger.Warnf("旧预算缓存迁移失败: %v", err)
+	}
+	cancelMigrate()
+
 	clickhouseRepo := repository.NewClickHouseRepo(&cfg.ClickHouse)
 	defer clickhouseRepo.Close()
 
@@ -51,22 +70,128 @@ func main() {
 	} else {
 		defer budgetClient.Close()
 		logger.Info("预算服务连接成功")
+
+		if leaseCfg := cfg.RPC.BudgetLease; leaseCfg.Enabled {
+			sliceSize, err := money.ParseDecimal(leaseCfg.SliceSize)
+			if err != nil {
+				logger.Fatalf("预算租约额度配置错误: %v", err)
+			}
+			lc := rpc.DefaultLeaseConfig(leaseCfg.NodeID)
+			lc.SliceSize = sliceSize
+			lc.TTL = time.Duration(leaseCfg.TTLSeconds) * time.Second
+			budgetClient.EnableLeases(lc)
+			logger.Infof("预算租约已启用: NodeID=%s, Slice=%s, TTL=%s", lc.NodeID, lc.SliceSize, lc.TTL)
+		}
 	}
 
+	// 赢标、曝光、点击回调的用户行为异步批量上报（用户服务未连接时丢弃）
+	senderCfg := rpc.DefaultBehaviorSenderConfig()
+	senderCfg.BufferSize = cfg.RPC.BehaviorSender.BufferSize
+	senderCfg.BatchSize = cfg.RPC.BehaviorSender.BatchSize
+	senderCfg.FlushInterval = time.Duration(cfg.RPC.BehaviorSender.FlushIntervalMs) * time.Millisecond
+	behaviorSender := userClient.EnableBehaviorSender(senderCfg)
+
 	logger.Info("RPC客户端初始化完成")
 
 	// 5. 初始化服务层
-	adSelector := service.NewAdSelector()
+	var campaignSources []campaign.Source
+	if cfg.Campaigns.File != "" {
+		campaignSources = append(campaignSources, campaign.NewFileSource(cfg.Campaigns.File))
+	}
+	if cfg.Campaigns.DBDSN != "" {
+		db, err := sql.Open(cfg.Campaigns.DBDriver, cfg.Campaigns.DBDSN)
+		if err != nil {
+			logger.Fatalf("连接广告库数据库失败: %v", err)
+		}
+		defer db.Close()
+		campaignSources = append(campaignSources, campaign.NewSQLSource(db, cfg.Campaigns.VersionQuery))
+	}
+	if len(campaignSources) == 0 {
+		logger.Warn("未配置广告库（CAMPAIGN_FILE或CAMPAIGN_DB_DSN），不会出价")
+	}
+	campaigns, err := campaign.NewRepository(campaignSources,
+		time.Duration(cfg.Campaigns.ReloadIntervalSeconds)*time.Second)
+	if err != nil {
+		logger.Fatalf("加载广告库失败: %v", err)
+	}
+	defer campaigns.Close()
+	// 频次计数存放在Redis，曝光监测时记录，竞价时查询
+	frequencyLimiter := frequency.NewLimiter(redisCache)
+	// 创意顺序播放的进度和点击率统计也存放在Redis，曝光和点击监测时更新
+	creativeRotator := rotation.NewRotator(redisCache)
+	var predictor *predict.Predictor
+	if cfg.Model.File != "" {
+		var err error
+		predictor, err = predict.NewPredictor(cfg.Model.File, time.Duration(cfg.Model.ReloadIntervalSeconds)*time.Second)
+		if err != nil {
+			logger.Fatalf("加载预估模型失败: %v", err)
+		}
+		defer predictor.Close()
+	} else {
+		logger.Warn("未配置预估模型（MODEL_FILE），按点击或转化出价的广告不参与竞价")
+	}
+	adSelector := service.NewAdSelector(campaigns, frequencyLimiter, creativeRotator, predictor)
+	var shader *shading.Shader
+	if cfg.BidShading.Enabled {
+		shader = shading.NewShader(redisCache, shading.Config{
+			MinFactor:       cfg.BidShading.MinFactor,
+			MinSamples:      int64(cfg.BidShading.MinSamples),
+			Window:          cfg.BidShading.WindowDays,
+			RefreshInterval: time.Duration(cfg.BidShading.RefreshIntervalSeconds) * time.Second,
+		})
+		defer shader.Close()
+	} else {
+		logger.Warn("出价折减已关闭（BID_SHADING_ENABLED），第一价格拍卖按出价上限出价")
+	}
+	userSync := service.NewUserSyncService(redisCache, cfg.Sync.MappingTTL)
+	privacyPolicy := privacy.NewPolicy(cfg.Privacy.TCFVendorID)
+	var dataSegments *service.DataSegmentMapper
+	if cfg.DataSegments.MappingFile != "" {
+		var err error
+		if dataSegments, err = service.LoadDataSegmentMapper(cfg.DataSegments.MappingFile); err != nil {
+			logger.Fatalf("加载数据段映射失败: %v", err)
+		}
+	}
+	var geoResolver *geo.Resolver
+	if cfg.Geo.DatabaseFile != "" {
+		var err error
+		geoResolver, err = geo.NewResolver(cfg.Geo.DatabaseFile, strings.Split(cfg.Geo.Languages, ","),
+			time.Duration(cfg.Geo.ReloadIntervalSeconds)*time.Second)
+		if err != nil {
+			logger.Fatalf("加载地理位置库失败: %v", err)
+		}
+		defer geoResolver.Close()
+	}
+	uaParser, err := useragent.NewParser(cfg.UserAgent.RulesFile, cfg.UserAgent.CacheSize,
+		time.Duration(cfg.UserAgent.ReloadIntervalSeconds)*time.Second)
+	if err != nil {
+		logger.Fatalf("加载UA规则失败: %v", err)
+	}
+	defer uaParser.Close()
+	var pacer *service.Pacer
+	if cfg.RPC.BudgetPacing.Enabled {
+		pacer = service.NewPacer(budgetClient, time.Duration(cfg.RPC.BudgetPacing.RefreshSeconds)*time.Second)
+	}
+	defer pacer.Close()
 	bidService := service.NewBidService(
 		adSelector,
 		userClient,
 		budgetClient,
 		redisCache,
 		clickhouseRepo,
+		userSync,
+		privacyPolicy,
+		dataSegments,
+		geoResolver,
+		uaParser,
+		shader,
+		pacer,
 	)
 
 	// 6. 初始化Handler层
 	rtbHandler := handler.NewRTBHandler(bidService)
+	syncHandler := handler.NewSyncHandler(userSync, &cfg.Sync, privacyPolicy)
+	eventHandler := handler.NewEventHandler(behaviorSender, campaigns, frequencyLimiter, creativeRotator, shader, budgetClient, redisCache)
 
 	// 7. 配置Gin
 	gin.SetMode(gin.ReleaseMode)
@@ -82,9 +207,16 @@ func main() {
 
 	// RTB竞价接口
 	router.POST("/bid", rtbHandler.HandleBidRequest)
+	router.POST("/bid/:exchange", rtbHandler.HandleBidRequest)
+
+	// Cookie同步
+	router.GET("/sync", syncHandler.HandleSync)
+	router.GET("/sync/pixel", syncHandler.HandlePixel)
 
 	// 竞价结果回调
-	router.GET("/win", handleWinNotice)
+	router.GET("/win", eventHandler.HandleWin)
+	router.GET("/imp", eventHandler.HandleImpression)
+	router.GET("/click", eventHandler.HandleClick)
 	router.GET("/bill", handleBillNotice)
 
 	// 9. 启动HTTP服务器
@@ -102,9 +234,14 @@ func main() {
 		logger.Info("======================================")
 		logger.Info("API文档:")
 		logger.Info("  POST /bid        - OpenRTB竞价接口")
+		logger.Info("  POST /bid/:exchange - OpenRTB竞价接口（指定交易平台）")
+		logger.Info("  GET  /sync       - Cookie同步（跳转）")
+		logger.Info("  GET  /sync/pixel - Cookie同步（像素）")
 		logger.Info("  GET  /health     - 健康检查")
 		logger.Info("  GET  /stats      - 统计信息")
 		logger.Info("  GET  /win        - 赢标通知")
+		logger.Info("  GET  /imp        - 曝光监测")
+		logger.Info("  GET  /click      - 点击监测")
 		logger.Info("  GET  /bill       - 计费通知")
 		logger.Info("======================================")
 
@@ -131,21 +268,6 @@ func main() {
 	logger.Info("服务器已关闭")
 }
 
-// handleWinNotice 处理赢标通知
-func handleWinNotice(c *gin.Context) {
-	price := c.Query("price")
-	bidID := c.Query("bidid")
-
-	logger.Infof("赢标通知: BidID=%s, Price=%s", bidID, price)
-
-	// 实际项目中应该:
-	// 1. 记录赢标日志到ClickHouse
-	// 2. 扣减预算（调用预算服务）
-	// 3. 更新统计数据
-
-	c.String(http.StatusOK, "OK")
-}
-
 // handleBillNotice 处理计费通知
 func handleBillNotice(c *gin.Context) {
 	bidID := c.Query("bidid")
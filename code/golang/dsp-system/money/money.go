@@ -0,0 +1,113 @@
+// Package money 金额统一使用整数微单位（百万分之一货币单位）表示，避免浮点累加误差。
+// 只有在OpenRTB协议边界（api包）才与浮点CPM价格互相转换。
+package money
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Micros 金额（微单位，1元 = 1,000,000 Micros）
+type Micros int64
+
+// MicrosPerUnit 每个货币单位对应的微单位数
+const MicrosPerUnit Micros = 1_000_000
+
+// DefaultCurrency 默认币种（ISO-4217）
+const DefaultCurrency = "CNY"
+
+// FromFloat 将浮点金额转换为微单位（四舍五入到最近的微单位）
+func FromFloat(v float64) Micros {
+	return Micros(math.Round(v * float64(MicrosPerUnit)))
+}
+
+// Float 转换为浮点金额，仅用于协议边界和展示
+func (m Micros) Float() float64 {
+	return float64(m) / float64(MicrosPerUnit)
+}
+
+// String 以定点小数形式输出，如 "12.345600"
+func (m Micros) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%06d", sign, v/int64(MicrosPerUnit), v%int64(MicrosPerUnit))
+}
+
+// ParseDecimal 精确解析十进制金额字符串（如 "8500.25"）为微单位，不经过浮点数。
+// 用于迁移以浮点形式存储的历史数据，超过6位的小数按四舍五入处理。
+func ParseDecimal(s string) (Micros, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("金额为空")
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	// 科学计数法等非常规格式回退到浮点解析
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效金额: %q", s)
+		}
+		m := FromFloat(f)
+		if negative {
+			m = -m
+		}
+		return m, nil
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("无效金额: %q", s) // 如 "-"、"."，没有数字
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效金额: %q", s)
+	}
+	if units > math.MaxInt64/int64(MicrosPerUnit)-1 {
+		return 0, fmt.Errorf("金额超出范围: %q", s)
+	}
+
+	var frac int64
+	roundUp := false
+	for i, c := range fracPart {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("无效金额: %q", s)
+		}
+		switch {
+		case i < 6:
+			frac = frac*10 + int64(c-'0')
+		case i == 6:
+			roundUp = c >= '5'
+		}
+	}
+	for i := len(fracPart); i < 6; i++ {
+		frac *= 10
+	}
+	if roundUp {
+		frac++
+	}
+
+	m := Micros(units*int64(MicrosPerUnit) + frac)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
@@ -0,0 +1,58 @@
+package money_test
+
+import (
+	"testing"
+
+	"dsp-system/money"
+)
+
+func TestRepeatedDeductionsDoNotDrift(t *testing.T) {
+	balance := money.FromFloat(8500)
+	amount := money.FromFloat(0.1)
+	for i := 0; i < 1000; i++ {
+		balance -= amount
+	}
+	for i := 0; i < 1000; i++ {
+		balance += amount
+	}
+	if balance != money.FromFloat(8500) {
+		t.Errorf("扣减后再退还应回到原值，实际为%s", balance)
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in   string
+		want money.Micros
+	}{
+		{"8500", 8_500_000_000},
+		{"8500.25", 8_500_250_000},
+		{"0.1", 100_000},
+		{".5", 500_000},
+		{"-3.2", -3_200_000},
+		{"1.0000005", 1_000_001},
+		{"1.0000004", 1_000_000},
+		{"1e2", 100_000_000},
+	}
+	for _, tt := range tests {
+		got, err := money.ParseDecimal(tt.in)
+		if err != nil {
+			t.Fatalf("ParseDecimal(%q): %v", tt.in, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseDecimal(%q) = %d, 期望 %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"12.3a", "-", ".", "-.", "+"} {
+		if _, err := money.ParseDecimal(in); err == nil {
+			t.Errorf("非法金额%q应返回错误", in)
+		}
+	}
+}
+
+func TestMicrosString(t *testing.T) {
+	if s := money.Micros(-1_500_000).String(); s != "-1.500000" {
+		t.Errorf("String() = %s", s)
+	}
+}
@@ -0,0 +1,136 @@
+package predict
+
+import (
+	"dsp-system/api"
+	"dsp-system/rpc"
+	"dsp-system/targeting"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Feature 一个特征：类别特征的名称为"字段=取值"、值为1，数值特征的名称为字段名
+type Feature struct {
+	Name  string
+	Value float64
+}
+
+// Features 一个候选广告的稀疏特征，没有出现的特征取值为0
+type Features []Feature
+
+// add 追加类别特征，取值为空时不追加
+func (f Features) add(field, value string) Features {
+	if value == "" {
+		return f
+	}
+	return append(f, Feature{Name: field + "=" + value, Value: 1})
+}
+
+// RequestFeatures 请求、广告位和用户的特征，同一广告位上的候选广告共用
+// env中的字符串已转为小写；时间特征按用户当地时间（请求没有时区时为服务器时区）
+func RequestFeatures(env *targeting.Env, imp *api.Imp, profile *rpc.UserProfile) Features {
+	f := make(Features, 0, 32)
+	f = f.add("country", env.Country)
+	f = f.add("region", env.Region)
+	f = f.add("city", env.City)
+
+	if env.DeviceType > 0 {
+		f = f.add("device.type", strconv.Itoa(env.DeviceType))
+	}
+	f = f.add("device.os", env.OS)
+	f = f.add("device.make", env.Make)
+	f = f.add("device.browser", env.Browser)
+	f = f.add("device.carrier", env.Carrier)
+	if env.ConnectionType > 0 {
+		f = f.add("device.connection", strconv.Itoa(env.ConnectionType))
+	}
+
+	f = f.add("site.domain", env.SiteDomain)
+	f = f.add("app.bundle", env.AppBundle)
+	for _, category := range env.Categories {
+		f = f.add("category", category)
+	}
+
+	switch {
+	case imp.Banner != nil:
+		f = f.add("imp.type", "banner")
+		if imp.Banner.W > 0 && imp.Banner.H > 0 {
+			f = f.add("imp.size", fmt.Sprintf("%dx%d", imp.Banner.W, imp.Banner.H))
+		}
+		if imp.Banner.Pos > 0 {
+			f = f.add("imp.pos", strconv.Itoa(imp.Banner.Pos))
+		}
+	case imp.Video != nil:
+		f = f.add("imp.type", "video")
+	case imp.Native != nil:
+		f = f.add("imp.type", "native")
+	}
+
+	now := env.Now
+	if env.UTCOffset != nil {
+		now = now.In(time.FixedZone("", *env.UTCOffset*60))
+	}
+	f = f.add("hour", strconv.Itoa(now.Hour()))
+	f = f.add("weekday", strconv.Itoa(int(now.Weekday())))
+
+	for _, tag := range env.Tags {
+		f = f.add("tag", tag)
+	}
+	for _, segment := range env.Segments {
+		f = f.add("segment", segment)
+	}
+	if profile != nil {
+		f = f.add("gender", strings.ToLower(profile.Gender))
+		f = f.add("age", ageBucket(profile.Age))
+		for _, interest := range profile.Interests {
+			f = f.add("interest", strings.ToLower(interest))
+		}
+	}
+	return f
+}
+
+// ageBucket 年龄段，未知时为空
+func ageBucket(age int) string {
+	switch {
+	case age <= 0:
+		return ""
+	case age < 18:
+		return "0-17"
+	case age < 25:
+		return "18-24"
+	case age < 35:
+		return "25-34"
+	case age < 45:
+		return "35-44"
+	case age < 55:
+		return "45-54"
+	}
+	return "55+"
+}
+
+// Ad 广告侧的特征来源
+type Ad struct {
+	CampaignID string
+	LineItemID string
+	CreativeID string
+	W, H       int
+	// TagMatch 投放单元定向标签中用户命中的比例，没有定向标签时为0
+	TagMatch float64
+}
+
+// AdFeatures 在请求特征后追加广告的特征，不修改base
+func AdFeatures(base Features, ad Ad) Features {
+	f := make(Features, len(base), len(base)+5)
+	copy(f, base)
+	f = f.add("campaign", ad.CampaignID)
+	f = f.add("line_item", ad.LineItemID)
+	f = f.add("creative", ad.CreativeID)
+	if ad.W > 0 && ad.H > 0 {
+		f = f.add("creative.size", fmt.Sprintf("%dx%d", ad.W, ad.H))
+	}
+	if ad.TagMatch > 0 {
+		f = append(f, Feature{Name: "tag_match", Value: ad.TagMatch})
+	}
+	return f
+}
@@ -0,0 +1,211 @@
+// Package predict 点击率（pCTR）和转化率（pCVR）预估
+// 模型由离线训练导出为JSON文件（逻辑回归或GBDT），竞价时按请求、用户画像和创意构造特征打分；
+// 模型文件变化后自动重新加载，新旧版本原子切换
+package predict
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// 模型类型
+const (
+	TypeLR   = "lr"   // 逻辑回归
+	TypeGBDT = "gbdt" // 梯度提升树（二分类，叶子值为对数几率）
+)
+
+// File 模型文件
+type File struct {
+	Version string `json:"version"`
+	// CTR 点击率模型，必须有
+	CTR *Spec `json:"ctr"`
+	// CVR 点击后的转化率模型，没有时不能预估转化
+	CVR *Spec `json:"cvr,omitempty"`
+}
+
+// Spec 一个二分类模型，输出为对数几率，经sigmoid得到概率
+type Spec struct {
+	Type string `json:"type"`
+	// Bias 逻辑回归的截距或GBDT的初始分
+	Bias float64 `json:"bias"`
+	// Weights 逻辑回归的特征权重，没有列出的特征权重为0
+	Weights map[string]float64 `json:"weights,omitempty"`
+	// Trees GBDT的树，每棵树是节点数组，第一个为根节点
+	Trees [][]Node `json:"trees,omitempty"`
+}
+
+// Node GBDT的节点：特征取值小于Threshold时走Yes，否则走No；没有的特征取值为0
+// Feature为空的节点是叶子，取值为Leaf
+type Node struct {
+	Feature   string  `json:"feature,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	Yes       int     `json:"yes,omitempty"`
+	No        int     `json:"no,omitempty"`
+	Leaf      float64 `json:"leaf,omitempty"`
+}
+
+// Prediction 预估结果
+type Prediction struct {
+	CTR float64
+	CVR float64 // 点击后转化的概率，没有转化率模型时为0
+}
+
+// scorer 编译后的模型，返回对数几率
+type scorer interface {
+	score(f Features) float64
+}
+
+// Model 编译后的模型，只读，可以并发预估
+type Model struct {
+	Version string
+	ctr     scorer
+	cvr     scorer
+}
+
+// LoadModel 读取并编译模型文件
+func LoadModel(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析模型文件失败: %w", err)
+	}
+	return NewModel(&file)
+}
+
+// NewModel 校验并编译模型
+func NewModel(file *File) (*Model, error) {
+	if file.CTR == nil {
+		return nil, fmt.Errorf("缺少点击率模型")
+	}
+	m := &Model{Version: file.Version}
+	var err error
+	if m.ctr, err = compile(file.CTR); err != nil {
+		return nil, fmt.Errorf("点击率模型无效: %w", err)
+	}
+	if file.CVR != nil {
+		if m.cvr, err = compile(file.CVR); err != nil {
+			return nil, fmt.Errorf("转化率模型无效: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// HasCVR 是否有转化率模型
+func (m *Model) HasCVR() bool {
+	return m != nil && m.cvr != nil
+}
+
+// Predict 预估点击率和转化率，m为nil时返回零值
+func (m *Model) Predict(f Features) Prediction {
+	if m == nil {
+		return Prediction{}
+	}
+	p := Prediction{CTR: sigmoid(m.ctr.score(f))}
+	if m.cvr != nil {
+		p.CVR = sigmoid(m.cvr.score(f))
+	}
+	return p
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+// compile 按模型类型编译
+func compile(spec *Spec) (scorer, error) {
+	switch spec.Type {
+	case TypeLR:
+		return &linear{bias: spec.Bias, weights: spec.Weights}, nil
+	case TypeGBDT:
+		return compileTrees(spec)
+	}
+	return nil, fmt.Errorf("模型类型无效: %q", spec.Type)
+}
+
+// linear 逻辑回归
+type linear struct {
+	bias    float64
+	weights map[string]float64
+}
+
+func (l *linear) score(f Features) float64 {
+	z := l.bias
+	for _, feature := range f {
+		z += l.weights[feature.Name] * feature.Value
+	}
+	return z
+}
+
+// node 编译后的树节点，feature为特征下标，-1表示叶子
+type node struct {
+	feature   int
+	threshold float64
+	yes, no   int32
+	leaf      float64
+}
+
+// forest GBDT，树中引用的特征编号为稠密下标
+type forest struct {
+	bias     float64
+	trees    [][]node
+	features map[string]int
+}
+
+// compileTrees 编译GBDT，子节点必须在父节点之后，保证没有环
+func compileTrees(spec *Spec) (*forest, error) {
+	if len(spec.Trees) == 0 {
+		return nil, fmt.Errorf("GBDT没有树")
+	}
+	g := &forest{bias: spec.Bias, features: make(map[string]int)}
+	for t, tree := range spec.Trees {
+		if len(tree) == 0 {
+			return nil, fmt.Errorf("第%d棵树为空", t+1)
+		}
+		nodes := make([]node, len(tree))
+		for i, n := range tree {
+			if n.Feature == "" {
+				nodes[i] = node{feature: -1, leaf: n.Leaf}
+				continue
+			}
+			if n.Yes <= i || n.No <= i || n.Yes >= len(tree) || n.No >= len(tree) {
+				return nil, fmt.Errorf("第%d棵树第%d个节点的子节点无效: yes=%d, no=%d", t+1, i, n.Yes, n.No)
+			}
+			index, ok := g.features[n.Feature]
+			if !ok {
+				index = len(g.features)
+				g.features[n.Feature] = index
+			}
+			nodes[i] = node{feature: index, threshold: n.Threshold, yes: int32(n.Yes), no: int32(n.No)}
+		}
+		g.trees = append(g.trees, nodes)
+	}
+	return g, nil
+}
+
+func (g *forest) score(f Features) float64 {
+	values := make([]float64, len(g.features))
+	for _, feature := range f {
+		if i, ok := g.features[feature.Name]; ok {
+			values[i] += feature.Value
+		}
+	}
+
+	z := g.bias
+	for _, tree := range g.trees {
+		i := int32(0)
+		for tree[i].feature >= 0 {
+			if n := tree[i]; values[n.feature] < n.threshold {
+				i = n.yes
+			} else {
+				i = n.no
+			}
+		}
+		z += tree[i].leaf
+	}
+	return z
+}
@@ -0,0 +1,199 @@
+package predict_test
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/predict"
+	"dsp-system/rpc"
+	"dsp-system/targeting"
+)
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func TestModelLR(t *testing.T) {
+	model, err := predict.NewModel(&predict.File{
+		Version: "v1",
+		CTR: &predict.Spec{Type: predict.TypeLR, Bias: -4, Weights: map[string]float64{
+			"device.os=ios": 0.5,
+			"creative=cr1":  0.3,
+			"tag_match":     1.2,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := predict.Features{
+		{Name: "device.os=ios", Value: 1},
+		{Name: "country=cn", Value: 1}, // 模型中没有的特征权重为0
+		{Name: "creative=cr1", Value: 1},
+		{Name: "tag_match", Value: 0.5},
+	}
+	p := model.Predict(features)
+	if want := sigmoid(-4 + 0.5 + 0.3 + 0.6); math.Abs(p.CTR-want) > 1e-12 {
+		t.Errorf("点击率应为%v，实际为%v", want, p.CTR)
+	}
+	if p.CVR != 0 || model.HasCVR() {
+		t.Error("没有转化率模型时转化率应为0")
+	}
+
+	var missing *predict.Model
+	if p := missing.Predict(features); p.CTR != 0 || missing.HasCVR() {
+		t.Error("没有模型时应返回零值")
+	}
+}
+
+func TestModelGBDT(t *testing.T) {
+	model, err := predict.NewModel(&predict.File{
+		CTR: &predict.Spec{Type: predict.TypeLR, Bias: -3},
+		CVR: &predict.Spec{Type: predict.TypeGBDT, Bias: -2, Trees: [][]predict.Node{
+			{
+				{Feature: "tag_match", Threshold: 0.5, Yes: 1, No: 2},
+				{Leaf: -0.5},
+				{Feature: "device.os=ios", Threshold: 0.5, Yes: 3, No: 4},
+				{Leaf: 0.2},
+				{Leaf: 0.8},
+			},
+			{
+				{Feature: "hour=20", Threshold: 0.5, Yes: 1, No: 2},
+				{Leaf: 0},
+				{Leaf: 0.3},
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		features predict.Features
+		want     float64
+	}{
+		{"没有特征时走取值为0的分支", nil, -2 - 0.5},
+		{"标签命中", predict.Features{{Name: "tag_match", Value: 1}}, -2 + 0.2},
+		{"标签命中且iOS晚上", predict.Features{{Name: "tag_match", Value: 1}, {Name: "device.os=ios", Value: 1}, {Name: "hour=20", Value: 1}}, -2 + 0.8 + 0.3},
+	}
+	for _, tt := range tests {
+		if got := model.Predict(tt.features).CVR; math.Abs(got-sigmoid(tt.want)) > 1e-12 {
+			t.Errorf("%s: 转化率应为%v，实际为%v", tt.name, sigmoid(tt.want), got)
+		}
+	}
+}
+
+func TestModelInvalid(t *testing.T) {
+	tests := []struct {
+		file predict.File
+		err  string
+	}{
+		{predict.File{}, "缺少点击率模型"},
+		{predict.File{CTR: &predict.Spec{Type: "dnn"}}, "模型类型无效"},
+		{predict.File{CTR: &predict.Spec{Type: predict.TypeGBDT}}, "没有树"},
+		{predict.File{CTR: &predict.Spec{Type: predict.TypeGBDT, Trees: [][]predict.Node{{}}}}, "为空"},
+		{predict.File{CTR: &predict.Spec{Type: predict.TypeGBDT, Trees: [][]predict.Node{
+			{{Feature: "a", Yes: 0, No: 1}, {Leaf: 1}},
+		}}}, "子节点无效"},
+		{predict.File{CTR: &predict.Spec{Type: predict.TypeLR}, CVR: &predict.Spec{Type: predict.TypeGBDT, Trees: [][]predict.Node{
+			{{Feature: "a", Yes: 1, No: 5}, {Leaf: 1}},
+		}}}, "转化率模型无效"},
+	}
+	for _, tt := range tests {
+		if _, err := predict.NewModel(&tt.file); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("错误应包含%q，实际为%v", tt.err, err)
+		}
+	}
+}
+
+func TestPredictorReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.json")
+	write := func(content string, mod time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"version": "v1", "ctr": {"type": "lr", "bias": -4}}`, start)
+
+	predictor, err := predict.NewPredictor(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer predictor.Close()
+	v1 := predictor.Model()
+	if v1.Version != "v1" {
+		t.Fatalf("应加载v1: %s", v1.Version)
+	}
+
+	if reloaded, err := predictor.Reload(); err != nil || reloaded {
+		t.Errorf("文件未变化时不应重新加载: %v, %v", reloaded, err)
+	}
+
+	write(`{"version": "v2", "ctr": {"type": "lr", "bias": -3}}`, start.Add(time.Minute))
+	if reloaded, err := predictor.Reload(); err != nil || !reloaded {
+		t.Fatalf("文件变化后应重新加载: %v, %v", reloaded, err)
+	}
+	if predictor.Model().Version != "v2" {
+		t.Errorf("应切换到v2: %s", predictor.Model().Version)
+	}
+	if p := v1.Predict(nil); math.Abs(p.CTR-sigmoid(-4)) > 1e-12 {
+		t.Error("已取出的旧版本不受切换影响")
+	}
+
+	write(`{"version": "v3", "ctr": {"type": "dnn"}}`, start.Add(2*time.Minute))
+	if _, err := predictor.Reload(); err == nil {
+		t.Error("无效的模型应返回错误")
+	}
+	if predictor.Model().Version != "v2" {
+		t.Errorf("加载失败时应继续使用旧模型: %s", predictor.Model().Version)
+	}
+
+	if _, err := predict.NewPredictor(filepath.Join(t.TempDir(), "missing.json"), 0); err == nil {
+		t.Error("模型文件不存在时应返回错误")
+	}
+	var disabled *predict.Predictor
+	if disabled.Model() != nil {
+		t.Error("没有预估器时模型应为nil")
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	offset := 480
+	req := &api.BidRequest{
+		Device: &api.Device{OS: "iOS", DeviceType: 4, Geo: &api.Geo{Country: "CN", UTCOffset: &offset}},
+		App:    &api.App{Bundle: "com.example.news", Cat: []string{"IAB12"}},
+	}
+	now := time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC) // 北京时间20:30，周一
+	env := targeting.NewEnv(req, []string{"s1"}, []string{"运动爱好者"}, now)
+	imp := &api.Imp{ID: "imp1", Banner: &api.Banner{W: 300, H: 250, Pos: 1}}
+	profile := &rpc.UserProfile{Age: 28, Gender: "M", Interests: []string{"Sports"}}
+
+	base := predict.RequestFeatures(env, imp, profile)
+	features := predict.AdFeatures(base, predict.Ad{CampaignID: "c1", LineItemID: "li1", CreativeID: "cr1", W: 300, H: 250, TagMatch: 0.5})
+
+	var names []string
+	for _, f := range features {
+		names = append(names, f.Name)
+	}
+	for _, want := range []string{
+		"country=cn", "device.type=4", "device.os=ios", "app.bundle=com.example.news", "category=iab12",
+		"imp.type=banner", "imp.size=300x250", "imp.pos=1", "hour=20", "weekday=1",
+		"tag=运动爱好者", "segment=s1", "gender=m", "age=25-34", "interest=sports",
+		"campaign=c1", "line_item=li1", "creative=cr1", "creative.size=300x250", "tag_match",
+	} {
+		if !slices.Contains(names, want) {
+			t.Errorf("缺少特征%s: %v", want, names)
+		}
+	}
+	if len(base) != len(features)-5 {
+		t.Error("追加广告特征不应修改请求特征")
+	}
+}
@@ -0,0 +1,112 @@
+package predict
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Predictor 持有当前版本的模型，模型文件变化后自动重新加载
+// 发布新模型时先写临时文件再重命名，避免读到写了一半的文件；加载失败时继续使用旧模型
+type Predictor struct {
+	path    string
+	current atomic.Pointer[Model]
+
+	mu      sync.Mutex // 串行化重新加载
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPredictor 加载模型文件，reloadInterval大于0时按该间隔检查文件是否变化
+func NewPredictor(path string, reloadInterval time.Duration) (*Predictor, error) {
+	p := &Predictor{
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	if reloadInterval > 0 {
+		go p.watch(reloadInterval)
+	} else {
+		close(p.done)
+	}
+	return p, nil
+}
+
+// Model 当前版本的模型，p为nil时返回nil
+// 一次竞价应只取一次，保证同一请求的候选广告用同一版本打分
+func (p *Predictor) Model() *Model {
+	if p == nil {
+		return nil
+	}
+	return p.current.Load()
+}
+
+// Reload 模型文件有变化时重新加载，返回是否加载了新模型
+func (p *Predictor) Reload() (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+	if p.current.Load() != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+
+	model, err := LoadModel(p.path)
+	if err != nil {
+		return false, fmt.Errorf("加载预估模型失败: %w", err)
+	}
+	previous := p.current.Swap(model)
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+
+	if previous != nil {
+		log.Printf("预估模型已切换: %s -> %s", previous.Version, model.Version)
+	} else {
+		log.Printf("预估模型已加载: Version=%s, Path=%s", model.Version, p.path)
+	}
+	return true, nil
+}
+
+// watch 定期检查模型文件
+func (p *Predictor) watch(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := p.Reload(); err != nil {
+			log.Printf("重新加载预估模型失败（继续使用旧模型）: %v", err)
+		}
+	}
+}
+
+// Close 停止检查模型文件
+func (p *Predictor) Close() {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+}
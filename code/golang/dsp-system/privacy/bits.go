@@ -0,0 +1,76 @@
+package privacy
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// errTruncated 字符串长度不足以读出声明的字段
+var errTruncated = errors.New("数据长度不足")
+
+// decodeSegment 解码TCF/GPP使用的base64url分段（不带填充，兼容带填充的写法）。
+// 分段按6位字符编码位串，长度不是4的倍数时标准解码会丢掉末尾的位，所以先补全零字符'A'
+func decodeSegment(s string) ([]byte, error) {
+	s = strings.TrimRight(s, "=")
+	if n := len(s) % 4; n != 0 {
+		s += strings.Repeat("A", 4-n)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// bitReader 按位从高到低读取整数字段，读越界后所有读取返回0并记录错误
+type bitReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBitReader(data []byte) *bitReader {
+	return &bitReader{data: data}
+}
+
+// bit 读取一位
+func (r *bitReader) bit() bool {
+	if r.err != nil {
+		return false
+	}
+	if r.pos >= len(r.data)*8 {
+		r.err = errTruncated
+		return false
+	}
+	b := r.data[r.pos/8]&(0x80>>(r.pos%8)) != 0
+	r.pos++
+	return b
+}
+
+// int 读取n位无符号整数
+func (r *bitReader) int(n int) int {
+	v := 0
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.bit() {
+			v |= 1
+		}
+	}
+	return v
+}
+
+// fibonacci 读取斐波那契编码的整数（以连续两个1结束），GPP头部使用
+func (r *bitReader) fibonacci() int {
+	v := 0
+	a, b := 1, 2
+	prev := false
+	for r.err == nil {
+		cur := r.bit()
+		if cur && prev {
+			return v
+		}
+		if cur {
+			v += a
+		}
+		prev = cur
+		a, b = b, a+b
+	}
+	return 0
+}
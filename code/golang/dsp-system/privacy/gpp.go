@@ -0,0 +1,126 @@
+package privacy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GPP 分区ID
+const (
+	GPPSectionTCFEU = 2 // tcfeuv2，内容为TCF v2同意字符串
+	GPPSectionUSP   = 6 // uspv1，内容为CCPA字符串
+	GPPSectionUSNat = 7 // usnat，美国全国隐私分区
+)
+
+// GPPString 解析后的GPP字符串
+type GPPString struct {
+	SectionIDs []int
+	sections   map[int]string
+}
+
+// ParseGPP 解析GPP字符串：头部分段声明分区ID，后面按顺序是各分区内容，用"~"分隔
+func ParseGPP(gpp string) (*GPPString, error) {
+	parts := strings.Split(gpp, "~")
+	data, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("GPP头部解码失败: %v", err)
+	}
+
+	r := newBitReader(data)
+	if typ := r.int(6); r.err == nil && typ != 3 {
+		return nil, fmt.Errorf("GPP头部类型错误: %d", typ)
+	}
+	r.int(6) // Version
+
+	// 分区ID为斐波那契编码的整数区间，每项相对上一个值递增
+	var ids []int
+	last := 0
+	numRanges := r.int(12)
+	for i := 0; i < numRanges && r.err == nil; i++ {
+		isRange := r.bit()
+		start := last + r.fibonacci()
+		end := start
+		if isRange {
+			end = start + r.fibonacci()
+		}
+		for id := start; id <= end && r.err == nil; id++ {
+			ids = append(ids, id)
+		}
+		last = end
+	}
+	if r.err != nil {
+		return nil, fmt.Errorf("GPP头部格式错误: %v", r.err)
+	}
+	if len(ids) != len(parts)-1 {
+		return nil, fmt.Errorf("GPP分区数量不匹配: 头部%d个，实际%d个", len(ids), len(parts)-1)
+	}
+
+	g := &GPPString{SectionIDs: ids, sections: make(map[int]string, len(ids))}
+	for i, id := range ids {
+		g.sections[id] = parts[i+1]
+	}
+	return g, nil
+}
+
+// Section 获取指定分区的内容
+func (g *GPPString) Section(id int) (string, bool) {
+	s, ok := g.sections[id]
+	return s, ok
+}
+
+// usNatOptedOut 解析usnat分区，用户拒绝出售、共享、定向广告，儿童未授权处理，
+// 或开启了全局隐私控制（GPC）时返回true
+func usNatOptedOut(section string) (bool, error) {
+	segments := strings.Split(section, ".")
+	data, err := decodeSegment(segments[0])
+	if err != nil {
+		return false, fmt.Errorf("usnat分区解码失败: %v", err)
+	}
+
+	r := newBitReader(data)
+	if version := r.int(6); r.err == nil && version != 1 {
+		return false, fmt.Errorf("不支持的usnat版本: %d", version)
+	}
+	r.int(2 * 6) // 各项告知字段
+	saleOptOut := r.int(2)
+	sharingOptOut := r.int(2)
+	targetedAdsOptOut := r.int(2)
+	r.int(2 * 12) // SensitiveDataProcessing
+	childUnder13 := r.int(2)
+	childUnder17 := r.int(2)
+	if r.err != nil {
+		return false, fmt.Errorf("usnat分区格式错误: %v", r.err)
+	}
+
+	// 拒绝类字段：1=已拒绝；儿童授权字段：1=未授权
+	if saleOptOut == 1 || sharingOptOut == 1 || targetedAdsOptOut == 1 ||
+		childUnder13 == 1 || childUnder17 == 1 {
+		return true, nil
+	}
+
+	// 可选的GPC子分段：SubsectionType(2)=1，随后一位为GPC
+	for _, sub := range segments[1:] {
+		data, err := decodeSegment(sub)
+		if err != nil {
+			return false, fmt.Errorf("usnat子分段解码失败: %v", err)
+		}
+		r := newBitReader(data)
+		if r.int(2) == 1 && r.bit() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// uspOptedOut 解析CCPA字符串（如"1YYN"），第三位为Y表示用户拒绝出售个人信息
+func uspOptedOut(usp string) (bool, error) {
+	if len(usp) != 4 || usp[0] != '1' {
+		return false, fmt.Errorf("CCPA字符串格式错误: %q", usp)
+	}
+	for i := 1; i < 4; i++ {
+		if c := usp[i]; c != 'Y' && c != 'N' && c != '-' {
+			return false, fmt.Errorf("CCPA字符串格式错误: %q", usp)
+		}
+	}
+	return usp[2] == 'Y', nil
+}
@@ -0,0 +1,212 @@
+// Package privacy 根据竞价请求中的法规和同意信号（COPPA、DNT/LMT、TCF v2、CCPA、GPP）
+// 判断能否使用个人数据。不允许时不查询和保存用户画像，日志中只记录截断的IP和哈希后的ID。
+package privacy
+
+import (
+	"crypto/sha256"
+	"dsp-system/api"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// Decision 个人数据使用判定
+type Decision struct {
+	AllowPersonalData bool
+	Reason            string // 不允许时的原因，用于日志
+}
+
+// allow 允许使用个人数据
+var allow = Decision{AllowPersonalData: true}
+
+// deny 不允许使用个人数据
+func deny(format string, args ...interface{}) Decision {
+	return Decision{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Signals 竞价请求或同步请求中的法规和同意信号
+type Signals struct {
+	COPPA      bool
+	DNT        bool
+	LMT        bool
+	GDPR       *int   // nil表示未声明
+	TCFConsent string // TCF v2同意字符串
+	USPrivacy  string
+	GPP        string
+	GPPSID     []int
+}
+
+// SignalsFromRequest 从竞价请求中提取信号，兼容OpenRTB 2.6字段和2.5的ext写法
+func SignalsFromRequest(req *api.BidRequest) Signals {
+	var s Signals
+	if req.Device != nil {
+		s.DNT = req.Device.DNT != nil && *req.Device.DNT == 1
+		s.LMT = req.Device.Lmt != nil && *req.Device.Lmt == 1
+	}
+	if req.User != nil {
+		s.TCFConsent = req.User.Consent
+		if s.TCFConsent == "" && req.User.Ext != nil {
+			s.TCFConsent = req.User.Ext.Consent
+		}
+	}
+	if regs := req.Regs; regs != nil {
+		s.COPPA = regs.COPPA == 1
+		s.GDPR = regs.GDPR
+		s.USPrivacy = regs.USPrivacy
+		s.GPP = regs.GPP
+		s.GPPSID = regs.GPPSID
+		if regs.Ext != nil {
+			if s.GDPR == nil {
+				s.GDPR = regs.Ext.GDPR
+			}
+			if s.USPrivacy == "" {
+				s.USPrivacy = regs.Ext.USPrivacy
+			}
+		}
+	}
+	return s
+}
+
+// Policy 隐私策略
+type Policy struct {
+	vendorID int // 本方在IAB全球供应商列表中的ID，0表示未注册，适用GDPR时一律不使用个人数据
+}
+
+// NewPolicy 创建隐私策略
+func NewPolicy(vendorID int) *Policy {
+	return &Policy{vendorID: vendorID}
+}
+
+// Evaluate 判断竞价请求能否使用个人数据
+func (p *Policy) Evaluate(req *api.BidRequest) Decision {
+	return p.EvaluateSignals(SignalsFromRequest(req))
+}
+
+// EvaluateSignals 按信号判断能否使用个人数据，任一信号不满足即不允许；
+// 同意字符串缺失或无法解析时按未同意处理
+func (p *Policy) EvaluateSignals(s Signals) Decision {
+	if s.COPPA {
+		return deny("COPPA")
+	}
+	if s.LMT {
+		return deny("LMT")
+	}
+	if s.DNT {
+		return deny("DNT")
+	}
+
+	var gpp *GPPString
+	if s.GPP != "" {
+		var err error
+		if gpp, err = ParseGPP(s.GPP); err != nil {
+			return deny("%v", err)
+		}
+	}
+	// gpp_sid声明了适用的分区；未声明时GPP字符串中的分区都适用
+	var sections []int
+	if gpp != nil {
+		sections = gpp.SectionIDs
+		if len(s.GPPSID) > 0 {
+			sections = s.GPPSID
+		}
+	}
+
+	// GDPR：明确声明适用、GPP适用欧盟分区，或未声明但带了同意字符串
+	tcfConsent := s.TCFConsent
+	if tcfConsent == "" && gpp != nil {
+		tcfConsent, _ = gpp.Section(GPPSectionTCFEU)
+	}
+	gdprApplies := slices.Contains(sections, GPPSectionTCFEU)
+	if s.GDPR != nil {
+		gdprApplies = gdprApplies || *s.GDPR == 1
+	} else if tcfConsent != "" {
+		gdprApplies = true
+	}
+	if gdprApplies {
+		if d := p.evaluateTCF(tcfConsent); !d.AllowPersonalData {
+			return d
+		}
+	}
+
+	if s.USPrivacy != "" {
+		optedOut, err := uspOptedOut(s.USPrivacy)
+		if err != nil {
+			return deny("%v", err)
+		}
+		if optedOut {
+			return deny("CCPA拒绝出售")
+		}
+	}
+
+	for _, id := range sections {
+		if id == GPPSectionTCFEU {
+			continue
+		}
+		section, ok := gpp.Section(id)
+		if !ok {
+			return deny("GPP缺少适用的分区: %d", id)
+		}
+
+		var optedOut bool
+		var err error
+		switch id {
+		case GPPSectionUSP:
+			optedOut, err = uspOptedOut(section)
+		case GPPSectionUSNat:
+			optedOut, err = usNatOptedOut(section)
+		default:
+			// 无法确认用户选择的分区按未同意处理
+			return deny("不支持的GPP分区: %d", id)
+		}
+		if err != nil {
+			return deny("%v", err)
+		}
+		if optedOut {
+			return deny("GPP分区%d拒绝", id)
+		}
+	}
+
+	return allow
+}
+
+// evaluateTCF 需要用户同意存储访问、建立画像和个性化广告三个用途，并同意本方供应商
+func (p *Policy) evaluateTCF(consent string) Decision {
+	if consent == "" {
+		return deny("GDPR缺少同意字符串")
+	}
+	tcf, err := ParseTCFv2(consent)
+	if err != nil {
+		return deny("%v", err)
+	}
+	for _, purpose := range []int{PurposeStoreAccess, PurposeAdsProfile, PurposePersonalizeAds} {
+		if !tcf.PurposeConsent(purpose) {
+			return deny("TCF未同意用途%d", purpose)
+		}
+	}
+	if !tcf.VendorConsent(p.vendorID) {
+		return deny("TCF未同意供应商%d", p.vendorID)
+	}
+	return allow
+}
+
+// HashID 对用户ID和设备ID做SHA-256哈希，空字符串保持为空
+func HashID(id string) string {
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+// TruncateIP 截断IP地址：IPv4保留前24位，IPv6保留前48位；无法解析时返回空字符串
+func TruncateIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
@@ -0,0 +1,274 @@
+package privacy_test
+
+import (
+	"strings"
+	"testing"
+
+	"dsp-system/api"
+	"dsp-system/privacy"
+)
+
+const testVendorID = 42
+
+// bitWriter 按TCF/GPP的位布局构造测试字符串
+type bitWriter struct {
+	bits []bool
+}
+
+func (w *bitWriter) int(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = append(w.bits, v&(1<<i) != 0)
+	}
+}
+
+func (w *bitWriter) bool(b bool) {
+	w.bits = append(w.bits, b)
+}
+
+// fibonacci 写入斐波那契编码（Zeckendorf表示加结束位1）
+func (w *bitWriter) fibonacci(v int) {
+	fibs := []int{1, 2}
+	for fibs[len(fibs)-1] <= v {
+		fibs = append(fibs, fibs[len(fibs)-1]+fibs[len(fibs)-2])
+	}
+	code := make([]bool, len(fibs))
+	for i := len(fibs) - 1; i >= 0; i-- {
+		if fibs[i] <= v {
+			code[i] = true
+			v -= fibs[i]
+		}
+	}
+	for len(code) > 0 && !code[len(code)-1] {
+		code = code[:len(code)-1]
+	}
+	w.bits = append(append(w.bits, code...), true)
+}
+
+// String 每6位编码为一个base64url字符
+func (w *bitWriter) String() string {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	var sb strings.Builder
+	for i := 0; i < len(w.bits); i += 6 {
+		v := 0
+		for j := i; j < i+6; j++ {
+			v <<= 1
+			if j < len(w.bits) && w.bits[j] {
+				v |= 1
+			}
+		}
+		sb.WriteByte(alphabet[v])
+	}
+	return sb.String()
+}
+
+// tcfString 构造TCF v2同意字符串，vendorRange为true时供应商使用区间编码
+func tcfString(purposes []int, vendors []int, vendorRange bool) string {
+	w := &bitWriter{}
+	w.int(2, 6)
+	w.int(0, 36)
+	w.int(0, 36)
+	w.int(7, 12) // CmpId
+	w.int(1, 12)
+	w.int(1, 6)
+	w.int(0, 12)
+	w.int(150, 12) // VendorListVersion
+	w.int(2, 6)
+	w.int(0, 2)
+	w.int(0, 12)
+	consent := 0
+	for _, p := range purposes {
+		consent |= 1 << (24 - p)
+	}
+	w.int(consent, 24)
+	w.int(0, 24) // PurposesLITransparency
+	w.int(0, 1)
+	w.int(0, 12)
+
+	maxVendor := 0
+	for _, v := range vendors {
+		maxVendor = max(maxVendor, v)
+	}
+	w.int(maxVendor, 16)
+	w.bool(vendorRange)
+	if vendorRange {
+		w.int(len(vendors), 12)
+		for _, v := range vendors {
+			w.bool(false)
+			w.int(v, 16)
+		}
+	} else {
+		for id := 1; id <= maxVendor; id++ {
+			found := false
+			for _, v := range vendors {
+				found = found || v == id
+			}
+			w.bool(found)
+		}
+	}
+	// 正当利益供应商分段为空
+	w.int(0, 16)
+	w.bool(false)
+	return w.String()
+}
+
+// gppHeader 构造GPP头部，分区ID逐个编码
+func gppHeader(ids ...int) string {
+	w := &bitWriter{}
+	w.int(3, 6)
+	w.int(1, 6)
+	w.int(len(ids), 12)
+	last := 0
+	for _, id := range ids {
+		w.bool(false)
+		w.fibonacci(id - last)
+		last = id
+	}
+	return w.String()
+}
+
+// usNatString 构造usnat分区，三项拒绝字段取值1=拒绝、2=未拒绝
+func usNatString(sale, sharing, targeted int) string {
+	w := &bitWriter{}
+	w.int(1, 6)
+	w.int(0, 12)
+	w.int(sale, 2)
+	w.int(sharing, 2)
+	w.int(targeted, 2)
+	w.int(0, 24)
+	w.int(0, 4)
+	w.int(0, 2)
+	w.int(0, 6)
+	return w.String()
+}
+
+func TestParseTCFv2(t *testing.T) {
+	for _, vendorRange := range []bool{false, true} {
+		consent, err := privacy.ParseTCFv2(tcfString([]int{1, 3, 4}, []int{5, testVendorID}, vendorRange) + ".IF0EWSFgA")
+		if err != nil {
+			t.Fatalf("解析失败(range=%v): %v", vendorRange, err)
+		}
+		if consent.CMPID != 7 || consent.VendorListVersion != 150 {
+			t.Errorf("核心字段错误: %+v", consent)
+		}
+		for purpose, want := range map[int]bool{1: true, 2: false, 3: true, 4: true, 10: false} {
+			if got := consent.PurposeConsent(purpose); got != want {
+				t.Errorf("用途%d同意应为%v(range=%v)", purpose, want, vendorRange)
+			}
+		}
+		for vendor, want := range map[int]bool{5: true, testVendorID: true, 6: false, 1000: false} {
+			if got := consent.VendorConsent(vendor); got != want {
+				t.Errorf("供应商%d同意应为%v(range=%v)", vendor, want, vendorRange)
+			}
+		}
+	}
+
+	for _, bad := range []string{"", "!!!", "BAAAAAAA", tcfString(nil, nil, false)[:20]} {
+		if _, err := privacy.ParseTCFv2(bad); err == nil {
+			t.Errorf("非法同意字符串应返回错误: %q", bad)
+		}
+	}
+}
+
+func TestParseGPP(t *testing.T) {
+	// IAB规范示例头部：分区2和6
+	if got := gppHeader(2, 6); got != "DBACNY" {
+		t.Fatalf("头部编码与规范示例不一致: %s", got)
+	}
+
+	gpp, err := privacy.ParseGPP("DBACNY~" + tcfString([]int{1}, nil, false) + "~1YNN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gpp.SectionIDs) != 2 || gpp.SectionIDs[0] != 2 || gpp.SectionIDs[1] != 6 {
+		t.Errorf("分区ID错误: %v", gpp.SectionIDs)
+	}
+	if usp, ok := gpp.Section(6); !ok || usp != "1YNN" {
+		t.Errorf("uspv1分区内容错误: %q", usp)
+	}
+
+	if _, err := privacy.ParseGPP("DBACNY~only-one"); err == nil {
+		t.Error("分区数量不匹配应返回错误")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	one := 1
+	zero := 0
+	granted := tcfString([]int{1, 2, 3, 4}, []int{testVendorID}, false)
+
+	tests := []struct {
+		name  string
+		req   *api.BidRequest
+		allow bool
+	}{
+		{"无法规信号", &api.BidRequest{}, true},
+		{"COPPA", &api.BidRequest{Regs: &api.Regs{COPPA: 1}}, false},
+		{"LMT", &api.BidRequest{Device: &api.Device{Lmt: &one}}, false},
+		{"DNT", &api.BidRequest{Device: &api.Device{DNT: &one}}, false},
+		{"DNT=0", &api.BidRequest{Device: &api.Device{DNT: &zero, Lmt: &zero}}, true},
+		{"GDPR缺少同意", &api.BidRequest{Regs: &api.Regs{GDPR: &one}}, false},
+		{"GDPR已同意", &api.BidRequest{Regs: &api.Regs{GDPR: &one}, User: &api.User{Consent: granted}}, true},
+		{"GDPR通过ext传递", &api.BidRequest{
+			Regs: &api.Regs{Ext: &api.RegsExt{GDPR: &one}},
+			User: &api.User{Ext: &api.UserExt{Consent: granted}},
+		}, true},
+		{"GDPR未同意本方供应商", &api.BidRequest{
+			Regs: &api.Regs{GDPR: &one},
+			User: &api.User{Consent: tcfString([]int{1, 2, 3, 4}, []int{7}, false)},
+		}, false},
+		{"GDPR未同意画像用途", &api.BidRequest{
+			Regs: &api.Regs{GDPR: &one},
+			User: &api.User{Consent: tcfString([]int{1, 2}, []int{testVendorID}, false)},
+		}, false},
+		{"GDPR同意字符串损坏", &api.BidRequest{Regs: &api.Regs{GDPR: &one}, User: &api.User{Consent: "garbage"}}, false},
+		{"GDPR=0忽略同意字符串", &api.BidRequest{Regs: &api.Regs{GDPR: &zero}, User: &api.User{Consent: "garbage"}}, true},
+		{"CCPA拒绝", &api.BidRequest{Regs: &api.Regs{USPrivacy: "1YYN"}}, false},
+		{"CCPA未拒绝", &api.BidRequest{Regs: &api.Regs{Ext: &api.RegsExt{USPrivacy: "1YNN"}}}, true},
+		{"GPP欧盟分区已同意", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(2) + "~" + granted, GPPSID: []int{2}}}, true},
+		{"GPP欧盟分区未同意", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(2) + "~" + tcfString(nil, nil, false)}}, false},
+		{"GPP usnat拒绝定向广告", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(7) + "~" + usNatString(2, 2, 1), GPPSID: []int{7}}}, false},
+		{"GPP usnat未拒绝", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(7) + "~" + usNatString(2, 2, 2), GPPSID: []int{7}}}, true},
+		{"GPP usnat开启GPC", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(7) + "~" + usNatString(2, 2, 2) + ".YA", GPPSID: []int{7}}}, false},
+		{"GPP不适用的分区不检查", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(6, 7) + "~1YYN~" + usNatString(2, 2, 2), GPPSID: []int{7}}}, true},
+		{"GPP不支持的分区", &api.BidRequest{Regs: &api.Regs{GPP: gppHeader(8) + "~BAAAAAAA", GPPSID: []int{8}}}, false},
+		{"GPP损坏", &api.BidRequest{Regs: &api.Regs{GPP: "garbage"}}, false},
+	}
+
+	policy := privacy.NewPolicy(testVendorID)
+	for _, tt := range tests {
+		d := policy.Evaluate(tt.req)
+		if d.AllowPersonalData != tt.allow {
+			t.Errorf("%s: 期望允许=%v，实际为%v（%s）", tt.name, tt.allow, d.AllowPersonalData, d.Reason)
+		}
+		if !d.AllowPersonalData && d.Reason == "" {
+			t.Errorf("%s: 不允许时应给出原因", tt.name)
+		}
+	}
+
+	// 未配置供应商ID时，适用GDPR的请求一律不使用个人数据
+	req := &api.BidRequest{Regs: &api.Regs{GDPR: &one}, User: &api.User{Consent: granted}}
+	if privacy.NewPolicy(0).Evaluate(req).AllowPersonalData {
+		t.Error("未配置供应商ID时不应允许使用个人数据")
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	tests := map[string]string{
+		"203.0.113.77":             "203.0.113.0",
+		"2001:db8:abcd:12:1:2:3:4": "2001:db8:abcd::",
+		"not-an-ip":                "",
+		"":                         "",
+	}
+	for in, want := range tests {
+		if got := privacy.TruncateIP(in); got != want {
+			t.Errorf("TruncateIP(%q) = %q, 期望 %q", in, got, want)
+		}
+	}
+
+	if privacy.HashID("") != "" {
+		t.Error("空ID哈希后应为空")
+	}
+	if h := privacy.HashID("ifa-1"); len(h) != 64 || h == "ifa-1" || h != privacy.HashID("ifa-1") {
+		t.Errorf("哈希结果应为稳定的64位十六进制: %s", h)
+	}
+}
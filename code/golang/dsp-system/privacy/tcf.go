@@ -0,0 +1,138 @@
+package privacy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TCF v2 用途ID
+const (
+	PurposeStoreAccess    = 1 // 在设备上存储和/或访问信息
+	PurposeBasicAds       = 2 // 使用有限的数据选择广告
+	PurposeAdsProfile     = 3 // 建立个性化广告画像
+	PurposePersonalizeAds = 4 // 使用画像选择个性化广告
+)
+
+// TCFConsent 解析后的TCF v2核心分段，只保留竞价需要的字段
+type TCFConsent struct {
+	Version           int
+	CMPID             int
+	VendorListVersion int
+	purposesConsent   int // 24位，最高位为用途1
+	purposesLI        int
+	vendorConsents    vendorSet
+	vendorLI          vendorSet
+}
+
+// ParseTCFv2 解析TCF v2同意字符串，只读取核心分段（第一个"."之前）
+func ParseTCFv2(consent string) (*TCFConsent, error) {
+	core, _, _ := strings.Cut(consent, ".")
+	if core == "" {
+		return nil, fmt.Errorf("TCF同意字符串为空")
+	}
+	data, err := decodeSegment(core)
+	if err != nil {
+		return nil, fmt.Errorf("TCF同意字符串解码失败: %v", err)
+	}
+
+	r := newBitReader(data)
+	c := &TCFConsent{}
+	c.Version = r.int(6)
+	if r.err == nil && c.Version != 2 {
+		return nil, fmt.Errorf("不支持的TCF版本: %d", c.Version)
+	}
+	r.int(36) // Created
+	r.int(36) // LastUpdated
+	c.CMPID = r.int(12)
+	r.int(12) // CmpVersion
+	r.int(6)  // ConsentScreen
+	r.int(12) // ConsentLanguage
+	c.VendorListVersion = r.int(12)
+	r.int(6)  // TcfPolicyVersion
+	r.int(1)  // IsServiceSpecific
+	r.int(1)  // UseNonStandardTexts
+	r.int(12) // SpecialFeatureOptIns
+	c.purposesConsent = r.int(24)
+	c.purposesLI = r.int(24)
+	r.int(1)  // PurposeOneTreatment
+	r.int(12) // PublisherCC
+	c.vendorConsents = readVendorSet(r)
+	c.vendorLI = readVendorSet(r)
+	if r.err != nil {
+		return nil, fmt.Errorf("TCF同意字符串格式错误: %v", r.err)
+	}
+	return c, nil
+}
+
+// PurposeConsent 用户是否同意指定用途
+func (c *TCFConsent) PurposeConsent(purpose int) bool {
+	return purposeBit(c.purposesConsent, purpose)
+}
+
+// PurposeLI 是否以正当利益为依据声明了指定用途（用户未反对）
+func (c *TCFConsent) PurposeLI(purpose int) bool {
+	return purposeBit(c.purposesLI, purpose)
+}
+
+// VendorConsent 用户是否同意指定供应商
+func (c *TCFConsent) VendorConsent(vendorID int) bool {
+	return c.vendorConsents.contains(vendorID)
+}
+
+// VendorLI 指定供应商的正当利益是否成立（用户未反对）
+func (c *TCFConsent) VendorLI(vendorID int) bool {
+	return c.vendorLI.contains(vendorID)
+}
+
+func purposeBit(bits int, purpose int) bool {
+	if purpose < 1 || purpose > 24 {
+		return false
+	}
+	return bits&(1<<(24-purpose)) != 0
+}
+
+// vendorSet 供应商集合，位图或区间两种编码
+type vendorSet struct {
+	bits   []bool // bits[i]对应供应商i+1
+	ranges [][2]int
+}
+
+// readVendorSet 读取MaxVendorId开头的供应商分段
+func readVendorSet(r *bitReader) vendorSet {
+	var set vendorSet
+	maxVendorID := r.int(16)
+	if !r.bit() {
+		set.bits = make([]bool, 0, maxVendorID)
+		for i := 0; i < maxVendorID && r.err == nil; i++ {
+			set.bits = append(set.bits, r.bit())
+		}
+		return set
+	}
+
+	numEntries := r.int(12)
+	for i := 0; i < numEntries && r.err == nil; i++ {
+		isRange := r.bit()
+		start := r.int(16)
+		end := start
+		if isRange {
+			end = r.int(16)
+		}
+		set.ranges = append(set.ranges, [2]int{start, end})
+	}
+	return set
+}
+
+func (s vendorSet) contains(vendorID int) bool {
+	if vendorID < 1 {
+		return false
+	}
+	if vendorID <= len(s.bits) && s.bits[vendorID-1] {
+		return true
+	}
+	for _, rg := range s.ranges {
+		if vendorID >= rg[0] && vendorID <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -19,10 +19,16 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	BudgetService_CheckBudget_FullMethodName   = "/budget.BudgetService/CheckBudget"
-	BudgetService_DeductBudget_FullMethodName  = "/budget.BudgetService/DeductBudget"
-	BudgetService_GetBudgetInfo_FullMethodName = "/budget.BudgetService/GetBudgetInfo"
-	BudgetService_RefundBudget_FullMethodName  = "/budget.BudgetService/RefundBudget"
+	BudgetService_CheckBudget_FullMethodName       = "/budget.BudgetService/CheckBudget"
+	BudgetService_DeductBudget_FullMethodName      = "/budget.BudgetService/DeductBudget"
+	BudgetService_GetBudgetInfo_FullMethodName     = "/budget.BudgetService/GetBudgetInfo"
+	BudgetService_RefundBudget_FullMethodName      = "/budget.BudgetService/RefundBudget"
+	BudgetService_ListLedgerEntries_FullMethodName = "/budget.BudgetService/ListLedgerEntries"
+	BudgetService_ReconcileBudget_FullMethodName   = "/budget.BudgetService/ReconcileBudget"
+	BudgetService_AcquireLease_FullMethodName      = "/budget.BudgetService/AcquireLease"
+	BudgetService_ReleaseLease_FullMethodName      = "/budget.BudgetService/ReleaseLease"
+	BudgetService_ListLeases_FullMethodName        = "/budget.BudgetService/ListLeases"
+	BudgetService_WatchAlerts_FullMethodName       = "/budget.BudgetService/WatchAlerts"
 )
 
 // BudgetServiceClient is the client API for BudgetService service.
@@ -39,6 +45,18 @@ type BudgetServiceClient interface {
 	GetBudgetInfo(ctx context.Context, in *GetBudgetInfoRequest, opts ...grpc.CallOption) (*GetBudgetInfoResponse, error)
 	// 退还预算（竞价失败时）
 	RefundBudget(ctx context.Context, in *RefundBudgetRequest, opts ...grpc.CallOption) (*RefundBudgetResponse, error)
+	// 查询预算流水（按活动和时间范围）
+	ListLedgerEntries(ctx context.Context, in *ListLedgerEntriesRequest, opts ...grpc.CallOption) (*ListLedgerEntriesResponse, error)
+	// 根据流水重算余额（对账）
+	ReconcileBudget(ctx context.Context, in *ReconcileBudgetRequest, opts ...grpc.CallOption) (*ReconcileBudgetResponse, error)
+	// 申请预算租约（竞价节点预先领取一部分预算在本地消耗）
+	AcquireLease(ctx context.Context, in *AcquireLeaseRequest, opts ...grpc.CallOption) (*AcquireLeaseResponse, error)
+	// 归还预算租约（上报实际消耗，退还未用完的部分）
+	ReleaseLease(ctx context.Context, in *ReleaseLeaseRequest, opts ...grpc.CallOption) (*ReleaseLeaseResponse, error)
+	// 查询活动的预算租约
+	ListLeases(ctx context.Context, in *ListLeasesRequest, opts ...grpc.CallOption) (*ListLeasesResponse, error)
+	// 订阅预算告警（阈值和超支通知）
+	WatchAlerts(ctx context.Context, in *WatchAlertsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BudgetAlert], error)
 }
 
 type budgetServiceClient struct {
@@ -89,6 +107,75 @@ func (c *budgetServiceClient) RefundBudget(ctx context.Context, in *RefundBudget
 	return out, nil
 }
 
+func (c *budgetServiceClient) ListLedgerEntries(ctx context.Context, in *ListLedgerEntriesRequest, opts ...grpc.CallOption) (*ListLedgerEntriesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLedgerEntriesResponse)
+	err := c.cc.Invoke(ctx, BudgetService_ListLedgerEntries_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *budgetServiceClient) ReconcileBudget(ctx context.Context, in *ReconcileBudgetRequest, opts ...grpc.CallOption) (*ReconcileBudgetResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReconcileBudgetResponse)
+	err := c.cc.Invoke(ctx, BudgetService_ReconcileBudget_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *budgetServiceClient) AcquireLease(ctx context.Context, in *AcquireLeaseRequest, opts ...grpc.CallOption) (*AcquireLeaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AcquireLeaseResponse)
+	err := c.cc.Invoke(ctx, BudgetService_AcquireLease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *budgetServiceClient) ReleaseLease(ctx context.Context, in *ReleaseLeaseRequest, opts ...grpc.CallOption) (*ReleaseLeaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReleaseLeaseResponse)
+	err := c.cc.Invoke(ctx, BudgetService_ReleaseLease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *budgetServiceClient) ListLeases(ctx context.Context, in *ListLeasesRequest, opts ...grpc.CallOption) (*ListLeasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLeasesResponse)
+	err := c.cc.Invoke(ctx, BudgetService_ListLeases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *budgetServiceClient) WatchAlerts(ctx context.Context, in *WatchAlertsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[BudgetAlert], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &BudgetService_ServiceDesc.Streams[0], BudgetService_WatchAlerts_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchAlertsRequest, BudgetAlert]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BudgetService_WatchAlertsClient = grpc.ServerStreamingClient[BudgetAlert]
+
 // BudgetServiceServer is the server API for BudgetService service.
 // All implementations must embed UnimplementedBudgetServiceServer
 // for forward compatibility.
@@ -103,6 +190,18 @@ type BudgetServiceServer interface {
 	GetBudgetInfo(context.Context, *GetBudgetInfoRequest) (*GetBudgetInfoResponse, error)
 	// 退还预算（竞价失败时）
 	RefundBudget(context.Context, *RefundBudgetRequest) (*RefundBudgetResponse, error)
+	// 查询预算流水（按活动和时间范围）
+	ListLedgerEntries(context.Context, *ListLedgerEntriesRequest) (*ListLedgerEntriesResponse, error)
+	// 根据流水重算余额（对账）
+	ReconcileBudget(context.Context, *ReconcileBudgetRequest) (*ReconcileBudgetResponse, error)
+	// 申请预算租约（竞价节点预先领取一部分预算在本地消耗）
+	AcquireLease(context.Context, *AcquireLeaseRequest) (*AcquireLeaseResponse, error)
+	// 归还预算租约（上报实际消耗，退还未用完的部分）
+	ReleaseLease(context.Context, *ReleaseLeaseRequest) (*ReleaseLeaseResponse, error)
+	// 查询活动的预算租约
+	ListLeases(context.Context, *ListLeasesRequest) (*ListLeasesResponse, error)
+	// 订阅预算告警（阈值和超支通知）
+	WatchAlerts(*WatchAlertsRequest, grpc.ServerStreamingServer[BudgetAlert]) error
 	mustEmbedUnimplementedBudgetServiceServer()
 }
 
@@ -125,6 +224,24 @@ func (UnimplementedBudgetServiceServer) GetBudgetInfo(context.Context, *GetBudge
 func (UnimplementedBudgetServiceServer) RefundBudget(context.Context, *RefundBudgetRequest) (*RefundBudgetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method RefundBudget not implemented")
 }
+func (UnimplementedBudgetServiceServer) ListLedgerEntries(context.Context, *ListLedgerEntriesRequest) (*ListLedgerEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLedgerEntries not implemented")
+}
+func (UnimplementedBudgetServiceServer) ReconcileBudget(context.Context, *ReconcileBudgetRequest) (*ReconcileBudgetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReconcileBudget not implemented")
+}
+func (UnimplementedBudgetServiceServer) AcquireLease(context.Context, *AcquireLeaseRequest) (*AcquireLeaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcquireLease not implemented")
+}
+func (UnimplementedBudgetServiceServer) ReleaseLease(context.Context, *ReleaseLeaseRequest) (*ReleaseLeaseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReleaseLease not implemented")
+}
+func (UnimplementedBudgetServiceServer) ListLeases(context.Context, *ListLeasesRequest) (*ListLeasesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLeases not implemented")
+}
+func (UnimplementedBudgetServiceServer) WatchAlerts(*WatchAlertsRequest, grpc.ServerStreamingServer[BudgetAlert]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchAlerts not implemented")
+}
 func (UnimplementedBudgetServiceServer) mustEmbedUnimplementedBudgetServiceServer() {}
 func (UnimplementedBudgetServiceServer) testEmbeddedByValue()                       {}
 
@@ -218,6 +335,107 @@ func _BudgetService_RefundBudget_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _BudgetService_ListLedgerEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLedgerEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BudgetServiceServer).ListLedgerEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BudgetService_ListLedgerEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BudgetServiceServer).ListLedgerEntries(ctx, req.(*ListLedgerEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BudgetService_ReconcileBudget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReconcileBudgetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BudgetServiceServer).ReconcileBudget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BudgetService_ReconcileBudget_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BudgetServiceServer).ReconcileBudget(ctx, req.(*ReconcileBudgetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BudgetService_AcquireLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AcquireLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BudgetServiceServer).AcquireLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BudgetService_AcquireLease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BudgetServiceServer).AcquireLease(ctx, req.(*AcquireLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BudgetService_ReleaseLease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReleaseLeaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BudgetServiceServer).ReleaseLease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BudgetService_ReleaseLease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BudgetServiceServer).ReleaseLease(ctx, req.(*ReleaseLeaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BudgetService_ListLeases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLeasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BudgetServiceServer).ListLeases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: BudgetService_ListLeases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BudgetServiceServer).ListLeases(ctx, req.(*ListLeasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BudgetService_WatchAlerts_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchAlertsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BudgetServiceServer).WatchAlerts(m, &grpc.GenericServerStream[WatchAlertsRequest, BudgetAlert]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type BudgetService_WatchAlertsServer = grpc.ServerStreamingServer[BudgetAlert]
+
 // BudgetService_ServiceDesc is the grpc.ServiceDesc for BudgetService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -241,7 +459,33 @@ var BudgetService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "RefundBudget",
 			Handler:    _BudgetService_RefundBudget_Handler,
 		},
+		{
+			MethodName: "ListLedgerEntries",
+			Handler:    _BudgetService_ListLedgerEntries_Handler,
+		},
+		{
+			MethodName: "ReconcileBudget",
+			Handler:    _BudgetService_ReconcileBudget_Handler,
+		},
+		{
+			MethodName: "AcquireLease",
+			Handler:    _BudgetService_AcquireLease_Handler,
+		},
+		{
+			MethodName: "ReleaseLease",
+			Handler:    _BudgetService_ReleaseLease_Handler,
+		},
+		{
+			MethodName: "ListLeases",
+			Handler:    _BudgetService_ListLeases_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchAlerts",
+			Handler:       _BudgetService_WatchAlerts_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/budget.proto",
 }
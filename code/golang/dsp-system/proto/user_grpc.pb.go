@@ -21,7 +21,19 @@ const _ = grpc.SupportPackageIsVersion9
 const (
 	UserService_GetUserProfile_FullMethodName       = "/user.UserService/GetUserProfile"
 	UserService_UpdateUserBehavior_FullMethodName   = "/user.UserService/UpdateUserBehavior"
+	UserService_IngestBehaviors_FullMethodName      = "/user.UserService/IngestBehaviors"
 	UserService_BatchGetUserProfiles_FullMethodName = "/user.UserService/BatchGetUserProfiles"
+	UserService_ExportProfiles_FullMethodName       = "/user.UserService/ExportProfiles"
+	UserService_ImportProfiles_FullMethodName       = "/user.UserService/ImportProfiles"
+	UserService_CreateSegment_FullMethodName        = "/user.UserService/CreateSegment"
+	UserService_UploadSegment_FullMethodName        = "/user.UserService/UploadSegment"
+	UserService_ListSegments_FullMethodName         = "/user.UserService/ListSegments"
+	UserService_DeleteSegment_FullMethodName        = "/user.UserService/DeleteSegment"
+	UserService_GetUserSegments_FullMethodName      = "/user.UserService/GetUserSegments"
+	UserService_ObserveIdentifiers_FullMethodName   = "/user.UserService/ObserveIdentifiers"
+	UserService_ResolveIdentity_FullMethodName      = "/user.UserService/ResolveIdentity"
+	UserService_DeleteUser_FullMethodName           = "/user.UserService/DeleteUser"
+	UserService_ExportUser_FullMethodName           = "/user.UserService/ExportUser"
 )
 
 // UserServiceClient is the client API for UserService service.
@@ -34,8 +46,32 @@ type UserServiceClient interface {
 	GetUserProfile(ctx context.Context, in *GetUserProfileRequest, opts ...grpc.CallOption) (*GetUserProfileResponse, error)
 	// 更新用户行为
 	UpdateUserBehavior(ctx context.Context, in *UpdateUserBehaviorRequest, opts ...grpc.CallOption) (*UpdateUserBehaviorResponse, error)
+	// 流式上报用户行为：客户端分批发送，服务端逐批写入后再接收下一批，结束时返回写入失败的事件
+	IngestBehaviors(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BehaviorBatch, IngestBehaviorsResponse], error)
 	// 批量获取用户画像
 	BatchGetUserProfiles(ctx context.Context, in *BatchGetUserProfilesRequest, opts ...grpc.CallOption) (*BatchGetUserProfilesResponse, error)
+	// 导出全部用户画像（按用户ID顺序）
+	ExportProfiles(ctx context.Context, in *ExportProfilesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserProfileRecord], error)
+	// 批量导入用户画像（已存在的用户会被覆盖）
+	ImportProfiles(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UserProfileRecord, ImportProfilesResponse], error)
+	// 创建规则人群
+	CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*SegmentInfo, error)
+	// 上传名单人群（首条消息为元数据，其后为文件内容分片）
+	UploadSegment(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadSegmentRequest, UploadSegmentResponse], error)
+	// 列出全部人群
+	ListSegments(ctx context.Context, in *ListSegmentsRequest, opts ...grpc.CallOption) (*ListSegmentsResponse, error)
+	// 删除人群
+	DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error)
+	// 查询用户所属人群
+	GetUserSegments(ctx context.Context, in *GetUserSegmentsRequest, opts ...grpc.CallOption) (*GetUserSegmentsResponse, error)
+	// 记录同时出现的一组用户标识（跨设备身份关联）
+	ObserveIdentifiers(ctx context.Context, in *ObserveIdentifiersRequest, opts ...grpc.CallOption) (*ObserveIdentifiersResponse, error)
+	// 查询标识所属的身份簇
+	ResolveIdentity(ctx context.Context, in *ResolveIdentityRequest, opts ...grpc.CallOption) (*ResolveIdentityResponse, error)
+	// 删除用户（含同一身份簇的全部标识）在各数据源中的数据，返回执行报告并记录审计
+	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DataSubjectReport, error)
+	// 导出用户（含同一身份簇的全部标识）的数据，并记录审计
+	ExportUser(ctx context.Context, in *ExportUserRequest, opts ...grpc.CallOption) (*ExportUserResponse, error)
 }
 
 type userServiceClient struct {
@@ -66,6 +102,19 @@ func (c *userServiceClient) UpdateUserBehavior(ctx context.Context, in *UpdateUs
 	return out, nil
 }
 
+func (c *userServiceClient) IngestBehaviors(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[BehaviorBatch, IngestBehaviorsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[0], UserService_IngestBehaviors_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BehaviorBatch, IngestBehaviorsResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_IngestBehaviorsClient = grpc.ClientStreamingClient[BehaviorBatch, IngestBehaviorsResponse]
+
 func (c *userServiceClient) BatchGetUserProfiles(ctx context.Context, in *BatchGetUserProfilesRequest, opts ...grpc.CallOption) (*BatchGetUserProfilesResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(BatchGetUserProfilesResponse)
@@ -76,6 +125,131 @@ func (c *userServiceClient) BatchGetUserProfiles(ctx context.Context, in *BatchG
 	return out, nil
 }
 
+func (c *userServiceClient) ExportProfiles(ctx context.Context, in *ExportProfilesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[UserProfileRecord], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[1], UserService_ExportProfiles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExportProfilesRequest, UserProfileRecord]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ExportProfilesClient = grpc.ServerStreamingClient[UserProfileRecord]
+
+func (c *userServiceClient) ImportProfiles(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UserProfileRecord, ImportProfilesResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[2], UserService_ImportProfiles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UserProfileRecord, ImportProfilesResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ImportProfilesClient = grpc.ClientStreamingClient[UserProfileRecord, ImportProfilesResponse]
+
+func (c *userServiceClient) CreateSegment(ctx context.Context, in *CreateSegmentRequest, opts ...grpc.CallOption) (*SegmentInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SegmentInfo)
+	err := c.cc.Invoke(ctx, UserService_CreateSegment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) UploadSegment(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadSegmentRequest, UploadSegmentResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UserService_ServiceDesc.Streams[3], UserService_UploadSegment_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UploadSegmentRequest, UploadSegmentResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_UploadSegmentClient = grpc.ClientStreamingClient[UploadSegmentRequest, UploadSegmentResponse]
+
+func (c *userServiceClient) ListSegments(ctx context.Context, in *ListSegmentsRequest, opts ...grpc.CallOption) (*ListSegmentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListSegmentsResponse)
+	err := c.cc.Invoke(ctx, UserService_ListSegments_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) DeleteSegment(ctx context.Context, in *DeleteSegmentRequest, opts ...grpc.CallOption) (*DeleteSegmentResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteSegmentResponse)
+	err := c.cc.Invoke(ctx, UserService_DeleteSegment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) GetUserSegments(ctx context.Context, in *GetUserSegmentsRequest, opts ...grpc.CallOption) (*GetUserSegmentsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserSegmentsResponse)
+	err := c.cc.Invoke(ctx, UserService_GetUserSegments_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ObserveIdentifiers(ctx context.Context, in *ObserveIdentifiersRequest, opts ...grpc.CallOption) (*ObserveIdentifiersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ObserveIdentifiersResponse)
+	err := c.cc.Invoke(ctx, UserService_ObserveIdentifiers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ResolveIdentity(ctx context.Context, in *ResolveIdentityRequest, opts ...grpc.CallOption) (*ResolveIdentityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ResolveIdentityResponse)
+	err := c.cc.Invoke(ctx, UserService_ResolveIdentity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DataSubjectReport, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DataSubjectReport)
+	err := c.cc.Invoke(ctx, UserService_DeleteUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userServiceClient) ExportUser(ctx context.Context, in *ExportUserRequest, opts ...grpc.CallOption) (*ExportUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExportUserResponse)
+	err := c.cc.Invoke(ctx, UserService_ExportUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // UserServiceServer is the server API for UserService service.
 // All implementations must embed UnimplementedUserServiceServer
 // for forward compatibility.
@@ -86,8 +260,32 @@ type UserServiceServer interface {
 	GetUserProfile(context.Context, *GetUserProfileRequest) (*GetUserProfileResponse, error)
 	// 更新用户行为
 	UpdateUserBehavior(context.Context, *UpdateUserBehaviorRequest) (*UpdateUserBehaviorResponse, error)
+	// 流式上报用户行为：客户端分批发送，服务端逐批写入后再接收下一批，结束时返回写入失败的事件
+	IngestBehaviors(grpc.ClientStreamingServer[BehaviorBatch, IngestBehaviorsResponse]) error
 	// 批量获取用户画像
 	BatchGetUserProfiles(context.Context, *BatchGetUserProfilesRequest) (*BatchGetUserProfilesResponse, error)
+	// 导出全部用户画像（按用户ID顺序）
+	ExportProfiles(*ExportProfilesRequest, grpc.ServerStreamingServer[UserProfileRecord]) error
+	// 批量导入用户画像（已存在的用户会被覆盖）
+	ImportProfiles(grpc.ClientStreamingServer[UserProfileRecord, ImportProfilesResponse]) error
+	// 创建规则人群
+	CreateSegment(context.Context, *CreateSegmentRequest) (*SegmentInfo, error)
+	// 上传名单人群（首条消息为元数据，其后为文件内容分片）
+	UploadSegment(grpc.ClientStreamingServer[UploadSegmentRequest, UploadSegmentResponse]) error
+	// 列出全部人群
+	ListSegments(context.Context, *ListSegmentsRequest) (*ListSegmentsResponse, error)
+	// 删除人群
+	DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error)
+	// 查询用户所属人群
+	GetUserSegments(context.Context, *GetUserSegmentsRequest) (*GetUserSegmentsResponse, error)
+	// 记录同时出现的一组用户标识（跨设备身份关联）
+	ObserveIdentifiers(context.Context, *ObserveIdentifiersRequest) (*ObserveIdentifiersResponse, error)
+	// 查询标识所属的身份簇
+	ResolveIdentity(context.Context, *ResolveIdentityRequest) (*ResolveIdentityResponse, error)
+	// 删除用户（含同一身份簇的全部标识）在各数据源中的数据，返回执行报告并记录审计
+	DeleteUser(context.Context, *DeleteUserRequest) (*DataSubjectReport, error)
+	// 导出用户（含同一身份簇的全部标识）的数据，并记录审计
+	ExportUser(context.Context, *ExportUserRequest) (*ExportUserResponse, error)
 	mustEmbedUnimplementedUserServiceServer()
 }
 
@@ -104,9 +302,45 @@ func (UnimplementedUserServiceServer) GetUserProfile(context.Context, *GetUserPr
 func (UnimplementedUserServiceServer) UpdateUserBehavior(context.Context, *UpdateUserBehaviorRequest) (*UpdateUserBehaviorResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method UpdateUserBehavior not implemented")
 }
+func (UnimplementedUserServiceServer) IngestBehaviors(grpc.ClientStreamingServer[BehaviorBatch, IngestBehaviorsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method IngestBehaviors not implemented")
+}
 func (UnimplementedUserServiceServer) BatchGetUserProfiles(context.Context, *BatchGetUserProfilesRequest) (*BatchGetUserProfilesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method BatchGetUserProfiles not implemented")
 }
+func (UnimplementedUserServiceServer) ExportProfiles(*ExportProfilesRequest, grpc.ServerStreamingServer[UserProfileRecord]) error {
+	return status.Errorf(codes.Unimplemented, "method ExportProfiles not implemented")
+}
+func (UnimplementedUserServiceServer) ImportProfiles(grpc.ClientStreamingServer[UserProfileRecord, ImportProfilesResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ImportProfiles not implemented")
+}
+func (UnimplementedUserServiceServer) CreateSegment(context.Context, *CreateSegmentRequest) (*SegmentInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSegment not implemented")
+}
+func (UnimplementedUserServiceServer) UploadSegment(grpc.ClientStreamingServer[UploadSegmentRequest, UploadSegmentResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method UploadSegment not implemented")
+}
+func (UnimplementedUserServiceServer) ListSegments(context.Context, *ListSegmentsRequest) (*ListSegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSegments not implemented")
+}
+func (UnimplementedUserServiceServer) DeleteSegment(context.Context, *DeleteSegmentRequest) (*DeleteSegmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSegment not implemented")
+}
+func (UnimplementedUserServiceServer) GetUserSegments(context.Context, *GetUserSegmentsRequest) (*GetUserSegmentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUserSegments not implemented")
+}
+func (UnimplementedUserServiceServer) ObserveIdentifiers(context.Context, *ObserveIdentifiersRequest) (*ObserveIdentifiersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ObserveIdentifiers not implemented")
+}
+func (UnimplementedUserServiceServer) ResolveIdentity(context.Context, *ResolveIdentityRequest) (*ResolveIdentityResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveIdentity not implemented")
+}
+func (UnimplementedUserServiceServer) DeleteUser(context.Context, *DeleteUserRequest) (*DataSubjectReport, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedUserServiceServer) ExportUser(context.Context, *ExportUserRequest) (*ExportUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExportUser not implemented")
+}
 func (UnimplementedUserServiceServer) mustEmbedUnimplementedUserServiceServer() {}
 func (UnimplementedUserServiceServer) testEmbeddedByValue()                     {}
 
@@ -164,6 +398,13 @@ func _UserService_UpdateUserBehavior_Handler(srv interface{}, ctx context.Contex
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_IngestBehaviors_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UserServiceServer).IngestBehaviors(&grpc.GenericServerStream[BehaviorBatch, IngestBehaviorsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_IngestBehaviorsServer = grpc.ClientStreamingServer[BehaviorBatch, IngestBehaviorsResponse]
+
 func _UserService_BatchGetUserProfiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(BatchGetUserProfilesRequest)
 	if err := dec(in); err != nil {
@@ -182,6 +423,175 @@ func _UserService_BatchGetUserProfiles_Handler(srv interface{}, ctx context.Cont
 	return interceptor(ctx, in, info, handler)
 }
 
+func _UserService_ExportProfiles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportProfilesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(UserServiceServer).ExportProfiles(m, &grpc.GenericServerStream[ExportProfilesRequest, UserProfileRecord]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ExportProfilesServer = grpc.ServerStreamingServer[UserProfileRecord]
+
+func _UserService_ImportProfiles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UserServiceServer).ImportProfiles(&grpc.GenericServerStream[UserProfileRecord, ImportProfilesResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_ImportProfilesServer = grpc.ClientStreamingServer[UserProfileRecord, ImportProfilesResponse]
+
+func _UserService_CreateSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).CreateSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_CreateSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).CreateSegment(ctx, req.(*CreateSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_UploadSegment_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UserServiceServer).UploadSegment(&grpc.GenericServerStream[UploadSegmentRequest, UploadSegmentResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UserService_UploadSegmentServer = grpc.ClientStreamingServer[UploadSegmentRequest, UploadSegmentResponse]
+
+func _UserService_ListSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ListSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ListSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ListSegments(ctx, req.(*ListSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_DeleteSegment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSegmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).DeleteSegment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_DeleteSegment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).DeleteSegment(ctx, req.(*DeleteSegmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_GetUserSegments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserSegmentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).GetUserSegments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_GetUserSegments_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).GetUserSegments(ctx, req.(*GetUserSegmentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ObserveIdentifiers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ObserveIdentifiersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ObserveIdentifiers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ObserveIdentifiers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ObserveIdentifiers(ctx, req.(*ObserveIdentifiersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ResolveIdentity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveIdentityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ResolveIdentity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ResolveIdentity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ResolveIdentity(ctx, req.(*ResolveIdentityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_DeleteUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).DeleteUser(ctx, req.(*DeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _UserService_ExportUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExportUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(UserServiceServer).ExportUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: UserService_ExportUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(UserServiceServer).ExportUser(ctx, req.(*ExportUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // UserService_ServiceDesc is the grpc.ServiceDesc for UserService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -201,7 +611,60 @@ var UserService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "BatchGetUserProfiles",
 			Handler:    _UserService_BatchGetUserProfiles_Handler,
 		},
+		{
+			MethodName: "CreateSegment",
+			Handler:    _UserService_CreateSegment_Handler,
+		},
+		{
+			MethodName: "ListSegments",
+			Handler:    _UserService_ListSegments_Handler,
+		},
+		{
+			MethodName: "DeleteSegment",
+			Handler:    _UserService_DeleteSegment_Handler,
+		},
+		{
+			MethodName: "GetUserSegments",
+			Handler:    _UserService_GetUserSegments_Handler,
+		},
+		{
+			MethodName: "ObserveIdentifiers",
+			Handler:    _UserService_ObserveIdentifiers_Handler,
+		},
+		{
+			MethodName: "ResolveIdentity",
+			Handler:    _UserService_ResolveIdentity_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _UserService_DeleteUser_Handler,
+		},
+		{
+			MethodName: "ExportUser",
+			Handler:    _UserService_ExportUser_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "IngestBehaviors",
+			Handler:       _UserService_IngestBehaviors_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ExportProfiles",
+			Handler:       _UserService_ExportProfiles_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportProfiles",
+			Handler:       _UserService_ImportProfiles_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "UploadSegment",
+			Handler:       _UserService_UploadSegment_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/user.proto",
 }
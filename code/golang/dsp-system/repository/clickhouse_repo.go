@@ -4,6 +4,8 @@ import (
 	"context"
 	"dsp-system/api"
 	"dsp-system/config"
+	"dsp-system/money"
+	"dsp-system/privacy"
 	"log"
 	"time"
 )
@@ -55,19 +57,34 @@ type BidLog struct {
 	UserID         string
 	DeviceType     string
 	OS             string
+	OSVersion      string
+	Make           string
+	Model          string
+	Browser        string
+	Bot            bool // UA识别为爬虫或自动化工具
 	IP             string
 	Country        string
 	City           string
 	AdID           string
 	CampaignID     string
 	CreativeID     string
-	BidPrice       float64
+	BidPrice       money.Micros
 	BidStatus      string // "bid", "win", "lose"
 	ProcessingTime int64  // 处理时间(毫秒)
 }
 
 // LogBidRequest 记录竞价日志
-func (r *ClickHouseRepo) LogBidRequest(ctx context.Context, req *api.BidRequest, bids []api.Bid, duration time.Duration) error {
+// personalData为false（未获得使用个人数据的同意）时，IP截断、用户ID哈希后再记录
+func (r *ClickHouseRepo) LogBidRequest(ctx context.Context, req *api.BidRequest, bids []api.Bid, duration time.Duration, personalData bool) error {
+	userID, ip := extractUserID(req), getIP(req)
+	if !personalData {
+		userID, ip = privacy.HashID(userID), privacy.TruncateIP(ip)
+	}
+	var device api.Device
+	if req.Device != nil {
+		device = *req.Device
+	}
+
 	// 实际项目中应该插入到ClickHouse
 	// INSERT INTO bid_logs (timestamp, request_id, ...) VALUES (?, ?, ...)
 
@@ -76,16 +93,21 @@ func (r *ClickHouseRepo) LogBidRequest(ctx context.Context, req *api.BidRequest,
 			Timestamp:      time.Now(),
 			RequestID:      req.ID,
 			ImpID:          bid.ImpID,
-			UserID:         extractUserID(req),
+			UserID:         userID,
 			DeviceType:     getDeviceType(req),
 			OS:             getOS(req),
-			IP:             getIP(req),
+			OSVersion:      device.OSV,
+			Make:           device.Make,
+			Model:          device.Model,
+			Browser:        device.Browser,
+			Bot:            device.Bot,
+			IP:             ip,
 			Country:        getCountry(req),
 			City:           getCity(req),
 			AdID:           bid.AdID,
 			CampaignID:     bid.CampaignID,
 			CreativeID:     bid.CreativeID,
-			BidPrice:       bid.Price,
+			BidPrice:       bid.PriceMicros(),
 			BidStatus:      "bid",
 			ProcessingTime: duration.Milliseconds(),
 		}
@@ -98,11 +120,11 @@ func (r *ClickHouseRepo) LogBidRequest(ctx context.Context, req *api.BidRequest,
 }
 
 // LogWin 记录赢标日志
-func (r *ClickHouseRepo) LogWin(ctx context.Context, requestID string, bidID string, winPrice float64) error {
+func (r *ClickHouseRepo) LogWin(ctx context.Context, requestID string, bidID string, winPrice money.Micros) error {
 	// 实际项目中应该更新ClickHouse记录
 	// UPDATE bid_logs SET bid_status='win', win_price=? WHERE request_id=? AND bid_id=?
 
-	log.Printf("WinLog: RequestID=%s, BidID=%s, WinPrice=%.2f", requestID, bidID, winPrice)
+	log.Printf("WinLog: RequestID=%s, BidID=%s, WinPrice=%s", requestID, bidID, winPrice)
 
 	return nil
 }
@@ -122,9 +144,23 @@ func (r *ClickHouseRepo) LogClick(ctx context.Context, requestID string, adID st
 }
 
 // LogConversion 记录转化日志
-func (r *ClickHouseRepo) LogConversion(ctx context.Context, requestID string, adID string, conversionValue float64) error {
+func (r *ClickHouseRepo) LogConversion(ctx context.Context, requestID string, adID string, conversionValue money.Micros) error {
 	// 实际项目中应该插入转化日志表
-	log.Printf("ConversionLog: RequestID=%s, AdID=%s, Value=%.2f", requestID, adID, conversionValue)
+	log.Printf("ConversionLog: RequestID=%s, AdID=%s, Value=%s", requestID, adID, conversionValue)
+	return nil
+}
+
+// DeleteUserLogs 删除用户的竞价日志，未获得同意时记录的是哈希后的ID，两种形式都删除
+func (r *ClickHouseRepo) DeleteUserLogs(ctx context.Context, userIDs []string) error {
+	ids := make([]string, 0, 2*len(userIDs))
+	for _, userID := range userIDs {
+		ids = append(ids, userID, privacy.HashID(userID))
+	}
+
+	// 实际项目中应该提交ClickHouse删除变更（异步执行，mutations表中可查询进度）
+	// ALTER TABLE bid_logs DELETE WHERE user_id IN (?)
+
+	log.Printf("DeleteUserLogs: Users=%d, IDs=%d", len(userIDs), len(ids))
 	return nil
 }
 
@@ -176,6 +212,10 @@ func getDeviceType(req *api.BidRequest) string {
 			return "Phone"
 		case 5:
 			return "Tablet"
+		case 6:
+			return "Connected Device"
+		case 7:
+			return "Set Top Box"
 		default:
 			return "Unknown"
 		}
@@ -192,7 +232,10 @@ func getOS(req *api.BidRequest) string {
 
 func getIP(req *api.BidRequest) string {
 	if req.Device != nil {
-		return req.Device.IP
+		if req.Device.IP != "" {
+			return req.Device.IP
+		}
+		return req.Device.IPv6
 	}
 	return ""
 }
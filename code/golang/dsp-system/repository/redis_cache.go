@@ -3,10 +3,18 @@ package repository
 import (
 	"context"
 	"dsp-system/config"
+	"dsp-system/frequency"
+	"dsp-system/money"
+	"dsp-system/rotation"
 	"dsp-system/rpc"
+	"dsp-system/shading"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -110,28 +118,468 @@ func (r *RedisCache) GetStats(ctx context.Context, date string) (bidCount int64,
 	return bidCount, winCount, nil
 }
 
-// SetFrequencyCap 设置频次控制
-func (r *RedisCache) SetFrequencyCap(ctx context.Context, userID string, adID string, expiration time.Duration) error {
-	key := fmt.Sprintf("freq_cap:%s:%s", userID, adID)
-	return r.client.Set(ctx, key, "1", expiration).Err()
+// frequencyKey 用户在一个对象上的曝光记录，有序集合，成员为曝光事件ID，分数为曝光时间（毫秒）
+func frequencyKey(userID string, scope frequency.Scope) string {
+	return fmt.Sprintf("freq_cap:%s:%s", userID, scope)
 }
 
-// CheckFrequencyCap 检查频次控制
-func (r *RedisCache) CheckFrequencyCap(ctx context.Context, userID string, adID string) bool {
-	key := fmt.Sprintf("freq_cap:%s:%s", userID, adID)
-	_, err := r.client.Get(ctx, key).Result()
-	return err == redis.Nil // 如果不存在，说明没有超过频次限制
+// CountImpressions 用一次流水线查询用户在各对象上自Since以来的曝光次数
+func (r *RedisCache) CountImpressions(ctx context.Context, userID string, queries []frequency.Query) ([]int64, error) {
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(queries))
+	for i, q := range queries {
+		cmds[i] = pipe.ZCount(ctx, frequencyKey(userID, q.Scope), strconv.FormatInt(q.Since.UnixMilli(), 10), "+inf")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	counts := make([]int64, len(cmds))
+	for i, cmd := range cmds {
+		counts[i] = cmd.Val()
+	}
+	return counts, nil
+}
+
+// RecordImpression 在各对象的曝光记录中加入一次曝光，同时清理超过保留时间的记录
+// eventID为空时按曝光时间生成，不去重
+func (r *RedisCache) RecordImpression(ctx context.Context, userID, eventID string, at time.Time, retention map[frequency.Scope]time.Duration) error {
+	if eventID == "" {
+		eventID = strconv.FormatInt(at.UnixNano(), 10)
+	}
+
+	pipe := r.client.TxPipeline()
+	for scope, keep := range retention {
+		key := frequencyKey(userID, scope)
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(at.UnixMilli()), Member: eventID})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(at.Add(-keep).UnixMilli(), 10))
+		pipe.PExpire(ctx, key, keep)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// sequenceKey 用户在投放单元中下一个应看的创意序号，与频次记录同一前缀，随用户数据一起导出和删除
+func sequenceKey(userID, lineItemID string) string {
+	return fmt.Sprintf("freq_cap:%s:sequence:%s", userID, lineItemID)
+}
+
+// rotationStatsKey 投放单元中各创意的曝光和点击次数，哈希，字段为<创意ID>:imp和<创意ID>:click
+func rotationStatsKey(lineItemID string) string {
+	return fmt.Sprintf("rotation_stats:%s", lineItemID)
+}
+
+// LoadRotation 用一次流水线读取用户的顺序播放进度和投放单元的创意统计
+func (r *RedisCache) LoadRotation(ctx context.Context, userID string, sequential, optimized []string) (*rotation.State, error) {
+	pipe := r.client.Pipeline()
+	positions := make([]*redis.StringCmd, len(sequential))
+	for i, lineItemID := range sequential {
+		positions[i] = pipe.Get(ctx, sequenceKey(userID, lineItemID))
+	}
+	stats := make([]*redis.MapStringStringCmd, len(optimized))
+	for i, lineItemID := range optimized {
+		stats[i] = pipe.HGetAll(ctx, rotationStatsKey(lineItemID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	state := &rotation.State{
+		Positions: make(map[string]int, len(sequential)),
+		Stats:     make(map[string]map[string]rotation.Stats, len(optimized)),
+	}
+	for i, cmd := range positions {
+		if position, err := cmd.Int(); err == nil {
+			state.Positions[sequential[i]] = position
+		}
+	}
+	for i, cmd := range stats {
+		creatives := make(map[string]rotation.Stats)
+		for field, val := range cmd.Val() {
+			creativeID, kind, ok := cutLast(field, ":")
+			count, err := strconv.ParseInt(val, 10, 64)
+			if !ok || err != nil {
+				continue
+			}
+			s := creatives[creativeID]
+			switch kind {
+			case "imp":
+				s.Impressions = count
+			case "click":
+				s.Clicks = count
+			}
+			creatives[creativeID] = s
+		}
+		state.Stats[optimized[i]] = creatives
+	}
+	return state, nil
+}
+
+// cutLast 按最后一个sep切分，创意ID中可能含有sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// SetSequence 记录用户在投放单元中下一个应看的创意序号，保留rotation.SequenceRetention
+func (r *RedisCache) SetSequence(ctx context.Context, userID, lineItemID string, next int) error {
+	return r.client.Set(ctx, sequenceKey(userID, lineItemID), next, rotation.SequenceRetention).Err()
+}
+
+// IncrRotationStats 累加创意在投放单元中的曝光和点击次数
+func (r *RedisCache) IncrRotationStats(ctx context.Context, lineItemID, creativeID string, impressions, clicks int64) error {
+	key := rotationStatsKey(lineItemID)
+	pipe := r.client.Pipeline()
+	if impressions != 0 {
+		pipe.HIncrBy(ctx, key, creativeID+":imp", impressions)
+	}
+	if clicks != 0 {
+		pipe.HIncrBy(ctx, key, creativeID+":click", clicks)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// CacheBudget 缓存预算信息
-func (r *RedisCache) CacheBudget(ctx context.Context, campaignID string, remaining float64, expiration time.Duration) error {
-	key := fmt.Sprintf("budget:%s", campaignID)
-	return r.client.Set(ctx, key, remaining, expiration).Err()
+// shadingKey 某天某维度的出价和赢标次数，哈希，字段为<出价桶>:bid和<出价桶>:win
+func shadingKey(day string, key shading.Key) string {
+	return fmt.Sprintf("shading:%s:%s", day, key)
+}
+
+// shadingKeysKey 某天出现过的维度集合，读取时不用扫描键空间
+func shadingKeysKey(day string) string {
+	return fmt.Sprintf("shading_keys:%s", day)
+}
+
+// IncrShading 累加某天某维度某出价桶的出价和赢标次数，保留shading.Retention
+func (r *RedisCache) IncrShading(ctx context.Context, day string, key shading.Key, bucket int, bids, wins int64) error {
+	hashKey := shadingKey(day, key)
+	keysKey := shadingKeysKey(day)
+	field := strconv.Itoa(bucket)
+	pipe := r.client.Pipeline()
+	if bids != 0 {
+		pipe.HIncrBy(ctx, hashKey, field+":bid", bids)
+	}
+	if wins != 0 {
+		pipe.HIncrBy(ctx, hashKey, field+":win", wins)
+	}
+	pipe.Expire(ctx, hashKey, shading.Retention)
+	pipe.SAdd(ctx, keysKey, key.String())
+	pipe.Expire(ctx, keysKey, shading.Retention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// winKey 已扣减预算的竞价ID，用于赢标通知去重
+func winKey(bidID string) string {
+	return fmt.Sprintf("win:%s", bidID)
+}
+
+// ClaimWin 登记竞价ID，SETNX保证多个实例中只有一个登记成功
+func (r *RedisCache) ClaimWin(ctx context.Context, bidID string, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, winKey(bidID), time.Now().UnixMilli(), ttl).Result()
+}
+
+// ReleaseWin 删除竞价ID的登记
+func (r *RedisCache) ReleaseWin(ctx context.Context, bidID string) error {
+	return r.client.Del(ctx, winKey(bidID)).Err()
+}
+
+// shadingWinKey 已记录赢标的竞价ID，用于去重
+func shadingWinKey(bidID string) string {
+	return fmt.Sprintf("shading_win:%s", bidID)
+}
+
+// recordShadingWinScript 在第一个该出价桶有出价记录的那天记录赢标，竞价ID已记录过时不计入
+// KEYS[1]为去重键，KEYS[2..]为各天的哈希；ARGV为出价字段、赢标字段、保留毫秒数
+var recordShadingWinScript = redis.NewScript(`
+for i = 2, #KEYS do
+	if tonumber(redis.call('HGET', KEYS[i], ARGV[1]) or '0') > 0 then
+		if not redis.call('SET', KEYS[1], '1', 'NX', 'PX', ARGV[3]) then
+			return 0
+		end
+		redis.call('HINCRBY', KEYS[i], ARGV[2], 1)
+		return 1
+	end
+end
+return 0
+`)
+
+// RecordShadingWin 按竞价ID去重记录一次赢标，出价桶在各天都没有出价记录时不计入
+func (r *RedisCache) RecordShadingWin(ctx context.Context, days []string, key shading.Key, bucket int, bidID string) (bool, error) {
+	keys := []string{shadingWinKey(bidID)}
+	for _, day := range days {
+		keys = append(keys, shadingKey(day, key))
+	}
+	field := strconv.Itoa(bucket)
+	recorded, err := recordShadingWinScript.Run(ctx, r.client, keys, field+":bid", field+":win", shading.Retention.Milliseconds()).Int()
+	return recorded == 1, err
+}
+
+// LoadShading 读取若干天的出价和赢标次数，同一维度各天的记录合并
+func (r *RedisCache) LoadShading(ctx context.Context, days []string) (map[shading.Key]shading.Histogram, error) {
+	pipe := r.client.Pipeline()
+	members := make([]*redis.StringSliceCmd, len(days))
+	for i, day := range days {
+		members[i] = pipe.SMembers(ctx, shadingKeysKey(day))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	type entry struct {
+		key shading.Key
+		cmd *redis.MapStringStringCmd
+	}
+	var entries []entry
+	pipe = r.client.Pipeline()
+	for i, day := range days {
+		for _, member := range members[i].Val() {
+			key, err := shading.ParseKey(member)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, entry{key: key, cmd: pipe.HGetAll(ctx, shadingKey(day, key))})
+		}
+	}
+	if len(entries) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[shading.Key]shading.Histogram)
+	for _, e := range entries {
+		h := result[e.key]
+		if h == nil {
+			h = make(shading.Histogram)
+			result[e.key] = h
+		}
+		for field, val := range e.cmd.Val() {
+			bucketField, kind, ok := cutLast(field, ":")
+			bucket, err := strconv.Atoi(bucketField)
+			count, countErr := strconv.ParseInt(val, 10, 64)
+			if !ok || err != nil || countErr != nil {
+				continue
+			}
+			c := h[bucket]
+			switch kind {
+			case "bid":
+				c.Bids += count
+			case "win":
+				c.Wins += count
+			}
+			h[bucket] = c
+		}
+	}
+	return result, nil
+}
+
+// SetUserSync 保存交易平台用户ID到本方用户ID的映射
+// 同时在user_sync_ids:<dspUID>中记录映射键，用于按本方用户ID导出和删除映射
+func (r *RedisCache) SetUserSync(ctx context.Context, exchange string, exchangeUID string, dspUID string, expiration time.Duration) error {
+	key := fmt.Sprintf("user_sync:%s:%s", exchange, exchangeUID)
+	indexKey := fmt.Sprintf("user_sync_ids:%s", dspUID)
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, key, dspUID, expiration)
+	pipe.SAdd(ctx, indexKey, key)
+	pipe.Expire(ctx, indexKey, expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetUserSync 查询交易平台用户ID对应的本方用户ID，不存在时返回空字符串
+func (r *RedisCache) GetUserSync(ctx context.Context, exchange string, exchangeUID string) (string, error) {
+	key := fmt.Sprintf("user_sync:%s:%s", exchange, exchangeUID)
+	dspUID, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return dspUID, err
+}
+
+// ListUserSyncs 列出映射到本方用户ID的交易平台用户ID（"<exchange>:<exchangeUID>"），
+// 已过期或已改为映射到其他用户的条目不返回
+func (r *RedisCache) ListUserSyncs(ctx context.Context, dspUID string) ([]string, error) {
+	keys, err := r.client.SMembers(ctx, fmt.Sprintf("user_sync_ids:%s", dspUID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []string
+	for _, key := range keys {
+		val, err := r.client.Get(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if val == dspUID {
+			mappings = append(mappings, strings.TrimPrefix(key, "user_sync:"))
+		}
+	}
+	sort.Strings(mappings)
+	return mappings, nil
+}
+
+// DeleteUserSyncs 删除映射到本方用户ID的全部交易平台用户ID映射，返回删除条数
+func (r *RedisCache) DeleteUserSyncs(ctx context.Context, dspUID string) (int, error) {
+	mappings, err := r.ListUserSyncs(ctx, dspUID)
+	if err != nil {
+		return 0, err
+	}
+
+	keys := []string{fmt.Sprintf("user_sync_ids:%s", dspUID)}
+	for _, mapping := range mappings {
+		keys = append(keys, "user_sync:"+mapping)
+	}
+	if err := r.client.Del(ctx, keys...).Err(); err != nil {
+		return 0, err
+	}
+	return len(mappings), nil
+}
+
+// DeleteUserProfiles 删除用户画像缓存，返回删除条数
+func (r *RedisCache) DeleteUserProfiles(ctx context.Context, userIDs []string) (int, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		keys = append(keys, fmt.Sprintf("user_profile:%s", userID))
+	}
+	deleted, err := r.client.Del(ctx, keys...).Result()
+	return int(deleted), err
+}
+
+// ListFrequencyCaps 列出用户有曝光记录的频次控制对象（级别:ID），包括创意顺序播放的进度（sequence:投放单元ID）
+func (r *RedisCache) ListFrequencyCaps(ctx context.Context, userID string) ([]string, error) {
+	keys, err := r.scanKeys(ctx, fmt.Sprintf("freq_cap:%s:*", escapePattern(userID)))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("freq_cap:%s:", userID)
+	scopes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		scopes = append(scopes, strings.TrimPrefix(key, prefix))
+	}
+	sort.Strings(scopes)
+	return scopes, nil
+}
+
+// DeleteFrequencyCaps 删除用户的全部频次控制记录，返回删除条数
+func (r *RedisCache) DeleteFrequencyCaps(ctx context.Context, userID string) (int, error) {
+	keys, err := r.scanKeys(ctx, fmt.Sprintf("freq_cap:%s:*", escapePattern(userID)))
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	deleted, err := r.client.Del(ctx, keys...).Result()
+	return int(deleted), err
+}
+
+// scanKeys 按模式遍历键
+func (r *RedisCache) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	iter := r.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// escapePattern 转义SCAN模式中的通配符，避免用户ID中的*、?等匹配到其他用户
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// CacheBudget 缓存预算信息（整数微单位）
+func (r *RedisCache) CacheBudget(ctx context.Context, campaignID string, remaining money.Micros, expiration time.Duration) error {
+	key := fmt.Sprintf("budget_micros:%s", campaignID)
+	return r.client.Set(ctx, key, int64(remaining), expiration).Err()
 }
 
 // GetCachedBudget 获取缓存的预算信息
-func (r *RedisCache) GetCachedBudget(ctx context.Context, campaignID string) (float64, error) {
-	key := fmt.Sprintf("budget:%s", campaignID)
-	return r.client.Get(ctx, key).Float64()
+// 新键不存在时回退读取旧的浮点格式键（budget:<campaignID>），并就地迁移为微单位
+func (r *RedisCache) GetCachedBudget(ctx context.Context, campaignID string) (money.Micros, error) {
+	key := fmt.Sprintf("budget_micros:%s", campaignID)
+	remaining, err := r.client.Get(ctx, key).Int64()
+	if err == nil {
+		return money.Micros(remaining), nil
+	}
+	if err != redis.Nil {
+		return 0, err
+	}
+
+	return r.migrateLegacyBudget(ctx, campaignID)
+}
+
+// MigrateLegacyBudgets 批量迁移旧的浮点格式预算缓存，返回迁移条数
+// 单个键迁移失败时记录日志并保留旧键，继续迁移其余的键，最后返回所有失败的错误
+func (r *RedisCache) MigrateLegacyBudgets(ctx context.Context) (int, error) {
+	migrated := 0
+	var errs []error
+	iter := r.client.Scan(ctx, 0, "budget:*", 100).Iterator()
+	for iter.Next(ctx) {
+		campaignID := strings.TrimPrefix(iter.Val(), "budget:")
+		if _, err := r.migrateLegacyBudget(ctx, campaignID); err != nil {
+			if err == redis.Nil {
+				continue // 已被并发迁移
+			}
+			log.Printf("跳过无法迁移的旧预算缓存: CampaignID=%s, %v", campaignID, err)
+			errs = append(errs, err)
+			continue
+		}
+		migrated++
+	}
+	if err := iter.Err(); err != nil {
+		errs = append(errs, err)
+	}
+
+	log.Printf("旧预算缓存迁移完成: Count=%d, Failed=%d", migrated, len(errs))
+	if len(errs) > 0 {
+		return migrated, fmt.Errorf("%d条旧预算缓存迁移失败: %w", len(errs), errors.Join(errs...))
+	}
+	return migrated, nil
+}
+
+// migrateLegacyBudget 将旧的浮点格式预算缓存转换为微单位，保留原有过期时间
+func (r *RedisCache) migrateLegacyBudget(ctx context.Context, campaignID string) (money.Micros, error) {
+	legacyKey := fmt.Sprintf("budget:%s", campaignID)
+	val, err := r.client.Get(ctx, legacyKey).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	// 按十进制字符串精确解析，避免再次经过浮点数
+	remaining, err := money.ParseDecimal(val)
+	if err != nil {
+		return 0, fmt.Errorf("解析旧预算缓存失败: key=%s, %v", legacyKey, err)
+	}
+
+	ttl := r.client.TTL(ctx, legacyKey).Val()
+	if ttl < 0 {
+		ttl = 0 // 无过期时间
+	}
+
+	pipe := r.client.TxPipeline()
+	pipe.Set(ctx, fmt.Sprintf("budget_micros:%s", campaignID), int64(remaining), ttl)
+	pipe.Del(ctx, legacyKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("迁移旧预算缓存失败: key=%s, %v", legacyKey, err)
+	}
+
+	log.Printf("迁移旧预算缓存: CampaignID=%s, Remaining=%s", campaignID, remaining)
+	return remaining, nil
 }
 
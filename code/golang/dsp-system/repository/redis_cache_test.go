@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"dsp-system/config"
+	"dsp-system/money"
+	"dsp-system/rotation"
+	"dsp-system/shading"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestMigrateLegacyBudgets(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	ctx := context.Background()
+
+	mr.Set("budget:c1", "8500.25")
+	mr.SetTTL("budget:c1", time.Hour)
+	mr.Set("budget:c2", "12")
+	mr.Set("budget:c3", "-") // 无法解析的旧值
+	mr.Set("budget:c4", "0.5")
+
+	// 无法解析的键返回错误并保留旧键，不影响其余键的迁移
+	migrated, err := cache.MigrateLegacyBudgets(ctx)
+	if err == nil || !strings.Contains(err.Error(), "budget:c3") {
+		t.Errorf("旧值无法解析时应返回包含该键的错误，实际为%v", err)
+	}
+	if migrated != 3 {
+		t.Errorf("应迁移3条，实际为%d条", migrated)
+	}
+	if !mr.Exists("budget:c3") {
+		t.Error("迁移失败时不应删除旧键")
+	}
+
+	for key, want := range map[string]money.Micros{"c1": 8_500_250_000, "c2": 12_000_000, "c4": 500_000} {
+		if mr.Exists("budget:" + key) {
+			t.Errorf("迁移后应删除旧键budget:%s", key)
+		}
+		got, err := cache.GetCachedBudget(ctx, key)
+		if err != nil || got != want {
+			t.Errorf("活动%s的预算应为%s，实际为%s, %v", key, want, got, err)
+		}
+	}
+	if ttl := mr.TTL("budget_micros:c1"); ttl != time.Hour {
+		t.Errorf("迁移后应保留过期时间1h，实际为%s", ttl)
+	}
+	if ttl := mr.TTL("budget_micros:c2"); ttl != 0 {
+		t.Errorf("旧键没有过期时间时新键也不应过期，实际为%s", ttl)
+	}
+}
+
+func TestRecordShadingWin(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	shader := shading.NewShader(cache, shading.Config{})
+	defer shader.Close()
+	ctx := context.Background()
+
+	key := shading.Key{Exchange: "adx", Publisher: "pub1", Size: "300x250"}
+	bid := money.FromFloat(5)
+	bidAt := time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC)
+	if err := shader.RecordBid(ctx, key, bid, bidAt); err != nil {
+		t.Fatal(err)
+	}
+
+	// 赢标通知在第二天到达，计入出价那天
+	winAt := bidAt.Add(2 * time.Minute)
+	if recorded, err := shader.RecordWin(ctx, key, "b1", bid, winAt); err != nil || !recorded {
+		t.Fatalf("第一次赢标通知应计入: %v", err)
+	}
+	if recorded, _ := shader.RecordWin(ctx, key, "b1", bid, winAt); recorded {
+		t.Error("同一竞价的重复赢标通知不应计入")
+	}
+	if recorded, _ := shader.RecordWin(ctx, key, "b2", money.FromFloat(50), winAt); recorded {
+		t.Error("出价桶没有出价记录时不应计入")
+	}
+	if ttl := mr.TTL("shading_win:b1"); ttl != shading.Retention {
+		t.Errorf("去重记录应保留%s，实际为%s", shading.Retention, ttl)
+	}
+
+	histograms, err := cache.LoadShading(ctx, []string{"20261018", "20261019"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := histograms[key][shading.Bucket(bid)]; c.Bids != 1 || c.Wins != 1 {
+		t.Errorf("应有1次出价1次赢标，实际为%+v", c)
+	}
+	if len(histograms[key]) != 1 {
+		t.Errorf("没有出价记录的赢标不应产生新的出价桶: %+v", histograms[key])
+	}
+}
+
+func TestRotationRoundTrip(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	ctx := context.Background()
+
+	// 创意ID中可以含有:
+	cache.IncrRotationStats(ctx, "li1", "cr:1", 3, 0)
+	cache.IncrRotationStats(ctx, "li1", "cr:1", 2, 1)
+	cache.IncrRotationStats(ctx, "li1", "cr2", 0, 1)
+	cache.SetSequence(ctx, "u1", "li2", 2)
+
+	state, err := cache.LoadRotation(ctx, "u1", []string{"li2", "li3"}, []string{"li1", "li4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]rotation.Stats{"cr:1": {Impressions: 5, Clicks: 1}, "cr2": {Clicks: 1}}
+	if !maps.Equal(state.Stats["li1"], want) {
+		t.Errorf("创意统计应为%+v，实际为%+v", want, state.Stats["li1"])
+	}
+	if len(state.Stats["li4"]) != 0 {
+		t.Errorf("没有记录的投放单元统计应为空: %+v", state.Stats["li4"])
+	}
+	if position, ok := state.Positions["li2"]; !ok || position != 2 {
+		t.Errorf("顺序播放进度应为2，实际为%d", position)
+	}
+	if _, ok := state.Positions["li3"]; ok {
+		t.Error("没有记录的投放单元不应有顺序播放进度")
+	}
+}
@@ -0,0 +1,74 @@
+// Package rotation 投放单元有多个创意时的创意轮播
+// 支持按权重随机、按用户顺序播放（故事化创意）和按点击率优化（带探索）三种方式
+package rotation
+
+import (
+	"fmt"
+	"slices"
+)
+
+// 轮播方式
+const (
+	ModeWeighted   = "weighted"   // 按权重随机，无状态
+	ModeSequential = "sequential" // 每个人按创意顺序依次观看，状态按人记录
+	ModeOptimized  = "optimized"  // 按点击率选择，部分流量随机探索，统计全局记录
+)
+
+// DefaultExploration 点击率优化时随机探索的流量比例
+const DefaultExploration = 0.1
+
+// Policy 一个投放单元编译后的轮播方式
+type Policy struct {
+	LineItemID  string
+	Mode        string
+	Creatives   []string  // 按投放单元中的顺序，顺序播放时即播放顺序
+	Weights     []float64 // 与Creatives对应
+	Exploration float64
+}
+
+// NewPolicy 创建轮播方式，mode为空时按权重随机；weights中没有的创意权重为1
+// exploration为nil（未设置）时使用DefaultExploration，设置为0时不探索
+func NewPolicy(lineItemID, mode string, creatives []string, weights map[string]float64, exploration *float64) (*Policy, error) {
+	p := &Policy{
+		LineItemID:  lineItemID,
+		Mode:        mode,
+		Creatives:   slices.Clone(creatives),
+		Weights:     make([]float64, len(creatives)),
+		Exploration: DefaultExploration,
+	}
+	if exploration != nil {
+		p.Exploration = *exploration
+	}
+	switch p.Mode {
+	case "":
+		p.Mode = ModeWeighted
+	case ModeWeighted, ModeSequential, ModeOptimized:
+	default:
+		return nil, fmt.Errorf("轮播方式无效: %s", mode)
+	}
+
+	for creativeID, weight := range weights {
+		if !slices.Contains(creatives, creativeID) {
+			return nil, fmt.Errorf("权重中的创意不属于投放单元: %s", creativeID)
+		}
+		if weight <= 0 {
+			return nil, fmt.Errorf("创意%s的权重应大于0: %v", creativeID, weight)
+		}
+	}
+	for i, creativeID := range creatives {
+		p.Weights[i] = 1
+		if weight, ok := weights[creativeID]; ok {
+			p.Weights[i] = weight
+		}
+	}
+
+	if p.Exploration < 0 || p.Exploration > 1 {
+		return nil, fmt.Errorf("探索比例应在0到1之间: %v", p.Exploration)
+	}
+	return p, nil
+}
+
+// index 创意在投放单元中的位置，不存在时返回-1
+func (p *Policy) index(creativeID string) int {
+	return slices.Index(p.Creatives, creativeID)
+}
@@ -0,0 +1,196 @@
+package rotation
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// 点击率的先验：相当于每个创意已有priorImpressions次曝光、priorClicks次点击，
+// 曝光少的新创意估计值偏高，会先获得一些流量
+const (
+	priorImpressions = 100
+	priorClicks      = 1
+)
+
+// SequenceRetention 顺序播放进度的保留时间，用户超过这个时间没有曝光时从第一个创意重新开始
+const SequenceRetention = 30 * 24 * time.Hour
+
+// Stats 创意在投放单元中的全局曝光和点击次数
+type Stats struct {
+	Impressions int64
+	Clicks      int64
+}
+
+// State 一次选择需要的轮播状态
+type State struct {
+	// Positions 投放单元ID -> 用户下一个应看的创意序号（sequential）
+	Positions map[string]int
+	// Stats 投放单元ID -> 创意ID -> 统计（optimized）
+	Stats map[string]map[string]Stats
+}
+
+// Store 轮播状态的存储：顺序播放的位置按人记录，点击率统计全局记录
+type Store interface {
+	// LoadRotation 一次往返读取用户在sequential投放单元中的位置和optimized投放单元的创意统计
+	// userID为空时不读取位置
+	LoadRotation(ctx context.Context, userID string, sequential, optimized []string) (*State, error)
+	// SetSequence 记录用户在投放单元中下一个应看的创意序号
+	SetSequence(ctx context.Context, userID, lineItemID string, next int) error
+	// IncrRotationStats 累加创意在投放单元中的曝光和点击次数
+	IncrRotationStats(ctx context.Context, lineItemID, creativeID string, impressions, clicks int64) error
+}
+
+// Group 同一广告位上同一投放单元的候选创意
+type Group struct {
+	Policy    *Policy  // nil时总是选第一个创意
+	Creatives []string // 可投放的创意ID，属于Policy.Creatives
+}
+
+// Rotator 按投放单元的轮播方式选择创意
+type Rotator struct {
+	store Store
+	rand  func() float64 // [0,1)的随机数
+}
+
+// NewRotator 创建轮播器，store为nil时只按权重随机：顺序播放总是从第一个创意开始，点击率优化没有统计
+func NewRotator(store Store) *Rotator {
+	return &Rotator{store: store, rand: rand.Float64}
+}
+
+// Select 为每组选择一个创意，返回其在Group.Creatives中的下标
+// 需要的状态一次读取；读取失败时记录日志，按没有状态选择
+func (r *Rotator) Select(ctx context.Context, userID string, groups []Group) []int {
+	state := r.load(ctx, userID, groups)
+	chosen := make([]int, len(groups))
+	for i, g := range groups {
+		switch {
+		case len(g.Creatives) <= 1 || g.Policy == nil:
+		case g.Policy.Mode == ModeSequential:
+			chosen[i] = sequential(g, state.Positions[g.Policy.LineItemID])
+		case g.Policy.Mode == ModeOptimized:
+			chosen[i] = r.optimized(g, state.Stats[g.Policy.LineItemID])
+		default:
+			chosen[i] = r.weighted(g)
+		}
+	}
+	return chosen
+}
+
+// load 读取各组需要的状态，同一投放单元只读一次
+func (r *Rotator) load(ctx context.Context, userID string, groups []Group) *State {
+	var sequential, optimized []string
+	for _, g := range groups {
+		if len(g.Creatives) <= 1 || g.Policy == nil {
+			continue
+		}
+		id := g.Policy.LineItemID
+		switch g.Policy.Mode {
+		case ModeSequential:
+			if userID != "" && !slices.Contains(sequential, id) {
+				sequential = append(sequential, id)
+			}
+		case ModeOptimized:
+			if !slices.Contains(optimized, id) {
+				optimized = append(optimized, id)
+			}
+		}
+	}
+	if r.store == nil || (len(sequential) == 0 && len(optimized) == 0) {
+		return &State{}
+	}
+	state, err := r.store.LoadRotation(ctx, userID, sequential, optimized)
+	if err != nil {
+		log.Printf("读取创意轮播状态失败: %v", err)
+		return &State{}
+	}
+	return state
+}
+
+// weighted 按权重随机选择
+func (r *Rotator) weighted(g Group) int {
+	weights := make([]float64, len(g.Creatives))
+	total := 0.0
+	for i, creativeID := range g.Creatives {
+		if j := g.Policy.index(creativeID); j >= 0 {
+			weights[i] = g.Policy.Weights[j]
+		}
+		total += weights[i]
+	}
+	x := r.rand() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(weights) - 1
+}
+
+// sequential 从用户的位置开始按顺序找第一个可投放的创意，
+// 位置上的创意在这个广告位不能投放（如尺寸不符）时顺延
+func sequential(g Group, position int) int {
+	n := len(g.Policy.Creatives)
+	position = (position%n + n) % n
+	for k := range n {
+		creativeID := g.Policy.Creatives[(position+k)%n]
+		if i := slices.Index(g.Creatives, creativeID); i >= 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// optimized 以Exploration的概率随机选择，否则选择估计点击率最高的创意，并列时随机
+func (r *Rotator) optimized(g Group, stats map[string]Stats) int {
+	if r.rand() < g.Policy.Exploration {
+		return r.uniform(len(g.Creatives))
+	}
+	var best []int
+	bestCTR := -1.0
+	for i, creativeID := range g.Creatives {
+		s := stats[creativeID]
+		ctr := float64(s.Clicks+priorClicks) / float64(s.Impressions+priorImpressions)
+		switch {
+		case ctr > bestCTR:
+			best, bestCTR = append(best[:0], i), ctr
+		case ctr == bestCTR:
+			best = append(best, i)
+		}
+	}
+	return best[r.uniform(len(best))]
+}
+
+// uniform 返回[0,n)中均匀随机的整数
+func (r *Rotator) uniform(n int) int {
+	return min(int(r.rand()*float64(n)), n-1)
+}
+
+// RecordImpression 记录曝光：顺序播放时用户的下一个创意为看过的创意的下一个，看完最后一个后从头开始；
+// 点击率优化时累加曝光次数。按权重随机没有状态，不记录
+func (r *Rotator) RecordImpression(ctx context.Context, userID string, policy *Policy, creativeID string) error {
+	if r == nil || r.store == nil || policy == nil || len(policy.Creatives) <= 1 {
+		return nil
+	}
+	switch policy.Mode {
+	case ModeSequential:
+		i := policy.index(creativeID)
+		if userID == "" || i < 0 {
+			return nil
+		}
+		return r.store.SetSequence(ctx, userID, policy.LineItemID, (i+1)%len(policy.Creatives))
+	case ModeOptimized:
+		return r.store.IncrRotationStats(ctx, policy.LineItemID, creativeID, 1, 0)
+	}
+	return nil
+}
+
+// RecordClick 点击率优化时累加点击次数
+func (r *Rotator) RecordClick(ctx context.Context, policy *Policy, creativeID string) error {
+	if r == nil || r.store == nil || policy == nil || len(policy.Creatives) <= 1 || policy.Mode != ModeOptimized {
+		return nil
+	}
+	return r.store.IncrRotationStats(ctx, policy.LineItemID, creativeID, 0, 1)
+}
@@ -0,0 +1,207 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// fakeStore 内存中的轮播状态，记录读取次数
+type fakeStore struct {
+	positions map[string]int
+	stats     map[string]map[string]Stats
+	loads     int
+	err       error
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{positions: make(map[string]int), stats: make(map[string]map[string]Stats)}
+}
+
+func (s *fakeStore) LoadRotation(ctx context.Context, userID string, sequential, optimized []string) (*State, error) {
+	s.loads++
+	if s.err != nil {
+		return nil, s.err
+	}
+	state := &State{Positions: make(map[string]int), Stats: make(map[string]map[string]Stats)}
+	for _, id := range sequential {
+		if position, ok := s.positions[userID+"/"+id]; ok {
+			state.Positions[id] = position
+		}
+	}
+	for _, id := range optimized {
+		state.Stats[id] = s.stats[id]
+	}
+	return state, nil
+}
+
+func (s *fakeStore) SetSequence(ctx context.Context, userID, lineItemID string, next int) error {
+	s.positions[userID+"/"+lineItemID] = next
+	return nil
+}
+
+func (s *fakeStore) IncrRotationStats(ctx context.Context, lineItemID, creativeID string, impressions, clicks int64) error {
+	if s.stats[lineItemID] == nil {
+		s.stats[lineItemID] = make(map[string]Stats)
+	}
+	st := s.stats[lineItemID][creativeID]
+	st.Impressions += impressions
+	st.Clicks += clicks
+	s.stats[lineItemID][creativeID] = st
+	return nil
+}
+
+// seeded 使用固定种子的轮播器，结果可重复
+func seeded(store Store) *Rotator {
+	r := NewRotator(store)
+	r.rand = rand.New(rand.NewPCG(1, 2)).Float64
+	return r
+}
+
+// exploration 探索比例参数
+func exploration(v float64) *float64 {
+	return &v
+}
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy("li1", "", []string{"cr1", "cr2"}, map[string]float64{"cr2": 3}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode != ModeWeighted || p.Weights[0] != 1 || p.Weights[1] != 3 || p.Exploration != DefaultExploration {
+		t.Errorf("默认值不正确: %+v", p)
+	}
+	if p, err := NewPolicy("li1", ModeOptimized, []string{"cr1", "cr2"}, nil, exploration(0)); err != nil || p.Exploration != 0 {
+		t.Errorf("探索比例设置为0时应不探索: %+v, %v", p, err)
+	}
+
+	invalid := []struct {
+		mode        string
+		weights     map[string]float64
+		exploration float64
+	}{
+		{"random", nil, 0},
+		{ModeWeighted, map[string]float64{"cr3": 1}, 0},
+		{ModeWeighted, map[string]float64{"cr1": 0}, 0},
+		{ModeOptimized, nil, 1.5},
+	}
+	for _, tt := range invalid {
+		if _, err := NewPolicy("li1", tt.mode, []string{"cr1", "cr2"}, tt.weights, exploration(tt.exploration)); err == nil {
+			t.Errorf("%+v应返回错误", tt)
+		}
+	}
+}
+
+func TestSelectWeighted(t *testing.T) {
+	policy, _ := NewPolicy("li1", ModeWeighted, []string{"cr1", "cr2", "cr3"}, map[string]float64{"cr1": 3}, nil)
+	store := newFakeStore()
+	r := seeded(store)
+
+	counts := make(map[string]int)
+	groups := []Group{{Policy: policy, Creatives: []string{"cr1", "cr2"}}} // cr3不能投放
+	for range 4000 {
+		counts[groups[0].Creatives[r.Select(context.Background(), "u1", groups)[0]]]++
+	}
+	if share := float64(counts["cr1"]) / 4000; share < 0.72 || share > 0.78 {
+		t.Errorf("cr1的权重为cr2的3倍，占比应约为75%%，实际为%v", share)
+	}
+	if store.loads != 0 {
+		t.Error("按权重随机不应读取状态")
+	}
+}
+
+func TestSelectSequential(t *testing.T) {
+	policy, _ := NewPolicy("li1", ModeSequential, []string{"cr1", "cr2", "cr3"}, nil, nil)
+	store := newFakeStore()
+	r := seeded(store)
+	ctx := context.Background()
+	all := []Group{{Policy: policy, Creatives: []string{"cr1", "cr2", "cr3"}}}
+
+	var seen []string
+	for range 4 {
+		creativeID := policy.Creatives[r.Select(ctx, "u1", all)[0]]
+		seen = append(seen, creativeID)
+		r.RecordImpression(ctx, "u1", policy, creativeID)
+	}
+	if want := []string{"cr1", "cr2", "cr3", "cr1"}; !slices.Equal(seen, want) {
+		t.Errorf("应按顺序观看，看完从头开始: %v", seen)
+	}
+
+	// 进度按人记录；位置上的创意不能投放时顺延
+	if got := r.Select(ctx, "u2", all)[0]; got != 0 {
+		t.Errorf("其他人应从第一个创意开始: %d", got)
+	}
+	partial := []Group{{Policy: policy, Creatives: []string{"cr1", "cr3"}}} // u1下一个应看cr2
+	if got := partial[0].Creatives[r.Select(ctx, "u1", partial)[0]]; got != "cr3" {
+		t.Errorf("cr2不能投放时应顺延到cr3: %s", got)
+	}
+
+	// 没有用户ID时不读取状态，总是第一个
+	loads := store.loads
+	if got := r.Select(ctx, "", all)[0]; got != 0 || store.loads != loads {
+		t.Errorf("没有用户ID时应选第一个创意且不读取状态: %d", got)
+	}
+
+	// 读取失败时按没有进度选择
+	store.err = errors.New("连接断开")
+	if got := r.Select(ctx, "u1", all)[0]; got != 0 {
+		t.Errorf("读取失败时应从第一个创意开始: %d", got)
+	}
+}
+
+func TestSelectOptimized(t *testing.T) {
+	policy, _ := NewPolicy("li1", ModeOptimized, []string{"cr1", "cr2"}, nil, exploration(0.2))
+	sequential, _ := NewPolicy("li2", ModeSequential, []string{"cr1", "cr2"}, nil, nil)
+	store := newFakeStore()
+	r := seeded(store)
+	ctx := context.Background()
+
+	// cr1点击率1%，cr2点击率3%
+	for i := range 1000 {
+		r.RecordImpression(ctx, "u1", policy, "cr1")
+		r.RecordImpression(ctx, "u1", policy, "cr2")
+		if i%100 == 0 {
+			r.RecordClick(ctx, policy, "cr1")
+		}
+		if i%100 < 3 {
+			r.RecordClick(ctx, policy, "cr2")
+		}
+	}
+	if s := store.stats["li1"]["cr2"]; s.Impressions != 1000 || s.Clicks != 30 {
+		t.Fatalf("统计不正确: %+v", s)
+	}
+	r.RecordClick(ctx, sequential, "cr1")
+	if _, ok := store.stats["li2"]; ok {
+		t.Error("顺序播放不应记录点击统计")
+	}
+
+	store.loads = 0
+	groups := []Group{
+		{Policy: policy, Creatives: []string{"cr1", "cr2"}},
+		{Policy: sequential, Creatives: []string{"cr1", "cr2"}},
+		{Policy: policy, Creatives: []string{"cr1", "cr2"}}, // 另一个广告位上的同一投放单元
+	}
+	best := 0
+	for range 1000 {
+		chosen := r.Select(ctx, "u1", groups)
+		if chosen[0] == 1 {
+			best++
+		}
+	}
+	if store.loads != 1000 {
+		t.Errorf("每次选择应只读取一次状态，实际为%d次", store.loads)
+	}
+	// 80%选择点击率高的cr2，20%探索中一半也是cr2
+	if share := float64(best) / 1000; share < 0.86 || share > 0.94 {
+		t.Errorf("cr2的占比应约为90%%，实际为%v", share)
+	}
+
+	// 没有曝光的新创意按先验估计，高于已有大量曝光但点击率低的创意
+	fresh, _ := NewPolicy("li3", ModeOptimized, []string{"cr1", "cr2"}, nil, exploration(0))
+	stats := map[string]Stats{"cr1": {Impressions: 5000, Clicks: 20}}
+	if got := r.optimized(Group{Policy: fresh, Creatives: []string{"cr1", "cr2"}}, stats); got != 1 {
+		t.Errorf("没有曝光的新创意应优先: %d", got)
+	}
+}
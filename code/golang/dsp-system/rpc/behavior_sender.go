@@ -0,0 +1,277 @@
+package rpc
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	pb "dsp-system/proto"
+)
+
+// 行为类型，与用户服务兴趣模型的权重配置对应
+const (
+	BehaviorWin        = "win" // 赢标，默认不计入兴趣得分，只刷新画像活跃时间
+	BehaviorImpression = "view"
+	BehaviorClick      = "click"
+	BehaviorConversion = "conversion"
+)
+
+// BehaviorSenderConfig 行为异步上报参数
+type BehaviorSenderConfig struct {
+	// BufferSize 待发送队列长度，队列满时新事件直接丢弃，不阻塞回调请求
+	BufferSize int
+	// BatchSize 每批事件数，攒够一批立即发送
+	BatchSize int
+	// FlushInterval 不足一批时最长等待多久发送
+	FlushInterval time.Duration
+	// StreamBatches 一个流最多发送多少批，积压时在同一个流里连续发送
+	StreamBatches int
+	// StreamTimeout 单个流的超时
+	StreamTimeout time.Duration
+	// MaxAttempts 每个事件最多发送次数（含首次），临时失败时重新入队
+	MaxAttempts int
+}
+
+// DefaultBehaviorSenderConfig 默认行为上报参数
+func DefaultBehaviorSenderConfig() BehaviorSenderConfig {
+	return BehaviorSenderConfig{
+		BufferSize:    10000,
+		BatchSize:     200,
+		FlushInterval: 500 * time.Millisecond,
+		StreamBatches: 50,
+		StreamTimeout: 5 * time.Second,
+		MaxAttempts:   3,
+	}
+}
+
+// BehaviorSenderStats 行为上报计数
+type BehaviorSenderStats struct {
+	Sent    int64 // 用户服务确认写入
+	Failed  int64 // 参数错误或重试次数用尽
+	Dropped int64 // 队列已满、已关闭或用户服务未连接
+}
+
+// queuedBehavior 队列中的行为事件
+type queuedBehavior struct {
+	userID    string
+	behavior  string
+	adID      string
+	timestamp int64
+	attempts  int
+}
+
+// BehaviorSender 用户行为的异步批量上报
+// 回调请求只把事件放入有界队列；后台通过IngestBehaviors流分批发送。
+// 用户服务写入慢时流控会让发送阻塞，队列积满后新事件被丢弃并计数，不会拖慢请求。
+// 流失败时整批重发，同一事件可能被写入多次（至少一次语义）
+type BehaviorSender struct {
+	client *UserClient
+	cfg    BehaviorSenderConfig
+	queue  chan queuedBehavior
+
+	sent    atomic.Int64
+	failed  atomic.Int64
+	dropped atomic.Int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBehaviorSender 创建行为上报器并启动后台发送
+func NewBehaviorSender(client *UserClient, cfg BehaviorSenderConfig) *BehaviorSender {
+	s := &BehaviorSender{
+		client: client,
+		cfg:    cfg,
+		queue:  make(chan queuedBehavior, cfg.BufferSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Record 记录一次行为，不阻塞；队列已满或上报器已关闭时丢弃并返回false
+func (s *BehaviorSender) Record(userID, behavior, adID string) bool {
+	select {
+	case <-s.stop:
+		s.dropped.Add(1)
+		return false
+	default:
+	}
+	return s.enqueue(queuedBehavior{
+		userID:    userID,
+		behavior:  behavior,
+		adID:      adID,
+		timestamp: time.Now().Unix(),
+	})
+}
+
+// enqueue 非阻塞入队
+func (s *BehaviorSender) enqueue(e queuedBehavior) bool {
+	select {
+	case s.queue <- e:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+// Stats 上报计数
+func (s *BehaviorSender) Stats() BehaviorSenderStats {
+	return BehaviorSenderStats{
+		Sent:    s.sent.Load(),
+		Failed:  s.failed.Load(),
+		Dropped: s.dropped.Load(),
+	}
+}
+
+// Close 停止接收新事件，发送队列中剩余的事件；ctx到期时不再等待
+func (s *BehaviorSender) Close(ctx context.Context) {
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		log.Printf("行为上报未在关闭时限内完成，剩余%d个事件丢弃", len(s.queue))
+	}
+	stats := s.Stats()
+	log.Printf("行为上报已关闭: Sent=%d, Failed=%d, Dropped=%d", stats.Sent, stats.Failed, stats.Dropped)
+}
+
+// run 攒批并发送，关闭时发送完队列中的事件（含重试）再退出
+func (s *BehaviorSender) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []queuedBehavior
+	for {
+		select {
+		case <-s.stop:
+			for {
+				pending = append(pending, s.take(len(s.queue))...)
+				if len(pending) == 0 {
+					return
+				}
+				pending = s.flush(pending)
+			}
+		case e := <-s.queue:
+			if pending = append(pending, e); len(pending) >= s.cfg.BatchSize {
+				pending = s.flush(pending)
+			}
+		case <-ticker.C:
+			if len(pending) > 0 {
+				pending = s.flush(pending)
+			}
+		}
+	}
+}
+
+// take 非阻塞地从队列取出最多n个事件
+func (s *BehaviorSender) take(n int) []queuedBehavior {
+	var events []queuedBehavior
+	for len(events) < n {
+		select {
+		case e := <-s.queue:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+// flush 打开一个流发送pending，队列有积压时继续在同一个流里发送，返回未来得及发送的事件
+func (s *BehaviorSender) flush(pending []queuedBehavior) []queuedBehavior {
+	if s.client.client == nil {
+		log.Printf("用户服务未连接，丢弃行为事件: Count=%d", len(pending))
+		s.dropped.Add(int64(len(pending)))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.StreamTimeout)
+	defer cancel()
+
+	stream, err := s.client.client.IngestBehaviors(ctx)
+	if err != nil {
+		log.Printf("打开行为上报流失败: %v", err)
+		s.retry(pending)
+		return nil
+	}
+
+	// 流内序号即inFlight的下标
+	var inFlight []queuedBehavior
+	batch := pending
+	for n := 0; len(batch) > 0 && n < s.cfg.StreamBatches; n++ {
+		if len(batch) > s.cfg.BatchSize {
+			batch, pending = batch[:s.cfg.BatchSize], batch[s.cfg.BatchSize:]
+		} else {
+			pending = nil
+		}
+
+		events := make([]*pb.BehaviorEvent, len(batch))
+		for i, e := range batch {
+			events[i] = &pb.BehaviorEvent{
+				Seq:       uint64(len(inFlight) + i),
+				UserId:    e.userID,
+				Behavior:  e.behavior,
+				AdId:      e.adID,
+				Timestamp: e.timestamp,
+			}
+		}
+		inFlight = append(inFlight, batch...)
+		// 发送失败时流已中断，错误由CloseAndRecv返回
+		if err := stream.Send(&pb.BehaviorBatch{Events: events}); err != nil {
+			batch = pending
+			break
+		}
+
+		if batch = pending; len(batch) == 0 {
+			batch = s.take(s.cfg.BatchSize)
+		}
+	}
+	// 未发送的部分留给下一个流
+	pending = batch
+
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		log.Printf("行为上报流失败: Events=%d, err=%v", len(inFlight), err)
+		s.retry(inFlight)
+		return pending
+	}
+
+	s.sent.Add(resp.Accepted)
+	var retryable []queuedBehavior
+	for _, failure := range resp.Failures {
+		if failure.Seq >= uint64(len(inFlight)) {
+			continue
+		}
+		if failure.Retryable {
+			retryable = append(retryable, inFlight[failure.Seq])
+		} else {
+			log.Printf("行为事件被拒绝: UserID=%s, Behavior=%s, err=%s",
+				inFlight[failure.Seq].userID, inFlight[failure.Seq].behavior, failure.Error)
+			s.failed.Add(1)
+		}
+	}
+	s.retry(retryable)
+	return pending
+}
+
+// retry 发送次数未用尽的事件重新入队，否则计为失败
+func (s *BehaviorSender) retry(events []queuedBehavior) {
+	for _, e := range events {
+		if e.attempts++; e.attempts >= s.cfg.MaxAttempts {
+			s.failed.Add(1)
+			continue
+		}
+		s.enqueue(e)
+	}
+}
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	pb "dsp-system/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeBehaviorServer 只实现行为上报接口的用户服务
+// 用户"flaky"的事件第一次返回临时失败，用户"bad"的事件总是返回参数错误
+type fakeBehaviorServer struct {
+	pb.UnimplementedUserServiceServer
+
+	mu       sync.Mutex
+	received []*pb.BehaviorEvent
+	streams  int
+	flaked   bool
+}
+
+func (f *fakeBehaviorServer) IngestBehaviors(stream pb.UserService_IngestBehaviorsServer) error {
+	resp := &pb.IngestBehaviorsResponse{}
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		f.mu.Lock()
+		for _, e := range batch.Events {
+			switch {
+			case e.UserId == "bad":
+				resp.Failures = append(resp.Failures, &pb.BehaviorFailure{Seq: e.Seq, Error: "invalid"})
+			case e.UserId == "flaky" && !f.flaked:
+				f.flaked = true
+				resp.Failures = append(resp.Failures, &pb.BehaviorFailure{Seq: e.Seq, Error: "busy", Retryable: true})
+			default:
+				f.received = append(f.received, e)
+				resp.Accepted++
+			}
+		}
+		f.mu.Unlock()
+	}
+
+	f.mu.Lock()
+	f.streams++
+	f.mu.Unlock()
+	return stream.SendAndClose(resp)
+}
+
+// newBehaviorTestClient 创建连接到fakeBehaviorServer的用户客户端
+func newBehaviorTestClient(t *testing.T, fake *fakeBehaviorServer) *UserClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterUserServiceServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &UserClient{conn: conn, client: pb.NewUserServiceClient(conn)}
+}
+
+func TestBehaviorSenderBatchesAndRetries(t *testing.T) {
+	fake := &fakeBehaviorServer{}
+	client := newBehaviorTestClient(t, fake)
+	cfg := DefaultBehaviorSenderConfig()
+	cfg.BatchSize = 2
+	cfg.FlushInterval = 10 * time.Millisecond
+	s := client.EnableBehaviorSender(cfg)
+
+	for _, userID := range []string{"user_a", "flaky", "bad", "user_b", "user_a"} {
+		if !s.Record(userID, BehaviorClick, "ad_001") {
+			t.Fatalf("队列未满时应接收事件: %s", userID)
+		}
+	}
+	s.Close(context.Background())
+
+	stats := s.Stats()
+	if stats.Sent != 4 || stats.Failed != 1 || stats.Dropped != 0 {
+		t.Errorf("临时失败应重试成功，参数错误不重试: %+v", stats)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.received) != 4 {
+		t.Fatalf("用户服务应收到4个事件，实际为%d", len(fake.received))
+	}
+	for _, e := range fake.received {
+		if e.Behavior != BehaviorClick || e.AdId != "ad_001" || e.Timestamp == 0 {
+			t.Errorf("事件字段不正确: %+v", e)
+		}
+	}
+
+	if s.Record("user_a", BehaviorClick, "ad_001") {
+		t.Error("关闭后不应再接收事件")
+	}
+}
+
+func TestBehaviorSenderDisconnected(t *testing.T) {
+	client := NewUserClient("localhost:0")
+	cfg := DefaultBehaviorSenderConfig()
+	cfg.FlushInterval = 10 * time.Millisecond
+	s := client.EnableBehaviorSender(cfg)
+
+	// 用户服务未连接时回调照常返回，事件丢弃并计数
+	for i := 0; i < 3; i++ {
+		s.Record("user_a", BehaviorImpression, "ad_001")
+	}
+	client.Close()
+	if stats := s.Stats(); stats.Dropped != 3 || stats.Sent != 0 {
+		t.Errorf("未连接时事件应丢弃: %+v", stats)
+	}
+}
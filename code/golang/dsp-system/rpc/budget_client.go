@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 
+	"dsp-system/money"
 	pb "dsp-system/proto"
 
 	"google.golang.org/grpc"
@@ -15,18 +16,73 @@ import (
 // BudgetInfo 预算信息
 type BudgetInfo struct {
 	CampaignID      string
-	TotalBudget     float64
-	UsedBudget      float64
-	RemainingBudget float64
-	DailyLimit      float64
+	Currency        string
+	TotalBudget     money.Micros
+	UsedBudget      money.Micros
+	RemainingBudget money.Micros
+	DailyLimit      money.Micros
+	DailySpent      money.Micros // 今日已消耗（含已发放的租约额度）
 	Status          string
 }
 
+// BudgetCheckResult 预算检查结果
+type BudgetCheckResult struct {
+	HasBudget    bool
+	Remaining    money.Micros
+	BlockedLevel string // 拦截的预算层级：advertiser_total, campaign_total, campaign_daily, line_item, lease
+	Message      string
+}
+
+// LedgerEntry 预算流水记录
+type LedgerEntry struct {
+	ID           int64
+	CampaignID   string
+	Type         string
+	Amount       money.Micros
+	BidID        string
+	Reason       string
+	Timestamp    time.Time
+	BalanceAfter money.Micros
+	Currency     string
+	LeaseID      string
+}
+
+// ReconcileResult 对账结果
+type ReconcileResult struct {
+	CampaignID      string
+	LedgerBalance   money.Micros
+	RecordedBalance money.Micros
+	Consistent      bool
+	EntryCount      int64
+	TotalDeducted   money.Micros
+	TotalRefunded   money.Micros
+	Currency        string
+
+	TotalLeased        money.Micros
+	TotalLeaseReturned money.Micros
+	LeaseOutstanding   money.Micros
+	LeaseSpent         money.Micros
+	LeasesConsistent   bool
+}
+
+// LeaseGrant 预算服务发放的租约
+type LeaseGrant struct {
+	ID         string
+	CampaignID string
+	LineItemID string
+	Granted    money.Micros
+	ExpiresAt  time.Time
+	Currency   string
+}
+
 // BudgetClient 预算服务客户端
 type BudgetClient struct {
 	addr   string
 	conn   *grpc.ClientConn
 	client pb.BudgetServiceClient
+
+	// 启用租约后，校验和扣减优先使用本地租约额度
+	leases *LeaseManager
 }
 
 // NewBudgetClient 创建预算服务客户端
@@ -58,8 +114,19 @@ func (c *BudgetClient) Connect() error {
 	return nil
 }
 
-// Close 关闭连接
+// EnableLeases 启用预算租约，之后的CheckBudgetDetail/DeductLineItemBudget优先使用本地额度
+func (c *BudgetClient) EnableLeases(cfg LeaseConfig) *LeaseManager {
+	c.leases = NewLeaseManager(c, cfg)
+	return c.leases
+}
+
+// Close 关闭连接（启用租约时先归还全部租约）
 func (c *BudgetClient) Close() error {
+	if c.leases != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		c.leases.Close(ctx)
+		cancel()
+	}
 	if c.conn != nil {
 		return c.conn.Close()
 	}
@@ -67,41 +134,79 @@ func (c *BudgetClient) Close() error {
 }
 
 // CheckBudget 检查预算是否充足
-func (c *BudgetClient) CheckBudget(ctx context.Context, campaignID string, bidPrice float64) (bool, error) {
+func (c *BudgetClient) CheckBudget(ctx context.Context, campaignID string, bidPrice money.Micros) (bool, error) {
+	result, err := c.CheckBudgetDetail(ctx, campaignID, "", bidPrice)
+	if err != nil {
+		return false, err
+	}
+	return result.HasBudget, nil
+}
+
+// CheckBudgetDetail 按广告主、活动、日预算、投放单元逐级检查预算，返回拦截层级
+func (c *BudgetClient) CheckBudgetDetail(ctx context.Context, campaignID string, lineItemID string, bidPrice money.Micros) (*BudgetCheckResult, error) {
 	if c.client == nil {
 		// 降级逻辑：gRPC 未连接时使用模拟数据
-		log.Printf("预算服务未连接，使用模拟数据: CampaignID=%s, BidPrice=%.2f", campaignID, bidPrice)
-		return bidPrice <= 10.0, nil
+		log.Printf("预算服务未连接，使用模拟数据: CampaignID=%s, BidPrice=%s", campaignID, bidPrice)
+		if bidPrice > 10*money.MicrosPerUnit {
+			return &BudgetCheckResult{HasBudget: false, BlockedLevel: "campaign_total", Message: "模拟预算不足"}, nil
+		}
+		return &BudgetCheckResult{HasBudget: true, Message: "模拟预算充足"}, nil
+	}
+
+	if c.leases != nil {
+		return c.leases.Check(ctx, campaignID, lineItemID, bidPrice)
 	}
 
 	req := &pb.CheckBudgetRequest{
-		CampaignId: campaignID,
-		Amount:     bidPrice,
+		CampaignId:   campaignID,
+		AmountMicros: int64(bidPrice),
+		Currency:     money.DefaultCurrency,
+		LineItemId:   lineItemID,
 	}
 
 	resp, err := c.client.CheckBudget(ctx, req)
 	if err != nil {
 		log.Printf("检查预算失败: %v", err)
-		return false, err
+		return nil, err
 	}
 
-	log.Printf("检查预算: CampaignID=%s, HasBudget=%v, Remaining=%.2f",
-		campaignID, resp.HasBudget, resp.Remaining)
+	remaining := money.Micros(resp.RemainingMicros)
+	log.Printf("检查预算: CampaignID=%s, LineItemID=%s, HasBudget=%v, Remaining=%s, BlockedLevel=%s",
+		campaignID, lineItemID, resp.HasBudget, remaining, resp.BlockedLevel)
 
-	return resp.HasBudget, nil
+	return &BudgetCheckResult{
+		HasBudget:    resp.HasBudget,
+		Remaining:    remaining,
+		BlockedLevel: resp.BlockedLevel,
+		Message:      resp.Message,
+	}, nil
 }
 
-// DeductBudget 扣减预算（竞价成功后）
-func (c *BudgetClient) DeductBudget(ctx context.Context, campaignID string, amount float64) error {
+// DeductBudget 扣减预算（竞价成功后），bidID为赢标的竞价ID
+func (c *BudgetClient) DeductBudget(ctx context.Context, campaignID, bidID string, amount money.Micros) error {
+	return c.DeductLineItemBudget(ctx, campaignID, "", bidID, amount)
+}
+
+// DeductLineItemBudget 在广告主、活动和投放单元各层级扣减预算
+// bidID为赢标的竞价ID，记入预算流水，用于追溯到竞价和服务端去重
+func (c *BudgetClient) DeductLineItemBudget(ctx context.Context, campaignID, lineItemID, bidID string, amount money.Micros) error {
 	if c.client == nil {
-		log.Printf("预算服务未连接，跳过扣减: CampaignID=%s, Amount=%.2f", campaignID, amount)
+		log.Printf("预算服务未连接，跳过扣减: CampaignID=%s, Amount=%s", campaignID, amount)
+		return nil
+	}
+
+	// 租约额度不足时回退到中心扣减，保证赢标的花费一定被记账
+	if c.leases != nil && c.leases.Spend(campaignID, lineItemID, amount) {
 		return nil
 	}
 
 	req := &pb.DeductBudgetRequest{
-		CampaignId: campaignID,
-		Amount:     amount,
-		BidId:      fmt.Sprintf("bid_%d", time.Now().UnixNano()),
+		CampaignId:   campaignID,
+		AmountMicros: int64(amount),
+		Currency:     money.DefaultCurrency,
+		BidId:        bidID,
+		Reason:       "win",
+		LineItemId:   lineItemID,
 	}
 
 	resp, err := c.client.DeductBudget(ctx, req)
@@ -111,10 +216,10 @@ func (c *BudgetClient) DeductBudget(ctx context.Context, campaignID string, amou
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("扣减失败: %s", resp.Message)
+		return fmt.Errorf("扣减失败(%s): %s", resp.BlockedLevel, resp.Message)
 	}
 
-	log.Printf("扣减预算成功: CampaignID=%s, Remaining=%.2f", campaignID, resp.Remaining)
+	log.Printf("扣减预算成功: CampaignID=%s, Remaining=%s", campaignID, money.Micros(resp.RemainingMicros))
 	return nil
 }
 
@@ -124,10 +229,11 @@ func (c *BudgetClient) GetBudgetInfo(ctx context.Context, campaignID string) (*B
 		log.Printf("预算服务未连接，返回模拟数据: CampaignID=%s", campaignID)
 		return &BudgetInfo{
 			CampaignID:      campaignID,
-			TotalBudget:     10000.0,
-			UsedBudget:      3500.0,
-			RemainingBudget: 6500.0,
-			DailyLimit:      1000.0,
+			Currency:        money.DefaultCurrency,
+			TotalBudget:     10000 * money.MicrosPerUnit,
+			UsedBudget:      3500 * money.MicrosPerUnit,
+			RemainingBudget: 6500 * money.MicrosPerUnit,
+			DailyLimit:      1000 * money.MicrosPerUnit,
 			Status:          "active",
 		}, nil
 	}
@@ -144,29 +250,32 @@ func (c *BudgetClient) GetBudgetInfo(ctx context.Context, campaignID string) (*B
 
 	info := &BudgetInfo{
 		CampaignID:      resp.CampaignId,
-		TotalBudget:     resp.TotalBudget,
-		UsedBudget:      resp.TotalBudget - resp.RemainingBudget,
-		RemainingBudget: resp.RemainingBudget,
-		DailyLimit:      resp.DailyBudget,
+		Currency:        resp.Currency,
+		TotalBudget:     money.Micros(resp.TotalBudgetMicros),
+		UsedBudget:      money.Micros(resp.TotalBudgetMicros - resp.RemainingBudgetMicros),
+		RemainingBudget: money.Micros(resp.RemainingBudgetMicros),
+		DailyLimit:      money.Micros(resp.DailyBudgetMicros),
+		DailySpent:      money.Micros(resp.DailySpentMicros),
 		Status:          resp.Status,
 	}
 
-	log.Printf("获取预算信息: CampaignID=%s, Remaining=%.2f", campaignID, info.RemainingBudget)
+	log.Printf("获取预算信息: CampaignID=%s, Remaining=%s %s", campaignID, info.RemainingBudget, info.Currency)
 	return info, nil
 }
 
-// RefundBudget 退还预算（竞价失败时）
-func (c *BudgetClient) RefundBudget(ctx context.Context, campaignID string, amount float64) error {
+// RefundBudget 退还预算（竞价失败时），bidID为原扣减的竞价ID
+func (c *BudgetClient) RefundBudget(ctx context.Context, campaignID, bidID string, amount money.Micros) error {
 	if c.client == nil {
-		log.Printf("预算服务未连接，跳过退还: CampaignID=%s, Amount=%.2f", campaignID, amount)
+		log.Printf("预算服务未连接，跳过退还: CampaignID=%s, Amount=%s", campaignID, amount)
 		return nil
 	}
 
 	req := &pb.RefundBudgetRequest{
-		CampaignId: campaignID,
-		Amount:     amount,
-		BidId:      fmt.Sprintf("bid_%d", time.Now().UnixNano()),
-		Reason:     "bid_failed",
+		CampaignId:   campaignID,
+		AmountMicros: int64(amount),
+		Currency:     money.DefaultCurrency,
+		BidId:        bidID,
+		Reason:       "bid_failed",
 	}
 
 	resp, err := c.client.RefundBudget(ctx, req)
@@ -179,12 +288,12 @@ func (c *BudgetClient) RefundBudget(ctx context.Context, campaignID string, amou
 		return fmt.Errorf("退还失败: %s", resp.Message)
 	}
 
-	log.Printf("退还预算成功: CampaignID=%s, Remaining=%.2f", campaignID, resp.Remaining)
+	log.Printf("退还预算成功: CampaignID=%s, Remaining=%s", campaignID, money.Micros(resp.RemainingMicros))
 	return nil
 }
 
 // BatchCheckBudget 批量检查预算
-func (c *BudgetClient) BatchCheckBudget(ctx context.Context, requests map[string]float64) (map[string]bool, error) {
+func (c *BudgetClient) BatchCheckBudget(ctx context.Context, requests map[string]money.Micros) (map[string]bool, error) {
 	// requests: campaignID -> bidPrice
 	results := make(map[string]bool)
 
@@ -200,3 +309,147 @@ func (c *BudgetClient) BatchCheckBudget(ctx context.Context, requests map[string
 
 	return results, nil
 }
+
+// ListLedgerEntries 查询预算流水（start/end为零值表示不限）
+func (c *BudgetClient) ListLedgerEntries(ctx context.Context, campaignID string, start, end time.Time, limit int) ([]LedgerEntry, error) {
+	if c.client == nil {
+		return nil, fmt.Errorf("预算服务未连接")
+	}
+
+	req := &pb.ListLedgerEntriesRequest{
+		CampaignId: campaignID,
+		Limit:      int32(limit),
+	}
+	if !start.IsZero() {
+		req.StartTime = start.UnixMilli()
+	}
+	if !end.IsZero() {
+		req.EndTime = end.UnixMilli()
+	}
+
+	resp, err := c.client.ListLedgerEntries(ctx, req)
+	if err != nil {
+		log.Printf("查询预算流水失败: %v", err)
+		return nil, err
+	}
+
+	entries := make([]LedgerEntry, 0, len(resp.Entries))
+	for _, e := range resp.Entries {
+		entries = append(entries, LedgerEntry{
+			ID:           e.Id,
+			CampaignID:   e.CampaignId,
+			Type:         e.Type,
+			Amount:       money.Micros(e.AmountMicros),
+			BidID:        e.BidId,
+			Reason:       e.Reason,
+			Timestamp:    time.UnixMilli(e.Timestamp),
+			BalanceAfter: money.Micros(e.BalanceAfterMicros),
+			Currency:     e.Currency,
+			LeaseID:      e.LeaseId,
+		})
+	}
+
+	return entries, nil
+}
+
+// ReconcileBudget 根据流水对账
+func (c *BudgetClient) ReconcileBudget(ctx context.Context, campaignID string) (*ReconcileResult, error) {
+	if c.client == nil {
+		return nil, fmt.Errorf("预算服务未连接")
+	}
+
+	resp, err := c.client.ReconcileBudget(ctx, &pb.ReconcileBudgetRequest{CampaignId: campaignID})
+	if err != nil {
+		log.Printf("预算对账失败: %v", err)
+		return nil, err
+	}
+
+	if !resp.Consistent {
+		log.Printf("预算对账不一致: CampaignID=%s, Ledger=%s, Recorded=%s",
+			campaignID, money.Micros(resp.LedgerBalanceMicros), money.Micros(resp.RecordedBalanceMicros))
+	}
+
+	return &ReconcileResult{
+		CampaignID:      resp.CampaignId,
+		LedgerBalance:   money.Micros(resp.LedgerBalanceMicros),
+		RecordedBalance: money.Micros(resp.RecordedBalanceMicros),
+		Consistent:      resp.Consistent,
+		EntryCount:      resp.EntryCount,
+		TotalDeducted:   money.Micros(resp.TotalDeductedMicros),
+		TotalRefunded:   money.Micros(resp.TotalRefundedMicros),
+		Currency:        resp.Currency,
+
+		TotalLeased:        money.Micros(resp.TotalLeasedMicros),
+		TotalLeaseReturned: money.Micros(resp.TotalLeaseReturnedMicros),
+		LeaseOutstanding:   money.Micros(resp.LeaseOutstandingMicros),
+		LeaseSpent:         money.Micros(resp.LeaseSpentMicros),
+		LeasesConsistent:   resp.LeasesConsistent,
+	}, nil
+}
+
+// AcquireLease 申请预算租约，未发放时返回拦截信息
+func (c *BudgetClient) AcquireLease(ctx context.Context, campaignID, lineItemID, nodeID string, amount money.Micros, ttl time.Duration) (*LeaseGrant, *BudgetCheckResult, error) {
+	if c.client == nil {
+		return nil, nil, fmt.Errorf("预算服务未连接")
+	}
+
+	resp, err := c.client.AcquireLease(ctx, &pb.AcquireLeaseRequest{
+		CampaignId:   campaignID,
+		LineItemId:   lineItemID,
+		NodeId:       nodeID,
+		AmountMicros: int64(amount),
+		Currency:     money.DefaultCurrency,
+		TtlMs:        ttl.Milliseconds(),
+	})
+	if err != nil {
+		log.Printf("申请租约失败: %v", err)
+		return nil, nil, err
+	}
+
+	result := &BudgetCheckResult{
+		HasBudget:    resp.Granted,
+		Remaining:    money.Micros(resp.RemainingMicros),
+		BlockedLevel: resp.BlockedLevel,
+		Message:      resp.Message,
+	}
+	if !resp.Granted {
+		return nil, result, nil
+	}
+
+	lease := resp.Lease
+	log.Printf("申请租约成功: LeaseID=%s, CampaignID=%s, Granted=%s",
+		lease.Id, campaignID, money.Micros(lease.GrantedMicros))
+
+	return &LeaseGrant{
+		ID:         lease.Id,
+		CampaignID: lease.CampaignId,
+		LineItemID: lease.LineItemId,
+		Granted:    money.Micros(lease.GrantedMicros),
+		ExpiresAt:  time.UnixMilli(lease.ExpiresAt),
+		Currency:   lease.Currency,
+	}, result, nil
+}
+
+// ReleaseLease 归还租约并上报本地消耗
+func (c *BudgetClient) ReleaseLease(ctx context.Context, leaseID string, spent money.Micros) error {
+	if c.client == nil {
+		return fmt.Errorf("预算服务未连接")
+	}
+
+	resp, err := c.client.ReleaseLease(ctx, &pb.ReleaseLeaseRequest{
+		LeaseId:     leaseID,
+		SpentMicros: int64(spent),
+	})
+	if err != nil {
+		log.Printf("归还租约失败: %v", err)
+		return err
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("%w: %s", ErrLeaseRejected, resp.Message)
+	}
+
+	log.Printf("归还租约成功: LeaseID=%s, Spent=%s, Returned=%s",
+		leaseID, money.Micros(resp.Lease.SpentMicros), money.Micros(resp.Lease.ReturnedMicros))
+	return nil
+}
@@ -0,0 +1,274 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"dsp-system/money"
+)
+
+// BlockedLevelLease 本地租约额度不足（中心预算只能部分发放）
+const BlockedLevelLease = "lease"
+
+// ErrLeaseRejected 预算服务拒绝归还（租约不存在或已归还），无需重试
+var ErrLeaseRejected = errors.New("租约归还被拒绝")
+
+// LeaseConfig 竞价节点的租约参数
+type LeaseConfig struct {
+	NodeID    string        // 节点ID，预算服务据此记录租约归属
+	SliceSize money.Micros  // 每次申请的额度
+	TTL       time.Duration // 租约有效期
+	// SafetyMargin 本地在过期前多久停止使用并归还租约，
+	// 避免与服务端的过期处理重叠
+	SafetyMargin time.Duration
+	// RetryAfter 预算服务拒绝发放后，多久之内不再重新申请
+	RetryAfter time.Duration
+}
+
+// DefaultLeaseConfig 默认租约参数
+func DefaultLeaseConfig(nodeID string) LeaseConfig {
+	return LeaseConfig{
+		NodeID:       nodeID,
+		SliceSize:    100 * money.MicrosPerUnit,
+		TTL:          time.Minute,
+		SafetyMargin: 5 * time.Second,
+		RetryAfter:   time.Second,
+	}
+}
+
+// localLease 节点持有的一份租约
+type localLease struct {
+	id          string
+	granted     money.Micros
+	spent       money.Micros
+	usableUntil time.Time
+}
+
+// available 租约剩余可用额度
+func (l *localLease) available() money.Micros {
+	return l.granted - l.spent
+}
+
+// leaseSlot 一个活动（或投放单元）的本地租约
+type leaseSlot struct {
+	mu           sync.Mutex
+	lease        *localLease
+	blocked      *BudgetCheckResult // 最近一次被拒绝的结果
+	blockedUntil time.Time
+}
+
+// LeaseManager 竞价节点本地的预算租约管理
+// 节点先从预算服务领取一部分预算，竞价校验和赢标扣减都在本地完成，
+// 租约快到期、额度用完或节点关闭时把实际消耗上报并退还剩余额度
+type LeaseManager struct {
+	client *BudgetClient
+	cfg    LeaseConfig
+
+	mu    sync.Mutex
+	slots map[string]*leaseSlot
+	// 归还失败的租约，后台定期重试；服务端会在过期后保持其额度扣除，不会超扣
+	pending []pendingRelease
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// pendingRelease 待重试的归还
+type pendingRelease struct {
+	leaseID string
+	spent   money.Micros
+}
+
+// NewLeaseManager 创建租约管理器并启动后台归还
+func NewLeaseManager(client *BudgetClient, cfg LeaseConfig) *LeaseManager {
+	m := &LeaseManager{
+		client: client,
+		cfg:    cfg,
+		slots:  make(map[string]*leaseSlot),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go m.run()
+	return m
+}
+
+// Check 用本地租约校验预算，额度不足或即将到期时换一份新租约
+func (m *LeaseManager) Check(ctx context.Context, campaignID, lineItemID string, amount money.Micros) (*BudgetCheckResult, error) {
+	slot := m.slot(campaignID, lineItemID)
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	now := time.Now()
+	if l := slot.lease; l != nil && now.Before(l.usableUntil) && l.available() >= amount {
+		return &BudgetCheckResult{HasBudget: true, Remaining: l.available(), Message: "租约额度充足"}, nil
+	}
+
+	// 预算服务刚拒绝过，短时间内直接沿用拒绝结果
+	if slot.blocked != nil && now.Before(slot.blockedUntil) {
+		return slot.blocked, nil
+	}
+
+	m.retire(ctx, slot)
+
+	request := m.cfg.SliceSize
+	if amount > request {
+		request = amount
+	}
+	grant, result, err := m.client.AcquireLease(ctx, campaignID, lineItemID, m.cfg.NodeID, request, m.cfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		slot.blocked = result
+		slot.blockedUntil = now.Add(m.cfg.RetryAfter)
+		return result, nil
+	}
+
+	slot.blocked = nil
+	slot.lease = &localLease{
+		id:          grant.ID,
+		granted:     grant.Granted,
+		usableUntil: grant.ExpiresAt.Add(-m.cfg.SafetyMargin),
+	}
+
+	// 只部分发放说明中心预算已不足本次金额，保留租约给更小的出价使用
+	if grant.Granted < amount {
+		slot.blocked = &BudgetCheckResult{HasBudget: false, Remaining: grant.Granted, BlockedLevel: BlockedLevelLease, Message: "租约额度不足"}
+		slot.blockedUntil = now.Add(m.cfg.RetryAfter)
+		return slot.blocked, nil
+	}
+	return &BudgetCheckResult{HasBudget: true, Remaining: grant.Granted, Message: "租约额度充足"}, nil
+}
+
+// Spend 从本地租约扣减，租约无效或额度不足时返回false（调用方应回退到中心扣减）
+func (m *LeaseManager) Spend(campaignID, lineItemID string, amount money.Micros) bool {
+	slot := m.slot(campaignID, lineItemID)
+	slot.mu.Lock()
+	defer slot.mu.Unlock()
+
+	l := slot.lease
+	if l == nil || !time.Now().Before(l.usableUntil) || l.available() < amount {
+		return false
+	}
+	l.spent += amount
+	return true
+}
+
+// Close 停止后台任务并归还全部租约
+func (m *LeaseManager) Close(ctx context.Context) {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+	<-m.done
+
+	for _, slot := range m.allSlots() {
+		slot.mu.Lock()
+		m.retire(ctx, slot)
+		slot.mu.Unlock()
+	}
+	m.retryPending(ctx)
+
+	m.mu.Lock()
+	if len(m.pending) > 0 {
+		log.Printf("仍有%d个租约未能归还，将由预算服务过期处理", len(m.pending))
+	}
+	m.mu.Unlock()
+}
+
+// run 定期归还已到期的租约并重试失败的归还
+func (m *LeaseManager) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		now := time.Now()
+		for _, slot := range m.allSlots() {
+			slot.mu.Lock()
+			if slot.lease != nil && !now.Before(slot.lease.usableUntil) {
+				m.retire(ctx, slot)
+			}
+			slot.mu.Unlock()
+		}
+		m.retryPending(ctx)
+		cancel()
+	}
+}
+
+// retire 归还槽位上的租约，调用方需持有slot.mu
+func (m *LeaseManager) retire(ctx context.Context, slot *leaseSlot) {
+	l := slot.lease
+	if l == nil {
+		return
+	}
+	slot.lease = nil
+
+	err := m.client.ReleaseLease(ctx, l.id, l.spent)
+	if err != nil && !errors.Is(err, ErrLeaseRejected) {
+		m.mu.Lock()
+		m.pending = append(m.pending, pendingRelease{leaseID: l.id, spent: l.spent})
+		m.mu.Unlock()
+	}
+}
+
+// retryPending 重试归还失败的租约
+func (m *LeaseManager) retryPending(ctx context.Context) {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.mu.Unlock()
+
+	var failed []pendingRelease
+	for _, p := range pending {
+		err := m.client.ReleaseLease(ctx, p.leaseID, p.spent)
+		if err != nil && !errors.Is(err, ErrLeaseRejected) {
+			failed = append(failed, p)
+		}
+	}
+
+	if len(failed) > 0 {
+		m.mu.Lock()
+		m.pending = append(m.pending, failed...)
+		m.mu.Unlock()
+	}
+}
+
+// slot 获取或创建租约槽位
+func (m *LeaseManager) slot(campaignID, lineItemID string) *leaseSlot {
+	key := campaignID + "|" + lineItemID
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slot, exists := m.slots[key]
+	if !exists {
+		slot = &leaseSlot{}
+		m.slots[key] = slot
+	}
+	return slot
+}
+
+// allSlots 返回全部槽位的快照
+func (m *LeaseManager) allSlots() []*leaseSlot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slots := make([]*leaseSlot, 0, len(m.slots))
+	for _, slot := range m.slots {
+		slots = append(slots, slot)
+	}
+	return slots
+}
@@ -0,0 +1,188 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	pb "dsp-system/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeLeaseServer 只实现租约接口的预算服务
+type fakeLeaseServer struct {
+	pb.UnimplementedBudgetServiceServer
+
+	mu        sync.Mutex
+	available money.Micros
+	acquires  int
+	releases  map[string]money.Micros // leaseID -> 上报消耗
+	failNext  bool                    // 下一次归还返回错误
+	bidIDs    []string                // 中心扣减和退还请求中的竞价ID
+}
+
+func (f *fakeLeaseServer) AcquireLease(ctx context.Context, req *pb.AcquireLeaseRequest) (*pb.AcquireLeaseResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.acquires++
+	granted := min(money.Micros(req.AmountMicros), f.available)
+	if granted <= 0 {
+		return &pb.AcquireLeaseResponse{Granted: false, BlockedLevel: "campaign_total", Message: "总预算不足"}, nil
+	}
+	f.available -= granted
+
+	return &pb.AcquireLeaseResponse{
+		Granted: true,
+		Lease: &pb.Lease{
+			Id:            fmt.Sprintf("lease_%d", f.acquires),
+			CampaignId:    req.CampaignId,
+			GrantedMicros: int64(granted),
+			ExpiresAt:     time.Now().Add(time.Duration(req.TtlMs) * time.Millisecond).UnixMilli(),
+		},
+		RemainingMicros: int64(f.available),
+	}, nil
+}
+
+func (f *fakeLeaseServer) ReleaseLease(ctx context.Context, req *pb.ReleaseLeaseRequest) (*pb.ReleaseLeaseResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.failNext {
+		f.failNext = false
+		return nil, errors.New("unavailable")
+	}
+	f.releases[req.LeaseId] = money.Micros(req.SpentMicros)
+	return &pb.ReleaseLeaseResponse{Success: true, Lease: &pb.Lease{Id: req.LeaseId, SpentMicros: req.SpentMicros}}, nil
+}
+
+func (f *fakeLeaseServer) DeductBudget(ctx context.Context, req *pb.DeductBudgetRequest) (*pb.DeductBudgetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bidIDs = append(f.bidIDs, req.BidId)
+	return &pb.DeductBudgetResponse{Success: true}, nil
+}
+
+func (f *fakeLeaseServer) RefundBudget(ctx context.Context, req *pb.RefundBudgetRequest) (*pb.RefundBudgetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.bidIDs = append(f.bidIDs, req.BidId)
+	return &pb.RefundBudgetResponse{Success: true}, nil
+}
+
+// newLeaseTestClient 创建连接到fakeLeaseServer的预算客户端
+func newLeaseTestClient(t *testing.T, fake *fakeLeaseServer) *BudgetClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterBudgetServiceServer(server, fake)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return &BudgetClient{conn: conn, client: pb.NewBudgetServiceClient(conn)}
+}
+
+func TestLeaseManagerSpendsLocally(t *testing.T) {
+	fake := &fakeLeaseServer{available: 1000 * money.MicrosPerUnit, releases: make(map[string]money.Micros)}
+	client := newLeaseTestClient(t, fake)
+	m := client.EnableLeases(DefaultLeaseConfig("node_test"))
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		result, err := client.CheckBudgetDetail(ctx, "campaign_001", "", 2*money.MicrosPerUnit)
+		if err != nil || !result.HasBudget {
+			t.Fatalf("租约额度内校验应通过: %+v, %v", result, err)
+		}
+		if err := client.DeductLineItemBudget(ctx, "campaign_001", "", fmt.Sprintf("bid_%d", i), 2*money.MicrosPerUnit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if fake.acquires != 1 {
+		t.Errorf("额度充足时只应申请一次租约，实际为%d次", fake.acquires)
+	}
+
+	m.Close(ctx)
+	if spent := fake.releases["lease_1"]; spent != 40*money.MicrosPerUnit {
+		t.Errorf("关闭时应归还租约并上报消耗40，实际为%s", spent)
+	}
+}
+
+func TestLeaseManagerBlockedBackoff(t *testing.T) {
+	fake := &fakeLeaseServer{available: 0, releases: make(map[string]money.Micros)}
+	client := newLeaseTestClient(t, fake)
+	m := client.EnableLeases(DefaultLeaseConfig("node_test"))
+	defer m.Close(context.Background())
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		result, err := m.Check(ctx, "campaign_001", "", money.MicrosPerUnit)
+		if err != nil || result.HasBudget || result.BlockedLevel != "campaign_total" {
+			t.Fatalf("中心预算不足时应拦截: %+v, %v", result, err)
+		}
+	}
+	if fake.acquires != 1 {
+		t.Errorf("被拒绝后短时间内不应重复申请，实际申请%d次", fake.acquires)
+	}
+
+	// 没有租约时扣减应回退到中心
+	if m.Spend("campaign_001", "", money.MicrosPerUnit) {
+		t.Error("没有租约时不应在本地扣减")
+	}
+}
+
+func TestLeaseManagerRetriesFailedRelease(t *testing.T) {
+	fake := &fakeLeaseServer{available: 1000 * money.MicrosPerUnit, releases: make(map[string]money.Micros)}
+	client := newLeaseTestClient(t, fake)
+	m := client.EnableLeases(DefaultLeaseConfig("node_test"))
+	ctx := context.Background()
+
+	if _, err := m.Check(ctx, "campaign_001", "", money.MicrosPerUnit); err != nil {
+		t.Fatal(err)
+	}
+	m.Spend("campaign_001", "", 3*money.MicrosPerUnit)
+
+	// 第一次归还失败后进入重试队列，Close时再次归还
+	fake.mu.Lock()
+	fake.failNext = true
+	fake.mu.Unlock()
+	m.Close(ctx)
+
+	if spent, ok := fake.releases["lease_1"]; !ok || spent != 3*money.MicrosPerUnit {
+		t.Errorf("归还失败后应重试: %v", fake.releases)
+	}
+}
+
+func TestDeductAndRefundCarryBidID(t *testing.T) {
+	fake := &fakeLeaseServer{releases: make(map[string]money.Micros)}
+	client := newLeaseTestClient(t, fake)
+	ctx := context.Background()
+
+	if err := client.DeductLineItemBudget(ctx, "campaign_001", "li_001", "bid_req1_1", money.MicrosPerUnit); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RefundBudget(ctx, "campaign_001", "bid_req1_1", money.MicrosPerUnit); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.bidIDs) != 2 || fake.bidIDs[0] != "bid_req1_1" || fake.bidIDs[1] != "bid_req1_1" {
+		t.Errorf("扣减和退还应带上竞价ID，实际为%v", fake.bidIDs)
+	}
+}
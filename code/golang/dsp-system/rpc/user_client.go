@@ -18,6 +18,12 @@ type UserProfile struct {
 	Gender   string
 	Tags     []string
 	Interests []string
+	// BehaviorScores 行为推导的标签及其得分（标签已包含在Tags中）
+	BehaviorScores map[string]float64
+	// SegmentIDs 所属人群ID
+	SegmentIDs []string
+	// PersonID 跨设备合并后的人ID（未关联时等于UserID），频次控制等按人计算的逻辑应使用该ID
+	PersonID string
 }
 
 // UserClient 用户服务客户端
@@ -25,6 +31,8 @@ type UserClient struct {
 	addr   string
 	conn   *grpc.ClientConn
 	client pb.UserServiceClient
+
+	behaviors *BehaviorSender
 }
 
 // NewUserClient 创建用户服务客户端
@@ -56,8 +64,19 @@ func (c *UserClient) Connect() error {
 	return nil
 }
 
-// Close 关闭连接
+// EnableBehaviorSender 启用行为异步上报，赢标、曝光、点击回调通过返回的上报器记录行为
+func (c *UserClient) EnableBehaviorSender(cfg BehaviorSenderConfig) *BehaviorSender {
+	c.behaviors = NewBehaviorSender(c, cfg)
+	return c.behaviors
+}
+
+// Close 关闭连接（启用行为上报时先发送完队列中的事件）
 func (c *UserClient) Close() error {
+	if c.behaviors != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		c.behaviors.Close(ctx)
+		cancel()
+	}
 	if c.conn != nil {
 		return c.conn.Close()
 	}
@@ -94,6 +113,9 @@ func (c *UserClient) GetUserProfile(ctx context.Context, userID string) (*UserPr
 		Gender:    resp.Gender,
 		Tags:      resp.Tags,
 		Interests: resp.Interests,
+		BehaviorScores: behaviorScores(resp.BehaviorTags),
+		SegmentIDs: resp.SegmentIds,
+		PersonID: resp.PersonId,
 	}
 	
 	log.Printf("获取用户画像成功: UserID=%s, Tags=%v", userID, profile.Tags)
@@ -134,6 +156,9 @@ func (c *UserClient) BatchGetUserProfiles(ctx context.Context, userIDs []string)
 			Gender:    p.Gender,
 			Tags:      p.Tags,
 			Interests: p.Interests,
+			BehaviorScores: behaviorScores(p.BehaviorTags),
+			SegmentIDs: p.SegmentIds,
+			PersonID: p.PersonId,
 		}
 	}
 	
@@ -169,3 +194,30 @@ func (c *UserClient) UpdateUserBehavior(ctx context.Context, userID string, beha
 	return nil
 }
 
+// ObserveIdentifiers 上报同一请求中同时出现的用户标识，用于跨设备身份关联
+func (c *UserClient) ObserveIdentifiers(ctx context.Context, identifiers []string) error {
+	if c.client == nil {
+		return nil
+	}
+
+	_, err := c.client.ObserveIdentifiers(ctx, &pb.ObserveIdentifiersRequest{
+		Identifiers: identifiers,
+	})
+	if err != nil {
+		log.Printf("上报用户标识失败: %v", err)
+		return err
+	}
+	return nil
+}
+
+// behaviorScores 转换行为标签得分
+func behaviorScores(tags []*pb.BehaviorTag) map[string]float64 {
+	if len(tags) == 0 {
+		return nil
+	}
+	scores := make(map[string]float64, len(tags))
+	for _, tag := range tags {
+		scores[tag.Tag] = tag.Score
+	}
+	return scores
+}
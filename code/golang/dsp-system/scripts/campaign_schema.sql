@@ -0,0 +1,60 @@
+-- 广告库表结构（MySQL）
+-- 服务按 CAMPAIGN_RELOAD_INTERVAL_SECONDS 检查各表的 MAX(updated_at) 和行数，变化后重新加载
+
+CREATE TABLE IF NOT EXISTS advertisers (
+    id             VARCHAR(64)  NOT NULL PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL DEFAULT '',
+    frequency_caps JSON         NULL COMMENT '频次上限，如 [{"max": 10, "window": "week"}]',
+    updated_at     TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3)
+);
+
+CREATE TABLE IF NOT EXISTS campaigns (
+    id          VARCHAR(64)  NOT NULL PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL DEFAULT '',
+    advertiser  VARCHAR(255) NOT NULL DEFAULT '' COMMENT '广告主ID',
+    domain      VARCHAR(255) NOT NULL DEFAULT '' COMMENT '广告主域名（adomain）',
+    status      VARCHAR(16)  NOT NULL DEFAULT 'active' COMMENT 'active, paused',
+    start_time  DATETIME     NULL COMMENT '为空表示不限',
+    end_time    DATETIME     NULL COMMENT '不含，为空表示不限',
+    timezone    VARCHAR(64)  NOT NULL DEFAULT '' COMMENT '分时段投放的时区（IANA名称），为空时为服务器时区',
+    disable_bid_shading TINYINT(1) NOT NULL DEFAULT 0 COMMENT '1表示不做出价折减',
+    frequency_caps JSON      NULL COMMENT '频次上限，如 [{"max": 3, "window": "day"}]',
+    updated_at  TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3)
+);
+
+CREATE TABLE IF NOT EXISTS line_items (
+    id          VARCHAR(64)    NOT NULL PRIMARY KEY,
+    campaign_id VARCHAR(64)    NOT NULL,
+    name        VARCHAR(255)   NOT NULL DEFAULT '',
+    status      VARCHAR(16)    NOT NULL DEFAULT 'active',
+    bid_type    VARCHAR(8)     NOT NULL DEFAULT 'cpm' COMMENT 'cpm, cpc, cpa',
+    bid_price   DECIMAL(18, 6) NOT NULL COMMENT '按bid_type的出价（元）',
+    start_time  DATETIME       NULL,
+    end_time    DATETIME       NULL,
+    targeting   JSON           NULL COMMENT '定向条件，格式与广告库文件中的targeting相同',
+    dayparting  JSON           NULL COMMENT '分时段投放，格式与广告库文件中的dayparting相同，为空表示全天',
+    rotation    JSON           NULL COMMENT '创意轮播，格式与广告库文件中的rotation相同，为空表示等权随机',
+    updated_at  TIMESTAMP(3)   NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    KEY idx_campaign (campaign_id)
+);
+
+CREATE TABLE IF NOT EXISTS creatives (
+    id          VARCHAR(64)  NOT NULL PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL DEFAULT '',
+    status      VARCHAR(16)  NOT NULL DEFAULT 'active',
+    format      VARCHAR(16)  NOT NULL COMMENT 'banner, video, native',
+    w           INT          NOT NULL DEFAULT 0,
+    h           INT          NOT NULL DEFAULT 0,
+    duration    INT          NOT NULL DEFAULT 0 COMMENT '视频时长（秒）',
+    adm         TEXT         NOT NULL,
+    frequency_caps JSON      NULL,
+    updated_at  TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3)
+);
+
+CREATE TABLE IF NOT EXISTS line_item_creatives (
+    line_item_id VARCHAR(64)  NOT NULL,
+    creative_id  VARCHAR(64)  NOT NULL,
+    position     INT          NOT NULL DEFAULT 0 COMMENT '创意顺序，顺序播放时按此顺序',
+    updated_at   TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    PRIMARY KEY (line_item_id, creative_id)
+);
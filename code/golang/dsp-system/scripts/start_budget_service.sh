@@ -9,7 +9,7 @@ echo "启动 Budget gRPC Service"
 echo "========================================="
 
 # 编译
-go build -o build/budget_service grpc_server/budget_service.go
+go build -o build/budget_service ./grpc_server/budget
 
 # 运行
 ./build/budget_service
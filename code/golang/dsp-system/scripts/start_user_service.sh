@@ -9,7 +9,7 @@ echo "启动 User gRPC Service"
 echo "========================================="
 
 # 编译
-go build -o build/user_service grpc_server/user_service.go
+go build -o build/user_service ./grpc_server/user
 
 # 运行
 ./build/user_service
@@ -3,56 +3,104 @@ package service
 import (
 	"context"
 	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/frequency"
+	"dsp-system/money"
+	"dsp-system/predict"
+	"dsp-system/rotation"
 	"dsp-system/rpc"
+	"dsp-system/targeting"
 	"log"
-	"math/rand"
+	"slices"
+	"time"
 )
 
 // AdCandidate 广告候选
 type AdCandidate struct {
-	AdID        string
-	ImpID       string
-	CampaignID  string
-	CreativeID  string
-	BidPrice    float64
-	Creative    string
-	Domain      string
-	Width       int
-	Height      int
-	TargetTags  []string
-	Score       float64
+	AdID       string
+	ImpID      string
+	CampaignID string
+	LineItemID string
+	CreativeID string
+	BidType    string // 投放单元的出价方式：cpm、cpc、cpa
+	// BidPrice 出价（微单位）：打分前为投放单元按BidType的出价，打分后为CPM出价（eCPM）
+	BidPrice   money.Micros
+	Creative   string
+	Format     string // 创意形式：banner、video、native
+	Domain     string
+	Width      int
+	Height     int
+	TargetTags []string
+	// IncludeSegments 定向人群，用户属于其中任一人群才投放；为空表示不限
+	IncludeSegments []string
+	// ExcludeSegments 排除人群，用户属于其中任一人群则不投放
+	ExcludeSegments []string
+	// Rule 定向规则，nil表示不限
+	Rule *targeting.Rule
+	// FrequencyCaps 创意、活动和广告主的频次上限
+	FrequencyCaps []frequency.Cap
+	// Rotation 投放单元的创意轮播方式
+	Rotation *rotation.Policy
+	// Progress 活动时区当天的投放进度（0到1），匀速投放按日预算乘以进度控制消耗
+	Progress float64
+	// Location 活动时区，匀速投放按这个时区的日期判断日消耗是否属于当天
+	Location *time.Location
+	// DisableBidShading 活动不做出价折减
+	DisableBidShading bool
+	PCTR              float64 // 预估点击率，没有模型时为0
+	PCVR              float64 // 预估点击后转化率，没有转化率模型时为0
+	Score             float64 // eCPM（元）
 }
 
 // AdSelector 广告选择服务
 type AdSelector struct {
-	// 这里可以注入广告库、规则引擎等
+	campaigns *campaign.Repository
+	frequency *frequency.Limiter
+	rotation  *rotation.Rotator
+	predictor *predict.Predictor
 }
 
-// NewAdSelector 创建广告选择服务
-func NewAdSelector() *AdSelector {
-	return &AdSelector{}
+// NewAdSelector 创建广告选择服务，limiter为nil时不做频次控制，
+// rotator为nil时不做创意轮播（投放单元的全部创意都参与排序），
+// predictor为nil时不预估点击率和转化率（只有按CPM出价的广告参与竞价）
+func NewAdSelector(campaigns *campaign.Repository, limiter *frequency.Limiter, rotator *rotation.Rotator, predictor *predict.Predictor) *AdSelector {
+	return &AdSelector{campaigns: campaigns, frequency: limiter, rotation: rotator, predictor: predictor}
 }
 
 // SelectAds 选择匹配的广告
 func (s *AdSelector) SelectAds(ctx context.Context, req *api.BidRequest, userProfile *rpc.UserProfile) []AdCandidate {
 	var candidates []AdCandidate
 
+	// 整个请求使用同一个快照，广告库重新加载不影响进行中的请求
+	catalog := s.campaigns.Catalog()
+	now := time.Now()
+	env := s.targetingEnv(req, userProfile, now)
+
 	// 遍历每个广告位
 	for _, imp := range req.Imp {
-		// 1. 根据广告位类型筛选广告
-		ads := s.getAdsByImp(&imp)
+		// 1. 根据广告位类型、投放时间和定向索引筛选广告
+		ads := s.getAdsByImp(catalog, &imp, env, req.Test == 1, now)
 
-		// 2. 根据用户标签匹配广告
-		matchedAds := s.matchAdsByUserTags(ads, userProfile)
+		// 2. 根据定向规则过滤广告
+		ads = s.filterAdsByRule(ads, env, req.Test == 1)
 
-		// 3. 计算广告得分
-		for _, ad := range matchedAds {
-			ad.Score = s.calculateAdScore(ad, userProfile, &imp)
-			candidates = append(candidates, ad)
-		}
+		// 3. 根据人群定向过滤广告
+		ads = s.filterAdsBySegments(ads, userProfile)
+
+		// 4. 根据用户标签匹配广告
+		candidates = append(candidates, s.matchAdsByUserTags(ads, userProfile)...)
 	}
 
-	// 4. 排序（按得分降序）
+	// 5. 频次控制，所有广告位的候选一起查询
+	candidates = s.filterAdsByFrequency(ctx, candidates, userProfile, now)
+
+	// 6. 创意轮播，每个广告位上同一投放单元只保留一个创意
+	candidates = s.selectCreatives(ctx, candidates, userProfile)
+
+	// 7. 预估点击率和转化率，计算eCPM
+	candidates = s.scoreAds(candidates, req, env, userProfile)
+
+	// 8. 排序（按eCPM降序）
 	candidates = s.sortAdsByScore(candidates)
 
 	log.Printf("广告选择完成: Total=%d", len(candidates))
@@ -60,53 +108,43 @@ func (s *AdSelector) SelectAds(ctx context.Context, req *api.BidRequest, userPro
 	return candidates
 }
 
-// getAdsByImp 根据广告位获取候选广告
-func (s *AdSelector) getAdsByImp(imp *api.Imp) []AdCandidate {
-	// 实际项目中，这里应该从数据库或缓存中查询
-	// 这里为示例，返回模拟数据
-	
-	mockAds := []AdCandidate{
-		{
-			AdID:       "ad_001",
-			ImpID:      imp.ID,
-			CampaignID: "campaign_001",
-			CreativeID: "creative_001",
-			BidPrice:   5.50,
-			Creative:   "<a href='http://example.com'><img src='http://cdn.example.com/ad1.jpg' /></a>",
-			Domain:     "example.com",
-			TargetTags: []string{"男性", "25-34岁", "运动爱好者"},
-		},
-		{
-			AdID:       "ad_002",
-			ImpID:      imp.ID,
-			CampaignID: "campaign_002",
-			CreativeID: "creative_002",
-			BidPrice:   4.80,
-			Creative:   "<a href='http://shop.com'><img src='http://cdn.shop.com/ad2.jpg' /></a>",
-			Domain:     "shop.com",
-			TargetTags: []string{"女性", "18-24岁", "购物达人"},
-		},
-		{
-			AdID:       "ad_003",
-			ImpID:      imp.ID,
-			CampaignID: "campaign_003",
-			CreativeID: "creative_003",
-			BidPrice:   6.20,
-			Creative:   "<a href='http://tech.com'><img src='http://cdn.tech.com/ad3.jpg' /></a>",
-			Domain:     "tech.com",
-			TargetTags: []string{"科技爱好者", "程序员"},
-		},
-	}
-
-	// 根据广告位尺寸筛选
-	if imp.Banner != nil {
-		for i := range mockAds {
-			mockAds[i].Width = imp.Banner.W
-			mockAds[i].Height = imp.Banner.H
-		}
-	}
-
-	return mockAds
+// getAdsByImp 根据广告位从广告库快照中获取候选广告，用倒排索引预先排除定向一定不满足的广告
+// 测试请求（scan为true）不走索引，以便输出每个广告未命中规则的原因
+func (s *AdSelector) getAdsByImp(catalog *campaign.Catalog, imp *api.Imp, env *targeting.Env, scan bool, now time.Time) []AdCandidate {
+	var ads []*campaign.Ad
+	if scan {
+		ads = catalog.ScanAds(imp, env, now)
+	} else {
+		ads = catalog.Ads(imp, env, now)
+	}
+	candidates := make([]AdCandidate, 0, len(ads))
+	for _, ad := range ads {
+		lineItemTargeting := ad.LineItem.Targeting
+		candidates = append(candidates, AdCandidate{
+			AdID:              ad.ID,
+			ImpID:             imp.ID,
+			CampaignID:        ad.Campaign.ID,
+			LineItemID:        ad.LineItem.ID,
+			CreativeID:        ad.Creative.ID,
+			BidType:           ad.BidType,
+			BidPrice:          ad.BidPrice,
+			Creative:          ad.Creative.AdM,
+			Format:            ad.Creative.Format,
+			Domain:            ad.Campaign.Domain,
+			Width:             ad.Creative.W,
+			Height:            ad.Creative.H,
+			TargetTags:        lineItemTargeting.Tags,
+			IncludeSegments:   lineItemTargeting.IncludeSegments,
+			ExcludeSegments:   lineItemTargeting.ExcludeSegments,
+			Rule:              ad.Rule,
+			FrequencyCaps:     ad.FrequencyCaps,
+			Rotation:          ad.Rotation,
+			Progress:          ad.Progress(now),
+			Location:          ad.Location(),
+			DisableBidShading: ad.Campaign.DisableBidShading,
+		})
+	}
+	return candidates
 }
 
 // matchAdsByUserTags 根据用户标签匹配广告
@@ -145,37 +183,252 @@ func (s *AdSelector) matchAdsByUserTags(ads []AdCandidate, userProfile *rpc.User
 	return matched
 }
 
-// calculateAdScore 计算广告得分
-func (s *AdSelector) calculateAdScore(ad AdCandidate, userProfile *rpc.UserProfile, imp *api.Imp) float64 {
-	score := 0.0
+// targetingEnv 构造定向规则的求值环境，整个请求共用
+func (s *AdSelector) targetingEnv(req *api.BidRequest, userProfile *rpc.UserProfile, now time.Time) *targeting.Env {
+	var segments, tags []string
+	if userProfile != nil {
+		segments, tags = userProfile.SegmentIDs, userProfile.Tags
+	}
+	return targeting.NewEnv(req, segments, tags, now)
+}
+
+// filterAdsByRule 根据投放单元的定向规则过滤广告
+// explain为true时（测试请求）输出未命中规则的原因
+func (s *AdSelector) filterAdsByRule(ads []AdCandidate, env *targeting.Env, explain bool) []AdCandidate {
+	var matched []AdCandidate
+	for _, ad := range ads {
+		if ad.Rule.Match(env) {
+			matched = append(matched, ad)
+			continue
+		}
+		if explain {
+			log.Printf("定向规则未命中: AdID=%s, Rule=%s\n%s", ad.AdID, ad.Rule, ad.Rule.Explain(env))
+		}
+	}
 
-	// 1. 出价权重（40%）
-	score += ad.BidPrice * 0.4
+	if len(matched) < len(ads) {
+		log.Printf("定向规则过滤: Matched=%d/%d", len(matched), len(ads))
+	}
+
+	return matched
+}
+
+// filterAdsBySegments 根据定向人群和排除人群过滤广告
+// 没有画像时无法确认人群归属，只保留未设置定向人群的广告
+func (s *AdSelector) filterAdsBySegments(ads []AdCandidate, userProfile *rpc.UserProfile) []AdCandidate {
+	var segmentIDs []string
+	if userProfile != nil {
+		segmentIDs = userProfile.SegmentIDs
+	}
+	userSegments := make(map[string]bool, len(segmentIDs))
+	for _, segmentID := range segmentIDs {
+		userSegments[segmentID] = true
+	}
 
-	// 2. 标签匹配度（30%）
-	if userProfile != nil && len(userProfile.Tags) > 0 {
-		userTagsMap := make(map[string]bool)
-		for _, tag := range userProfile.Tags {
-			userTagsMap[tag] = true
+	inAny := func(segmentIDs []string) bool {
+		for _, segmentID := range segmentIDs {
+			if userSegments[segmentID] {
+				return true
+			}
 		}
+		return false
+	}
 
-		matchCount := 0
-		for _, targetTag := range ad.TargetTags {
-			if userTagsMap[targetTag] {
-				matchCount++
+	var matched []AdCandidate
+	for _, ad := range ads {
+		if len(ad.IncludeSegments) > 0 && !inAny(ad.IncludeSegments) {
+			continue
+		}
+		if inAny(ad.ExcludeSegments) {
+			continue
+		}
+		matched = append(matched, ad)
+	}
+
+	if len(matched) < len(ads) {
+		log.Printf("人群过滤: UserSegments=%v, Matched=%d/%d", segmentIDs, len(matched), len(ads))
+	}
+
+	return matched
+}
+
+// filterAdsByFrequency 过滤用户已达到频次上限的广告，一次Redis往返查询全部计数
+// 没有用户ID时无法计数，只保留未设置频次上限的广告；查询失败时不过滤
+func (s *AdSelector) filterAdsByFrequency(ctx context.Context, ads []AdCandidate, userProfile *rpc.UserProfile, now time.Time) []AdCandidate {
+	if s.frequency == nil {
+		return ads
+	}
+	var caps []frequency.Cap
+	for _, ad := range ads {
+		caps = append(caps, ad.FrequencyCaps...)
+	}
+	if len(caps) == 0 {
+		return ads
+	}
+
+	var exceeded map[frequency.Cap]bool
+	if userID := frequencyUserID(userProfile); userID != "" {
+		var err error
+		if exceeded, err = s.frequency.Exceeded(ctx, userID, caps, now); err != nil {
+			log.Printf("频次控制查询失败，不过滤: %v", err)
+			return ads
+		}
+	}
+
+	var matched []AdCandidate
+	for _, ad := range ads {
+		capped := false
+		for _, c := range ad.FrequencyCaps {
+			if exceeded == nil || exceeded[c] {
+				capped = true
+				break
 			}
 		}
+		if !capped {
+			matched = append(matched, ad)
+		}
+	}
+
+	if len(matched) < len(ads) {
+		log.Printf("频次控制过滤: Matched=%d/%d", len(matched), len(ads))
+	}
+
+	return matched
+}
+
+// selectCreatives 按投放单元的轮播方式为每个广告位上的每个投放单元选择一个创意，
+// 需要的轮播状态一次读取；投放单元都只有一个候选创意时不读取
+func (s *AdSelector) selectCreatives(ctx context.Context, ads []AdCandidate, userProfile *rpc.UserProfile) []AdCandidate {
+	if s.rotation == nil {
+		return ads
+	}
+
+	type groupKey struct {
+		impID      string
+		lineItemID string
+	}
+	index := make(map[groupKey]int)
+	var groups []rotation.Group
+	var members [][]int // 每组候选在ads中的下标
+	for i, ad := range ads {
+		key := groupKey{ad.ImpID, ad.LineItemID}
+		g, ok := index[key]
+		if !ok {
+			g = len(groups)
+			index[key] = g
+			groups = append(groups, rotation.Group{Policy: ad.Rotation})
+			members = append(members, nil)
+		}
+		groups[g].Creatives = append(groups[g].Creatives, ad.CreativeID)
+		members[g] = append(members[g], i)
+	}
+	if len(groups) == len(ads) {
+		return ads
+	}
 
-		if len(ad.TargetTags) > 0 {
-			matchRate := float64(matchCount) / float64(len(ad.TargetTags))
-			score += matchRate * 3.0 // 3.0是标签匹配的基础分
+	keep := make([]bool, len(ads))
+	for g, chosen := range s.rotation.Select(ctx, frequencyUserID(userProfile), groups) {
+		keep[members[g][chosen]] = true
+	}
+	var selected []AdCandidate
+	for i, ad := range ads {
+		if keep[i] {
+			selected = append(selected, ad)
 		}
 	}
 
-	// 3. 随机因子（10%）- 避免总是返回相同广告
-	score += rand.Float64() * 1.0
+	log.Printf("创意轮播: Selected=%d/%d", len(selected), len(ads))
+
+	return selected
+}
 
-	return score
+// frequencyUserID 频次控制和创意顺序播放按人记录，优先使用跨设备合并后的人ID
+func frequencyUserID(userProfile *rpc.UserProfile) string {
+	if userProfile == nil {
+		return ""
+	}
+	if userProfile.PersonID != "" {
+		return userProfile.PersonID
+	}
+	return userProfile.UserID
+}
+
+// scoreAds 用预估模型计算每个广告的eCPM作为得分，整个请求使用同一个模型版本
+// 按点击出价的eCPM为出价×pCTR×1000，按转化出价的为出价×pCTR×pCVR×1000，换算后作为CPM出价；
+// 没有模型（或没有转化率模型）时无法换算的广告不参与竞价。测试请求输出每个广告的预估值
+func (s *AdSelector) scoreAds(ads []AdCandidate, req *api.BidRequest, env *targeting.Env, userProfile *rpc.UserProfile) []AdCandidate {
+	model := s.predictor.Model()
+	version := "无"
+	if model != nil {
+		version = model.Version
+	}
+	base := make(map[string]predict.Features, len(req.Imp))
+
+	var scored []AdCandidate
+	for _, ad := range ads {
+		if (ad.BidType == campaign.BidTypeCPC && model == nil) || (ad.BidType == campaign.BidTypeCPA && !model.HasCVR()) {
+			log.Printf("没有预估模型，无法按%s出价: AdID=%s", ad.BidType, ad.AdID)
+			continue
+		}
+
+		if model != nil {
+			features, ok := base[ad.ImpID]
+			if !ok {
+				features = predict.RequestFeatures(env, impByID(req, ad.ImpID), userProfile)
+				base[ad.ImpID] = features
+			}
+			prediction := model.Predict(predict.AdFeatures(features, predict.Ad{
+				CampaignID: ad.CampaignID,
+				LineItemID: ad.LineItemID,
+				CreativeID: ad.CreativeID,
+				W:          ad.Width,
+				H:          ad.Height,
+				TagMatch:   tagMatchRate(ad, userProfile),
+			}))
+			ad.PCTR, ad.PCVR = prediction.CTR, prediction.CVR
+		}
+
+		switch ad.BidType {
+		case campaign.BidTypeCPC:
+			ad.BidPrice = money.FromFloat(ad.BidPrice.Float() * ad.PCTR * 1000)
+		case campaign.BidTypeCPA:
+			ad.BidPrice = money.FromFloat(ad.BidPrice.Float() * ad.PCTR * ad.PCVR * 1000)
+		}
+		if ad.BidPrice <= 0 {
+			continue
+		}
+		ad.Score = ad.BidPrice.Float()
+
+		if req.Test == 1 {
+			log.Printf("预估: AdID=%s, Model=%s, pCTR=%.5f, pCVR=%.5f, eCPM=%s", ad.AdID, version, ad.PCTR, ad.PCVR, ad.BidPrice)
+		}
+		scored = append(scored, ad)
+	}
+	return scored
+}
+
+// impByID 按ID查找广告位，候选广告都来自请求中的广告位
+func impByID(req *api.BidRequest, impID string) *api.Imp {
+	for i := range req.Imp {
+		if req.Imp[i].ID == impID {
+			return &req.Imp[i]
+		}
+	}
+	return &api.Imp{ID: impID}
+}
+
+// tagMatchRate 投放单元定向标签中用户命中的比例
+func tagMatchRate(ad AdCandidate, userProfile *rpc.UserProfile) float64 {
+	if userProfile == nil || len(ad.TargetTags) == 0 {
+		return 0
+	}
+	matchCount := 0
+	for _, targetTag := range ad.TargetTags {
+		if slices.Contains(userProfile.Tags, targetTag) {
+			matchCount++
+		}
+	}
+	return float64(matchCount) / float64(len(ad.TargetTags))
 }
 
 // sortAdsByScore 按得分排序（降序）
@@ -191,4 +444,3 @@ func (s *AdSelector) sortAdsByScore(candidates []AdCandidate) []AdCandidate {
 	}
 	return candidates
 }
-
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"context"
+	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/config"
+	"dsp-system/frequency"
+	"dsp-system/predict"
+	"dsp-system/repository"
+	"dsp-system/rotation"
+	"dsp-system/rpc"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestSelectAdsFromRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaigns.json")
+	os.WriteFile(path, []byte(`{
+		"campaigns": [{"id": "c1", "domain": "a.com"}, {"id": "c2", "domain": "b.com"}],
+		"line_items": [
+			{"id": "li1", "campaign_id": "c1", "bid_price": "5.5", "targeting": {"tags": ["运动爱好者"]}, "creative_ids": ["cr1"]},
+			{"id": "li2", "campaign_id": "c2", "bid_price": "4", "targeting": {"exclude_segments": ["s1"]}, "creative_ids": ["cr1"]},
+			{"id": "li3", "campaign_id": "c2", "bid_price": "3", "targeting": {"rule": "device.os == 'iOS' and user.segment in ('s1')"}, "creative_ids": ["cr2"]}
+		],
+		"creatives": [
+			{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"},
+			{"id": "cr2", "format": "banner", "w": 300, "h": 250, "adm": "<a/>"}
+		]
+	}`), 0o644)
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	selector := NewAdSelector(repo, nil, nil, nil)
+	req := &api.BidRequest{Imp: []api.Imp{
+		{ID: "imp1", Banner: &api.Banner{W: 728, H: 90}},
+		{ID: "imp2", Banner: &api.Banner{W: 300, H: 250}},
+	}}
+	profile := &rpc.UserProfile{Tags: []string{"运动爱好者"}, SegmentIDs: []string{"s1"}}
+
+	candidates := selector.SelectAds(context.Background(), req, profile)
+	if len(candidates) != 1 {
+		t.Fatalf("应只有li1匹配，实际为%+v", candidates)
+	}
+	got := candidates[0]
+	if got.AdID != "li1:cr1" || got.ImpID != "imp1" || got.CampaignID != "c1" || got.LineItemID != "li1" ||
+		got.CreativeID != "cr1" || got.BidPrice != 5_500_000 || got.Domain != "a.com" || got.Width != 728 || got.Creative != "<a/>" {
+		t.Errorf("候选广告字段不正确: %+v", got)
+	}
+
+	// 定向规则：li3只投iOS上s1人群的用户
+	req.Device = &api.Device{OS: "Android"}
+	for _, c := range selector.SelectAds(context.Background(), req, profile) {
+		if c.LineItemID == "li3" {
+			t.Errorf("不满足定向规则的广告不应入选: %+v", c)
+		}
+	}
+	req.Device.OS = "iOS"
+	found := false
+	for _, c := range selector.SelectAds(context.Background(), req, profile) {
+		found = found || c.LineItemID == "li3"
+	}
+	if !found {
+		t.Error("满足定向规则的广告应入选")
+	}
+
+	// 没有广告库时没有候选广告
+	if candidates := NewAdSelector(nil, nil, nil, nil).SelectAds(context.Background(), req, profile); len(candidates) != 0 {
+		t.Errorf("没有广告库时不应有候选广告: %+v", candidates)
+	}
+}
+
+func TestSelectAdsFrequencyCap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaigns.json")
+	os.WriteFile(path, []byte(`{
+		"advertisers": [{"id": "adv1", "frequency_caps": [{"max": 2, "window": "7d"}]}],
+		"campaigns": [
+			{"id": "c1", "advertiser": "adv1", "domain": "a.com", "frequency_caps": [{"max": 1, "window": "24h"}]},
+			{"id": "c2", "advertiser": "adv1", "domain": "a.com"},
+			{"id": "c3", "domain": "b.com"}
+		],
+		"line_items": [
+			{"id": "li1", "campaign_id": "c1", "bid_price": "3", "creative_ids": ["cr1"]},
+			{"id": "li2", "campaign_id": "c2", "bid_price": "2", "creative_ids": ["cr1"]},
+			{"id": "li3", "campaign_id": "c3", "bid_price": "1", "creative_ids": ["cr1"]}
+		],
+		"creatives": [{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"}]
+	}`), 0o644)
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	limiter := frequency.NewLimiter(cache)
+	selector := NewAdSelector(repo, limiter, nil, nil)
+
+	ctx := context.Background()
+	req := &api.BidRequest{Imp: []api.Imp{{ID: "imp1", Banner: &api.Banner{W: 728, H: 90}}}}
+	profile := &rpc.UserProfile{UserID: "u1", PersonID: "p1"}
+	selected := func(profile *rpc.UserProfile) []string {
+		var ids []string
+		for _, c := range selector.SelectAds(ctx, req, profile) {
+			ids = append(ids, c.LineItemID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	impression := func(userID, bidID, adID string) {
+		if err := limiter.Record(ctx, userID, bidID, repo.Catalog().Ad(adID).FrequencyCaps, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := selected(profile); !slices.Equal(got, []string{"li1", "li2", "li3"}) {
+		t.Fatalf("未曝光时所有广告都应入选: %v", got)
+	}
+
+	// 活动c1每天1次，同一竞价的重复曝光只计一次
+	impression("p1", "bid_1", "li1:cr1")
+	impression("p1", "bid_1", "li1:cr1")
+	if got := selected(profile); !slices.Equal(got, []string{"li2", "li3"}) {
+		t.Errorf("活动达到上限后不应入选: %v", got)
+	}
+
+	// 广告主每周2次，计入其下所有活动
+	impression("p1", "bid_2", "li2:cr1")
+	if got := selected(profile); !slices.Equal(got, []string{"li3"}) {
+		t.Errorf("广告主达到上限后其活动都不应入选: %v", got)
+	}
+
+	// 按人计数，同一个人的其他设备也受限；其他人不受影响
+	if got := selected(&rpc.UserProfile{UserID: "u2", PersonID: "p1"}); !slices.Equal(got, []string{"li3"}) {
+		t.Errorf("同一个人的其他设备也应受限: %v", got)
+	}
+	if got := selected(&rpc.UserProfile{UserID: "u3"}); len(got) != 3 {
+		t.Errorf("其他用户不应受限: %v", got)
+	}
+
+	// 没有用户ID时无法计数，不投放设置了上限的广告
+	if got := selected(&rpc.UserProfile{}); !slices.Equal(got, []string{"li3"}) {
+		t.Errorf("没有用户ID时只应投放未设置上限的广告: %v", got)
+	}
+
+	// Redis不可用时不过滤
+	mr.Close()
+	if got := selected(profile); len(got) != 3 {
+		t.Errorf("频次查询失败时不应过滤: %v", got)
+	}
+}
+
+func TestSelectAdsCreativeRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "campaigns.json")
+	os.WriteFile(path, []byte(`{
+		"campaigns": [{"id": "c1", "domain": "a.com"}],
+		"line_items": [
+			{"id": "li1", "campaign_id": "c1", "bid_price": "3", "creative_ids": ["cr3", "cr1", "cr2"], "rotation": {"mode": "sequential"}},
+			{"id": "li2", "campaign_id": "c1", "bid_price": "2", "creative_ids": ["cr1", "cr2"], "rotation": {"weights": {"cr2": 2}}}
+		],
+		"creatives": [
+			{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"},
+			{"id": "cr2", "format": "banner", "w": 728, "h": 90, "adm": "<b/>"},
+			{"id": "cr3", "format": "banner", "w": 728, "h": 90, "adm": "<c/>"}
+		]
+	}`), 0o644)
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	rotator := rotation.NewRotator(cache)
+	selector := NewAdSelector(repo, nil, rotator, nil)
+
+	ctx := context.Background()
+	req := &api.BidRequest{Imp: []api.Imp{
+		{ID: "imp1", Banner: &api.Banner{W: 728, H: 90}},
+		{ID: "imp2", Banner: &api.Banner{W: 728, H: 90}},
+	}}
+	profile := &rpc.UserProfile{UserID: "u1", PersonID: "p1"}
+
+	// 每个广告位上每个投放单元只出一个创意
+	candidates := selector.SelectAds(ctx, req, profile)
+	if len(candidates) != 4 {
+		t.Fatalf("两个广告位各应有两个投放单元的一个创意: %+v", candidates)
+	}
+	for _, c := range candidates {
+		if c.LineItemID == "li1" && c.CreativeID != "cr3" {
+			t.Errorf("顺序播放应从第一个创意开始: %s", c.AdID)
+		}
+	}
+
+	// 曝光后同一个人看到下一个创意，其他人仍从头开始
+	sequence := func(profile *rpc.UserProfile) string {
+		for _, c := range selector.SelectAds(ctx, req, profile) {
+			if c.LineItemID == "li1" {
+				return c.CreativeID
+			}
+		}
+		return ""
+	}
+	var seen []string
+	for range 4 {
+		creativeID := sequence(profile)
+		seen = append(seen, creativeID)
+		ad := repo.Catalog().Ad("li1:" + creativeID)
+		if err := rotator.RecordImpression(ctx, "p1", ad.Rotation, ad.Creative.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"cr3", "cr1", "cr2", "cr3"}; !slices.Equal(seen, want) {
+		t.Errorf("应按creative_ids的顺序观看: %v", seen)
+	}
+	if got := sequence(&rpc.UserProfile{UserID: "u2", PersonID: "p1"}); got != "cr1" {
+		t.Errorf("同一个人的其他设备应接着看: %s", got)
+	}
+	if got := sequence(&rpc.UserProfile{UserID: "u3"}); got != "cr3" {
+		t.Errorf("其他人应从第一个创意开始: %s", got)
+	}
+
+	// Redis不可用时仍然选择创意
+	mr.Close()
+	if got := selector.SelectAds(ctx, req, profile); len(got) != 4 {
+		t.Errorf("读取轮播状态失败时仍应每个投放单元出一个创意: %+v", got)
+	}
+}
+
+func TestSelectAdsECPM(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "campaigns.json")
+	os.WriteFile(path, []byte(`{
+		"campaigns": [{"id": "c1", "domain": "a.com"}],
+		"line_items": [
+			{"id": "li1", "campaign_id": "c1", "bid_price": "5", "creative_ids": ["cr1"]},
+			{"id": "li2", "campaign_id": "c1", "bid_type": "cpc", "bid_price": "0.8", "creative_ids": ["cr2"]},
+			{"id": "li3", "campaign_id": "c1", "bid_type": "cpa", "bid_price": "20", "creative_ids": ["cr3"]}
+		],
+		"creatives": [
+			{"id": "cr1", "format": "banner", "w": 728, "h": 90, "adm": "<a/>"},
+			{"id": "cr2", "format": "banner", "w": 728, "h": 90, "adm": "<b/>"},
+			{"id": "cr3", "format": "banner", "w": 728, "h": 90, "adm": "<c/>"}
+		]
+	}`), 0o644)
+	repo, err := campaign.NewRepository([]campaign.Source{campaign.NewFileSource(path)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+
+	ctx := context.Background()
+	req := &api.BidRequest{Imp: []api.Imp{{ID: "imp1", Banner: &api.Banner{W: 728, H: 90}}}}
+	ranked := func(selector *AdSelector) []string {
+		var ids []string
+		for _, c := range selector.SelectAds(ctx, req, &rpc.UserProfile{}) {
+			ids = append(ids, c.LineItemID)
+		}
+		return ids
+	}
+
+	// 没有模型时只有按CPM出价的广告参与竞价
+	if got := ranked(NewAdSelector(repo, nil, nil, nil)); !slices.Equal(got, []string{"li1"}) {
+		t.Errorf("没有模型时只应保留CPM广告: %v", got)
+	}
+
+	// cr2点击率2%：eCPM为0.8×0.02×1000=16元；没有转化率模型时CPA广告不参与
+	logit := func(p float64) float64 { return math.Log(p / (1 - p)) }
+	modelPath := filepath.Join(dir, "model.json")
+	writeModel := func(file predict.File, mod time.Time) {
+		data, _ := json.Marshal(file)
+		os.WriteFile(modelPath, data, 0o644)
+		os.Chtimes(modelPath, mod, mod)
+	}
+	ctr := &predict.Spec{Type: predict.TypeLR, Bias: logit(0.01), Weights: map[string]float64{"creative=cr2": logit(0.02) - logit(0.01)}}
+	writeModel(predict.File{Version: "v1", CTR: ctr}, time.Now().Add(-time.Hour))
+	predictor, err := predict.NewPredictor(modelPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer predictor.Close()
+	selector := NewAdSelector(repo, nil, nil, predictor)
+
+	candidates := selector.SelectAds(ctx, req, &rpc.UserProfile{})
+	if len(candidates) != 2 || candidates[0].LineItemID != "li2" || candidates[1].LineItemID != "li1" {
+		t.Fatalf("应按eCPM排序且不含CPA广告: %+v", candidates)
+	}
+	if got := candidates[0]; got.BidPrice != 16_000_000 || math.Abs(got.PCTR-0.02) > 1e-9 || got.Score != 16 {
+		t.Errorf("CPC广告应换算为eCPM出价: %+v", got)
+	}
+	if got := candidates[1]; got.BidPrice != 5_000_000 || math.Abs(got.PCTR-0.01) > 1e-9 {
+		t.Errorf("CPM广告按原出价: %+v", got)
+	}
+
+	// 切换到带转化率模型的新版本：cr3点击率1%、转化率10%，eCPM为20×0.01×0.1×1000=20元
+	cvr := &predict.Spec{Type: predict.TypeLR, Bias: logit(0.1)}
+	writeModel(predict.File{Version: "v2", CTR: ctr, CVR: cvr}, time.Now())
+	if reloaded, err := predictor.Reload(); err != nil || !reloaded {
+		t.Fatalf("应加载新版本模型: %v, %v", reloaded, err)
+	}
+	if got := ranked(selector); !slices.Equal(got, []string{"li3", "li2", "li1"}) {
+		t.Errorf("新版本模型应立即生效: %v", got)
+	}
+}
@@ -3,11 +3,22 @@ package service
 import (
 	"context"
 	"dsp-system/api"
+	"dsp-system/campaign"
+	"dsp-system/geo"
+	"dsp-system/money"
+	"dsp-system/privacy"
 	"dsp-system/repository"
 	"dsp-system/rpc"
+	"dsp-system/shading"
+	"dsp-system/useragent"
 	"errors"
 	"fmt"
+	"html"
 	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -18,6 +29,13 @@ type BidService struct {
 	budgetClient  *rpc.BudgetClient
 	redisCache    *repository.RedisCache
 	clickhouseRepo *repository.ClickHouseRepo
+	userSync      *UserSyncService
+	privacy       *privacy.Policy
+	dataSegments  *DataSegmentMapper
+	geo           *geo.Resolver
+	ua            *useragent.Parser
+	shader        *shading.Shader
+	pacer         *Pacer
 }
 
 // NewBidService 创建竞价服务
@@ -27,6 +45,13 @@ func NewBidService(
 	budgetClient *rpc.BudgetClient,
 	redisCache *repository.RedisCache,
 	clickhouseRepo *repository.ClickHouseRepo,
+	userSync *UserSyncService,
+	privacyPolicy *privacy.Policy,
+	dataSegments *DataSegmentMapper,
+	geoResolver *geo.Resolver,
+	uaParser *useragent.Parser,
+	shader *shading.Shader,
+	pacer *Pacer,
 ) *BidService {
 	return &BidService{
 		adSelector:    adSelector,
@@ -34,23 +59,55 @@ func NewBidService(
 		budgetClient:  budgetClient,
 		redisCache:    redisCache,
 		clickhouseRepo: clickhouseRepo,
+		userSync:      userSync,
+		privacy:       privacyPolicy,
+		dataSegments:  dataSegments,
+		geo:           geoResolver,
+		ua:            uaParser,
+		shader:        shader,
+		pacer:         pacer,
 	}
 }
 
 // ProcessBid 处理竞价请求
-func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.BidResponse, error) {
+// exchange为发来请求的交易平台标识，用于解析Cookie同步得到的BuyerUID，未知时为空
+func (s *BidService) ProcessBid(ctx context.Context, exchange string, req *api.BidRequest) (*api.BidResponse, error) {
 	startTime := time.Now()
 
+	// 未获得同意时不查询画像、不上报标识，日志中的IP和ID做匿名化
+	consent := s.privacy.Evaluate(req)
+	if !consent.AllowPersonalData {
+		log.Printf("不使用个人数据: RequestID=%s, Reason=%s", req.ID, consent.Reason)
+	}
+
+	// 根据IP补全缺失的地理位置，供定向和日志使用；不允许使用个人数据时只补全到国家和地区
+	s.geo.Enrich(req, !consent.AllowPersonalData)
+
+	// 根据UA补全缺失的设备、系统和浏览器信息
+	s.ua.Enrich(req)
+	if req.Device != nil && req.Device.Bot {
+		log.Printf("UA识别为爬虫: RequestID=%s, UA=%s", req.ID, req.Device.UA)
+	}
+
 	// 1. 获取用户标签（并行调用）
 	userProfileChan := make(chan *rpc.UserProfile, 1)
 	go func() {
-		profile, err := s.getUserProfile(ctx, req)
+		if !consent.AllowPersonalData {
+			userProfileChan <- &rpc.UserProfile{Tags: []string{}}
+			return
+		}
+		userID := s.resolveUserID(ctx, exchange, req)
+		go s.observeIdentifiers(req, userID)
+		profile, err := s.getUserProfile(ctx, userID)
 		if err != nil {
 			log.Printf("获取用户画像失败: %v", err)
-			userProfileChan <- nil
-			return
+			profile = &rpc.UserProfile{
+				UserID: userID,
+				Tags:   []string{},
+			}
 		}
-		userProfileChan <- profile
+		// 交易平台带来的第三方数据段补充画像，没见过的用户也能按标签定向
+		userProfileChan <- s.dataSegments.Enrich(profile, req.User)
 	}()
 
 	// 2. 广告位信息解析
@@ -60,12 +117,6 @@ func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.
 
 	// 3. 获取用户画像结果
 	userProfile := <-userProfileChan
-	if userProfile == nil {
-		userProfile = &rpc.UserProfile{
-			UserID: s.extractUserID(req),
-			Tags:   []string{},
-		}
-	}
 
 	log.Printf("用户画像: UserID=%s, Tags=%v", userProfile.UserID, userProfile.Tags)
 
@@ -80,27 +131,50 @@ func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.
 
 	// 6. 预算校验和出价计算
 	var bids []api.Bid
+	var shadingBids []shadingBid
+	firstPrice := req.AT == api.AuctionFirstPrice
 	for _, candidate := range candidates {
+		// 匀速投放：活动当天消耗超过按投放进度应消耗的部分时不出价
+		if !s.pacer.Allow(candidate.CampaignID, candidate.Location, candidate.Progress, startTime) {
+			continue
+		}
+
+		// 第一价格拍卖按赢标概率曲线折减出价
+		price := candidate.BidPrice
+		var key shading.Key
+		if firstPrice {
+			imp := impByID(req, candidate.ImpID)
+			key = shadingKey(exchange, req, imp)
+			price = s.shadeBid(key, imp, candidate)
+		}
+
 		// 检查预算
-		hasBudget, err := s.budgetClient.CheckBudget(ctx, candidate.CampaignID, candidate.BidPrice)
+		budget, err := s.budgetClient.CheckBudgetDetail(ctx, candidate.CampaignID, candidate.LineItemID, price)
 		if err != nil {
 			log.Printf("预算检查失败: %v", err)
 			continue
 		}
 
-		if !hasBudget {
-			log.Printf("预算不足: CampaignID=%s", candidate.CampaignID)
+		if !budget.HasBudget {
+			log.Printf("预算不足: CampaignID=%s, Level=%s", candidate.CampaignID, budget.BlockedLevel)
 			continue
 		}
 
 		// 构建竞价响应
+		bidID := fmt.Sprintf("bid_%s_%d", req.ID, time.Now().UnixNano())
+		// 赢标回调带上提交的出价，扣减预算时成交价不超过出价
+		nurl := noticeURL("win", bidID, candidate, userProfile) + "&bp=" + strconv.FormatInt(int64(price), 10)
+		if firstPrice {
+			// 第一价格拍卖另带折减维度，用于学习赢标概率曲线
+			nurl += "&" + url.Values{"sk": {key.String()}}.Encode()
+			shadingBids = append(shadingBids, shadingBid{key: key, price: price})
+		}
 		bid := api.Bid{
-			ID:         fmt.Sprintf("bid_%s_%d", req.ID, time.Now().UnixNano()),
+			ID:         bidID,
 			ImpID:      candidate.ImpID,
-			Price:      candidate.BidPrice,
 			AdID:       candidate.AdID,
-			AdM:        candidate.Creative,
-			NURL:       fmt.Sprintf("http://dsp.example.com/win?price=${AUCTION_PRICE}"),
+			AdM:        renderAdM(candidate, noticeURL("imp", bidID, candidate, userProfile), noticeURL("click", bidID, candidate, userProfile)),
+			NURL:       nurl + "&price=${AUCTION_PRICE}",
 			BURL:       fmt.Sprintf("http://dsp.example.com/bill?bidid=%s", candidate.AdID),
 			CampaignID: candidate.CampaignID,
 			CreativeID: candidate.CreativeID,
@@ -108,6 +182,7 @@ func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.
 			W:          candidate.Width,
 			H:          candidate.Height,
 		}
+		bid.SetPriceMicros(price)
 
 		bids = append(bids, bid)
 
@@ -123,12 +198,15 @@ func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.
 	}
 
 	// 6. 记录竞价日志（异步）
-	go s.logBidRequest(req, bids, time.Since(startTime))
+	go s.logBidRequest(req, bids, time.Since(startTime), consent.AllowPersonalData)
+	if len(shadingBids) > 0 {
+		go s.recordShadingBids(shadingBids)
+	}
 
 	// 7. 构建响应
 	response := &api.BidResponse{
 		ID:  req.ID,
-		Cur: "CNY",
+		Cur: money.DefaultCurrency,
 		SeatBid: []api.SeatBid{
 			{
 				Bid:  bids,
@@ -143,8 +221,7 @@ func (s *BidService) ProcessBid(ctx context.Context, req *api.BidRequest) (*api.
 }
 
 // getUserProfile 获取用户画像
-func (s *BidService) getUserProfile(ctx context.Context, req *api.BidRequest) (*rpc.UserProfile, error) {
-	userID := s.extractUserID(req)
+func (s *BidService) getUserProfile(ctx context.Context, userID string) (*rpc.UserProfile, error) {
 	if userID == "" {
 		return nil, errors.New("no user id found")
 	}
@@ -167,6 +244,17 @@ func (s *BidService) getUserProfile(ctx context.Context, req *api.BidRequest) (*
 	return profile, nil
 }
 
+// resolveUserID 解析用户ID
+// 优先使用Cookie同步映射到的本方用户ID，这样同一浏览器在不同交易平台的请求落到同一个画像
+func (s *BidService) resolveUserID(ctx context.Context, exchange string, req *api.BidRequest) string {
+	if s.userSync != nil && req.User != nil && req.User.BuyerUID != "" {
+		if dspUID := s.userSync.ResolveBuyerUID(ctx, exchange, req.User.BuyerUID); dspUID != "" {
+			return dspUID
+		}
+	}
+	return s.extractUserID(req)
+}
+
 // extractUserID 提取用户ID
 func (s *BidService) extractUserID(req *api.BidRequest) string {
 	if req.User != nil && req.User.ID != "" {
@@ -178,15 +266,135 @@ func (s *BidService) extractUserID(req *api.BidRequest) string {
 	if req.Device != nil && req.Device.DIDSHA1 != "" {
 		return req.Device.DIDSHA1
 	}
+	// 未同步过的BuyerUID只在该交易平台内稳定，作为最后的选择
+	if req.User != nil && req.User.BuyerUID != "" {
+		return req.User.BuyerUID
+	}
 	return ""
 }
 
+// observeIdentifiers 上报请求中同时出现的用户标识，供用户服务做跨设备关联
+// userID为解析后的用户ID（可能是Cookie同步得到的本方ID）
+func (s *BidService) observeIdentifiers(req *api.BidRequest, userID string) {
+	identifiers := []string{userID}
+	if req.User != nil {
+		identifiers = append(identifiers, req.User.ID)
+	}
+	if req.Device != nil {
+		identifiers = append(identifiers, req.Device.IFA, req.Device.DIDSHA1)
+	}
+
+	var distinct []string
+	for _, identifier := range identifiers {
+		if identifier != "" && !slices.Contains(distinct, identifier) {
+			distinct = append(distinct, identifier)
+		}
+	}
+	if len(distinct) < 2 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.userClient.ObserveIdentifiers(ctx, distinct)
+}
+
+// noticeURL 赢标、曝光、点击回调地址，带上广告ID，带上用户ID供回调记录用户行为和曝光频次
+// 人ID与用户ID不同时另带pid，频次按人计数；不允许使用个人数据时画像没有用户ID，回调地址中也不带
+func noticeURL(event, bidID string, candidate AdCandidate, userProfile *rpc.UserProfile) string {
+	params := url.Values{}
+	params.Set("bidid", bidID)
+	params.Set("adid", candidate.AdID)
+	if userProfile.UserID != "" {
+		params.Set("uid", userProfile.UserID)
+	}
+	if userProfile.PersonID != "" && userProfile.PersonID != userProfile.UserID {
+		params.Set("pid", userProfile.PersonID)
+	}
+	return "http://dsp.example.com/" + event + "?" + params.Encode()
+}
+
+// 创意中的回调宏，竞价时替换为本次出价的曝光和点击回调地址（原样替换，不做转义）
+// 视频创意放在VAST的<Impression>和<ClickTracking>中，原生创意放在imptrackers和link.clicktrackers中，
+// banner创意在点击时请求${DSP_CLICK_URL}
+const (
+	MacroImpURL   = "${DSP_IMP_URL}"
+	MacroClickURL = "${DSP_CLICK_URL}"
+)
+
+// renderAdM 替换创意中的回调宏；banner创意没有曝光宏时在末尾追加1x1曝光像素，
+// 保证曝光回调到达，频次控制、用户行为和创意轮播才能按实际曝光计数
+func renderAdM(candidate AdCandidate, impURL, clickURL string) string {
+	adm := candidate.Creative
+	if candidate.Format == campaign.FormatBanner && !strings.Contains(adm, MacroImpURL) {
+		adm += `<img src="` + html.EscapeString(impURL) + `" width="1" height="1" style="display:none" alt="" />`
+	}
+	return strings.NewReplacer(MacroImpURL, impURL, MacroClickURL, clickURL).Replace(adm)
+}
+
 // logBidRequest 记录竞价日志
-func (s *BidService) logBidRequest(req *api.BidRequest, bids []api.Bid, duration time.Duration) {
-	err := s.clickhouseRepo.LogBidRequest(context.Background(), req, bids, duration)
+func (s *BidService) logBidRequest(req *api.BidRequest, bids []api.Bid, duration time.Duration, personalData bool) {
+	err := s.clickhouseRepo.LogBidRequest(context.Background(), req, bids, duration, personalData)
 	if err != nil {
 		log.Printf("记录竞价日志失败: %v", err)
 	}
 }
 
+// shadingBid 第一价格拍卖中提交的一个出价
+type shadingBid struct {
+	key   shading.Key
+	price money.Micros
+}
 
+// shadingKey 出价折减的维度：交易平台、媒体（没有媒体ID时用网站域名或APP包名）和广告位尺寸
+func shadingKey(exchange string, req *api.BidRequest, imp *api.Imp) shading.Key {
+	key := shading.Key{Exchange: exchange}
+	switch {
+	case req.Site != nil && req.Site.Publisher != nil && req.Site.Publisher.ID != "":
+		key.Publisher = req.Site.Publisher.ID
+	case req.Site != nil:
+		key.Publisher = req.Site.Domain
+	case req.App != nil && req.App.Publisher != nil && req.App.Publisher.ID != "":
+		key.Publisher = req.App.Publisher.ID
+	case req.App != nil:
+		key.Publisher = req.App.Bundle
+	}
+	switch {
+	case imp.Banner != nil:
+		key.Size = fmt.Sprintf("%dx%d", imp.Banner.W, imp.Banner.H)
+	case imp.Video != nil:
+		key.Size = "video"
+	case imp.Native != nil:
+		key.Size = "native"
+	}
+	return key
+}
+
+// shadeBid 第一价格拍卖中折减后的出价，活动关闭了出价折减时按出价上限出价
+// 底价不是本方货币时无法保证不低于底价，也不折减
+func (s *BidService) shadeBid(key shading.Key, imp *api.Imp, candidate AdCandidate) money.Micros {
+	if s.shader == nil || candidate.DisableBidShading {
+		return candidate.BidPrice
+	}
+	if imp.BidFloorCur != "" && imp.BidFloorCur != money.DefaultCurrency {
+		return candidate.BidPrice
+	}
+	price, shaded := s.shader.Shade(key, candidate.BidPrice, imp.BidFloorMicros())
+	if shaded {
+		log.Printf("出价折减: AdID=%s, Key=%s, %s -> %s", candidate.AdID, key, candidate.BidPrice, price)
+	}
+	return price
+}
+
+// recordShadingBids 记录第一价格拍卖中的出价，赢标在赢标回调中记录
+func (s *BidService) recordShadingBids(bids []shadingBid) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	now := time.Now()
+	for _, b := range bids {
+		if err := s.shader.RecordBid(ctx, b.key, b.price, now); err != nil {
+			log.Printf("记录出价失败: Key=%s, %v", b.key, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"dsp-system/api"
+	"dsp-system/config"
+	"dsp-system/money"
+	"dsp-system/repository"
+	"dsp-system/shading"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestShadingKey(t *testing.T) {
+	tests := []struct {
+		req  *api.BidRequest
+		imp  *api.Imp
+		want string
+	}{
+		{&api.BidRequest{Site: &api.Site{Domain: "a.com", Publisher: &api.Publisher{ID: "pub1"}}}, &api.Imp{Banner: &api.Banner{W: 300, H: 250}}, "adx|pub1|300x250"},
+		{&api.BidRequest{Site: &api.Site{Domain: "a.com"}}, &api.Imp{Video: &api.Video{}}, "adx|a.com|video"},
+		{&api.BidRequest{App: &api.App{Bundle: "com.example.news"}}, &api.Imp{Native: &api.Native{}}, "adx|com.example.news|native"},
+	}
+	for _, tt := range tests {
+		if got := shadingKey("adx", tt.req, tt.imp).String(); got != tt.want {
+			t.Errorf("折减维度应为%s，实际为%s", tt.want, got)
+		}
+	}
+}
+
+func TestShadeBid(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+	shader := shading.NewShader(cache, shading.Config{MinFactor: 0.5, MinSamples: 100, Window: 7})
+	defer shader.Close()
+
+	// 出价10元从不赢标、5元以上总是赢标：应折减到接近5元
+	ctx := context.Background()
+	now := time.Now()
+	key := shading.Key{Exchange: "adx", Publisher: "pub1", Size: "300x250"}
+	for _, price := range []float64{3, 5, 7, 10} {
+		for i := range 50 {
+			shader.RecordBid(ctx, key, money.FromFloat(price), now)
+			if price >= 5 {
+				shader.RecordWin(ctx, key, fmt.Sprintf("b%v_%d", price, i), money.FromFloat(price), now)
+			}
+		}
+	}
+	if err := shader.Refresh(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &BidService{shader: shader}
+	candidate := AdCandidate{AdID: "li1:cr1", ImpID: "imp1", BidPrice: money.FromFloat(10)}
+	imp := &api.Imp{ID: "imp1", BidFloor: 4}
+	price := s.shadeBid(key, imp, candidate)
+	if price >= candidate.BidPrice || price.Float() < 5 || price.Float() > 6 {
+		t.Errorf("应折减到5元左右: %s", price)
+	}
+
+	optOut := candidate
+	optOut.DisableBidShading = true
+	if price := s.shadeBid(key, imp, optOut); price != candidate.BidPrice {
+		t.Errorf("活动关闭出价折减时应按上限出价: %s", price)
+	}
+	if price := s.shadeBid(key, &api.Imp{ID: "imp1", BidFloor: 1, BidFloorCur: "USD"}, candidate); price != candidate.BidPrice {
+		t.Errorf("底价货币不同时不应折减: %s", price)
+	}
+	if price := (&BidService{}).shadeBid(key, imp, candidate); price != candidate.BidPrice {
+		t.Errorf("没有折减器时应按上限出价: %s", price)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"dsp-system/api"
+	"dsp-system/rpc"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+)
+
+// DataSegmentTarget 第三方数据段对应的本方标签
+type DataSegmentTarget struct {
+	Tags      []string `json:"tags,omitempty"`
+	Interests []string `json:"interests,omitempty"`
+	Gender    string   `json:"gender,omitempty"` // male, female；为空表示该数据段不含性别信息
+}
+
+// DataSegmentProvider 一个数据提供商的数据段映射
+// 按 User.Data.ID 匹配，ID为空或未配置时按 User.Data.Name 匹配
+type DataSegmentProvider struct {
+	ID       string                       `json:"id"`
+	Name     string                       `json:"name"`
+	Segments map[string]DataSegmentTarget `json:"segments"` // 段ID -> 标签
+}
+
+// DataSegmentMapping 数据段映射配置，提供商按可信度从高到低排列
+type DataSegmentMapping struct {
+	Providers []DataSegmentProvider `json:"providers"`
+}
+
+// DataSegmentMapper 把竞价请求中的第三方数据段映射到本方标签体系，并合并进用户画像
+//
+// 合并规则：
+//   - 本方画像优先：性别只在画像未知时由数据段补充，已有的值不会被覆盖
+//   - 多个提供商给出不同性别时，取配置中排在前面的提供商
+//   - 标签和兴趣取并集，本方画像的在前
+type DataSegmentMapper struct {
+	providers []DataSegmentProvider
+	byID      map[string]int
+	byName    map[string]int
+}
+
+// NewDataSegmentMapper 创建数据段映射
+func NewDataSegmentMapper(mapping DataSegmentMapping) *DataSegmentMapper {
+	m := &DataSegmentMapper{
+		providers: mapping.Providers,
+		byID:      make(map[string]int),
+		byName:    make(map[string]int),
+	}
+	for i, provider := range mapping.Providers {
+		if _, exists := m.byID[provider.ID]; provider.ID != "" && !exists {
+			m.byID[provider.ID] = i
+		}
+		if _, exists := m.byName[provider.Name]; provider.Name != "" && !exists {
+			m.byName[provider.Name] = i
+		}
+	}
+	return m
+}
+
+// LoadDataSegmentMapper 从JSON文件加载数据段映射，格式为
+// {"providers": [{"id": "1", "name": "acme", "segments": {"s1": {"tags": ["运动爱好者"], "gender": "male"}}}]}
+func LoadDataSegmentMapper(path string) (*DataSegmentMapper, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var mapping DataSegmentMapping
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("解析数据段映射文件失败: %w", err)
+	}
+	for i, provider := range mapping.Providers {
+		if provider.ID == "" && provider.Name == "" {
+			return nil, fmt.Errorf("第%d个数据提供商缺少id和name", i+1)
+		}
+	}
+	return NewDataSegmentMapper(mapping), nil
+}
+
+// provider 查找数据提供商在配置中的位置
+func (m *DataSegmentMapper) provider(data *api.Data) (int, bool) {
+	if i, ok := m.byID[data.ID]; ok && data.ID != "" {
+		return i, true
+	}
+	if i, ok := m.byName[data.Name]; ok && data.Name != "" {
+		return i, true
+	}
+	return 0, false
+}
+
+// Enrich 合并请求中的第三方数据段，返回新的画像，不修改传入的画像（可能来自缓存）
+// 没有可识别的数据段时原样返回
+func (m *DataSegmentMapper) Enrich(profile *rpc.UserProfile, user *api.User) *rpc.UserProfile {
+	if m == nil || user == nil || len(user.Data) == 0 {
+		return profile
+	}
+
+	// 按提供商优先级收集命中的数据段
+	matched := make([][]DataSegmentTarget, len(m.providers))
+	count := 0
+	for i := range user.Data {
+		idx, ok := m.provider(&user.Data[i])
+		if !ok {
+			continue
+		}
+		for _, segment := range user.Data[i].Segment {
+			if target, ok := m.providers[idx].Segments[segment.ID]; ok {
+				matched[idx] = append(matched[idx], target)
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return profile
+	}
+
+	enriched := *profile
+	enriched.Tags = slices.Clone(profile.Tags)
+	enriched.Interests = slices.Clone(profile.Interests)
+	for _, targets := range matched {
+		for _, target := range targets {
+			enriched.Tags = appendMissing(enriched.Tags, target.Tags...)
+			enriched.Interests = appendMissing(enriched.Interests, target.Interests...)
+			if (enriched.Gender == "" || enriched.Gender == "unknown") && target.Gender != "" {
+				enriched.Gender = target.Gender
+			}
+		}
+	}
+
+	log.Printf("第三方数据段补充画像: UserID=%s, Segments=%d, Tags=%d->%d",
+		profile.UserID, count, len(profile.Tags), len(enriched.Tags))
+	return &enriched
+}
+
+// appendMissing 追加不在切片中的值，保持顺序
+func appendMissing(values []string, add ...string) []string {
+	for _, v := range add {
+		if v != "" && !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
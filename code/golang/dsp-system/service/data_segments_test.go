@@ -0,0 +1,79 @@
+package service
+
+import (
+	"dsp-system/api"
+	"dsp-system/rpc"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func testDataSegmentMapper() *DataSegmentMapper {
+	return NewDataSegmentMapper(DataSegmentMapping{Providers: []DataSegmentProvider{
+		{ID: "1", Name: "acme", Segments: map[string]DataSegmentTarget{
+			"s_sport": {Tags: []string{"运动爱好者"}, Interests: []string{"sports"}},
+			"s_male":  {Tags: []string{"男性"}, Gender: "male"},
+		}},
+		{Name: "other", Segments: map[string]DataSegmentTarget{
+			"f": {Tags: []string{"女性"}, Gender: "female"},
+		}},
+	}})
+}
+
+func TestDataSegmentEnrich(t *testing.T) {
+	m := testDataSegmentMapper()
+
+	// 没见过的用户：数据段补充标签和性别，后面的提供商不覆盖前面的性别
+	unknown := &rpc.UserProfile{UserID: "new", Gender: "unknown", Tags: []string{}}
+	user := &api.User{Data: []api.Data{
+		{Name: "other", Segment: []api.Segment{{ID: "f"}}},
+		{ID: "1", Segment: []api.Segment{{ID: "s_sport"}, {ID: "s_male"}, {ID: "unmapped"}}},
+		{ID: "99", Segment: []api.Segment{{ID: "s_sport"}}},
+	}}
+	got := m.Enrich(unknown, user)
+	if got.Gender != "male" {
+		t.Errorf("性别应取排在前面的提供商，实际为%s", got.Gender)
+	}
+	if !slices.Equal(got.Tags, []string{"运动爱好者", "男性", "女性"}) || !slices.Equal(got.Interests, []string{"sports"}) {
+		t.Errorf("标签或兴趣合并错误: %v %v", got.Tags, got.Interests)
+	}
+	if unknown.Gender != "unknown" || len(unknown.Tags) != 0 {
+		t.Error("不应修改传入的画像")
+	}
+
+	// 本方画像已知的性别不被覆盖，已有标签不重复
+	known := &rpc.UserProfile{UserID: "u1", Gender: "female", Tags: []string{"男性", "购物达人"}}
+	got = m.Enrich(known, &api.User{Data: []api.Data{{ID: "1", Segment: []api.Segment{{ID: "s_male"}, {ID: "s_sport"}}}}})
+	if got.Gender != "female" || !slices.Equal(got.Tags, []string{"男性", "购物达人", "运动爱好者"}) {
+		t.Errorf("本方画像应优先: %+v", got)
+	}
+
+	// 没有命中的数据段或未配置映射时原样返回
+	if m.Enrich(known, &api.User{Data: []api.Data{{ID: "99", Segment: []api.Segment{{ID: "x"}}}}}) != known {
+		t.Error("没有命中的数据段时应返回原画像")
+	}
+	var nilMapper *DataSegmentMapper
+	if nilMapper.Enrich(known, user) != known {
+		t.Error("未配置映射时应返回原画像")
+	}
+}
+
+func TestLoadDataSegmentMapper(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "segments.json")
+	os.WriteFile(path, []byte(`{"providers": [{"id": "1", "segments": {"s": {"tags": ["科技爱好者"]}}}]}`), 0o644)
+	m, err := LoadDataSegmentMapper(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := m.Enrich(&rpc.UserProfile{}, &api.User{Data: []api.Data{{ID: "1", Segment: []api.Segment{{ID: "s"}}}}})
+	if !slices.Equal(got.Tags, []string{"科技爱好者"}) {
+		t.Errorf("加载的映射未生效: %v", got.Tags)
+	}
+
+	os.WriteFile(path, []byte(`{"providers": [{"segments": {}}]}`), 0o644)
+	if _, err := LoadDataSegmentMapper(path); err == nil {
+		t.Error("缺少id和name的提供商应返回错误")
+	}
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"dsp-system/money"
+	"dsp-system/rpc"
+	"log"
+	"sync"
+	"time"
+)
+
+// BudgetInfoSource 查询活动预算信息，由rpc.BudgetClient实现
+type BudgetInfoSource interface {
+	GetBudgetInfo(ctx context.Context, campaignID string) (*rpc.BudgetInfo, error)
+}
+
+// DefaultPacingRefresh 默认的预算信息刷新间隔
+const DefaultPacingRefresh = 5 * time.Second
+
+// PacingResetGrace 预算服务每分钟检查一次各活动的日期并清零日消耗，
+// 活动当地午夜后这段时间内查询到的日消耗可能还是前一天的，不用于限制出价
+const PacingResetGrace = 2 * time.Minute
+
+// pacingIdle 活动超过这个时长没有参与竞价时不再刷新其预算信息
+const pacingIdle = 10 * time.Minute
+
+// pacingEntry 缓存的活动预算信息
+type pacingEntry struct {
+	dailyLimit money.Micros
+	dailySpent money.Micros
+	fetchedAt  time.Time // 零值表示尚未查询成功
+	usedAt     time.Time // 最近一次参与竞价
+}
+
+// Pacer 匀速投放：活动当天的消耗超过日预算按投放进度应消耗的部分时，暂停出价直到进度追上
+// 投放进度由广告的分时段投放计划按活动时区决定（见campaign.Ad.Progress），与预算服务清零日消耗的日期一致；
+// 预算信息由后台定期查询，竞价路径只读缓存，不等待RPC。活动第一次参与竞价、查询失败、
+// 缓存的日消耗不属于活动当天或没有日预算时不限制
+type Pacer struct {
+	source  BudgetInfoSource
+	refresh time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*pacingEntry
+
+	wake chan struct{} // 有新活动时提前查询
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewPacer 创建匀速投放控制并启动后台刷新，source为nil时返回nil（不限制）
+// refresh不大于0时使用DefaultPacingRefresh
+func NewPacer(source BudgetInfoSource, refresh time.Duration) *Pacer {
+	p := newPacer(source, refresh)
+	if p != nil {
+		go p.watch()
+	}
+	return p
+}
+
+// newPacer 创建匀速投放控制，不启动后台刷新
+func newPacer(source BudgetInfoSource, refresh time.Duration) *Pacer {
+	if source == nil {
+		return nil
+	}
+	if refresh <= 0 {
+		refresh = DefaultPacingRefresh
+	}
+	return &Pacer{
+		source:  source,
+		refresh: refresh,
+		entries: make(map[string]*pacingEntry),
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// Allow 判断活动当前是否可以继续出价
+// loc为活动时区，progress为广告在活动时区当天的投放进度（0到1）
+func (p *Pacer) Allow(campaignID string, loc *time.Location, progress float64, now time.Time) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	entry, ok := p.entries[campaignID]
+	if !ok {
+		entry = &pacingEntry{}
+		p.entries[campaignID] = entry
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+	entry.usedAt = now
+	cached := *entry
+	p.mu.Unlock()
+
+	if cached.fetchedAt.IsZero() || cached.dailyLimit <= 0 {
+		return true
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	if cached.fetchedAt.Before(midnight.Add(PacingResetGrace)) {
+		return true // 跨过活动当地午夜，等待预算服务清零后的日消耗
+	}
+
+	target := money.FromFloat(cached.dailyLimit.Float() * progress)
+	if cached.dailySpent > target {
+		log.Printf("匀速投放暂停出价: CampaignID=%s, DailySpent=%s, Target=%s, Progress=%.3f",
+			campaignID, cached.dailySpent, target, progress)
+		return false
+	}
+	return true
+}
+
+// Refresh 查询所有参与竞价的活动的预算信息，清理长时间没有参与竞价的活动
+func (p *Pacer) Refresh(ctx context.Context, now time.Time) {
+	p.refreshEntries(ctx, now, false)
+}
+
+// refreshEntries 查询活动的预算信息，onlyNew为true时只查询尚未查询成功的活动
+func (p *Pacer) refreshEntries(ctx context.Context, now time.Time, onlyNew bool) {
+	p.mu.Lock()
+	var campaignIDs []string
+	for campaignID, entry := range p.entries {
+		if now.Sub(entry.usedAt) > pacingIdle {
+			delete(p.entries, campaignID)
+			continue
+		}
+		if !onlyNew || entry.fetchedAt.IsZero() {
+			campaignIDs = append(campaignIDs, campaignID)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, campaignID := range campaignIDs {
+		callCtx, cancel := context.WithTimeout(ctx, time.Second)
+		info, err := p.source.GetBudgetInfo(callCtx, campaignID)
+		cancel()
+
+		p.mu.Lock()
+		if entry := p.entries[campaignID]; entry != nil {
+			if err != nil {
+				entry.fetchedAt = time.Time{}
+			} else {
+				entry.dailyLimit, entry.dailySpent, entry.fetchedAt = info.DailyLimit, info.DailySpent, now
+			}
+		}
+		p.mu.Unlock()
+		if err != nil {
+			log.Printf("查询活动预算失败，暂不做匀速投放: CampaignID=%s, %v", campaignID, err)
+		}
+	}
+}
+
+// watch 定期刷新预算信息，有新活动时立即查询新活动
+func (p *Pacer) watch() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.refreshEntries(context.Background(), time.Now(), false)
+		case <-p.wake:
+			p.refreshEntries(context.Background(), time.Now(), true)
+		}
+	}
+}
+
+// Close 停止后台刷新
+func (p *Pacer) Close() {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+}
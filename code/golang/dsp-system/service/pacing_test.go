@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"dsp-system/money"
+	"dsp-system/rpc"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeBudgetInfo 按活动返回固定的预算信息
+type fakeBudgetInfo struct {
+	infos   map[string]*rpc.BudgetInfo
+	queries int
+}
+
+func (f *fakeBudgetInfo) GetBudgetInfo(ctx context.Context, campaignID string) (*rpc.BudgetInfo, error) {
+	f.queries++
+	info, ok := f.infos[campaignID]
+	if !ok {
+		return nil, errors.New("unavailable")
+	}
+	return info, nil
+}
+
+func TestPacer(t *testing.T) {
+	source := &fakeBudgetInfo{infos: map[string]*rpc.BudgetInfo{
+		"c1": {DailyLimit: 100 * money.MicrosPerUnit, DailySpent: 60 * money.MicrosPerUnit},
+		"c2": {DailySpent: 60 * money.MicrosPerUnit},
+	}}
+	pacer := newPacer(source, time.Minute)
+	ctx := context.Background()
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noon := time.Date(2026, 10, 19, 12, 0, 0, 0, shanghai)
+
+	// 第一次参与竞价时还没有预算信息，不限制也不在竞价路径上查询
+	if !pacer.Allow("c1", shanghai, 0.5, noon) || source.queries != 0 {
+		t.Fatalf("没有预算信息时应出价且不查询，查询%d次", source.queries)
+	}
+
+	// 日预算100，已消耗60：进度一半时超前，进度70%时可以出价
+	pacer.Refresh(ctx, noon)
+	if pacer.Allow("c1", shanghai, 0.5, noon) {
+		t.Error("消耗超过进度目标时不应出价")
+	}
+	if !pacer.Allow("c1", shanghai, 0.7, noon) {
+		t.Error("消耗未超过进度目标时应出价")
+	}
+
+	// 跨过上海午夜：前一天查询的日消耗不属于当天，预算服务清零前后的宽限期内查询的也不用
+	midnight := time.Date(2026, 10, 20, 0, 0, 0, 0, shanghai)
+	if !pacer.Allow("c1", shanghai, 0.01, midnight.Add(30*time.Minute)) {
+		t.Error("跨过活动当地午夜后不应按前一天的消耗限制")
+	}
+	pacer.Refresh(ctx, midnight.Add(time.Minute))
+	if !pacer.Allow("c1", shanghai, 0.01, midnight.Add(90*time.Second)) {
+		t.Error("预算服务清零前查询的消耗不应用于限制")
+	}
+	source.infos["c1"] = &rpc.BudgetInfo{DailyLimit: 100 * money.MicrosPerUnit, DailySpent: 5 * money.MicrosPerUnit}
+	pacer.Refresh(ctx, midnight.Add(3*time.Minute))
+	if pacer.Allow("c1", shanghai, 0.02, midnight.Add(3*time.Minute)) {
+		t.Error("清零后的当天消耗超过进度目标时不应出价")
+	}
+
+	if !pacer.Allow("c2", shanghai, 0, noon) {
+		t.Error("没有日预算时不应限制")
+	}
+	pacer.Allow("c3", shanghai, 0, noon)
+	pacer.Refresh(ctx, noon)
+	if !pacer.Allow("c3", shanghai, 0, noon) {
+		t.Error("查询失败时不应限制")
+	}
+
+	// 长时间没有参与竞价的活动不再查询
+	source.queries = 0
+	pacer.Refresh(ctx, midnight.Add(time.Hour))
+	if source.queries != 0 {
+		t.Errorf("空闲的活动不应再查询，实际查询%d次", source.queries)
+	}
+
+	var disabled *Pacer
+	if !disabled.Allow("c1", shanghai, 0, noon) {
+		t.Error("没有匀速投放控制时不应限制")
+	}
+	disabled.Close()
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"dsp-system/repository"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// UserSyncService Cookie同步服务
+// 维护交易平台用户ID（竞价请求中的User.BuyerUID）到本方Cookie用户ID的映射
+type UserSyncService struct {
+	redisCache *repository.RedisCache
+	mappingTTL time.Duration
+}
+
+// NewUserSyncService 创建Cookie同步服务
+func NewUserSyncService(redisCache *repository.RedisCache, mappingTTL time.Duration) *UserSyncService {
+	return &UserSyncService{
+		redisCache: redisCache,
+		mappingTTL: mappingTTL,
+	}
+}
+
+// NewDSPUID 生成本方用户ID（32位十六进制）
+func NewDSPUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidDSPUID 是否为本方生成的用户ID，Cookie中不合法的值会被替换
+func ValidDSPUID(uid string) bool {
+	if len(uid) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(uid)
+	return err == nil
+}
+
+// ValidExchange 交易平台标识只允许小写字母、数字、下划线和连字符
+func ValidExchange(exchange string) bool {
+	if exchange == "" || len(exchange) > 32 {
+		return false
+	}
+	for _, r := range exchange {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// Sync 记录交易平台用户ID与本方用户ID的对应关系
+// exchangeUID为空时记录本方用户ID自身：交易平台保存本方ID后会原样作为BuyerUID传回
+func (s *UserSyncService) Sync(ctx context.Context, exchange string, exchangeUID string, dspUID string) error {
+	if !ValidExchange(exchange) {
+		return fmt.Errorf("无效的交易平台标识: %q", exchange)
+	}
+	if exchangeUID == "" {
+		exchangeUID = dspUID
+	}
+	if len(exchangeUID) > 256 {
+		return fmt.Errorf("交易平台用户ID过长: %d", len(exchangeUID))
+	}
+
+	if err := s.redisCache.SetUserSync(ctx, exchange, exchangeUID, dspUID, s.mappingTTL); err != nil {
+		return fmt.Errorf("保存用户映射失败: %v", err)
+	}
+
+	log.Printf("用户同步: Exchange=%s, ExchangeUID=%s, DSPUID=%s", exchange, exchangeUID, dspUID)
+	return nil
+}
+
+// ResolveBuyerUID 把竞价请求中的BuyerUID解析为本方用户ID，未同步过时返回空字符串
+func (s *UserSyncService) ResolveBuyerUID(ctx context.Context, exchange string, buyerUID string) string {
+	if exchange == "" || buyerUID == "" {
+		return ""
+	}
+
+	dspUID, err := s.redisCache.GetUserSync(ctx, exchange, buyerUID)
+	if err != nil {
+		log.Printf("查询用户映射失败: %v", err)
+		return ""
+	}
+	return dspUID
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"dsp-system/api"
+	"dsp-system/config"
+	"dsp-system/repository"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestResolveUserIDByBuyerUID(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cache := repository.NewRedisCache(&config.RedisConfig{Host: mr.Host(), Port: mr.Port()})
+	defer cache.Close()
+
+	ctx := context.Background()
+	userSync := NewUserSyncService(cache, time.Hour)
+	if err := userSync.Sync(ctx, "adx", "adx-user-1", "0123456789abcdef0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	s := &BidService{userSync: userSync}
+
+	req := &api.BidRequest{
+		User:   &api.User{ID: "exchange-user", BuyerUID: "adx-user-1"},
+		Device: &api.Device{IFA: "ifa-1"},
+	}
+	if got := s.resolveUserID(ctx, "adx", req); got != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("同步过的BuyerUID应解析为本方用户ID，实际为%s", got)
+	}
+
+	// 映射按交易平台区分，其他平台的同名ID不命中
+	if got := s.resolveUserID(ctx, "openx", req); got != "exchange-user" {
+		t.Errorf("其他交易平台应回退到User.ID，实际为%s", got)
+	}
+
+	// 没有其他标识时使用未同步的BuyerUID
+	req = &api.BidRequest{User: &api.User{BuyerUID: "unknown"}}
+	if got := s.resolveUserID(ctx, "adx", req); got != "unknown" {
+		t.Errorf("应回退到未同步的BuyerUID，实际为%s", got)
+	}
+}
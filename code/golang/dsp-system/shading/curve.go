@@ -0,0 +1,125 @@
+package shading
+
+import (
+	"math"
+	"sort"
+
+	"dsp-system/money"
+)
+
+// 出价按几何分桶：第i个桶为[bucketBase×bucketRatio^i, bucketBase×bucketRatio^(i+1))，
+// 相邻桶相差5%，低价和高价的分辨率一致
+const (
+	bucketBase  = 0.01 // 元
+	bucketRatio = 1.05
+)
+
+// Bucket 出价所在的桶，低于bucketBase的出价计入第0个桶
+func Bucket(bid money.Micros) int {
+	price := bid.Float()
+	if price <= bucketBase {
+		return 0
+	}
+	return int(math.Log(price/bucketBase) / math.Log(bucketRatio))
+}
+
+// bucketPrice 桶的中间价（元）
+func bucketPrice(bucket int) float64 {
+	return bucketBase * math.Pow(bucketRatio, float64(bucket)+0.5)
+}
+
+// Counts 一个桶内的出价和赢标次数
+type Counts struct {
+	Bids int64
+	Wins int64
+}
+
+// Histogram 按出价桶统计的出价和赢标次数
+type Histogram map[int]Counts
+
+// add 累加另一个直方图
+func (h Histogram) add(other Histogram) {
+	for bucket, c := range other {
+		total := h[bucket]
+		total.Bids += c.Bids
+		total.Wins += c.Wins
+		h[bucket] = total
+	}
+}
+
+// bids 总出价次数
+func (h Histogram) bids() int64 {
+	var n int64
+	for _, c := range h {
+		n += c.Bids
+	}
+	return n
+}
+
+// Curve 赢标概率曲线：出价越高赢标概率越高（单调不减）
+type Curve struct {
+	prices []float64 // 各桶中间价（元），升序
+	probs  []float64 // 对应的赢标概率
+	Bids   int64     // 拟合用到的出价次数
+}
+
+// Fit 用保序回归（PAV）把各桶的赢标率拟合为单调不减的曲线，没有出价时返回nil
+func Fit(h Histogram) *Curve {
+	buckets := make([]int, 0, len(h))
+	for bucket, c := range h {
+		if c.Bids > 0 {
+			buckets = append(buckets, bucket)
+		}
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+	sort.Ints(buckets)
+
+	// 合并相邻的逆序块，每块取加权平均赢标率
+	type block struct {
+		rate   float64
+		weight float64
+		n      int // 块中的桶数
+	}
+	var blocks []block
+	for _, bucket := range buckets {
+		c := h[bucket]
+		wins := min(c.Wins, c.Bids)
+		blocks = append(blocks, block{rate: float64(wins) / float64(c.Bids), weight: float64(c.Bids), n: 1})
+		for len(blocks) > 1 && blocks[len(blocks)-2].rate > blocks[len(blocks)-1].rate {
+			a, b := blocks[len(blocks)-2], blocks[len(blocks)-1]
+			weight := a.weight + b.weight
+			blocks = blocks[:len(blocks)-2]
+			blocks = append(blocks, block{rate: (a.rate*a.weight + b.rate*b.weight) / weight, weight: weight, n: a.n + b.n})
+		}
+	}
+
+	c := &Curve{prices: make([]float64, len(buckets)), probs: make([]float64, 0, len(buckets)), Bids: h.bids()}
+	for i, bucket := range buckets {
+		c.prices[i] = bucketPrice(bucket)
+	}
+	for _, b := range blocks {
+		for range b.n {
+			c.probs = append(c.probs, b.rate)
+		}
+	}
+	return c
+}
+
+// WinProbability 以price（元）出价的赢标概率
+// 在相邻桶之间线性插值；高于最高桶时取最高桶的值；低于最低桶时从0线性插值，没有数据的低价区间不乐观估计
+func (c *Curve) WinProbability(price float64) float64 {
+	if c == nil || price <= 0 {
+		return 0
+	}
+	i := sort.SearchFloat64s(c.prices, price)
+	switch {
+	case i == len(c.prices):
+		return c.probs[i-1]
+	case i == 0:
+		return c.probs[0] * price / c.prices[0]
+	}
+	lo, hi := c.prices[i-1], c.prices[i]
+	return c.probs[i-1] + (c.probs[i]-c.probs[i-1])*(price-lo)/(hi-lo)
+}
@@ -0,0 +1,261 @@
+// Package shading 第一价格拍卖的出价折减（bid shading）
+// 按交易平台、媒体和尺寸从出价和赢标记录中学习赢标概率曲线，
+// 在出价上限以下选择期望剩余（(上限 - 出价) × 赢标概率）最大的出价
+package shading
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dsp-system/money"
+)
+
+// Key 赢标概率曲线的维度
+type Key struct {
+	Exchange  string
+	Publisher string // 媒体ID，没有时为网站域名或APP包名
+	Size      string // 300x250、video、native
+}
+
+// String 用于存储和回调参数，格式为exchange|publisher|size
+func (k Key) String() string {
+	return k.Exchange + "|" + k.Publisher + "|" + k.Size
+}
+
+// ParseKey 解析Key.String的结果，媒体ID中可以含有|
+func ParseKey(s string) (Key, error) {
+	first, last := strings.Index(s, "|"), strings.LastIndex(s, "|")
+	if first < 0 || first == last {
+		return Key{}, fmt.Errorf("出价折减维度无效: %q", s)
+	}
+	return Key{Exchange: s[:first], Publisher: s[first+1 : last], Size: s[last+1:]}, nil
+}
+
+// fallbacks 查找曲线的顺序：先用最细的维度，样本不足时依次放宽到同媒体、同尺寸、整个交易平台
+func (k Key) fallbacks() []Key {
+	keys := []Key{k, {Exchange: k.Exchange, Publisher: k.Publisher}, {Exchange: k.Exchange, Size: k.Size}, {Exchange: k.Exchange}}
+	unique := keys[:0]
+	for _, key := range keys {
+		duplicate := false
+		for _, u := range unique {
+			duplicate = duplicate || u == key
+		}
+		if !duplicate {
+			unique = append(unique, key)
+		}
+	}
+	return unique
+}
+
+// Retention 出价和赢标记录的保留时间，学习窗口不超过这个天数
+const Retention = 30 * 24 * time.Hour
+
+// Store 出价和赢标记录的存储，按自然日（YYYYMMDD）分开，多个竞价实例共享
+type Store interface {
+	// IncrShading 累加某天某维度某出价桶的出价和赢标次数
+	IncrShading(ctx context.Context, day string, key Key, bucket int, bids, wins int64) error
+	// RecordShadingWin 按bidID去重记录一次赢标，计入days中第一个该出价桶有出价记录的那天；
+	// bidID已记录过或各天都没有出价记录时不计入，返回是否计入。去重记录保留Retention
+	RecordShadingWin(ctx context.Context, days []string, key Key, bucket int, bidID string) (bool, error)
+	// LoadShading 读取若干天的全部记录，按维度合并
+	LoadShading(ctx context.Context, days []string) (map[Key]Histogram, error)
+}
+
+// DefaultMinFactor 默认最多折减到出价上限的一半
+const DefaultMinFactor = 0.5
+
+// Config 出价折减配置
+type Config struct {
+	// MinFactor 折减后的出价不低于出价上限的这个比例，取值(0, 1]，无效时为DefaultMinFactor
+	MinFactor float64
+	// MinSamples 曲线至少有这么多次出价才使用，否则放宽维度，都不足时不折减
+	MinSamples int64
+	// Window 学习最近多少天的记录，最多为Retention的天数
+	Window int
+	// RefreshInterval 重新拟合曲线的间隔，0表示只在创建时拟合
+	RefreshInterval time.Duration
+}
+
+// 候选出价的个数：在[下限, 上限]之间等距取点
+const steps = 50
+
+// curves 一次拟合的结果，整体替换
+type curves map[Key]*Curve
+
+// Shader 出价折减器，曲线在后台定期重新拟合
+type Shader struct {
+	store  Store
+	cfg    Config
+	curves atomic.Pointer[curves]
+
+	mu   sync.Mutex // 串行化重新拟合
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewShader 创建出价折减器并拟合一次曲线，store为nil时返回nil（不折减）
+// 首次拟合失败只记录日志，数据足够前不会折减
+func NewShader(store Store, cfg Config) *Shader {
+	if store == nil {
+		return nil
+	}
+	if cfg.MinFactor <= 0 || cfg.MinFactor > 1 {
+		log.Printf("出价折减下限比例无效: %g，使用%g", cfg.MinFactor, DefaultMinFactor)
+		cfg.MinFactor = DefaultMinFactor
+	}
+	s := &Shader{
+		store: store,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	s.curves.Store(&curves{})
+	if err := s.Refresh(context.Background(), time.Now()); err != nil {
+		log.Printf("拟合赢标概率曲线失败: %v", err)
+	}
+	if cfg.RefreshInterval > 0 {
+		go s.watch(cfg.RefreshInterval)
+	} else {
+		close(s.done)
+	}
+	return s
+}
+
+// days 截至now的最近n个自然日（1到Retention的天数之间）
+func days(now time.Time, n int) []string {
+	n = min(max(n, 1), int(Retention/(24*time.Hour)))
+	result := make([]string, 0, n)
+	for i := range n {
+		result = append(result, now.AddDate(0, 0, -i).Format("20060102"))
+	}
+	return result
+}
+
+// Refresh 读取最近Window天的记录，按各级维度合并后重新拟合曲线
+func (s *Shader) Refresh(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	histograms, err := s.store.LoadShading(ctx, days(now, s.cfg.Window))
+	if err != nil {
+		return err
+	}
+	merged := make(map[Key]Histogram)
+	for key, h := range histograms {
+		for _, level := range key.fallbacks() {
+			if merged[level] == nil {
+				merged[level] = make(Histogram)
+			}
+			merged[level].add(h)
+		}
+	}
+
+	fitted := make(curves, len(merged))
+	for key, h := range merged {
+		if c := Fit(h); c != nil && c.Bids >= s.cfg.MinSamples {
+			fitted[key] = c
+		}
+	}
+	s.curves.Store(&fitted)
+	log.Printf("赢标概率曲线已更新: Keys=%d, Curves=%d", len(histograms), len(fitted))
+	return nil
+}
+
+// Curve 返回key可用的曲线（依次放宽维度），都没有时返回nil
+func (s *Shader) Curve(key Key) *Curve {
+	if s == nil {
+		return nil
+	}
+	fitted := *s.curves.Load()
+	for _, level := range key.fallbacks() {
+		if c := fitted[level]; c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+// Shade 在value（出价上限）以下选择期望剩余最大的出价，返回出价和是否折减
+// 出价不低于value×MinFactor，也不低于底价floor（0表示没有底价）；
+// 没有可用的曲线、底价不低于上限或各候选的期望剩余都为0时按上限出价
+func (s *Shader) Shade(key Key, value, floor money.Micros) (money.Micros, bool) {
+	c := s.Curve(key)
+	if c == nil || value <= 0 || floor >= value {
+		return value, false
+	}
+
+	upper := value.Float()
+	lower := max(upper*s.cfg.MinFactor, floor.Float())
+	best, bestSurplus := upper, 0.0
+	for i := range steps + 1 {
+		bid := lower + (upper-lower)*float64(i)/steps
+		if surplus := (upper - bid) * c.WinProbability(bid); surplus > bestSurplus {
+			best, bestSurplus = bid, surplus
+		}
+	}
+	if bestSurplus == 0 {
+		return value, false
+	}
+
+	shaded := money.FromFloat(best)
+	if shaded < floor {
+		shaded = floor
+	}
+	return min(shaded, value), shaded < value
+}
+
+// RecordBid 记录一次第一价格拍卖中的出价
+func (s *Shader) RecordBid(ctx context.Context, key Key, bid money.Micros, at time.Time) error {
+	if s == nil {
+		return nil
+	}
+	return s.store.IncrShading(ctx, at.Format("20060102"), key, Bucket(bid), 1, 0)
+}
+
+// RecordWin 记录一次赢标，bid为当时提交的出价，返回是否计入
+// 同一bidID的重复通知只计一次；出价桶没有出价记录（伪造或过期的通知）时不计入。
+// 赢标通知可能在出价的第二天到达，出价记录先找当天、再找前一天
+func (s *Shader) RecordWin(ctx context.Context, key Key, bidID string, bid money.Micros, at time.Time) (bool, error) {
+	if s == nil || bidID == "" {
+		return false, nil
+	}
+	days := []string{at.Format("20060102"), at.AddDate(0, 0, -1).Format("20060102")}
+	return s.store.RecordShadingWin(ctx, days, key, Bucket(bid), bidID)
+}
+
+// watch 定期重新拟合曲线
+func (s *Shader) watch(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		}
+		if err := s.Refresh(context.Background(), time.Now()); err != nil {
+			log.Printf("重新拟合赢标概率曲线失败（继续使用旧曲线）: %v", err)
+		}
+	}
+}
+
+// Close 停止后台拟合
+func (s *Shader) Close() {
+	if s == nil {
+		return
+	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
@@ -0,0 +1,182 @@
+package shading_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"dsp-system/money"
+	"dsp-system/shading"
+)
+
+// fakeStore 内存中的出价和赢标记录
+type fakeStore struct {
+	days map[string]map[shading.Key]shading.Histogram
+	wins map[string]bool // 已记录赢标的bidID
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{days: make(map[string]map[shading.Key]shading.Histogram), wins: make(map[string]bool)}
+}
+
+func (f *fakeStore) IncrShading(ctx context.Context, day string, key shading.Key, bucket int, bids, wins int64) error {
+	if f.days[day] == nil {
+		f.days[day] = make(map[shading.Key]shading.Histogram)
+	}
+	if f.days[day][key] == nil {
+		f.days[day][key] = make(shading.Histogram)
+	}
+	c := f.days[day][key][bucket]
+	c.Bids += bids
+	c.Wins += wins
+	f.days[day][key][bucket] = c
+	return nil
+}
+
+func (f *fakeStore) RecordShadingWin(ctx context.Context, days []string, key shading.Key, bucket int, bidID string) (bool, error) {
+	if f.wins[bidID] {
+		return false, nil
+	}
+	for _, day := range days {
+		if f.days[day][key][bucket].Bids > 0 {
+			f.wins[bidID] = true
+			return true, f.IncrShading(ctx, day, key, bucket, 0, 1)
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeStore) LoadShading(ctx context.Context, days []string) (map[shading.Key]shading.Histogram, error) {
+	result := make(map[shading.Key]shading.Histogram)
+	for _, day := range days {
+		for key, h := range f.days[day] {
+			if result[key] == nil {
+				result[key] = make(shading.Histogram)
+			}
+			for bucket, c := range h {
+				total := result[key][bucket]
+				total.Bids += c.Bids
+				total.Wins += c.Wins
+				result[key][bucket] = total
+			}
+		}
+	}
+	return result, nil
+}
+
+// record 在0.5元到15元之间出价，赢标概率为出价/10元（对手出价在0到10元之间均匀分布）
+func record(t *testing.T, shader *shading.Shader, key shading.Key, at time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	for price := 0.5; price < 15; price *= 1.05 {
+		bid := money.FromFloat(price)
+		wins := int(math.Round(100 * math.Min(price/10, 1)))
+		for i := range 100 {
+			if err := shader.RecordBid(ctx, key, bid, at); err != nil {
+				t.Fatal(err)
+			}
+			if i < wins {
+				shader.RecordWin(ctx, key, fmt.Sprintf("%s|%s|%d|%d", key, at.Format(time.RFC3339), bid, i), bid, at)
+			}
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key := shading.Key{Exchange: "adx", Publisher: "pub|1", Size: "300x250"}
+	parsed, err := shading.ParseKey(key.String())
+	if err != nil || parsed != key {
+		t.Errorf("应还原维度: %+v, %v", parsed, err)
+	}
+	if _, err := shading.ParseKey("adx|300x250"); err == nil {
+		t.Error("缺少维度时应返回错误")
+	}
+}
+
+func TestFit(t *testing.T) {
+	c := shading.Fit(shading.Histogram{
+		shading.Bucket(money.FromFloat(1)): {Bids: 100, Wins: 10},
+		shading.Bucket(money.FromFloat(2)): {Bids: 100, Wins: 30},
+		shading.Bucket(money.FromFloat(3)): {Bids: 100, Wins: 20}, // 逆序，与前一个桶合并为25%
+		shading.Bucket(money.FromFloat(4)): {Bids: 100, Wins: 60},
+	})
+	if c == nil || c.Bids != 400 {
+		t.Fatalf("应拟合出曲线: %+v", c)
+	}
+	previous := 0.0
+	for price := 0.1; price < 6; price += 0.1 {
+		p := c.WinProbability(price)
+		if p < previous {
+			t.Fatalf("赢标概率应单调不减: %.1f元 %.3f < %.3f", price, p, previous)
+		}
+		previous = p
+	}
+	if p := c.WinProbability(2.5); math.Abs(p-0.25) > 0.01 {
+		t.Errorf("逆序的桶应合并为加权平均: %.3f", p)
+	}
+	if p := c.WinProbability(100); p != 0.6 {
+		t.Errorf("高于最高桶时应取最高桶的值: %.3f", p)
+	}
+	if p := c.WinProbability(0.5); p >= 0.1 {
+		t.Errorf("低于最低桶时不应乐观估计: %.3f", p)
+	}
+	if shading.Fit(shading.Histogram{1: {Wins: 3}}) != nil {
+		t.Error("没有出价时不应拟合")
+	}
+}
+
+func TestShade(t *testing.T) {
+	store := newFakeStore()
+	cfg := shading.Config{MinFactor: 0.3, MinSamples: 1000, Window: 7}
+	shader := shading.NewShader(store, cfg)
+	defer shader.Close()
+
+	key := shading.Key{Exchange: "adx", Publisher: "pub1", Size: "300x250"}
+	value := money.FromFloat(10)
+	if bid, shaded := shader.Shade(key, value, 0); shaded || bid != value {
+		t.Errorf("没有曲线时应按上限出价: %s", bid)
+	}
+
+	now := time.Now()
+	record(t, shader, key, now)
+	record(t, shader, shading.Key{Exchange: "old", Size: "300x250"}, now.AddDate(0, 0, -10))
+	if err := shader.Refresh(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 期望剩余(10 - b) × b/10在5元时最大
+	bid, shaded := shader.Shade(key, value, 0)
+	if !shaded || math.Abs(bid.Float()-5) > 0.3 {
+		t.Errorf("应折减到5元左右: %s", bid)
+	}
+	if bid, _ := shader.Shade(key, value, money.FromFloat(7)); bid.Float() < 7 {
+		t.Errorf("不应低于底价: %s", bid)
+	}
+	if bid, shaded := shader.Shade(key, value, money.FromFloat(12)); shaded || bid != value {
+		t.Errorf("底价高于上限时不折减: %s", bid)
+	}
+	if bid, _ := shader.Shade(key, money.FromFloat(4), 0); bid.Float() < 4*cfg.MinFactor {
+		t.Errorf("不应低于上限的MinFactor: %s", bid)
+	}
+
+	// 其他媒体使用交易平台整体的曲线，其他交易平台没有曲线
+	if _, shaded := shader.Shade(shading.Key{Exchange: "adx", Publisher: "pub2", Size: "728x90"}, value, 0); !shaded {
+		t.Error("样本不足时应放宽到交易平台的曲线")
+	}
+	if _, shaded := shader.Shade(shading.Key{Exchange: "old", Size: "300x250"}, value, 0); shaded {
+		t.Error("学习窗口之外的记录不应使用")
+	}
+
+	strict := shading.NewShader(store, shading.Config{MinSamples: 1_000_000, Window: 7})
+	defer strict.Close()
+	if _, shaded := strict.Shade(key, value, 0); shaded {
+		t.Error("样本不足MinSamples时不应折减")
+	}
+
+	var disabled *shading.Shader
+	if bid, shaded := disabled.Shade(key, value, 0); shaded || bid != value {
+		t.Error("没有折减器时应按上限出价")
+	}
+}
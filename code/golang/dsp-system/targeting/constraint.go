@@ -0,0 +1,107 @@
+package targeting
+
+import "strconv"
+
+// maxIndexedRange 整数区间展开为索引键的最大个数，超过时该条件不参与索引
+const maxIndexedRange = 256
+
+// Constraint 规则必须满足的条件：字段取值（或列表字段的某一项）必须是Values之一
+// 用于倒排索引预筛选，不满足Constraint的请求一定不满足规则
+type Constraint struct {
+	Field  string
+	Values []string // 索引键，与Env.Keys的取值一致
+}
+
+// Constraints 提取规则顶层and中可索引的肯定条件
+// 可索引的条件为字符串、列表、整数字段的==和in，以及同一字段上这类条件的or；
+// not、!=、比较运算、版本和布尔字段不参与索引，由规则求值判断
+func (r *Rule) Constraints() []Constraint {
+	if r == nil {
+		return nil
+	}
+	children := []node{r.root}
+	if and, ok := r.root.(*andNode); ok {
+		children = and.children
+	}
+
+	var constraints []Constraint
+	for _, child := range children {
+		if c, ok := constraintOf(child); ok {
+			constraints = append(constraints, c)
+		}
+	}
+	return constraints
+}
+
+// constraintOf 单个节点对应的约束
+func constraintOf(n node) (Constraint, bool) {
+	switch n := n.(type) {
+	case *cond:
+		return n.constraint()
+	case *orNode:
+		// 同一字段上的多个条件取并集
+		var merged Constraint
+		for i, child := range n.children {
+			c, ok := constraintOf(child)
+			if !ok || (i > 0 && c.Field != merged.Field) {
+				return Constraint{}, false
+			}
+			merged.Field = c.Field
+			merged.Values = append(merged.Values, c.Values...)
+		}
+		return merged, true
+	}
+	return Constraint{}, false
+}
+
+// constraint 条件对应的约束
+func (c *cond) constraint() (Constraint, bool) {
+	if c.negate || (c.op != "==" && c.op != "in") {
+		return Constraint{}, false
+	}
+	switch c.field.kind {
+	case kindString, kindList:
+		values := make([]string, 0, len(c.strs))
+		for s := range c.strs {
+			values = append(values, s)
+		}
+		return Constraint{Field: c.field.name, Values: values}, true
+	case kindInt:
+		total := 0
+		for _, r := range c.ranges {
+			total += r[1] - r[0] + 1
+		}
+		if total > maxIndexedRange {
+			return Constraint{}, false
+		}
+		values := make([]string, 0, total)
+		for _, r := range c.ranges {
+			for n := r[0]; n <= r[1]; n++ {
+				values = append(values, strconv.Itoa(n))
+			}
+		}
+		return Constraint{Field: c.field.name, Values: values}, true
+	}
+	return Constraint{}, false
+}
+
+// Keys 请求在指定字段上的索引键，字段为空时返回nil
+func (e *Env) Keys(name string) []string {
+	f, ok := fields[name]
+	if !ok {
+		return nil
+	}
+	v := f.get(e)
+	if !v.ok {
+		return nil
+	}
+	switch f.kind {
+	case kindString:
+		return []string{v.s}
+	case kindList:
+		return v.list
+	case kindInt:
+		return []string{strconv.Itoa(v.n)}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Package targeting 定向规则引擎
+// 规则是布尔表达式，在广告库加载时编译，竞价时针对每个请求求值，并能解释命中或未命中的原因
+package targeting
+
+import (
+	"dsp-system/api"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env 一次竞价请求中规则可以引用的取值
+// 字符串统一转为小写，规则中的字面量也转为小写，比较不区分大小写
+type Env struct {
+	Country string
+	Region  string
+	City    string
+	ZIP     string
+
+	DeviceType     int
+	OS             string
+	OSVersion      string
+	Make           string
+	Model          string
+	Browser        string
+	Bot            bool
+	Carrier        string
+	ConnectionType int
+	Language       string
+
+	SiteID     string
+	SiteDomain string
+	AppID      string
+	AppBundle  string
+	Categories []string // 网站或APP的IAB内容分类
+
+	Segments []string // 用户所属人群
+	Tags     []string // 用户标签
+
+	Now time.Time
+	// UTCOffset 用户当地时间与UTC的偏移（分钟），请求没有时为nil
+	UTCOffset *int
+
+	osVersion []int // 解析后的系统版本
+}
+
+// NewEnv 从竞价请求和用户画像构造求值环境，now决定time.*字段的取值
+func NewEnv(req *api.BidRequest, segments, tags []string, now time.Time) *Env {
+	env := &Env{
+		Segments: lowerAll(segments),
+		Tags:     lowerAll(tags),
+		Now:      now,
+	}
+
+	if device := req.Device; device != nil {
+		env.DeviceType = device.DeviceType
+		env.OS = lower(device.OS)
+		env.OSVersion = lower(device.OSV)
+		env.Make = lower(device.Make)
+		env.Model = lower(device.Model)
+		env.Browser = lower(device.Browser)
+		env.Bot = device.Bot
+		env.Carrier = lower(device.Carrier)
+		env.ConnectionType = device.ConnectionType
+		env.Language = lower(device.Language)
+	}
+
+	// 设备位置优先，没有时用用户登记的位置
+	var geo *api.Geo
+	if req.Device != nil && req.Device.Geo != nil {
+		geo = req.Device.Geo
+	} else if req.User != nil {
+		geo = req.User.Geo
+	}
+	if geo != nil {
+		env.Country = lower(geo.Country)
+		env.Region = lower(geo.Region)
+		env.City = lower(geo.City)
+		env.ZIP = lower(geo.ZIP)
+		env.UTCOffset = geo.UTCOffset
+	}
+
+	if site := req.Site; site != nil {
+		env.SiteID = lower(site.ID)
+		env.SiteDomain = lower(site.Domain)
+		env.Categories = append(env.Categories, lowerAll(site.Cat)...)
+	}
+	if app := req.App; app != nil {
+		env.AppID = lower(app.ID)
+		env.AppBundle = lower(app.Bundle)
+		env.Categories = append(env.Categories, lowerAll(app.Cat)...)
+	}
+
+	env.osVersion = parseVersion(env.OSVersion)
+	return env
+}
+
+func lower(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+func lowerAll(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = lower(v)
+	}
+	return out
+}
+
+// parseVersion 把"14.2.1"解析为[14 2 1]，每段只取开头的数字，无法解析时返回nil
+func parseVersion(s string) []int {
+	if s == "" {
+		return nil
+	}
+	parts := strings.Split(s, ".")
+	version := make([]int, 0, len(parts))
+	for _, part := range parts {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		if end == 0 {
+			break
+		}
+		n, _ := strconv.Atoi(part[:end])
+		version = append(version, n)
+		if end < len(part) {
+			break // "3b2"这样的段之后不再比较
+		}
+	}
+	if len(version) == 0 {
+		return nil
+	}
+	return version
+}
+
+// compareVersion 逐段比较版本，缺少的段按0处理
+func compareVersion(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
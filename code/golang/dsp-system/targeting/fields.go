@@ -0,0 +1,114 @@
+package targeting
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// kind 字段类型，决定可用的运算符和字面量
+type kind int
+
+const (
+	kindString  kind = iota // ==, !=, in, not in
+	kindInt                 // 比较运算、in、not in，列表中可以写区间 a..b
+	kindVersion             // 比较运算，按段比较数字
+	kindBool                // ==, !=，也可以单独写字段名
+	kindList                // in, not in：与列表有交集即为in
+)
+
+// value 字段在某个请求中的取值
+type value struct {
+	ok   bool // 请求中有该字段
+	s    string
+	n    int
+	ver  []int
+	b    bool
+	list []string
+}
+
+// display 取值的文字形式，用于解释
+func (v value) display(k kind) string {
+	if !v.ok {
+		return "空"
+	}
+	switch k {
+	case kindInt:
+		return strconv.Itoa(v.n)
+	case kindBool:
+		return strconv.FormatBool(v.b)
+	case kindList:
+		return "[" + strings.Join(v.list, ", ") + "]"
+	}
+	return v.s
+}
+
+// field 规则可以引用的字段
+type field struct {
+	name string
+	kind kind
+	get  func(*Env) value
+}
+
+func stringValue(s string) value {
+	return value{ok: s != "", s: s}
+}
+
+// intValue OpenRTB中0表示未知
+func intValue(n int) value {
+	return value{ok: n != 0, n: n}
+}
+
+func listValue(list []string) value {
+	return value{ok: len(list) > 0, list: list}
+}
+
+// fields 可用字段
+var fields = map[string]*field{}
+
+func init() {
+	for _, f := range []*field{
+		{"geo.country", kindString, func(e *Env) value { return stringValue(e.Country) }},
+		{"geo.region", kindString, func(e *Env) value { return stringValue(e.Region) }},
+		{"geo.city", kindString, func(e *Env) value { return stringValue(e.City) }},
+		{"geo.zip", kindString, func(e *Env) value { return stringValue(e.ZIP) }},
+
+		{"device.type", kindInt, func(e *Env) value { return intValue(e.DeviceType) }},
+		{"device.os", kindString, func(e *Env) value { return stringValue(e.OS) }},
+		{"device.osv", kindVersion, func(e *Env) value {
+			return value{ok: e.osVersion != nil, s: e.OSVersion, ver: e.osVersion}
+		}},
+		{"device.make", kindString, func(e *Env) value { return stringValue(e.Make) }},
+		{"device.model", kindString, func(e *Env) value { return stringValue(e.Model) }},
+		{"device.browser", kindString, func(e *Env) value { return stringValue(e.Browser) }},
+		{"device.bot", kindBool, func(e *Env) value { return value{ok: true, b: e.Bot} }},
+		{"device.carrier", kindString, func(e *Env) value { return stringValue(e.Carrier) }},
+		{"device.connectiontype", kindInt, func(e *Env) value { return intValue(e.ConnectionType) }},
+		{"device.language", kindString, func(e *Env) value { return stringValue(e.Language) }},
+
+		{"site.id", kindString, func(e *Env) value { return stringValue(e.SiteID) }},
+		{"site.domain", kindString, func(e *Env) value { return stringValue(e.SiteDomain) }},
+		{"app.id", kindString, func(e *Env) value { return stringValue(e.AppID) }},
+		{"app.bundle", kindString, func(e *Env) value { return stringValue(e.AppBundle) }},
+		{"cat", kindList, func(e *Env) value { return listValue(e.Categories) }},
+
+		{"user.segment", kindList, func(e *Env) value { return listValue(e.Segments) }},
+		{"user.tag", kindList, func(e *Env) value { return listValue(e.Tags) }},
+
+		// 小时0-23，星期0-6（0为周日），按Env.Now所在时区
+		{"time.hour", kindInt, func(e *Env) value { return value{ok: true, n: e.Now.Hour()} }},
+		{"time.weekday", kindInt, func(e *Env) value { return value{ok: true, n: int(e.Now.Weekday())} }},
+	} {
+		fields[f.name] = f
+	}
+}
+
+// Fields 可用字段名，按名称排序
+func Fields() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,327 @@
+package targeting
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp     // == != < <= > >=
+	tokLParen // (
+	tokRParen // )
+	tokComma  // ,
+	tokRange  // ..
+)
+
+// token 词法单元，pos和end为在表达式中的字节位置
+type token struct {
+	kind     tokenKind
+	text     string // 字符串为去掉引号后的内容
+	pos, end int
+}
+
+// is 判断是否为指定的关键字（不区分大小写）
+func (t token) is(keyword string) bool {
+	return t.kind == tokIdent && strings.EqualFold(t.text, keyword)
+}
+
+// lex 词法分析
+func lex(expr string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		start := i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i, i + 1})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i, i + 1})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i, i + 1})
+			i++
+		case strings.HasPrefix(expr[i:], ".."):
+			tokens = append(tokens, token{tokRange, "..", i, i + 2})
+			i += 2
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				op += "="
+			}
+			if op == "=" || op == "!" {
+				return nil, fmt.Errorf("第%d个字符: 无效的运算符%q，应为==或!=", i+1, op)
+			}
+			i += len(op)
+			tokens = append(tokens, token{tokOp, op, start, i})
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("第%d个字符: 字符串没有结束引号", i+1)
+			}
+			i += end + 2
+			tokens = append(tokens, token{tokString, expr[start+1 : i-1], start, i})
+		case c >= '0' && c <= '9':
+			for i < len(expr) && (isDigit(expr[i]) || expr[i] == '.' && !strings.HasPrefix(expr[i:], "..")) {
+				i++
+			}
+			tokens = append(tokens, token{tokNumber, expr[start:i], start, i})
+		case isIdentChar(c):
+			for i < len(expr) && (isIdentChar(expr[i]) || isDigit(expr[i]) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{tokIdent, expr[start:i], start, i})
+		default:
+			return nil, fmt.Errorf("第%d个字符: 无法识别%q", i+1, c)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, text: "结尾", pos: len(expr), end: len(expr)}), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// keywords 关键字，不能作为字段名
+var keywords = []string{"and", "or", "not", "in", "true", "false"}
+
+// parser 递归下降语法分析，优先级 not > and > or
+type parser struct {
+	expr   string
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return fmt.Errorf("第%d个字符: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) parseOr() (node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	children := []node{first}
+	for p.peek().is("or") {
+		p.next()
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	first, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	children := []node{first}
+	for p.peek().is("and") {
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &andNode{children: children}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	t := p.peek()
+	switch {
+	case t.is("not"):
+		p.next()
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{child: child}, nil
+	case t.kind == tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.errorf(t, "缺少右括号，遇到%s", t.text)
+		}
+		return inner, nil
+	}
+	return p.parseCond()
+}
+
+// parseCond 解析单个条件并按字段类型校验运算符和字面量
+func (p *parser) parseCond() (node, error) {
+	name := p.next()
+	if name.kind != tokIdent || slices.ContainsFunc(keywords, name.is) {
+		return nil, p.errorf(name, "应为字段名，遇到%s", name.text)
+	}
+	f, ok := fields[strings.ToLower(name.text)]
+	if !ok {
+		return nil, p.errorf(name, "未知字段: %s", name.text)
+	}
+
+	c := &cond{field: f}
+	t := p.peek()
+	switch {
+	case t.kind == tokOp:
+		p.next()
+		c.op = t.text
+	case t.is("in"):
+		p.next()
+		c.op = "in"
+	case t.is("not") && p.tokens[p.i+1].is("in"):
+		p.next()
+		p.next()
+		c.op = "not in"
+	case f.kind == kindBool:
+		// 单独的布尔字段表示为true
+		c.op, c.b = "==", true
+		c.text = p.expr[name.pos:name.end]
+		return c, nil
+	default:
+		return nil, p.errorf(t, "%s后应为运算符，遇到%s", name.text, t.text)
+	}
+	if !slices.Contains(validOps[f.kind], c.op) {
+		return nil, p.errorf(t, "字段%s不支持运算符%s", f.name, c.op)
+	}
+
+	var err error
+	if c.op == "in" || c.op == "not in" {
+		err = p.parseList(c)
+	} else {
+		err = p.parseLiteral(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.op {
+	case "!=":
+		c.op, c.negate = "==", true
+	case "not in":
+		c.op, c.negate = "in", true
+	}
+	c.text = p.expr[name.pos:p.tokens[p.i-1].end]
+	return c, nil
+}
+
+// parseList 解析 (字面量, ...)
+func (p *parser) parseList(c *cond) error {
+	if t := p.next(); t.kind != tokLParen {
+		return p.errorf(t, "in后应为括号，遇到%s", t.text)
+	}
+	for {
+		if err := p.parseLiteral(c); err != nil {
+			return err
+		}
+		t := p.next()
+		if t.kind == tokRParen {
+			return nil
+		}
+		if t.kind != tokComma {
+			return p.errorf(t, "列表中应为逗号或右括号，遇到%s", t.text)
+		}
+	}
+}
+
+// parseLiteral 解析一个字面量并记入条件，整数字段在列表中可以写区间a..b
+func (p *parser) parseLiteral(c *cond) error {
+	t := p.next()
+	switch c.field.kind {
+	case kindString, kindList:
+		if t.kind != tokString && t.kind != tokNumber {
+			return p.errorf(t, "字段%s应为字符串，遇到%s", c.field.name, t.text)
+		}
+		if c.strs == nil {
+			c.strs = make(map[string]bool)
+		}
+		c.strs[lower(t.text)] = true
+	case kindBool:
+		switch {
+		case t.is("true"):
+			c.b = true
+		case t.is("false"):
+			c.b = false
+		default:
+			return p.errorf(t, "字段%s应为true或false，遇到%s", c.field.name, t.text)
+		}
+	case kindVersion:
+		if t.kind != tokString && t.kind != tokNumber {
+			return p.errorf(t, "字段%s应为版本号，遇到%s", c.field.name, t.text)
+		}
+		if c.ver = parseVersion(t.text); c.ver == nil {
+			return p.errorf(t, "版本号无效: %s", t.text)
+		}
+	case kindInt:
+		lo, err := p.integer(t, c.field)
+		if err != nil {
+			return err
+		}
+		hi := lo
+		if c.op == "in" || c.op == "not in" {
+			if p.peek().kind == tokRange {
+				p.next()
+				end := p.next()
+				if hi, err = p.integer(end, c.field); err != nil {
+					return err
+				}
+				if hi < lo {
+					return p.errorf(end, "区间无效: %d..%d", lo, hi)
+				}
+			}
+		}
+		c.n = lo
+		c.ranges = append(c.ranges, [2]int{lo, hi})
+	}
+	return nil
+}
+
+func (p *parser) integer(t token, f *field) (int, error) {
+	if t.kind != tokNumber {
+		return 0, p.errorf(t, "字段%s应为整数，遇到%s", f.name, t.text)
+	}
+	n, err := strconv.Atoi(t.text)
+	if err != nil {
+		return 0, p.errorf(t, "字段%s应为整数，遇到%s", f.name, t.text)
+	}
+	return n, nil
+}
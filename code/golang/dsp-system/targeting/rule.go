@@ -0,0 +1,249 @@
+package targeting
+
+import "strings"
+
+// Rule 编译后的定向规则，可以并发求值
+//
+// 语法：
+//
+//	expr := expr or expr | expr and expr | not expr | ( expr ) | 条件
+//	条件 := 字段 运算符 字面量 | 字段 [not] in (字面量, ...) | 布尔字段
+//
+// 例如 geo.country in ('CHN', 'HKG') and device.os == 'iOS' and device.osv >= 14 and not device.bot
+// 字段见Fields；字符串比较不区分大小写；请求中没有的字段不满足任何肯定条件（!=和not in为其否定）
+type Rule struct {
+	expr string
+	root node
+}
+
+// Compile 编译规则，表达式为空时返回nil（nil规则匹配所有请求）
+func Compile(expr string) (*Rule, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{expr: expr, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "多余的内容: %s", t.text)
+	}
+	return &Rule{expr: expr, root: root}, nil
+}
+
+// Match 判断请求是否满足规则
+func (r *Rule) Match(env *Env) bool {
+	if r == nil {
+		return true
+	}
+	return r.root.match(env)
+}
+
+// Explain 求值并给出每个条件的结果和请求中的实际取值
+func (r *Rule) Explain(env *Env) Explanation {
+	if r == nil {
+		return Explanation{Expr: "（无定向规则）", Matched: true}
+	}
+	return r.root.explain(env)
+}
+
+// String 规则原文
+func (r *Rule) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.expr
+}
+
+// Explanation 规则求值的解释，与表达式结构一致
+type Explanation struct {
+	Expr     string
+	Matched  bool
+	Actual   string // 条件中字段的实际取值，组合节点为空
+	Children []Explanation
+}
+
+// String 多行缩进形式，命中的条件标记✓，未命中的标记✗
+func (e Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (e Explanation) write(b *strings.Builder, depth int) {
+	mark := "✗"
+	if e.Matched {
+		mark = "✓"
+	}
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(mark + " " + e.Expr)
+	if e.Children == nil && e.Actual != "" {
+		b.WriteString("（实际: " + e.Actual + "）")
+	}
+	b.WriteByte('\n')
+	for _, child := range e.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// node 表达式节点
+type node interface {
+	match(env *Env) bool
+	explain(env *Env) Explanation
+}
+
+type andNode struct {
+	children []node
+}
+
+func (n *andNode) match(env *Env) bool {
+	for _, child := range n.children {
+		if !child.match(env) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n *andNode) explain(env *Env) Explanation {
+	e := Explanation{Expr: "and", Matched: true}
+	for _, child := range n.children {
+		c := child.explain(env)
+		e.Matched = e.Matched && c.Matched
+		e.Children = append(e.Children, c)
+	}
+	return e
+}
+
+type orNode struct {
+	children []node
+}
+
+func (n *orNode) match(env *Env) bool {
+	for _, child := range n.children {
+		if child.match(env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *orNode) explain(env *Env) Explanation {
+	e := Explanation{Expr: "or"}
+	for _, child := range n.children {
+		c := child.explain(env)
+		e.Matched = e.Matched || c.Matched
+		e.Children = append(e.Children, c)
+	}
+	return e
+}
+
+type notNode struct {
+	child node
+}
+
+func (n *notNode) match(env *Env) bool {
+	return !n.child.match(env)
+}
+
+func (n *notNode) explain(env *Env) Explanation {
+	c := n.child.explain(env)
+	return Explanation{Expr: "not", Matched: !c.Matched, Children: []Explanation{c}}
+}
+
+// cond 单个条件；!=和not in编译为==和in再取反
+type cond struct {
+	text   string
+	field  *field
+	op     string // ==, <, <=, >, >=, in
+	negate bool
+
+	strs   map[string]bool // 字符串和列表字段
+	ranges [][2]int        // 整数字段的==和in
+	n      int             // 整数字段的比较
+	ver    []int
+	b      bool
+}
+
+func (c *cond) match(env *Env) bool {
+	return c.eval(c.field.get(env)) != c.negate
+}
+
+func (c *cond) explain(env *Env) Explanation {
+	v := c.field.get(env)
+	return Explanation{Expr: c.text, Matched: c.eval(v) != c.negate, Actual: v.display(c.field.kind)}
+}
+
+// eval 求肯定形式的值，字段为空时为false
+func (c *cond) eval(v value) bool {
+	if !v.ok {
+		return false
+	}
+	switch c.field.kind {
+	case kindString:
+		return c.strs[v.s]
+	case kindList:
+		for _, item := range v.list {
+			if c.strs[item] {
+				return true
+			}
+		}
+		return false
+	case kindBool:
+		return v.b == c.b
+	case kindInt:
+		if c.op == "==" || c.op == "in" {
+			for _, r := range c.ranges {
+				if v.n >= r[0] && v.n <= r[1] {
+					return true
+				}
+			}
+			return false
+		}
+		return compare(c.op, cmpInt(v.n, c.n))
+	case kindVersion:
+		return compare(c.op, compareVersion(v.ver, c.ver))
+	}
+	return false
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare 按运算符解释比较结果
+func compare(op string, cmp int) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// validOps 各类型字段可用的运算符
+var validOps = map[kind][]string{
+	kindString:  {"==", "!=", "in", "not in"},
+	kindList:    {"==", "!=", "in", "not in"},
+	kindBool:    {"==", "!="},
+	kindInt:     {"==", "!=", "<", "<=", ">", ">=", "in", "not in"},
+	kindVersion: {"==", "!=", "<", "<=", ">", ">="},
+}
@@ -0,0 +1,150 @@
+package targeting_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+	"dsp-system/targeting"
+)
+
+func testEnv() *targeting.Env {
+	req := &api.BidRequest{
+		Device: &api.Device{
+			DeviceType:     4,
+			OS:             "iOS",
+			OSV:            "16.4.1",
+			Make:           "Apple",
+			Carrier:        "China Mobile",
+			ConnectionType: 6,
+			Language:       "zh",
+			Geo:            &api.Geo{Country: "CHN", Region: "BJ", City: "Beijing"},
+		},
+		App:  &api.App{ID: "app_1", Bundle: "com.example.news", Cat: []string{"IAB12", "IAB1-2"}},
+		User: &api.User{Geo: &api.Geo{Country: "USA"}},
+	}
+	// 2024-06-12是周三
+	now := time.Date(2024, 6, 12, 20, 30, 0, 0, time.UTC)
+	return targeting.NewEnv(req, []string{"S_Sport"}, []string{"运动爱好者"}, now)
+}
+
+func TestRuleMatch(t *testing.T) {
+	env := testEnv()
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"geo.country == 'chn'", true},
+		{"geo.country in ('USA', 'JPN')", false},
+		{"geo.country not in ('USA', 'JPN')", true},
+		{"geo.zip == '100000'", false},
+		{"geo.zip != '100000'", true},
+		{"device.type in (4, 5)", true},
+		{"device.type == 1", false},
+		{"device.connectiontype >= 4", true},
+		{"device.os == 'iOS' and device.osv >= 16.4", true},
+		{"device.osv >= '16.10'", false},
+		{"device.osv < 17", true},
+		{"device.osv == 16.4.1", true},
+		{"device.carrier == 'china mobile'", true},
+		{"device.language in ('zh', 'zh-cn')", true},
+		{"device.bot", false},
+		{"not device.bot", true},
+		{"device.bot == false", true},
+		{"app.bundle == 'com.example.news' or site.domain == 'news.com'", true},
+		{"site.id == 'x'", false},
+		{"cat in ('IAB1-2', 'IAB3')", true},
+		{"cat not in ('IAB25', 'IAB26')", true},
+		{"user.segment == 's_sport'", true},
+		{"user.tag in ('程序员')", false},
+		{"time.hour in (9..18)", false},
+		{"time.hour in (0..6, 19..23) and time.weekday in (1..5)", true},
+		{"(geo.country == 'USA' or geo.region == 'bj') and not (device.make == 'Samsung')", true},
+		{"NOT device.os == 'Android' AND geo.city == 'beijing'", true},
+	}
+	for _, tt := range tests {
+		rule, err := targeting.Compile(tt.expr)
+		if err != nil {
+			t.Errorf("%q: 编译失败: %v", tt.expr, err)
+			continue
+		}
+		if got := rule.Match(env); got != tt.want {
+			t.Errorf("%q: 期望%v，实际为%v", tt.expr, tt.want, got)
+		}
+		if got := rule.Explain(env).Matched; got != tt.want {
+			t.Errorf("%q: 解释的结果应与Match一致，实际为%v", tt.expr, got)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := map[string]string{
+		"geo.planet == 'earth'":          "未知字段",
+		"geo.country = 'CHN'":            "无效的运算符",
+		"geo.country > 'CHN'":            "不支持运算符",
+		"device.osv in (14, 15)":         "不支持运算符",
+		"device.type == 'phone'":         "应为整数",
+		"time.hour in (18..9)":           "区间无效",
+		"device.bot == yes":              "应为true或false",
+		"geo.country == 'CHN":            "没有结束引号",
+		"(geo.country == 'CHN'":          "缺少右括号",
+		"geo.country == 'CHN' geo.city":  "多余的内容",
+		"geo.country in 'CHN'":           "应为括号",
+		"geo.country and device.os":      "应为运算符",
+		"device.osv >= 'beta'":           "版本号无效",
+		"geo.country == 'CHN' and or":    "应为字段名",
+		"geo.country in ('CHN' 'USA')":   "逗号或右括号",
+		"device.type in (1, 2) and  #":   "无法识别",
+		"device.connectiontype < 2.5":    "应为整数",
+		"user.segment in ('a', 'b'":      "逗号或右括号",
+		"geo.region == 'BJ' or not":      "应为字段名",
+		"device.os == 'iOS' and (not )":  "应为字段名",
+		"time.weekday in (1..)":          "应为整数",
+		"site.domain == example.com":     "应为字符串",
+		"device.make not 'Apple'":        "应为运算符",
+		"device.os == 'iOS' and device.": "未知字段",
+	}
+	for expr, want := range tests {
+		if _, err := targeting.Compile(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: 期望错误包含%q，实际为%v", expr, want, err)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	rule, err := targeting.Compile("geo.country in ('CHN', 'HKG') and (device.osv >= 17 or device.type == 5) and not device.bot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := rule.Explain(testEnv())
+	want := `✗ and
+  ✓ geo.country in ('CHN', 'HKG')（实际: chn）
+  ✗ or
+    ✗ device.osv >= 17（实际: 16.4.1）
+    ✗ device.type == 5（实际: 4）
+  ✓ not
+    ✗ device.bot（实际: false）`
+	if got := e.String(); got != want {
+		t.Errorf("解释不正确:\n%s\n期望:\n%s", got, want)
+	}
+
+	// 请求中没有的字段
+	rule, _ = targeting.Compile("geo.zip in ('100000')")
+	if e := rule.Explain(testEnv()); e.Matched || e.Actual != "空" {
+		t.Errorf("缺失的字段应显示为空: %+v", e)
+	}
+}
+
+func BenchmarkRuleMatch(b *testing.B) {
+	rule, err := targeting.Compile("geo.country in ('CHN', 'HKG') and device.os == 'iOS' and device.osv >= 14 and not device.bot and user.segment not in ('s_churned')")
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := testEnv()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		rule.Match(env)
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "dsp-system/money"
+
 // 这个包用于存放共享类型，避免循环导入
 
 // BidRequestContext 竞价请求上下文（简化版）
@@ -15,7 +17,7 @@ type ImpContext struct {
 	ID       string
 	BannerW  int
 	BannerH  int
-	BidFloor float64
+	BidFloor money.Micros
 }
 
 // DeviceContext 设备上下文
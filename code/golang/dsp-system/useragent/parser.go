@@ -0,0 +1,305 @@
+// Package useragent 解析User-Agent，补全竞价请求中缺失的设备、操作系统和浏览器信息
+package useragent
+
+import (
+	"container/list"
+	"dsp-system/api"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Info UA解析结果
+type Info struct {
+	OS             string
+	OSVersion      string
+	Browser        string
+	BrowserVersion string
+	DeviceType     int // OpenRTB设备类型，未识别为0
+	Make           string
+	Model          string
+	Bot            bool
+}
+
+// snapshot 一版规则及其解析缓存，规则更新时整体替换，缓存不会返回旧规则的结果
+type snapshot struct {
+	rules *compiledRules
+	cache *lruCache
+}
+
+// Parser UA解析器
+// 规则来自内置规则或规则文件，文件变化后自动重新加载；解析结果有LRU缓存
+type Parser struct {
+	path      string
+	cacheSize int
+	current   atomic.Pointer[snapshot]
+
+	mu      sync.Mutex // 串行化重新加载
+	modTime time.Time
+	size    int64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewParser 创建解析器
+// path为空时使用内置规则；否则加载规则文件，reloadInterval大于0时按该间隔检查文件是否变化
+func NewParser(path string, cacheSize int, reloadInterval time.Duration) (*Parser, error) {
+	p := &Parser{
+		path:      path,
+		cacheSize: cacheSize,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if path == "" {
+		if err := p.setRules(DefaultRules()); err != nil {
+			return nil, err
+		}
+		close(p.done)
+		return p, nil
+	}
+
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	if reloadInterval > 0 {
+		go p.watch(reloadInterval)
+	} else {
+		close(p.done)
+	}
+	return p, nil
+}
+
+// setRules 编译规则并替换当前版本
+func (p *Parser) setRules(rules *Rules) error {
+	compiled, err := rules.compile()
+	if err != nil {
+		return err
+	}
+	p.current.Store(&snapshot{rules: compiled, cache: newLRUCache(p.cacheSize)})
+	return nil
+}
+
+// Reload 规则文件有变化时重新加载，返回是否加载了新规则；加载失败时继续使用旧规则
+func (p *Parser) Reload() (bool, error) {
+	if p.path == "" {
+		return false, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+	if p.current.Load() != nil && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return false, nil
+	}
+
+	rules, err := LoadRules(p.path)
+	if err == nil {
+		err = p.setRules(rules)
+	}
+	if err != nil {
+		return false, fmt.Errorf("加载UA规则失败: %w", err)
+	}
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+
+	log.Printf("UA规则已加载: %s", p.path)
+	return true, nil
+}
+
+// watch 定期检查规则文件
+func (p *Parser) watch(interval time.Duration) {
+	defer close(p.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := p.Reload(); err != nil {
+			log.Printf("重新加载UA规则失败（继续使用旧规则）: %v", err)
+		}
+	}
+}
+
+// Close 停止检查规则文件
+func (p *Parser) Close() {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+}
+
+// Parse 解析UA
+func (p *Parser) Parse(ua string) Info {
+	if ua == "" {
+		return Info{}
+	}
+	snap := p.current.Load()
+	if info, ok := snap.cache.get(ua); ok {
+		return info
+	}
+	info := snap.rules.parse(ua)
+	snap.cache.add(ua, info)
+	return info
+}
+
+// parse 按规则解析UA
+func (c *compiledRules) parse(ua string) Info {
+	var info Info
+	for _, bot := range c.bots {
+		if bot.MatchString(ua) {
+			info.Bot = true
+			break
+		}
+	}
+	for _, r := range c.os {
+		if m := r.re.FindStringSubmatchIndex(ua); m != nil {
+			info.OS = r.rule.Name
+			info.OSVersion = version(r.re, ua, r.rule.Version, m)
+			break
+		}
+	}
+	for _, r := range c.browsers {
+		if m := r.re.FindStringSubmatchIndex(ua); m != nil {
+			info.Browser = r.rule.Name
+			info.BrowserVersion = version(r.re, ua, r.rule.Version, m)
+			break
+		}
+	}
+	for _, d := range c.devices {
+		if m := d.re.FindStringSubmatchIndex(ua); m != nil {
+			info.DeviceType = d.deviceType
+			info.Make = d.rule.Make
+			if d.rule.Model != "" {
+				info.Model = model(string(d.re.ExpandString(nil, d.rule.Model, ua, m)))
+			}
+			break
+		}
+	}
+	return info
+}
+
+// version 展开版本模板，iOS/macOS的下划线分隔统一为点
+func version(re *regexp.Regexp, ua, template string, match []int) string {
+	if template == "" {
+		return ""
+	}
+	return strings.ReplaceAll(string(re.ExpandString(nil, template, ua, match)), "_", ".")
+}
+
+// model 清理型号：去掉Android UA中的" Build/..."后缀
+func model(s string) string {
+	if i := strings.Index(s, " Build"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
+
+// Enrich 根据UA补全请求中缺失的设备信息
+// 请求自带的字段不覆盖；系统版本只在系统名称一致时补全。浏览器和爬虫标记不属于OpenRTB字段，总是写入
+func (p *Parser) Enrich(req *api.BidRequest) {
+	if p == nil || req.Device == nil || req.Device.UA == "" {
+		return
+	}
+	device := req.Device
+	info := p.Parse(device.UA)
+
+	if device.OS == "" {
+		device.OS = info.OS
+	}
+	if device.OSV == "" && strings.EqualFold(device.OS, info.OS) {
+		device.OSV = info.OSVersion
+	}
+	if device.DeviceType == 0 {
+		device.DeviceType = info.DeviceType
+	}
+	if device.Make == "" {
+		device.Make = info.Make
+	}
+	if device.Model == "" {
+		device.Model = info.Model
+	}
+	device.Browser = info.Browser
+	device.BrowserVersion = info.BrowserVersion
+	device.Bot = info.Bot
+}
+
+// lruCache 并发安全的LRU缓存，容量不大于0时不缓存
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List // 最近使用的在前
+}
+
+// lruEntry 缓存项
+type lruEntry struct {
+	key  string
+	info Info
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *lruCache) get(key string) (Info, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return Info{}, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).info, true
+}
+
+func (c *lruCache) add(key string, info Info) {
+	if c.capacity <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).info = info
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, info: info})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// len 缓存项数量
+func (c *lruCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,156 @@
+package useragent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dsp-system/api"
+)
+
+func TestParseDefaultRules(t *testing.T) {
+	p, err := NewParser("", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	tests := []struct {
+		ua   string
+		want Info
+	}{
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			want: Info{OS: "iOS", OSVersion: "17.2.1", Browser: "Safari", BrowserVersion: "17.2", DeviceType: DeviceTypePhone, Make: "Apple", Model: "iPhone"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 14; SM-S9180 Build/UP1A.231005.007) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			want: Info{OS: "Android", OSVersion: "14", Browser: "Samsung Internet", BrowserVersion: "24.0", DeviceType: DeviceTypePhone, Make: "Samsung", Model: "SM-S9180"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X710) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.43 Safari/537.36",
+			want: Info{OS: "Android", OSVersion: "13", Browser: "Chrome", BrowserVersion: "120.0.6099.43", DeviceType: DeviceTypeTablet, Make: "Samsung", Model: "SM-X710"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			want: Info{OS: "Windows", OSVersion: "10.0", Browser: "Chrome", BrowserVersion: "120.0.0.0", DeviceType: DeviceTypePC},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61",
+			want: Info{OS: "Windows", OSVersion: "10.0", Browser: "Edge", BrowserVersion: "120.0.2210.61", DeviceType: DeviceTypePC},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 12; V2196A; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/86.0.4240.99 XWEB/4317 MMWEBSDK/20220903 Mobile Safari/537.36 MicroMessenger/8.0.28.2240(0x28001C35) WeChat/arm64",
+			want: Info{OS: "Android", OSVersion: "12", Browser: "WeChat", BrowserVersion: "8.0.28.2240", DeviceType: DeviceTypePhone, Make: "vivo", Model: "V2196A"},
+		},
+		{
+			ua:   "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: Info{Bot: true},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36",
+			want: Info{OS: "Linux", Browser: "Chrome", BrowserVersion: "120.0.0.0", DeviceType: DeviceTypePC, Bot: true},
+		},
+	}
+	for _, tt := range tests {
+		if got := p.Parse(tt.ua); got != tt.want {
+			t.Errorf("%s\n期望%+v\n实际为%+v", tt.ua, tt.want, got)
+		}
+	}
+}
+
+func TestParserCache(t *testing.T) {
+	p, err := NewParser("", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 5; i++ {
+		p.Parse(fmt.Sprintf("Mozilla/5.0 (Windows NT 10.%d)", i))
+	}
+	cache := p.current.Load().cache
+	if n := cache.len(); n != 2 {
+		t.Errorf("缓存条数应不超过容量2，实际为%d", n)
+	}
+	if _, ok := cache.get("Mozilla/5.0 (Windows NT 10.0)"); ok {
+		t.Error("最早的条目应被淘汰")
+	}
+	if info, ok := cache.get("Mozilla/5.0 (Windows NT 10.4)"); !ok || info.OSVersion != "10.4" {
+		t.Errorf("最近的条目应在缓存中: %+v, %v", info, ok)
+	}
+}
+
+func TestEnrichKeepsRequestFields(t *testing.T) {
+	p, err := NewParser("", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ua := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1"
+	req := &api.BidRequest{Device: &api.Device{UA: ua, OS: "iOS", Model: "iPhone15,2", DeviceType: DeviceTypeMobile}}
+	p.Enrich(req)
+
+	d := req.Device
+	if d.OS != "iOS" || d.OSV != "17.2" || d.Model != "iPhone15,2" || d.DeviceType != DeviceTypeMobile || d.Make != "Apple" {
+		t.Errorf("应只补全缺失字段: %+v", d)
+	}
+	if d.Browser != "Chrome" || d.BrowserVersion != "120.0.6099.119" || d.Bot {
+		t.Errorf("浏览器字段不正确: %+v", d)
+	}
+
+	// 请求自带的系统与UA不一致时不补全版本
+	req = &api.BidRequest{Device: &api.Device{UA: ua, OS: "Android"}}
+	p.Enrich(req)
+	if req.Device.OSV != "" {
+		t.Errorf("系统不一致时不应补全版本: %+v", req.Device)
+	}
+}
+
+func TestParserReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ua.json")
+	write := func(content string, mod time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mod, mod)
+	}
+	write(`{"os":[{"pattern":"FooOS/(\\d+)","name":"FooOS","version":"$1"}],"devices":[{"pattern":"FooOS","type":"tv","make":"Foo"}]}`, time.Now())
+
+	p, err := NewParser(path, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if info := p.Parse("FooOS/3"); info.OS != "FooOS" || info.OSVersion != "3" || info.DeviceType != DeviceTypeTV || info.Make != "Foo" {
+		t.Errorf("应使用规则文件: %+v", info)
+	}
+
+	// 规则更新后缓存随之失效
+	write(`{"os":[{"pattern":"FooOS/(\\d+)","name":"BarOS","version":"$1"}],"bots":["FooOS"]}`, time.Now().Add(time.Second))
+	if reloaded, err := p.Reload(); err != nil || !reloaded {
+		t.Fatalf("文件变化后应重新加载: %v, %v", reloaded, err)
+	}
+	if info := p.Parse("FooOS/3"); info.OS != "BarOS" || !info.Bot || info.DeviceType != 0 {
+		t.Errorf("重新加载后应使用新规则: %+v", info)
+	}
+
+	// 新规则无效时继续使用旧规则
+	write(`{"os":[{"pattern":"(","name":"Broken"}]}`, time.Now().Add(2*time.Second))
+	if _, err := p.Reload(); err == nil {
+		t.Error("无效的规则应返回错误")
+	}
+	if info := p.Parse("FooOS/3"); info.OS != "BarOS" {
+		t.Errorf("加载失败时应保留旧规则: %+v", info)
+	}
+
+	write(`{"devices":[{"pattern":"x","type":"fridge"}]}`, time.Now().Add(3*time.Second))
+	if _, err := p.Reload(); err == nil {
+		t.Error("未知的设备类型应返回错误")
+	}
+}
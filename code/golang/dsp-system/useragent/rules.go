@@ -0,0 +1,191 @@
+package useragent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// OpenRTB设备类型
+const (
+	DeviceTypeMobile    = 1 // 手机或平板
+	DeviceTypePC        = 2
+	DeviceTypeTV        = 3
+	DeviceTypePhone     = 4
+	DeviceTypeTablet    = 5
+	DeviceTypeConnected = 6
+	DeviceTypeSetTopBox = 7
+)
+
+// deviceTypes 规则文件中的设备类型名称
+var deviceTypes = map[string]int{
+	"mobile":    DeviceTypeMobile,
+	"desktop":   DeviceTypePC,
+	"tv":        DeviceTypeTV,
+	"phone":     DeviceTypePhone,
+	"tablet":    DeviceTypeTablet,
+	"connected": DeviceTypeConnected,
+	"settopbox": DeviceTypeSetTopBox,
+}
+
+// Rule 操作系统或浏览器规则，Version可以引用正则分组（如"$1"）
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// DeviceRule 设备规则，Model可以引用正则分组
+type DeviceRule struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"` // mobile, desktop, tv, phone, tablet, connected, settopbox
+	Make    string `json:"make,omitempty"`
+	Model   string `json:"model,omitempty"`
+}
+
+// Rules UA解析规则，每一类按顺序匹配，取第一条命中的规则；正则不区分大小写
+type Rules struct {
+	OS       []Rule       `json:"os"`
+	Browsers []Rule       `json:"browsers"`
+	Devices  []DeviceRule `json:"devices"`
+	Bots     []string     `json:"bots"` // 命中任一即为爬虫或自动化工具
+}
+
+// LoadRules 从JSON文件加载规则
+func LoadRules(path string) (*Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("解析UA规则文件失败: %w", err)
+	}
+	return &rules, nil
+}
+
+// DefaultRules 内置规则，覆盖主流操作系统、浏览器和设备
+// 更具体的规则排在前面（如鸿蒙在Android之前、Edge在Chrome之前、Chrome在Safari之前）
+func DefaultRules() *Rules {
+	return &Rules{
+		OS: []Rule{
+			{Pattern: `OpenHarmony ([\d.]+)`, Name: "HarmonyOS", Version: "$1"},
+			{Pattern: `HarmonyOS(?:[ /]([\d.]+))?`, Name: "HarmonyOS", Version: "$1"},
+			{Pattern: `(?:iPhone|CPU) OS (\d+(?:[_.]\d+)*)`, Name: "iOS", Version: "$1"},
+			{Pattern: `Android[ /]?([\d.]+)?`, Name: "Android", Version: "$1"},
+			{Pattern: `Windows NT ([\d.]+)`, Name: "Windows", Version: "$1"},
+			{Pattern: `CrOS \S+ ([\d.]+)`, Name: "ChromeOS", Version: "$1"},
+			{Pattern: `Mac OS X (\d+(?:[_.]\d+)*)`, Name: "macOS", Version: "$1"},
+			{Pattern: `Tizen ?([\d.]+)?`, Name: "Tizen", Version: "$1"},
+			{Pattern: `Web0S|webOS`, Name: "webOS"},
+			{Pattern: `Roku`, Name: "Roku"},
+			{Pattern: `Linux`, Name: "Linux"},
+		},
+		Browsers: []Rule{
+			{Pattern: `MicroMessenger/([\d.]+)`, Name: "WeChat", Version: "$1"},
+			{Pattern: `Edg(?:e|A|iOS)?/([\d.]+)`, Name: "Edge", Version: "$1"},
+			{Pattern: `OPR/([\d.]+)`, Name: "Opera", Version: "$1"},
+			{Pattern: `SamsungBrowser/([\d.]+)`, Name: "Samsung Internet", Version: "$1"},
+			{Pattern: `UCBrowser/([\d.]+)`, Name: "UC Browser", Version: "$1"},
+			{Pattern: `(?:Firefox|FxiOS)/([\d.]+)`, Name: "Firefox", Version: "$1"},
+			{Pattern: `; wv\).*Chrome/([\d.]+)`, Name: "Chrome WebView", Version: "$1"},
+			{Pattern: `(?:Chrome|CriOS)/([\d.]+)`, Name: "Chrome", Version: "$1"},
+			{Pattern: `Version/([\d.]+).*Safari/`, Name: "Safari", Version: "$1"},
+			{Pattern: `Trident/.*rv:([\d.]+)`, Name: "Internet Explorer", Version: "$1"},
+			{Pattern: `MSIE ([\d.]+)`, Name: "Internet Explorer", Version: "$1"},
+		},
+		Devices: []DeviceRule{
+			{Pattern: `iPad`, Type: "tablet", Make: "Apple", Model: "iPad"},
+			{Pattern: `iPhone`, Type: "phone", Make: "Apple", Model: "iPhone"},
+			{Pattern: `iPod`, Type: "mobile", Make: "Apple", Model: "iPod"},
+			{Pattern: `AppleTV|Apple TV`, Type: "settopbox", Make: "Apple", Model: "Apple TV"},
+			{Pattern: `Roku`, Type: "settopbox", Make: "Roku"},
+			{Pattern: `CrKey`, Type: "settopbox", Make: "Google", Model: "Chromecast"},
+			{Pattern: `SMART-TV|SmartTV|Web0S|Tizen.*TV|BRAVIA|HbbTV`, Type: "tv"},
+			{Pattern: `Android.*; (SM-[TXP]\w+)`, Type: "tablet", Make: "Samsung", Model: "$1"},
+			{Pattern: `Android.*; ((?:SM|GT)-\w+)`, Type: "phone", Make: "Samsung", Model: "$1"},
+			{Pattern: `Android.*; (Pixel[^;)]*)`, Type: "phone", Make: "Google", Model: "$1"},
+			{Pattern: `Android.*; (?:HUAWEI|HONOR) ?([^;)]+)`, Type: "phone", Make: "Huawei", Model: "$1"},
+			{Pattern: `Android.*; ((?:MI|Redmi|POCO) [^;)]+)`, Type: "phone", Make: "Xiaomi", Model: "$1"},
+			{Pattern: `Android.*; (OPPO [^;)]+|CPH\d+)`, Type: "phone", Make: "OPPO", Model: "$1"},
+			{Pattern: `Android.*; (vivo [^;)]+|V\d{4}[A-Z]*)`, Type: "phone", Make: "vivo", Model: "$1"},
+			{Pattern: `Android.*Mobile`, Type: "phone"},
+			{Pattern: `Android`, Type: "tablet"},
+			{Pattern: `Mobile|Windows Phone`, Type: "phone"},
+			{Pattern: `Windows NT|Macintosh|X11|CrOS`, Type: "desktop"},
+		},
+		Bots: []string{
+			`bot\b|crawl|spider|slurp`,
+			`HeadlessChrome|PhantomJS|Puppeteer|Playwright|Selenium`,
+			`facebookexternalhit|Lighthouse|Google-Read-Aloud|Mediapartners-Google`,
+			`^(?:curl|Wget|python-requests|Go-http-client|Java|Apache-HttpClient|libwww-perl)/`,
+		},
+	}
+}
+
+// compiledRule 编译后的操作系统或浏览器规则
+type compiledRule struct {
+	re   *regexp.Regexp
+	rule Rule
+}
+
+// compiledDevice 编译后的设备规则
+type compiledDevice struct {
+	re         *regexp.Regexp
+	rule       DeviceRule
+	deviceType int
+}
+
+// compiledRules 编译后的规则
+type compiledRules struct {
+	os       []compiledRule
+	browsers []compiledRule
+	devices  []compiledDevice
+	bots     []*regexp.Regexp
+}
+
+// compile 编译规则，任一正则或设备类型无效时返回错误
+func (r *Rules) compile() (*compiledRules, error) {
+	c := &compiledRules{}
+	compileRules := func(kind string, rules []Rule) ([]compiledRule, error) {
+		compiled := make([]compiledRule, 0, len(rules))
+		for _, rule := range rules {
+			re, err := regexp.Compile("(?i)" + rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%s规则无效: %s: %w", kind, rule.Pattern, err)
+			}
+			compiled = append(compiled, compiledRule{re: re, rule: rule})
+		}
+		return compiled, nil
+	}
+
+	var err error
+	if c.os, err = compileRules("操作系统", r.OS); err != nil {
+		return nil, err
+	}
+	if c.browsers, err = compileRules("浏览器", r.Browsers); err != nil {
+		return nil, err
+	}
+	for _, rule := range r.Devices {
+		re, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("设备规则无效: %s: %w", rule.Pattern, err)
+		}
+		deviceType, ok := deviceTypes[strings.ToLower(rule.Type)]
+		if !ok {
+			return nil, fmt.Errorf("设备类型无效: %s", rule.Type)
+		}
+		c.devices = append(c.devices, compiledDevice{re: re, rule: rule, deviceType: deviceType})
+	}
+	for _, pattern := range r.Bots {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("爬虫规则无效: %s: %w", pattern, err)
+		}
+		c.bots = append(c.bots, re)
+	}
+	return c, nil
+}